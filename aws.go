@@ -0,0 +1,206 @@
+package tokenauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/envy"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// AWSConfig is the region and credentials the AWS APIs are called with,
+// the fields default to the standard AWS env variables
+type AWSConfig struct {
+	// Region defaults to AWS_REGION or AWS_DEFAULT_REGION
+	Region string
+	// AccessKeyID defaults to AWS_ACCESS_KEY_ID
+	AccessKeyID string
+	// SecretAccessKey defaults to AWS_SECRET_ACCESS_KEY
+	SecretAccessKey string
+	// SessionToken of temporary credentials, defaults to AWS_SESSION_TOKEN
+	SessionToken string
+	// Endpoint overrides the endpoint of the service, e.g. for VPC endpoints
+	Endpoint string
+	// Client used to call the API, defaults to a client with a 10s timeout
+	Client *http.Client
+}
+
+// withDefaults fills the unset fields from the env
+func (cfg AWSConfig) withDefaults() AWSConfig {
+	if cfg.Region == "" {
+		cfg.Region = envy.Get("AWS_REGION", envy.Get("AWS_DEFAULT_REGION", ""))
+	}
+	if cfg.AccessKeyID == "" && cfg.SecretAccessKey == "" {
+		cfg.AccessKeyID = envy.Get("AWS_ACCESS_KEY_ID", "")
+		cfg.SecretAccessKey = envy.Get("AWS_SECRET_ACCESS_KEY", "")
+		cfg.SessionToken = envy.Get("AWS_SESSION_TOKEN", "")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return cfg
+}
+
+// call calls the action of an AWS JSON API, e.g. secretsmanager.GetSecretValue
+func (cfg AWSConfig) call(ctx context.Context, service, target string, in, out interface{}) error {
+	cfg = cfg.withDefaults()
+	if cfg.Region == "" || cfg.AccessKeyID == "" {
+		return errors.New("AWS region and credentials required, set AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://" + service + "." + cfg.Region + ".amazonaws.com"
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s endpoint", service)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signV4(req, body, cfg, service, time.Now())
+	res, err := cfg.Client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't call %s", target)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't call %s", target)
+	}
+	if res.StatusCode != http.StatusOK {
+		var awsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &awsErr)
+		return errors.Errorf("%s failed: %s %s %s", target, res.Status, awsErr.Type, awsErr.Message)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// signV4 signs the request with AWS Signature Version 4
+func signV4(req *http.Request, body []byte, cfg AWSConfig, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + cfg.Region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := []byte("AWS4" + cfg.SecretAccessKey)
+	for _, part := range []string{date, cfg.Region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cfg.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// SecretsManagerKey returns a GetKey loading the key from the current version of
+// the AWS Secrets Manager secret, its name or ARN. The secret of HMAC methods is
+// the secret string or binary itself, public keys are PEM, DER or JWK encoded.
+// The key is cached by the middleware, to pick up rotated secrets set the
+// KeyRefreshInterval of the options.
+//
+//	GetKey:             tokenauth.SecretsManagerKey(tokenauth.AWSConfig{}, "prod/api/jwt-secret"),
+//	KeyRefreshInterval: time.Hour,
+func SecretsManagerKey(cfg AWSConfig, secretID string) func(jwt.SigningMethod) (interface{}, error) {
+	return func(method jwt.SigningMethod) (interface{}, error) {
+		var out struct {
+			SecretString string
+			SecretBinary []byte
+		}
+		in := map[string]string{"SecretId": secretID}
+		if err := cfg.call(context.Background(), "secretsmanager", "secretsmanager.GetSecretValue", in, &out); err != nil {
+			return nil, err
+		}
+		data := out.SecretBinary
+		if out.SecretString != "" {
+			data = []byte(out.SecretString)
+		}
+		return parseKey(method, data)
+	}
+}
+
+// ParameterStoreKey returns a GetKey loading the key from the AWS Systems Manager
+// Parameter Store parameter, SecureString parameters are decrypted. The key is
+// parsed and refreshed like the one of SecretsManagerKey, a HMAC secret can be
+// stored base64 encoded with a "base64:" prefix.
+func ParameterStoreKey(cfg AWSConfig, name string) func(jwt.SigningMethod) (interface{}, error) {
+	return func(method jwt.SigningMethod) (interface{}, error) {
+		var out struct {
+			Parameter struct {
+				Value string
+			}
+		}
+		in := map[string]interface{}{"Name": name, "WithDecryption": true}
+		if err := cfg.call(context.Background(), "ssm", "AmazonSSM.GetParameter", in, &out); err != nil {
+			return nil, err
+		}
+		value := out.Parameter.Value
+		if strings.HasPrefix(value, "base64:") {
+			data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, "base64:"))
+			if err != nil {
+				return nil, errors.Wrapf(err, "parameter %s is not valid base64", name)
+			}
+			return parseKey(method, data)
+		}
+		return parseKey(method, []byte(value))
+	}
+}
@@ -0,0 +1,91 @@
+package tokenauth_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// awsServer answers the AWS JSON API calls by X-Amz-Target
+func awsServer(t *testing.T, responses map[string]interface{}) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/") {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "UnrecognizedClientException", "message": "invalid signature"})
+			return
+		}
+		res, ok := responses[r.Header.Get("X-Amz-Target")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "ResourceNotFoundException", "message": "not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+}
+
+func TestSecretsManagerKey(t *testing.T) {
+	r := require.New(t)
+	ts := awsServer(t, map[string]interface{}{
+		"secretsmanager.GetSecretValue": map[string]string{"SecretString": "aws-secret"},
+	})
+	defer ts.Close()
+	cfg := tokenauth.AWSConfig{
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		Endpoint:        ts.URL,
+		Client:          ts.Client(),
+	}
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{GetKey: tokenauth.SecretsManagerKey(cfg, "prod/jwt")}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := bhttptest.New(a)
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}, "aws-secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	cfg.Region = "us-east-1"
+	_, err := tokenauth.SecretsManagerKey(cfg, "prod/jwt")(jwt.SigningMethodHS256)
+	r.Error(err)
+	r.Contains(err.Error(), "UnrecognizedClientException")
+}
+
+func TestParameterStoreKey(t *testing.T) {
+	r := require.New(t)
+	pub, err := ioutil.ReadFile("test_certs/sample_key.pub")
+	r.NoError(err)
+	ts := awsServer(t, map[string]interface{}{
+		"AmazonSSM.GetParameter": map[string]interface{}{"Parameter": map[string]string{"Value": string(pub)}},
+	})
+	defer ts.Close()
+	cfg := tokenauth.AWSConfig{
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		Endpoint:        ts.URL,
+		Client:          ts.Client(),
+	}
+
+	key, err := tokenauth.ParameterStoreKey(cfg, "/prod/jwt-public-key")(jwt.SigningMethodRS256)
+	r.NoError(err)
+	r.Equal(&rsaTestKey(t).PublicKey, key)
+
+	_, err = tokenauth.SecretsManagerKey(cfg, "prod/jwt")(jwt.SigningMethodRS256)
+	r.Error(err)
+	r.Contains(err.Error(), "ResourceNotFoundException")
+}
@@ -0,0 +1,25 @@
+package tokenauth
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/presets"
+)
+
+// ErrInvalidClient is returned if the token was issued to a client app which is not accepted
+var ErrInvalidClient = presets.ErrInvalidClient
+
+// AzureADPolicy returns the Policy of the access tokens the Microsoft identity
+// platform (Entra ID) tenant issues for the API with the application clientID,
+// optionally only those of the client apps, see presets.AzureAD
+func AzureADPolicy(tenantID, clientID string, clients ...string) Policy {
+	return presetPolicy(presets.AzureAD(tenantID, clientID, clients...))
+}
+
+// AzureAD returns the middleware validating the access tokens the Entra ID
+// tenant issues for the API with the application clientID, optionally only
+// those of the client apps
+//
+//	app.Use(tokenauth.AzureAD("00000000-0000-0000-0000-000000000000", "11111111-1111-1111-1111-111111111111"))
+func AzureAD(tenantID, clientID string, clients ...string) buffalo.MiddlewareFunc {
+	return AzureADPolicy(tenantID, clientID, clients...).Middleware(Options{})
+}
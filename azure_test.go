@@ -0,0 +1,59 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAzureADPolicy(t *testing.T) {
+	r := require.New(t)
+	const tenant, api, client = "tenant-1", "api-1", "client-1"
+	p := tokenauth.AzureADPolicy(tenant, api, client)
+	r.Equal("https://login.microsoftonline.com/tenant-1/discovery/v2.0/keys", p.JWKSURI)
+
+	key := rsaTestKey(t)
+	ts, _ := jwksServer(rsaJWK("key-1", &key.PublicKey))
+	defer ts.Close()
+	jwks := tokenauth.NewJWKSProvider(ts.URL)
+	jwks.Client = ts.Client()
+	defer jwks.Close()
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(p.Middleware(tokenauth.Options{JWKS: jwks}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := bhttptest.New(a)
+	v1 := "https://sts.windows.net/tenant-1/"
+	v2 := "https://login.microsoftonline.com/tenant-1/v2.0"
+
+	tcases := []struct {
+		name   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"v1", jwt.MapClaims{"iss": v1, "aud": "api://api-1", "appid": client}, http.StatusOK},
+		{"v2", jwt.MapClaims{"iss": v2, "aud": api, "azp": client}, http.StatusOK},
+		{"other tenant", jwt.MapClaims{"iss": "https://login.microsoftonline.com/tenant-2/v2.0", "tid": "tenant-2", "aud": api, "azp": client}, http.StatusUnauthorized},
+		{"tid of other tenant", jwt.MapClaims{"iss": v2, "tid": "tenant-2", "aud": api, "azp": client}, http.StatusUnauthorized},
+		{"other api", jwt.MapClaims{"iss": v2, "aud": "api-2", "azp": client}, http.StatusUnauthorized},
+		{"other client", jwt.MapClaims{"iss": v2, "aud": api, "azp": "client-2"}, http.StatusUnauthorized},
+		{"v1 client in azp", jwt.MapClaims{"iss": v1, "aud": api, "azp": client}, http.StatusUnauthorized},
+	}
+	for _, tc := range tcases {
+		claims := jwt.MapClaims{"tid": tenant, "exp": time.Now().Add(time.Minute * 5).Unix()}
+		for k, v := range tc.claims {
+			claims[k] = v
+		}
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signRS256(t, "key-1", key, claims)
+		r.Equal(tc.status, req.Get().Code, tc.name)
+	}
+}
@@ -0,0 +1,66 @@
+package tokenauth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// BaggageKey is the context key of the W3C baggage serialization of the
+// BaggageClaims, e.g. "tenant=eu-1,plan=pro", for the baggage header of
+// requests to downstream services
+const BaggageKey = "tokenauth_baggage"
+
+// BaggageFunc adds the claim members to the baggage of the request context,
+// e.g. with OpenTelemetry
+//
+//	func(ctx context.Context, members map[string]string) context.Context {
+//		bag := baggage.FromContext(ctx)
+//		for k, v := range members {
+//			m, _ := baggage.NewMember(k, url.QueryEscape(v))
+//			bag, _ = bag.SetMember(m)
+//		}
+//		return baggage.ContextWithBaggage(ctx, bag)
+//	}
+type BaggageFunc func(ctx context.Context, members map[string]string) context.Context
+
+// setBaggage propagates the BaggageClaims of the token as trace baggage,
+// only low cardinality claims like tenant or plan should be propagated
+func setBaggage(c buffalo.Context, options Options, claims jwt.Claims) {
+	if len(options.BaggageClaims) == 0 {
+		return
+	}
+	mc, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return
+	}
+	members := map[string]string{}
+	for _, name := range options.BaggageClaims {
+		if v, ok := mc[name]; ok {
+			members[name] = fmt.Sprint(v)
+		}
+	}
+	if len(members) == 0 {
+		return
+	}
+	c.Set(BaggageKey, serializeBaggage(members))
+	if options.Baggage != nil {
+		req := c.Request()
+		*req = *req.WithContext(options.Baggage(req.Context(), members))
+	}
+}
+
+// serializeBaggage encodes the members in the W3C baggage header format
+func serializeBaggage(members map[string]string) string {
+	list := make([]string, 0, len(members))
+	for k, v := range members {
+		list = append(list, k+"="+strings.Replace(url.QueryEscape(v), "+", "%20", -1))
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,46 @@
+package tokenauth_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type baggageKey struct{}
+
+func TestBaggage(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		BaggageClaims: []string{"tenant", "plan", "missing"},
+		Baggage: func(ctx context.Context, members map[string]string) context.Context {
+			return context.WithValue(ctx, baggageKey{}, members)
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		members := c.Request().Context().Value(baggageKey{}).(map[string]string)
+		return c.Render(200, render.String(c.Value(tokenauth.BaggageKey).(string)+"|"+members["tenant"]))
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{
+		"sub":    "1",
+		"tenant": "eu-1",
+		"plan":   "pro plus",
+		"exp":    time.Now().Add(time.Minute * 5).Unix(),
+	})
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("plan=pro%20plus,tenant=eu-1|eu-1", res.Body.String())
+}
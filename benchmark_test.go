@@ -0,0 +1,102 @@
+package tokenauth_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	nhttptest "net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivateKeyVerification(t *testing.T) {
+	r := require.New(t)
+	key := rsaTestKey(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		SignMethod: jwt.SigningMethodRS256,
+		// the public key is derived when the keys are registered
+		Keys: map[string]interface{}{"key-1": key},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	res := serveToken(a, signRS256(t, "key-1", key, jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}))
+	r.Equal(http.StatusOK, res.Code)
+}
+
+// serveToken serves a request with the token
+func serveToken(a *buffalo.App, token string) *nhttptest.ResponseRecorder {
+	req := nhttptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res := nhttptest.NewRecorder()
+	a.ServeHTTP(res, req)
+	return res
+}
+
+// benchmarkVerification serves requests with the token verified with the key of keyFunc
+func benchmarkVerification(b *testing.B, method jwt.SigningMethod, keyFunc jwt.Keyfunc, token string) {
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{SignMethod: method, KeyFunc: keyFunc}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	if res := serveToken(a, token); res.Code != http.StatusOK {
+		b.Fatalf("token rejected with %d", res.Code)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			serveToken(a, token)
+		}
+	})
+}
+
+// parseKeyFile parses the PEM key file on every call, like a
+// KeyFunc loading the key per request
+func parseKeyFile(file string, parse func([]byte) (interface{}, error)) jwt.Keyfunc {
+	return func(*jwt.Token) (interface{}, error) {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return parse(data)
+	}
+}
+
+func BenchmarkRS256(b *testing.B) {
+	key := rsaTestKey(b)
+	token := signRS256(b, "", key, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+	parse := func(data []byte) (interface{}, error) {
+		return jwt.ParseRSAPublicKeyFromPEM(data)
+	}
+	b.Run("loaded", func(b *testing.B) {
+		benchmarkVerification(b, jwt.SigningMethodRS256, tokenauth.StaticKey(key), token)
+	})
+	b.Run("per request", func(b *testing.B) {
+		benchmarkVerification(b, jwt.SigningMethodRS256, parseKeyFile("test_certs/sample_key.pub", parse), token)
+	})
+}
+
+func BenchmarkES256(b *testing.B) {
+	data, err := ioutil.ReadFile("test_certs/ec256-private.pem")
+	require.NoError(b, err)
+	key, err := jwt.ParseECPrivateKeyFromPEM(data)
+	require.NoError(b, err)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}).SignedString(key)
+	require.NoError(b, err)
+	parse := func(data []byte) (interface{}, error) {
+		return jwt.ParseECPublicKeyFromPEM(data)
+	}
+	b.Run("loaded", func(b *testing.B) {
+		benchmarkVerification(b, jwt.SigningMethodES256, tokenauth.StaticKey(key), token)
+	})
+	b.Run("per request", func(b *testing.B) {
+		benchmarkVerification(b, jwt.SigningMethodES256, parseKeyFile("test_certs/ec256-public.pem", parse), token)
+	})
+}
@@ -0,0 +1,123 @@
+package tokenauth
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// brancaVersion is the first byte of Branca tokens
+const brancaVersion = 0xBA
+
+// brancaAlphabet is the base62 alphabet of Branca tokens
+const brancaAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Branca verifies Branca tokens instead of JWTs, https://branca.io, they
+// are authenticated and encrypted with XChaCha20-Poly1305 with Key, a
+// symmetric alternative to HMAC signed JWTs whose claims can't be read
+//
+//	tokenauth.New(tokenauth.Options{
+//		Branca: &tokenauth.Branca{Key: key, TTL: time.Hour},
+//	})
+//
+// The payload is decoded as JSON claims and set in the context like the claims
+// of JWTs. The timestamp of the token is its iat claim, and with a TTL its exp
+// claim, unless the payload has these claims. JWTs are rejected, the options
+// for their keys are not used.
+type Branca struct {
+	// Key is the 32 byte shared key
+	Key []byte
+	// TTL if set, rejects tokens whose timestamp is older
+	TTL time.Duration
+	// Payload if set, decodes the payload into claims, e.g. for payloads
+	// which aren't JSON like MessagePack or a plain user id
+	Payload func(payload []byte) (jwt.MapClaims, error)
+}
+
+func (b *Branca) validate() error {
+	if len(b.Key) != chacha20poly1305.KeySize {
+		return errors.Errorf("Branca Key must be %d bytes", chacha20poly1305.KeySize)
+	}
+	if b.TTL < 0 {
+		return errors.New("Branca TTL must not be negative")
+	}
+	return nil
+}
+
+// verify decrypts the token and returns the token of its claims, with validated times
+func (b *Branca) verify(tokenString string, options Options) (*jwt.Token, error) {
+	data, err := decodeBase62(tokenString)
+	if err != nil {
+		return nil, jwt.NewValidationError(err.Error(), jwt.ValidationErrorMalformed)
+	}
+	aead, err := chacha20poly1305.NewX(b.Key)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := 1 + 4 + aead.NonceSize()
+	if len(data) < headerSize+aead.Overhead() || data[0] != brancaVersion {
+		return nil, jwt.NewValidationError("not a Branca token", jwt.ValidationErrorMalformed)
+	}
+	// the header of version, timestamp and nonce is authenticated with the payload
+	header := data[:headerSize]
+	payload, err := aead.Open(nil, header[5:], data[headerSize:], header)
+	if err != nil {
+		return nil, jwt.NewValidationError("invalid Branca token", jwt.ValidationErrorSignatureInvalid)
+	}
+	timestamp := time.Unix(int64(binary.BigEndian.Uint32(header[1:5])), 0)
+	if b.TTL > 0 && jwt.TimeFunc().Add(-options.Leeway).After(timestamp.Add(b.TTL)) {
+		return nil, jwt.NewValidationError("Token is expired", jwt.ValidationErrorExpired)
+	}
+
+	claims := jwt.MapClaims{}
+	if b.Payload != nil {
+		if claims, err = b.Payload(payload); err != nil {
+			return nil, err
+		}
+		if claims == nil {
+			return nil, jwt.NewValidationError("Branca payload has no claims", jwt.ValidationErrorMalformed)
+		}
+	} else if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, jwt.NewValidationError("invalid Branca payload", jwt.ValidationErrorMalformed)
+	}
+	claims = NormalizeClaims(claims)
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = float64(timestamp.Unix())
+	}
+	if _, ok := claims["exp"]; !ok && b.TTL > 0 {
+		claims["exp"] = float64(timestamp.Add(b.TTL).Unix())
+	}
+	if err := validTimes(claims, options); err != nil {
+		return nil, err
+	}
+	return &jwt.Token{
+		Raw:    tokenString,
+		Method: claimsMethod("branca"),
+		Header: map[string]interface{}{"alg": "branca"},
+		Claims: claims,
+		Valid:  true,
+	}, nil
+}
+
+// decodeBase62 decodes the token with the base62 alphabet of Branca
+func decodeBase62(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("empty token")
+	}
+	n := new(big.Int)
+	base := big.NewInt(62)
+	for _, r := range s {
+		i := strings.IndexRune(brancaAlphabet, r)
+		if i < 0 {
+			return nil, errors.Errorf("invalid base62 character %q", r)
+		}
+		n.Mul(n, base).Add(n, big.NewInt(int64(i)))
+	}
+	return n.Bytes(), nil
+}
@@ -0,0 +1,78 @@
+package tokenauth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ClaimsBuilder builds the claims of a token, the iat, nbf, exp and jti claims
+// are always set, so tokens are valid from the time they are built for the TTL
+//
+//	claims, err := tokenauth.NewClaims().
+//		Subject(user.ID.String()).
+//		TTL(15 * time.Minute).
+//		Audience("api").
+//		Add("role", "admin").
+//		Build()
+type ClaimsBuilder struct {
+	claims jwt.MapClaims
+	ttl    time.Duration
+}
+
+// NewClaims returns a ClaimsBuilder for a token valid for DefaultTokenTTL
+func NewClaims() *ClaimsBuilder {
+	return &ClaimsBuilder{claims: jwt.MapClaims{}, ttl: DefaultTokenTTL}
+}
+
+// Subject sets the sub claim
+func (b *ClaimsBuilder) Subject(sub string) *ClaimsBuilder {
+	b.claims["sub"] = sub
+	return b
+}
+
+// Issuer sets the iss claim
+func (b *ClaimsBuilder) Issuer(iss string) *ClaimsBuilder {
+	b.claims["iss"] = iss
+	return b
+}
+
+// Audience sets the aud claim, a single audience is set as string
+func (b *ClaimsBuilder) Audience(aud ...string) *ClaimsBuilder {
+	if len(aud) == 1 {
+		b.claims["aud"] = aud[0]
+	} else {
+		b.claims["aud"] = aud
+	}
+	return b
+}
+
+// TTL sets how long the token is valid
+func (b *ClaimsBuilder) TTL(ttl time.Duration) *ClaimsBuilder {
+	b.ttl = ttl
+	return b
+}
+
+// Add sets the claim, the iat, nbf, exp and jti claims are set by Build
+func (b *ClaimsBuilder) Add(name string, value interface{}) *ClaimsBuilder {
+	b.claims[name] = value
+	return b
+}
+
+// Build returns the claims of a token valid from now for the TTL
+func (b *ClaimsBuilder) Build() (jwt.MapClaims, error) {
+	jti, err := NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	now := jwt.TimeFunc().Unix()
+	claims := jwt.MapClaims{}
+	for k, v := range b.claims {
+		claims[k] = v
+	}
+	claims["iat"] = now
+	claims["nbf"] = now
+	claims["exp"] = now + int64(b.ttl/time.Second)
+	claims["jti"] = jti
+	return claims, nil
+}
@@ -0,0 +1,75 @@
+package tokenauth
+
+import (
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// IssuerSourceKey is the context key the source of the token is stored under,
+// either IssuerPrimary or IssuerCanary
+const IssuerSourceKey = "token_issuer"
+
+const (
+	// IssuerPrimary is the source of tokens verified with the primary configuration
+	IssuerPrimary = "primary"
+	// IssuerCanary is the source of tokens verified with the canary issuer
+	IssuerCanary = "canary"
+)
+
+// CanaryIssuer is a secondary issuer accepted next to the primary configuration
+// to migrate users between identity providers without downtime.
+// Tokens are verified with the canary when their iss claim matches Issuer.
+type CanaryIssuer struct {
+	// Issuer is the iss claim of tokens minted by the canary
+	Issuer string
+	// SignMethod used by the canary, defaults to the primary sign method
+	SignMethod jwt.SigningMethod
+	// GetKey for the canary, defaults to the key loader of the sign method
+	GetKey func(jwt.SigningMethod) (interface{}, error)
+	// Mapper maps canary claims to the claims contract of the primary,
+	// the Versions of the primary are not applied to canary tokens
+	Mapper ClaimsMapper
+}
+
+// IssuerMetrics counts the accepted tokens per issuer
+type IssuerMetrics struct {
+	primary uint64
+	canary  uint64
+}
+
+// Primary returns the number of accepted tokens of the primary issuer
+func (m *IssuerMetrics) Primary() uint64 {
+	return atomic.LoadUint64(&m.primary)
+}
+
+// Canary returns the number of accepted tokens of the canary issuer
+func (m *IssuerMetrics) Canary() uint64 {
+	return atomic.LoadUint64(&m.canary)
+}
+
+func (m *IssuerMetrics) inc(source string) {
+	if m == nil {
+		return
+	}
+	switch source {
+	case IssuerPrimary:
+		atomic.AddUint64(&m.primary, 1)
+	case IssuerCanary:
+		atomic.AddUint64(&m.canary, 1)
+	}
+}
+
+// isCanary reports if the token claims the canary as issuer,
+// it is called before the signature is verified
+func (ci *CanaryIssuer) isCanary(claims UntrustedClaims) bool {
+	return ci != nil && claims.Issuer() == ci.Issuer
+}
+
+// signMethod returns the sign method of the canary, nil without canary
+func (ci *CanaryIssuer) signMethod() jwt.SigningMethod {
+	if ci == nil {
+		return nil
+	}
+	return ci.SignMethod
+}
@@ -0,0 +1,75 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func appCanary(metrics *tokenauth.IssuerMetrics) *buffalo.App {
+	h := func(c buffalo.Context) error {
+		claims := c.Value("claims").(jwt.MapClaims)
+		return c.Render(200, render.String(c.Value(tokenauth.IssuerSourceKey).(string)+"|"+claims["sub"].(string)))
+	}
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		Canary: &tokenauth.CanaryIssuer{
+			Issuer: "https://new-idp.example.com",
+			GetKey: func(jwt.SigningMethod) (interface{}, error) {
+				return []byte("canary-secret"), nil
+			},
+			Mapper: tokenauth.RenameClaims(map[string]string{"uid": "sub"}),
+		},
+		IssuerMetrics: metrics,
+	}))
+	a.GET("/", h)
+	return a
+}
+
+func TestCanaryIssuer(t *testing.T) {
+	r := require.New(t)
+	metrics := &tokenauth.IssuerMetrics{}
+	w := httptest.New(appCanary(metrics))
+	exp := time.Now().Add(time.Minute * 5).Unix()
+
+	// primary token
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{"sub": "1", "exp": exp})
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("primary|1", res.Body.String())
+
+	// canary token
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "https://new-idp.example.com",
+		"uid": "2",
+		"exp": exp,
+	})
+	tokenString, err := token.SignedString([]byte("canary-secret"))
+	r.NoError(err)
+	req.Headers["Authorization"] = "Bearer " + tokenString
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("canary|2", res.Body.String())
+
+	// canary issuer signed with the primary key
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{
+		"iss": "https://new-idp.example.com",
+		"uid": "2",
+		"exp": exp,
+	})
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+
+	r.Equal(uint64(1), metrics.Primary())
+	r.Equal(uint64(1), metrics.Canary())
+}
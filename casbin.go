@@ -0,0 +1,68 @@
+package tokenauth
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// CasbinEnforcer is the method of the Casbin enforcer the requests are authorized
+// with, *casbin.Enforcer and *casbin.SyncedEnforcer of casbin/v2 implement it
+type CasbinEnforcer interface {
+	Enforce(rvals ...interface{}) (bool, error)
+}
+
+// Casbin authorizes requests with a Casbin enforcer, the subject of the verified
+// token, the path and the method of the request are enforced, so the request
+// definition of the model must be r = sub, obj, act, e.g. for a RESTful RBAC model
+//
+//	[matchers]
+//	m = g(r.sub, p.sub) && keyMatch2(r.obj, p.obj) && regexMatch(r.act, p.act)
+//
+// Use it as Guard for all routes or with Authorize for single routes
+//
+//	enforcer, _ := casbin.NewEnforcer("model.conf", "policy.csv")
+//	app.Use(tokenauth.New(tokenauth.Options{
+//		Guards: []tokenauth.Guard{&tokenauth.Casbin{Enforcer: enforcer}},
+//	}))
+type Casbin struct {
+	Enforcer CasbinEnforcer
+	// SubjectClaim is the path of the claim of the subject, e.g. email or
+	// realm_access.role, defaults to sub. Used as Guard with the Claims option,
+	// the claim must be a field of the claims struct
+	SubjectClaim string
+}
+
+// Allow enforces the subject, path and method of the request
+func (cb *Casbin) Allow(c buffalo.Context, claims jwt.Claims) error {
+	name := cb.SubjectClaim
+	if name == "" {
+		name = "sub"
+	}
+	// the map has the claims the struct of the Claims option lacks,
+	// it is set once the Guards allowed the request
+	mc := ClaimsMap(c)
+	if mc == nil {
+		mc = asMapClaims(claims)
+	}
+	sub, ok := guard.Claim(mc, name).(string)
+	if !ok || sub == "" {
+		return errors.Wrap(ErrMissingClaim, name)
+	}
+	req := c.Request()
+	allowed, err := cb.Enforcer.Enforce(sub, req.URL.Path, req.Method)
+	if err != nil {
+		return &AuthError{
+			Code:       ErrorCodePolicyUnavailable,
+			HTTPStatus: http.StatusInternalServerError,
+			Cause:      errors.Wrap(err, "couldn't enforce Casbin policy"),
+		}
+	}
+	if !allowed {
+		return ErrPolicyDenied
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// casbinPolicy is an enforcer of a RESTful model with
+// the matcher r.sub == p.sub && keyMatch(r.obj, p.obj) && r.act == p.act
+type casbinPolicy [][3]string
+
+func (p casbinPolicy) Enforce(rvals ...interface{}) (bool, error) {
+	if len(rvals) != 3 {
+		return false, errors.New("invalid request definition")
+	}
+	for _, rule := range p {
+		if rvals[0] == rule[0] && strings.HasPrefix(rvals[1].(string), strings.TrimSuffix(rule[1], "*")) && rvals[2] == rule[2] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestCasbin(t *testing.T) {
+	r := require.New(t)
+	enforcer := casbinPolicy{{"ada", "/reports/*", "GET"}, {"admin", "/reports/*", "DELETE"}}
+	handler := func(c buffalo.Context) error {
+		return c.Render(200, render.String("ok"))
+	}
+	// as guard of all routes
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		Claims:  func() jwt.Claims { return &userClaims{} },
+		Guards:  []tokenauth.Guard{&tokenauth.Casbin{Enforcer: enforcer}},
+	}))
+	a.GET("/reports/{id}", handler)
+	a.DELETE("/reports/{id}", handler)
+	// for a single route, with the role as subject
+	b := buffalo.New(buffalo.Options{})
+	b.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+	}))
+	b.DELETE("/reports/{id}", tokenauth.Authorize((&tokenauth.Casbin{Enforcer: enforcer, SubjectClaim: "realm_access.role"}).Allow)(handler))
+
+	for _, tt := range []struct {
+		app    *buffalo.App
+		method string
+		claims jwt.MapClaims
+		status int
+	}{
+		{a, "GET", jwt.MapClaims{"sub": "ada"}, http.StatusOK},
+		{a, "DELETE", jwt.MapClaims{"sub": "ada"}, http.StatusForbidden},
+		{a, "GET", jwt.MapClaims{"sub": "bob"}, http.StatusForbidden},
+		{a, "GET", jwt.MapClaims{}, http.StatusForbidden},
+		{b, "DELETE", jwt.MapClaims{"sub": "ada", "realm_access": map[string]string{"role": "admin"}}, http.StatusOK},
+		{b, "DELETE", jwt.MapClaims{"sub": "ada", "realm_access": map[string]string{"role": "user"}}, http.StatusForbidden},
+	} {
+		tt.claims["exp"] = time.Now().Add(time.Minute * 5).Unix()
+		req := httptest.New(tt.app).HTML("/reports/42")
+		req.Headers["Authorization"] = "Bearer " + signWith(tt.claims, "secret")
+		var res *httptest.Response
+		if tt.method == "GET" {
+			res = req.Get()
+		} else {
+			res = req.Delete()
+		}
+		r.Equal(tt.status, res.Code, tt.claims)
+	}
+}
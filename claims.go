@@ -0,0 +1,133 @@
+package tokenauth
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// MapClaimsKey is the context key of the verified claims as jwt.MapClaims,
+// they are also stored there if the Claims option decodes them into a struct
+const MapClaimsKey = "map_claims"
+
+// numericDateClaims are the claims holding a NumericDate
+var numericDateClaims = []string{"exp", "nbf", "iat"}
+
+// NormalizeClaims converts the exp, nbf and iat claims of issuers encoding
+// them as strings (e.g. "1577836800.5") to numbers, so they are validated
+// like the claims of other issuers. The middleware normalizes the claims
+// before validating them.
+func NormalizeClaims(claims jwt.MapClaims) jwt.MapClaims {
+	for _, name := range numericDateClaims {
+		switch v := claims[name].(type) {
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				claims[name] = f
+			}
+		case json.Number:
+			if f, err := v.Float64(); err == nil {
+				claims[name] = f
+			}
+		}
+	}
+	return claims
+}
+
+// validTimes validates the exp, nbf and iat claims like jwt.MapClaims.Valid,
+// allowing for clocks of the issuer and the app which are Leeway apart, and
+// checks the nbf and iat claims are present if the options require them
+func validTimes(claims jwt.MapClaims, options Options) error {
+	if _, ok := NotBefore(claims); options.RequireNotBefore && !ok {
+		return errors.Wrap(ErrMissingClaim, "nbf")
+	}
+	if _, ok := IssuedAt(claims); options.RequireIssuedAt && !ok {
+		return errors.Wrap(ErrMissingClaim, "iat")
+	}
+	leeway := options.Leeway
+	verr := &jwt.ValidationError{}
+	now := jwt.TimeFunc()
+	if !claims.VerifyExpiresAt(now.Add(-leeway).Unix(), false) {
+		verr.Inner = errors.New("Token is expired")
+		verr.Errors |= jwt.ValidationErrorExpired
+	}
+	if !claims.VerifyIssuedAt(now.Add(leeway).Unix(), false) {
+		verr.Inner = errors.New("Token used before issued")
+		verr.Errors |= jwt.ValidationErrorIssuedAt
+	}
+	if !claims.VerifyNotBefore(now.Add(leeway).Unix(), false) {
+		verr.Inner = errors.New("Token is not valid yet")
+		verr.Errors |= jwt.ValidationErrorNotValidYet
+	}
+	if verr.Errors == 0 {
+		return nil
+	}
+	return verr
+}
+
+// ClaimsMap returns the verified claims of the request as map, whether or
+// not the Claims option decodes them into a struct, nil if the request
+// isn't authenticated
+func ClaimsMap(c buffalo.Context) jwt.MapClaims {
+	if claims, ok := c.Value("claims").(jwt.MapClaims); ok {
+		return claims
+	}
+	claims, _ := c.Value(MapClaimsKey).(jwt.MapClaims)
+	return claims
+}
+
+// decodeClaims decodes the verified claims into the claims returned by the
+// Claims option, the claims are returned as they are if it isn't set
+func decodeClaims(options Options, claims jwt.MapClaims) (jwt.Claims, error) {
+	if options.Claims == nil {
+		return claims, nil
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't decode claims")
+	}
+	typed := options.Claims()
+	if err := json.Unmarshal(data, typed); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode claims")
+	}
+	return typed, nil
+}
+
+// asMapClaims returns the claims as map, claims decoded
+// with the Claims option are encoded back into one
+func asMapClaims(claims jwt.Claims) jwt.MapClaims {
+	if mc, ok := claims.(jwt.MapClaims); ok {
+		return mc
+	}
+	var mc jwt.MapClaims
+	if data, err := json.Marshal(claims); err == nil {
+		json.Unmarshal(data, &mc)
+	}
+	return mc
+}
+
+// ExpiresAt returns the time of the exp claim, false if the token has none
+func ExpiresAt(claims jwt.MapClaims) (time.Time, bool) {
+	return guard.NumericDate(claims, "exp")
+}
+
+// NotBefore returns the time of the nbf claim, false if the token has none
+func NotBefore(claims jwt.MapClaims) (time.Time, bool) {
+	return guard.NumericDate(claims, "nbf")
+}
+
+// IssuedAt returns the time of the iat claim, false if the token has none
+func IssuedAt(claims jwt.MapClaims) (time.Time, bool) {
+	return guard.NumericDate(claims, "iat")
+}
+
+// Audience returns the audiences of the aud claim, which issuers
+// send either as a single string or as an array of strings
+func Audience(claims jwt.MapClaims) []string {
+	return guard.Audience(claims)
+}
@@ -0,0 +1,173 @@
+package tokenauth_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeClaims(t *testing.T) {
+	r := require.New(t)
+	claims := tokenauth.NormalizeClaims(jwt.MapClaims{
+		"exp": "1577836800.5",
+		"nbf": json.Number("1577836800"),
+		"iat": float64(1577836800),
+		"sub": "1577836800",
+	})
+	r.Equal(1577836800.5, claims["exp"])
+	r.Equal(float64(1577836800), claims["nbf"])
+	r.Equal(float64(1577836800), claims["iat"])
+	r.Equal("1577836800", claims["sub"])
+}
+
+func TestNumericDateAccessors(t *testing.T) {
+	r := require.New(t)
+	want := time.Unix(1577836800, 5e8)
+	for _, exp := range []interface{}{1577836800.5, "1577836800.5", json.Number("1577836800.5")} {
+		got, ok := tokenauth.ExpiresAt(jwt.MapClaims{"exp": exp})
+		r.True(ok)
+		r.True(want.Equal(got), "%v", exp)
+	}
+	got, ok := tokenauth.IssuedAt(jwt.MapClaims{"iat": int64(1577836800)})
+	r.True(ok)
+	r.Equal(int64(1577836800), got.Unix())
+
+	_, ok = tokenauth.NotBefore(jwt.MapClaims{})
+	r.False(ok)
+	_, ok = tokenauth.ExpiresAt(jwt.MapClaims{"exp": "tomorrow"})
+	r.False(ok)
+}
+
+func TestAudience(t *testing.T) {
+	r := require.New(t)
+	r.Equal([]string{"api"}, tokenauth.Audience(jwt.MapClaims{"aud": "api"}))
+	r.Equal([]string{"my api"}, tokenauth.Audience(jwt.MapClaims{"aud": "my api"}))
+	r.Equal([]string{"api", "admin"}, tokenauth.Audience(jwt.MapClaims{"aud": []interface{}{"api", "admin"}}))
+	r.Empty(tokenauth.Audience(jwt.MapClaims{}))
+}
+
+func TestLeeway(t *testing.T) {
+	r := require.New(t)
+	app := func(leeway time.Duration) *httptest.Handler {
+		a := buffalo.New(buffalo.Options{})
+		a.Use(tokenauth.New(tokenauth.Options{
+			KeyFunc: tokenauth.StaticKey([]byte("secret")),
+			Leeway:  leeway,
+		}))
+		a.GET("/", func(c buffalo.Context) error {
+			return c.Render(200, nil)
+		})
+		return httptest.New(a)
+	}
+	strict, skewed := app(0), app(time.Minute)
+	now := time.Now()
+	for _, tt := range []struct {
+		claims         jwt.MapClaims
+		strict, skewed int
+	}{
+		{jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix()}, http.StatusUnauthorized, http.StatusOK},
+		{jwt.MapClaims{"exp": now.Add(-2 * time.Minute).Unix()}, http.StatusUnauthorized, http.StatusUnauthorized},
+		{jwt.MapClaims{"nbf": now.Add(30 * time.Second).Unix()}, http.StatusUnauthorized, http.StatusOK},
+		{jwt.MapClaims{"nbf": now.Add(2 * time.Minute).Unix()}, http.StatusUnauthorized, http.StatusUnauthorized},
+		{jwt.MapClaims{"iat": now.Add(30 * time.Second).Unix()}, http.StatusUnauthorized, http.StatusOK},
+	} {
+		token := "Bearer " + signWith(tt.claims, "secret")
+		req := strict.HTML("/")
+		req.Headers["Authorization"] = token
+		r.Equal(tt.strict, req.Get().Code, tt.claims)
+		req = skewed.HTML("/")
+		req.Headers["Authorization"] = token
+		r.Equal(tt.skewed, req.Get().Code, tt.claims)
+	}
+}
+
+func TestRequireNotBeforeAndIssuedAt(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc:          tokenauth.StaticKey([]byte("secret")),
+		Leeway:           time.Minute,
+		RequireNotBefore: true,
+		RequireIssuedAt:  true,
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	now := time.Now()
+	exp := now.Add(5 * time.Minute).Unix()
+	for _, tt := range []struct {
+		claims jwt.MapClaims
+		status int
+	}{
+		{jwt.MapClaims{"exp": exp, "nbf": now.Unix(), "iat": now.Unix()}, http.StatusOK},
+		{jwt.MapClaims{"exp": exp, "iat": now.Unix()}, http.StatusUnauthorized},
+		{jwt.MapClaims{"exp": exp, "nbf": now.Unix()}, http.StatusUnauthorized},
+		{jwt.MapClaims{"exp": exp, "nbf": now.Unix(), "iat": "yesterday"}, http.StatusUnauthorized},
+		// issued in the future beyond the leeway
+		{jwt.MapClaims{"exp": exp, "nbf": now.Unix(), "iat": now.Add(2 * time.Minute).Unix()}, http.StatusUnauthorized},
+	} {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signWith(tt.claims, "secret")
+		res := req.Get()
+		r.Equal(tt.status, res.Code, tt.claims)
+		if _, ok := tt.claims["nbf"]; !ok {
+			r.Contains(res.Header().Get("WWW-Authenticate"), "nbf: required claim missing")
+		}
+	}
+}
+
+// userClaims are the claims of the test app
+type userClaims struct {
+	jwt.RegisteredClaims
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+}
+
+func TestClaimsFactory(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc:        tokenauth.StaticKey([]byte("secret")),
+		Claims:         func() jwt.Claims { return &userClaims{} },
+		RequiredClaims: []string{"username"},
+		ValidateClaims: func(c buffalo.Context, claims jwt.Claims) error {
+			if len(claims.(*userClaims).Roles) == 0 {
+				return tokenauth.ErrInsufficientScope
+			}
+			return nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		claims := c.Value("claims").(*userClaims)
+		r.Equal("user-1", claims.Subject)
+		r.Equal("user-1", tokenauth.ClaimsMap(c)["sub"])
+		return c.Render(200, render.String(claims.Username+" "+claims.Roles[0]))
+	})
+	w := httptest.New(a)
+	// exp encoded as string is normalized before decoding
+	exp := fmt.Sprint(time.Now().Add(time.Minute * 5).Unix())
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"sub": "user-1", "username": "ada", "roles": []string{"admin"}, "exp": exp}, "secret")
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("ada admin", res.Body.String())
+
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"sub": "user-1", "username": "ada", "exp": exp}, "secret")
+	r.Equal(http.StatusForbidden, req.Get().Code)
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"sub": "user-1", "roles": []string{"admin"}, "exp": exp}, "secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+	// claims not matching the struct
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"sub": "user-1", "username": 42, "roles": []string{"admin"}, "exp": exp}, "secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+}
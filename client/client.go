@@ -0,0 +1,88 @@
+// Package client helps Go clients of APIs protected by the tokenauth middleware,
+// it detects responses rejecting an expired token and retries them with a refreshed token
+package client
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TokenSource provides the tokens requests are authenticated with
+type TokenSource interface {
+	// Token returns the current token
+	Token() (string, error)
+	// Refresh obtains a new token, e.g. from the refresh endpoint
+	Refresh() (string, error)
+}
+
+// ErrorCode returns the error_code of a response rejecting the token of the request,
+// as sent by the middleware when configured with RetryHints, or "" if there is none
+func ErrorCode(res *http.Response) string {
+	if res.StatusCode != http.StatusUnauthorized {
+		return ""
+	}
+	return authParam(res.Header.Get("WWW-Authenticate"), "error_code")
+}
+
+// Invalid reports if the response rejected the token of the request as invalid_token
+func Invalid(res *http.Response) bool {
+	return res.StatusCode == http.StatusUnauthorized &&
+		authParam(res.Header.Get("WWW-Authenticate"), "error") == "invalid_token"
+}
+
+// Expired reports if the response rejected the request because the token expired
+func Expired(res *http.Response) bool {
+	return ErrorCode(res) == "expired"
+}
+
+// Do sends the request authenticated with the token of the source, if the response
+// rejects the token as expired the token is refreshed and the request retried once.
+// Requests with a body are only retried if their GetBody is set, as done by http.NewRequest.
+func Do(c *http.Client, req *http.Request, source TokenSource) (*http.Response, error) {
+	token, err := source.Token()
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Do(authorize(req, token))
+	if err != nil || !Expired(res) {
+		return res, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return res, nil
+	}
+	token, err = source.Refresh()
+	if err != nil {
+		return res, nil
+	}
+	retry := authorize(req, token)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return res, nil
+		}
+	}
+	res.Body.Close()
+	return c.Do(retry)
+}
+
+// authorize returns a copy of the request carrying the token
+func authorize(req *http.Request, token string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// authParam returns the value of an auth-param of a WWW-Authenticate challenge
+func authParam(challenge, name string) string {
+	for _, part := range strings.Split(challenge, ",") {
+		part = strings.TrimSpace(part)
+		// the first param follows the scheme
+		if i := strings.Index(part, " "); i >= 0 && !strings.Contains(part[:i], "=") {
+			part = strings.TrimSpace(part[i+1:])
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == name {
+			return strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		}
+	}
+	return ""
+}
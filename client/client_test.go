@@ -0,0 +1,76 @@
+package client_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/client"
+	"github.com/stretchr/testify/require"
+)
+
+type source struct {
+	token     string
+	refreshes int
+}
+
+func (s *source) Token() (string, error) { return s.token, nil }
+
+func (s *source) Refresh() (string, error) {
+	s.refreshes++
+	s.token = "fresh"
+	return s.token, nil
+}
+
+func server() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_code="expired", error_description="Token is expired"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(append([]byte("ok"), body...))
+	}))
+}
+
+func TestDo(t *testing.T) {
+	r := require.New(t)
+	ts := server()
+	defer ts.Close()
+
+	src := &source{token: "stale"}
+	req, err := http.NewRequest("POST", ts.URL, strings.NewReader(" body"))
+	r.NoError(err)
+	res, err := client.Do(http.DefaultClient, req, src)
+	r.NoError(err)
+	defer res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+	body, err := ioutil.ReadAll(res.Body)
+	r.NoError(err)
+	r.Equal("ok body", string(body))
+	r.Equal(1, src.refreshes)
+
+	// a valid token is not refreshed
+	req, err = http.NewRequest("GET", ts.URL, nil)
+	r.NoError(err)
+	res, err = client.Do(http.DefaultClient, req, src)
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.Equal(1, src.refreshes)
+}
+
+func TestErrorCode(t *testing.T) {
+	r := require.New(t)
+	res := &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{}}
+	res.Header.Set("WWW-Authenticate", `Bearer error="invalid_token", error_code="malformed"`)
+	r.Equal("malformed", client.ErrorCode(res))
+	r.False(client.Expired(res))
+	res.Header.Set("WWW-Authenticate", `Bearer error_code="expired"`)
+	r.True(client.Expired(res))
+	res.StatusCode = http.StatusOK
+	r.Equal("", client.ErrorCode(res))
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// RefreshSource is a TokenSource exchanging its refresh token for a new token pair
+// at the refresh endpoint, as scaffolded by buffalo-tokenauth or served by
+// signer.RefreshHandler (POST refresh_token, answered with
+// {"access_token": ..., "refresh_token": ...}).
+type RefreshSource struct {
+	// URL of the refresh endpoint
+	URL string
+	// Client used to call the refresh endpoint, http.DefaultClient if nil,
+	// must not use a Transport relying on this source
+	Client *http.Client
+
+	mu           sync.Mutex
+	accessToken  string
+	refreshToken string
+}
+
+// NewRefreshSource returns a RefreshSource starting with the given token pair
+func NewRefreshSource(url, accessToken, refreshToken string) *RefreshSource {
+	return &RefreshSource{URL: url, accessToken: accessToken, refreshToken: refreshToken}
+}
+
+// Token returns the current access token
+func (s *RefreshSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accessToken, nil
+}
+
+// Refresh exchanges the refresh token for a new token pair
+func (s *RefreshSource) Refresh() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	res, err := c.PostForm(s.URL, url.Values{"refresh_token": {s.refreshToken}})
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("refreshing token: %s", res.Status)
+	}
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	if tokens.AccessToken == "" {
+		return "", errors.New("refreshing token: no access_token in response")
+	}
+	s.accessToken = tokens.AccessToken
+	if tokens.RefreshToken != "" {
+		s.refreshToken = tokens.RefreshToken
+	}
+	return s.accessToken, nil
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"net/http"
+)
+
+// Transport is an http.RoundTripper authenticating requests with the token of
+// Source, requests rejected with an invalid_token error are retried once with a
+// refreshed token
+//
+//	c := &http.Client{Transport: &client.Transport{
+//		Source: client.NewRefreshSource("https://api.example.com/auth/refresh", accessToken, refreshToken),
+//	}}
+type Transport struct {
+	// Source provides the tokens
+	Source TokenSource
+	// Base is the transport sending the requests, http.DefaultTransport if nil
+	Base http.RoundTripper
+	// OnRefresh if set, is called with the refreshed token
+	OnRefresh func(token string)
+	// OnRejected if set, is called with responses still rejecting the token
+	// after the refresh, or when the token could not be refreshed
+	OnRejected func(res *http.Response, err error)
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Source.Token()
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.base().RoundTrip(authorize(req, token))
+	if err != nil || !Invalid(res) {
+		return res, err
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		t.rejected(res, nil)
+		return res, nil
+	}
+	token, err = t.Source.Refresh()
+	if err != nil {
+		t.rejected(res, err)
+		return res, nil
+	}
+	if t.OnRefresh != nil {
+		t.OnRefresh(token)
+	}
+	retry := authorize(req, token)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			t.rejected(res, err)
+			return res, nil
+		}
+	}
+	res.Body.Close()
+	res, err = t.base().RoundTrip(retry)
+	if err == nil && Invalid(res) {
+		t.rejected(res, nil)
+	}
+	return res, err
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) rejected(res *http.Response, err error) {
+	if t.OnRejected != nil {
+		t.OnRejected(res, err)
+	}
+}
@@ -0,0 +1,64 @@
+package client_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	r := require.New(t)
+	ts := server()
+	defer ts.Close()
+
+	refresh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.FormValue("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "fresh", "refresh_token": "refresh2"})
+	}))
+	defer refresh.Close()
+
+	var refreshed string
+	c := &http.Client{Transport: &client.Transport{
+		Source:    client.NewRefreshSource(refresh.URL, "stale", "refresh"),
+		OnRefresh: func(token string) { refreshed = token },
+	}}
+	res, err := c.Post(ts.URL, "text/plain", strings.NewReader(" body"))
+	r.NoError(err)
+	defer res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+	body, err := ioutil.ReadAll(res.Body)
+	r.NoError(err)
+	r.Equal("ok body", string(body))
+	r.Equal("fresh", refreshed)
+}
+
+func TestTransportRefreshFails(t *testing.T) {
+	r := require.New(t)
+	ts := server()
+	defer ts.Close()
+
+	refresh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer refresh.Close()
+
+	var rejectErr error
+	c := &http.Client{Transport: &client.Transport{
+		Source:     client.NewRefreshSource(refresh.URL, "stale", "revoked"),
+		OnRejected: func(res *http.Response, err error) { rejectErr = err },
+	}}
+	res, err := c.Get(ts.URL)
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusUnauthorized, res.StatusCode)
+	r.Error(rejectErr)
+}
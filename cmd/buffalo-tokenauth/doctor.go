@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// runDoctor prints the diagnostics, it returns false if any check failed
+func runDoctor(args []string) (bool, error) {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	method := flags.String("method", "HS256", "signing method the middleware is configured with")
+	opts := tokenauth.DoctorOptions{}
+	flags.StringVar(&opts.JWKSURL, "jwks", "", "url of a JWKS to fetch")
+	flags.StringVar(&opts.Token, "token", "", "sample token to validate")
+	if err := flags.Parse(args); err != nil {
+		return false, err
+	}
+	opts.SignMethod = jwt.GetSigningMethod(*method)
+	if opts.SignMethod == nil {
+		return false, fmt.Errorf("unknown signing method %q", *method)
+	}
+	ok := true
+	for _, d := range tokenauth.Doctor(opts) {
+		fmt.Println(d)
+		if d.Status == tokenauth.DiagnosticFail {
+			ok = false
+		}
+	}
+	return ok, nil
+}
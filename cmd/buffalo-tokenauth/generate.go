@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// generateOptions for the tokenauth generator
+type generateOptions struct {
+	Root    string
+	KeysDir string
+	Force   bool
+}
+
+// generate writes the auth actions, example tests and key pair into the app
+// and registers the key locations in the .env file, it returns the created files
+func generate(opts generateOptions) ([]string, error) {
+	if _, err := os.Stat(filepath.Join(opts.Root, "actions")); err != nil {
+		return nil, fmt.Errorf("no actions directory found in %s, run the generator from the root of a buffalo app", opts.Root)
+	}
+	data := map[string]string{
+		"PrivateKey": filepath.ToSlash(filepath.Join(opts.KeysDir, "private.pem")),
+		"PublicKey":  filepath.ToSlash(filepath.Join(opts.KeysDir, "public.pem")),
+	}
+	var created []string
+	for _, f := range []struct{ name, tmpl string }{
+		{"actions/tokenauth.go", actionsTmpl},
+		{"actions/tokenauth_test.go", actionsTestTmpl},
+	} {
+		name, tmpl := f.name, f.tmpl
+		path := filepath.Join(opts.Root, name)
+		if !opts.Force && exists(path) {
+			return created, fmt.Errorf("%s already exists, use --force to overwrite", path)
+		}
+		if err := writeTemplate(path, tmpl, data); err != nil {
+			return created, err
+		}
+		created = append(created, name)
+	}
+
+	keysDir := filepath.Join(opts.Root, opts.KeysDir)
+	if opts.Force || !exists(filepath.Join(keysDir, "private.pem")) {
+		if err := writeKeyPair(keysDir, jwt.SigningMethodRS256); err != nil {
+			return created, err
+		}
+		created = append(created, data["PrivateKey"], data["PublicKey"])
+	}
+
+	if err := appendMissing(filepath.Join(opts.Root, ".env"), map[string]string{
+		"JWT_PRIVATE_KEY": data["PrivateKey"],
+		"JWT_PUBLIC_KEY":  data["PublicKey"],
+	}); err != nil {
+		return created, err
+	}
+	// the private key must never be committed
+	if err := appendLine(filepath.Join(opts.Root, ".gitignore"), data["PrivateKey"]); err != nil {
+		return created, err
+	}
+	return created, nil
+}
+
+func writeTemplate(path, tmpl string, data interface{}) error {
+	t, err := template.New(filepath.Base(path)).Parse(tmpl)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return t.Execute(f, data)
+}
+
+// appendMissing adds the env variables not yet defined in the env file
+func appendMissing(path string, vars map[string]string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	defined := map[string]bool{}
+	s := bufio.NewScanner(strings.NewReader(string(content)))
+	for s.Scan() {
+		if i := strings.Index(s.Text(), "="); i > 0 {
+			defined[strings.TrimSpace(s.Text()[:i])] = true
+		}
+	}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if defined[k] {
+			continue
+		}
+		if err := appendLine(path, k+"="+vars[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendLine adds the line to the file unless it already contains it
+func appendLine(path, line string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, l := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(l) == line {
+			return nil
+		}
+	}
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		line = "\n" + line
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, line)
+	return err
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	r := require.New(t)
+	root, err := ioutil.TempDir("", "tokenauth")
+	r.NoError(err)
+	defer os.RemoveAll(root)
+
+	// not a buffalo app
+	_, err = generate(generateOptions{Root: root, KeysDir: "config/jwt"})
+	r.Error(err)
+
+	r.NoError(os.Mkdir(filepath.Join(root, "actions"), 0755))
+	r.NoError(ioutil.WriteFile(filepath.Join(root, ".env"), []byte("JWT_PUBLIC_KEY=custom.pem"), 0644))
+	files, err := generate(generateOptions{Root: root, KeysDir: "config/jwt"})
+	r.NoError(err)
+	r.Equal([]string{
+		"actions/tokenauth.go",
+		"actions/tokenauth_test.go",
+		"config/jwt/private.pem",
+		"config/jwt/public.pem",
+	}, files)
+	for _, f := range files {
+		r.FileExists(filepath.Join(root, f))
+	}
+
+	// refresh tokens are not accepted as access tokens
+	actions, err := ioutil.ReadFile(filepath.Join(root, "actions/tokenauth.go"))
+	r.NoError(err)
+	r.Contains(string(actions), "ValidateClaims: rejectRefreshTokens")
+
+	env, err := ioutil.ReadFile(filepath.Join(root, ".env"))
+	r.NoError(err)
+	r.Equal("JWT_PUBLIC_KEY=custom.pem\nJWT_PRIVATE_KEY=config/jwt/private.pem\n", string(env))
+	gitignore, err := ioutil.ReadFile(filepath.Join(root, ".gitignore"))
+	r.NoError(err)
+	r.Equal("config/jwt/private.pem\n", string(gitignore))
+
+	// existing files are not overwritten without force
+	_, err = generate(generateOptions{Root: root, KeysDir: "config/jwt"})
+	r.Error(err)
+	_, err = generate(generateOptions{Root: root, KeysDir: "config/jwt", Force: true})
+	r.NoError(err)
+	gitignore, err = ioutil.ReadFile(filepath.Join(root, ".gitignore"))
+	r.NoError(err)
+	r.Equal("config/jwt/private.pem\n", string(gitignore))
+}
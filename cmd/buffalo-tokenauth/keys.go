@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// runKeys generates a key pair for the signing method, or prints a secret for HMAC methods
+func runKeys(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("keys", flag.ContinueOnError)
+	alg := flags.String("alg", "RS256", "signing method of the keys, e.g. RS256, ES256, EdDSA or HS256")
+	dir := flags.String("dir", "config/jwt", "directory the key pair is written to")
+	force := flags.Bool("force", false, "overwrite existing keys")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	method := jwt.GetSigningMethod(*alg)
+	if method == nil {
+		return fmt.Errorf("unknown signing method %q", *alg)
+	}
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		// HMAC secrets are configured in the environment, not in files
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "JWT_SECRET_BASE64=%s\n", base64.StdEncoding.EncodeToString(secret))
+		return nil
+	}
+	if !*force && exists(filepath.Join(*dir, "private.pem")) {
+		return fmt.Errorf("%s already exists, use --force to overwrite", filepath.Join(*dir, "private.pem"))
+	}
+	if err := writeKeyPair(*dir, method); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "create", filepath.Join(*dir, "private.pem"))
+	fmt.Fprintln(out, "create", filepath.Join(*dir, "public.pem"))
+	return nil
+}
+
+// runToken prints a token signed with the private key, e.g. to call the API of the app locally
+func runToken(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	alg := flags.String("alg", "RS256", "signing method of the token")
+	keyFile := flags.String("key", os.Getenv("JWT_PRIVATE_KEY"), "private key file, JWT_SECRET is used for HMAC methods")
+	claims := flags.String("claims", "{}", "claims of the token as JSON")
+	issuer := tokenauth.Issuer{}
+	flags.DurationVar(&issuer.TTL, "ttl", tokenauth.DefaultTokenTTL, "how long the token is valid")
+	flags.StringVar(&issuer.KeyID, "kid", "", "kid header of the token")
+	flags.StringVar(&issuer.Issuer, "iss", "", "iss claim of the token")
+	aud := flags.String("aud", "", "aud claim of the token, comma separated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	issuer.SignMethod = jwt.GetSigningMethod(*alg)
+	if issuer.SignMethod == nil {
+		return fmt.Errorf("unknown signing method %q", *alg)
+	}
+	if *aud != "" {
+		issuer.Audience = strings.Split(*aud, ",")
+	}
+	mc := jwt.MapClaims{}
+	if err := json.Unmarshal([]byte(*claims), &mc); err != nil {
+		return fmt.Errorf("invalid claims: %v", err)
+	}
+	var err error
+	if issuer.Key, err = loadSigningKey(issuer.SignMethod, *keyFile); err != nil {
+		return err
+	}
+	token, err := issuer.Issue(mc)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, token)
+	return nil
+}
+
+// generateKey returns a new key pair for the signing method
+func generateKey(method jwt.SigningMethod) (interface{}, interface{}, error) {
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &key.PublicKey, nil
+	case *jwt.SigningMethodECDSA:
+		curves := map[int]elliptic.Curve{256: elliptic.P256(), 384: elliptic.P384(), 521: elliptic.P521()}
+		key, err := ecdsa.GenerateKey(curves[m.CurveBits], rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, &key.PublicKey, nil
+	case *jwt.SigningMethodEd25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, public, err
+	}
+	return nil, nil, fmt.Errorf("%s has no key pair", method.Alg())
+}
+
+// writeKeyPair generates a key pair for the signing method, the private key is
+// written as PKCS #8 and the public key as PKIX PEM, which the middleware reads
+func writeKeyPair(dir string, method jwt.SigningMethod) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	private, public, err := generateKey(method)
+	if err != nil {
+		return err
+	}
+	privBytes, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	priv := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})
+	if err := ioutil.WriteFile(filepath.Join(dir, "private.pem"), priv, 0600); err != nil {
+		return err
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return err
+	}
+	pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+	return ioutil.WriteFile(filepath.Join(dir, "public.pem"), pub, 0644)
+}
+
+// loadSigningKey reads the private key of the signing method from the file,
+// or the secret of HMAC methods from JWT_SECRET or JWT_SECRET_BASE64
+func loadSigningKey(method jwt.SigningMethod, path string) (interface{}, error) {
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		// the secret the middleware verifies the tokens with
+		return tokenauth.GetHMACKey(method)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no private key, use --key or set JWT_PRIVATE_KEY")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		return jwt.ParseRSAPrivateKeyFromPEM(data)
+	case *jwt.SigningMethodECDSA:
+		return jwt.ParseECPrivateKeyFromPEM(data)
+	case *jwt.SigningMethodEd25519:
+		return jwt.ParseEdPrivateKeyFromPEM(data)
+	}
+	return nil, fmt.Errorf("%s has no private key", method.Alg())
+}
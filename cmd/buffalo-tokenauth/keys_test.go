@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeysAndToken(t *testing.T) {
+	for _, alg := range []string{"RS256", "PS384", "ES256", "ES512", "EdDSA", "HS256"} {
+		t.Run(alg, func(t *testing.T) {
+			r := require.New(t)
+			dir, err := ioutil.TempDir("", "tokenauth")
+			r.NoError(err)
+			defer os.RemoveAll(dir)
+
+			out := &bytes.Buffer{}
+			r.NoError(runKeys([]string{"--alg", alg, "--dir", dir}, out))
+			if strings.HasPrefix(alg, "HS") {
+				secret := strings.TrimPrefix(strings.TrimSpace(out.String()), "JWT_SECRET_BASE64=")
+				envy.Set("JWT_SECRET_BASE64", secret)
+				defer envy.Set("JWT_SECRET_BASE64", "")
+			} else {
+				envy.Set("JWT_PUBLIC_KEY", filepath.Join(dir, "public.pem"))
+				defer envy.Set("JWT_PUBLIC_KEY", "")
+				// existing keys are kept
+				r.Error(runKeys([]string{"--alg", alg, "--dir", dir}, out))
+			}
+
+			out.Reset()
+			r.NoError(runToken([]string{"--alg", alg, "--key", filepath.Join(dir, "private.pem"), "--claims", `{"sub":"1"}`}, out))
+			token := strings.TrimSpace(out.String())
+
+			// the middleware verifies the token with the generated key
+			a := buffalo.New(buffalo.Options{})
+			a.Use(tokenauth.New(tokenauth.Options{SignMethod: jwt.GetSigningMethod(alg)}))
+			a.GET("/", func(c buffalo.Context) error {
+				return c.Render(200, nil)
+			})
+			req := httptest.New(a).HTML("/")
+			req.Headers["Authorization"] = "Bearer " + token
+			r.Equal(http.StatusOK, req.Get().Code)
+		})
+	}
+}
+
+func TestTokenErrors(t *testing.T) {
+	r := require.New(t)
+	out := &bytes.Buffer{}
+	r.Error(runKeys([]string{"--alg", "XX256"}, out))
+	r.Error(runToken([]string{"--alg", "RS256", "--key", ""}, out))
+	r.Error(runToken([]string{"--alg", "HS256", "--claims", "{"}, out))
+}
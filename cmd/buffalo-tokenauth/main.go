@@ -0,0 +1,135 @@
+// Command buffalo-tokenauth is a buffalo plugin scaffolding the tokenauth middleware into an app
+//
+// Installing the plugin
+//
+//	go get github.com/gobuffalo/mw-tokenauth/v2/cmd/buffalo-tokenauth
+//
+// Generating the wiring, actions, keys and example tests from the root of a buffalo app
+//
+//	buffalo generate tokenauth
+//
+// Diagnosing the key configuration, optionally fetching a JWKS and validating a sample token
+//
+//	buffalo tokenauth doctor --method RS256 --token eyJhbGciOi...
+//
+// Generating keys for a signing method, and signing a token for local development
+//
+//	buffalo tokenauth keys --alg ES256
+//	buffalo tokenauth token --alg ES256 --key config/jwt/private.pem --claims '{"sub":"1"}'
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command describes a plugin command to the buffalo cli
+type command struct {
+	Name           string `json:"name"`
+	UseCommand     string `json:"use_command"`
+	BuffaloCommand string `json:"buffalo_command"`
+	Description    string `json:"description"`
+}
+
+var available = []command{
+	{
+		Name:           "tokenauth",
+		UseCommand:     "generate",
+		BuffaloCommand: "generate",
+		Description:    "scaffolds tokenauth middleware wiring, auth actions, keys and tests",
+	},
+	{
+		Name:           "tokenauth",
+		UseCommand:     "doctor",
+		BuffaloCommand: "root",
+		Description:    "diagnoses the tokenauth configuration of the app",
+	},
+	{
+		Name:           "tokenauth",
+		UseCommand:     "keys",
+		BuffaloCommand: "root",
+		Description:    "generates a key pair or secret for a signing method",
+	},
+	{
+		Name:           "tokenauth",
+		UseCommand:     "token",
+		BuffaloCommand: "root",
+		Description:    "signs a token with the claims for local development",
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+	switch os.Args[1] {
+	case "available":
+		if err := json.NewEncoder(os.Stdout).Encode(available); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "generate":
+		if err := runGenerate(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "doctor":
+		ok, err := runDoctor(os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	case "keys":
+		if err := runKeys(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "token":
+		if err := runToken(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
+
+func runGenerate(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	opts := generateOptions{}
+	flags.StringVar(&opts.Root, "root", ".", "root directory of the buffalo app")
+	flags.StringVar(&opts.KeysDir, "keys-dir", "config/jwt", "directory the key pair is written to, relative to root")
+	flags.BoolVar(&opts.Force, "force", false, "overwrite existing files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	// buffalo passes the name of the generator as first argument
+	if flags.NArg() > 0 && flags.Arg(0) != "tokenauth" {
+		return fmt.Errorf("unknown generator %q", flags.Arg(0))
+	}
+	files, err := generate(opts)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Println("create", f)
+	}
+	fmt.Println("\nprotect your routes with the generated middleware:")
+	fmt.Println("  api := app.Group(\"/api\")")
+	fmt.Println("  api.Use(TokenAuth())")
+	fmt.Println("  app.POST(\"/auth/login\", AuthLogin)")
+	fmt.Println("  app.POST(\"/auth/refresh\", AuthRefresh)")
+	fmt.Println("  api.DELETE(\"/auth/logout\", AuthLogout)")
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: buffalo-tokenauth available|generate|doctor|keys|token [flags]")
+}
@@ -0,0 +1,214 @@
+package main
+
+const actionsTmpl = `package actions
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// revoker keeps the revoked tokens until they expire
+// TODO: use store.NewRevoker with store/redis when running several instances
+var revoker = tokenauth.NewMemoryRevoker()
+
+// TokenAuth returns the token authentication middleware,
+// tokens are verified with the public key in JWT_PUBLIC_KEY ({{.PublicKey}})
+func TokenAuth() buffalo.MiddlewareFunc {
+	return tokenauth.New(tokenauth.Options{
+		SignMethod:     jwt.SigningMethodRS256,
+		Revoker:        revoker,
+		ValidateClaims: rejectRefreshTokens,
+	})
+}
+
+// rejectRefreshTokens rejects refresh tokens, they are signed with the same
+// key as access tokens but are only exchanged for new tokens with AuthRefresh
+func rejectRefreshTokens(c buffalo.Context, claims jwt.Claims) error {
+	if mc, ok := claims.(jwt.MapClaims); ok && mc["typ"] == "refresh" {
+		return tokenauth.ErrTokenInvalid
+	}
+	return nil
+}
+
+// authenticate checks the credentials and returns the subject of the token
+// TODO: replace with a lookup in your user store
+func authenticate(c buffalo.Context, login, password string) (string, error) {
+	return "", errors.New("authenticate is not implemented")
+}
+
+// AuthLogin checks the posted credentials and responds with a token pair
+func AuthLogin(c buffalo.Context) error {
+	sub, err := authenticate(c, c.Param("login"), c.Param("password"))
+	if err != nil {
+		return c.Error(http.StatusUnauthorized, err)
+	}
+	return renderTokens(c, sub)
+}
+
+// AuthRefresh exchanges a refresh token for a new token pair,
+// the refresh token is revoked so it can be used once
+func AuthRefresh(c buffalo.Context) error {
+	claims, err := refreshClaims(c)
+	if err != nil {
+		return c.Error(http.StatusUnauthorized, err)
+	}
+	if err := revokeToken(c, claims); err != nil {
+		return errors.WithStack(err)
+	}
+	sub, _ := claims["sub"].(string)
+	return renderTokens(c, sub)
+}
+
+// AuthLogout revokes the access token of the caller and the posted refresh token,
+// it must be used behind TokenAuth
+func AuthLogout(c buffalo.Context) error {
+	if c.Param("refresh_token") != "" {
+		claims, err := refreshClaims(c)
+		if err != nil {
+			return c.Error(http.StatusUnauthorized, err)
+		}
+		if err := revokeToken(c, claims); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return tokenauth.LogoutHandler(revoker)(c)
+}
+
+// refreshClaims verifies the posted refresh token and returns its claims
+func refreshClaims(c buffalo.Context) (jwt.MapClaims, error) {
+	key, err := tokenauth.GetKeyRSA(jwt.SigningMethodRS256)
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(c.Param("refresh_token"), claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+			return nil, tokenauth.ErrBadSigningMethod
+		}
+		return key, nil
+	})
+	if err != nil || claims["typ"] != "refresh" {
+		return nil, tokenauth.ErrTokenInvalid
+	}
+	revoked, err := revoker.IsRevoked(c, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, tokenauth.ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// revokeToken revokes the token of the claims until it expires
+func revokeToken(c buffalo.Context, claims jwt.MapClaims) error {
+	exp, _ := tokenauth.ExpiresAt(claims)
+	return revoker.Revoke(c, tokenauth.TokenID(claims), exp)
+}
+
+func renderTokens(c buffalo.Context, sub string) error {
+	access, err := signToken(jwt.MapClaims{"sub": sub}, accessTokenTTL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	refresh, err := signToken(jwt.MapClaims{"sub": sub, "typ": "refresh"}, refreshTokenTTL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.Render(http.StatusOK, r.JSON(map[string]interface{}{
+		"access_token":  access,
+		"refresh_token": refresh,
+		"token_type":    "Bearer",
+		"expires_in":    int(accessTokenTTL.Seconds()),
+	}))
+}
+
+// signToken signs the claims with the private key in JWT_PRIVATE_KEY ({{.PrivateKey}}),
+// the token gets an iat, exp and jti claim
+func signToken(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	keyFile, err := envy.MustGet("JWT_PRIVATE_KEY")
+	if err != nil {
+		return "", err
+	}
+	keyData, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(keyData)
+	if err != nil {
+		return "", err
+	}
+	issuer := tokenauth.Issuer{SignMethod: jwt.SigningMethodRS256, Key: key, TTL: ttl}
+	return issuer.Issue(claims)
+}
+`
+
+const actionsTestTmpl = `package actions
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func tokenAuthApp(t *testing.T) *buffalo.App {
+	// tests run from the actions directory, the keys live in the app root
+	envy.Set("JWT_PRIVATE_KEY", filepath.Join("..", "{{.PrivateKey}}"))
+	envy.Set("JWT_PUBLIC_KEY", filepath.Join("..", "{{.PublicKey}}"))
+	if _, err := os.Stat(envy.Get("JWT_PUBLIC_KEY", "")); err != nil {
+		t.Skip("key pair not found, run buffalo generate tokenauth")
+	}
+	a := buffalo.New(buffalo.Options{})
+	a.Use(TokenAuth())
+	a.GET("/", func(c buffalo.Context) error {
+		claims := c.Value("claims").(jwt.MapClaims)
+		return c.Render(http.StatusOK, r.String(claims["sub"].(string)))
+	})
+	return a
+}
+
+func Test_TokenAuth(t *testing.T) {
+	r := require.New(t)
+	w := httptest.New(tokenAuthApp(t))
+
+	// missing token
+	res := w.HTML("/").Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+
+	// valid token
+	token, err := signToken(jwt.MapClaims{"sub": "42"}, accessTokenTTL)
+	r.NoError(err)
+	req := w.HTML("/")
+	req.Headers["Authorization"] = fmt.Sprintf("Bearer %s", token)
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("42", res.Body.String())
+
+	// refresh tokens are not accepted as access tokens
+	refresh, err := signToken(jwt.MapClaims{"sub": "42", "typ": "refresh"}, refreshTokenTTL)
+	r.NoError(err)
+	req = w.HTML("/")
+	req.Headers["Authorization"] = fmt.Sprintf("Bearer %s", refresh)
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+}
+`
@@ -0,0 +1,125 @@
+// Package conformance is a suite of token vectors verifying that a token
+// middleware accepts and rejects tokens like tokenauth does: one valid and one
+// expired token per algorithm, claim edge cases (large and float exp, string and
+// array aud) and malformed inputs. Forks of the middleware and implementations
+// of key providers run it from their tests.
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, func(method jwt.SigningMethod, key interface{}) buffalo.MiddlewareFunc {
+//			return tokenauth.New(tokenauth.Options{
+//				SignMethod: method,
+//				GetKey: func(jwt.SigningMethod) (interface{}, error) {
+//					return key, nil
+//				},
+//			})
+//		})
+//	}
+package conformance
+
+//go:generate go run gen.go
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// Vector is a token and how the middleware is expected to treat it
+type Vector struct {
+	Name string
+	// Alg is the signing method the middleware is configured with
+	Alg string
+	// Key is the verification key, the secret for HMAC or a PEM encoded public key
+	Key   string
+	Token string
+	// Status is the expected response status
+	Status int
+	// Claims is the JSON of the claims the middleware sets for accepted tokens
+	Claims string
+}
+
+// Vectors returns the token vectors of the suite
+func Vectors() []Vector {
+	return append([]Vector(nil), vectors...)
+}
+
+// Method returns the signing method of the vector
+func (v Vector) Method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(v.Alg)
+}
+
+// VerificationKey returns the parsed key the vector is verified with
+func (v Vector) VerificationKey() (interface{}, error) {
+	switch v.Method().(type) {
+	case *jwt.SigningMethodHMAC:
+		return []byte(v.Key), nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		return jwt.ParseRSAPublicKeyFromPEM([]byte(v.Key))
+	case *jwt.SigningMethodECDSA:
+		return jwt.ParseECPublicKeyFromPEM([]byte(v.Key))
+	case *jwt.SigningMethodEd25519:
+		return jwt.ParseEdPublicKeyFromPEM([]byte(v.Key))
+	}
+	return nil, errors.Errorf("unsupported algorithm %s", v.Alg)
+}
+
+// Middleware returns the middleware under test, verifying
+// tokens signed with method with the key
+type Middleware func(method jwt.SigningMethod, key interface{}) buffalo.MiddlewareFunc
+
+// Run runs every vector as a subtest against the middleware, which is expected
+// to read the token from the Authorization header with the Bearer scheme and
+// to store the claims in the context under "claims". The vectors of sign
+// methods the middleware doesn't support are skipped if mw returns nil.
+func Run(t *testing.T, mw Middleware) {
+	for _, v := range vectors {
+		v := v
+		t.Run(v.Name, func(t *testing.T) {
+			runVector(t, mw, v)
+		})
+	}
+}
+
+func runVector(t *testing.T, mw Middleware, v Vector) {
+	key, err := v.VerificationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	middleware := mw(v.Method(), key)
+	if middleware == nil {
+		t.Skipf("sign method %s not supported", v.Alg)
+	}
+	app := buffalo.New(buffalo.Options{})
+	app.Use(middleware)
+	app.GET("/", func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, render.JSON(c.Value("claims")))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+v.Token)
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, req)
+	if res.Code != v.Status {
+		t.Fatalf("status %d, expected %d: %s", res.Code, v.Status, res.Body.String())
+	}
+	if v.Status != http.StatusOK {
+		return
+	}
+	var got, want interface{}
+	if err := json.Unmarshal(res.Body.Bytes(), &got); err != nil {
+		t.Fatalf("claims response %q: %v", res.Body.String(), err)
+	}
+	if err := json.Unmarshal([]byte(v.Claims), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("claims %s, expected %s", res.Body.String(), v.Claims)
+	}
+}
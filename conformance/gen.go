@@ -0,0 +1,184 @@
+//go:build ignore
+// +build ignore
+
+// gen generates the token vectors of the conformance suite, run with go generate.
+// Tokens are signed with the keys in test_certs, HMAC, RS256 and EdDSA signatures
+// are deterministic, ES256 and PS256 tokens change on every run but stay valid.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	secret = "conformance-secret"
+	// 2100-01-01, far enough in the future for the vectors to stay valid
+	future = 4102444800
+	// 2000-01-01
+	past = 946684800
+)
+
+type vector struct {
+	Name   string
+	Alg    string
+	Key    string
+	Token  string
+	Status int
+	Claims string
+}
+
+type signer struct {
+	method  jwt.SigningMethod
+	private interface{}
+	public  string
+}
+
+func main() {
+	signers := map[string]signer{
+		"HS256": {jwt.SigningMethodHS256, []byte(secret), secret},
+		"RS256": {jwt.SigningMethodRS256, rsaKey(), read("sample_key.pub")},
+		"PS256": {jwt.SigningMethodPS256, rsaKey(), read("sample_key.pub")},
+		"ES256": {jwt.SigningMethodES256, ecKey(), read("ec256-public.pem")},
+		"EdDSA": {jwt.SigningMethodEdDSA, edKey(), read("ed25519-public.pem")},
+	}
+	var vectors []vector
+	valid := func(name, alg string, claims jwt.MapClaims) {
+		s := signers[alg]
+		vectors = append(vectors, vector{name, alg, s.public, sign(s, claims), http.StatusOK, marshal(claims)})
+	}
+	// validAs vectors are accepted with normalized claims
+	validAs := func(name, alg string, claims, normalized jwt.MapClaims) {
+		s := signers[alg]
+		vectors = append(vectors, vector{name, alg, s.public, sign(s, claims), http.StatusOK, marshal(normalized)})
+	}
+	invalid := func(name, alg, token string) {
+		vectors = append(vectors, vector{name, alg, signers[alg].public, token, http.StatusUnauthorized, ""})
+	}
+	signed := func(alg string, claims jwt.MapClaims) string {
+		return sign(signers[alg], claims)
+	}
+
+	// every algorithm
+	for _, alg := range []string{"HS256", "RS256", "PS256", "ES256", "EdDSA"} {
+		valid(alg+"/valid", alg, jwt.MapClaims{"sub": "conformance", "exp": future})
+		invalid(alg+"/expired", alg, signed(alg, jwt.MapClaims{"sub": "conformance", "exp": past}))
+	}
+
+	// claim edge cases
+	valid("claims/no-exp", "HS256", jwt.MapClaims{"sub": "conformance"})
+	valid("claims/large-exp", "HS256", jwt.MapClaims{"exp": 253402300799})
+	valid("claims/float-exp", "HS256", jwt.MapClaims{"exp": future + 0.5})
+	invalid("claims/float-exp-expired", "HS256", signed("HS256", jwt.MapClaims{"exp": past + 0.5}))
+	validAs("claims/string-exp", "HS256", jwt.MapClaims{"exp": fmt.Sprint(future)}, jwt.MapClaims{"exp": future})
+	validAs("claims/float-string-exp", "HS256", jwt.MapClaims{"exp": fmt.Sprint(future + 0.5)}, jwt.MapClaims{"exp": future + 0.5})
+	invalid("claims/string-exp-expired", "HS256", signed("HS256", jwt.MapClaims{"exp": fmt.Sprint(past)}))
+	valid("claims/string-aud", "HS256", jwt.MapClaims{"aud": "api", "exp": future})
+	valid("claims/array-aud", "HS256", jwt.MapClaims{"aud": []string{"api", "admin"}, "exp": future})
+	valid("claims/nested", "HS256", jwt.MapClaims{"exp": future, "roles": []string{"admin"}, "meta": map[string]interface{}{"tenant": "a"}})
+	invalid("claims/nbf-future", "HS256", signed("HS256", jwt.MapClaims{"nbf": future}))
+	invalid("claims/iat-future", "HS256", signed("HS256", jwt.MapClaims{"iat": future}))
+
+	// malformed inputs
+	token := signed("HS256", jwt.MapClaims{"sub": "conformance", "exp": future})
+	other := signed("HS256", jwt.MapClaims{"sub": "other", "exp": future})
+	parts := strings.Split(token, ".")
+	invalid("malformed/garbage", "HS256", "not-a-token")
+	invalid("malformed/two-segments", "HS256", parts[0]+"."+parts[1])
+	invalid("malformed/four-segments", "HS256", token+".x")
+	invalid("malformed/empty-segments", "HS256", "..")
+	invalid("malformed/bad-base64", "HS256", "!!!."+parts[1]+"."+parts[2])
+	invalid("malformed/bad-json", "HS256", "eyJhbGciOiJIUzI1NiJ9.bm90IGpzb24."+parts[2])
+	invalid("malformed/swapped-signature", "HS256", parts[0]+"."+parts[1]+"."+strings.Split(other, ".")[2])
+
+	// algorithm confusion
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"exp": future}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	check(err)
+	invalid("alg/none", "HS256", none)
+	invalid("alg/mismatch", "HS256", signed("RS256", jwt.MapClaims{"exp": future}))
+	// HMAC signed with the public key, accepted by verifiers which don't check the alg
+	confused, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": future}).SignedString([]byte(read("sample_key.pub")))
+	check(err)
+	invalid("alg/hmac-with-public-key", "RS256", confused)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "// Code generated by gen.go. DO NOT EDIT.")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "package conformance")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "var vectors = []Vector{")
+	for _, v := range vectors {
+		fmt.Fprintf(buf, "{Name: %q, Alg: %q, Key: %s, Token: %q, Status: %d, Claims: %q},\n",
+			v.Name, v.Alg, key(v.Key), v.Token, v.Status, v.Claims)
+	}
+	fmt.Fprintln(buf, "}")
+	src, err := format.Source(buf.Bytes())
+	check(err)
+	check(ioutil.WriteFile("vectors.go", src, 0644))
+}
+
+// key refers to the key constants of the suite
+func key(k string) string {
+	switch k {
+	case secret:
+		return "hmacSecret"
+	case read("sample_key.pub"):
+		return "rsaPublicKey"
+	case read("ec256-public.pem"):
+		return "ecPublicKey"
+	case read("ed25519-public.pem"):
+		return "edPublicKey"
+	}
+	log.Fatalf("unknown key %q", k)
+	return ""
+}
+
+func sign(s signer, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(s.method, claims).SignedString(s.private)
+	check(err)
+	return token
+}
+
+func marshal(claims jwt.MapClaims) string {
+	data, err := json.Marshal(claims)
+	check(err)
+	return string(data)
+}
+
+func read(name string) string {
+	data, err := ioutil.ReadFile("../test_certs/" + name)
+	check(err)
+	return string(data)
+}
+
+func rsaKey() interface{} {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(read("sample_key")))
+	check(err)
+	return key
+}
+
+func ecKey() interface{} {
+	key, err := jwt.ParseECPrivateKeyFromPEM([]byte(read("ec256-private.pem")))
+	check(err)
+	return key
+}
+
+func edKey() interface{} {
+	key, err := jwt.ParseEdPrivateKeyFromPEM([]byte(read("ed25519-private.pem")))
+	check(err)
+	return key
+}
+
+func check(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,42 @@
+package tokenauth_test
+
+import (
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/gobuffalo/mw-tokenauth/v2/conformance"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(method jwt.SigningMethod, key interface{}) buffalo.MiddlewareFunc {
+		return tokenauth.New(tokenauth.Options{
+			SignMethod: method,
+			GetKey: func(jwt.SigningMethod) (interface{}, error) {
+				return key, nil
+			},
+		})
+	})
+}
+
+// the vectors are identical across the backends
+func TestConformanceCryptoBackends(t *testing.T) {
+	for _, backend := range tokenauth.CryptoBackends() {
+		backend := backend
+		t.Run(backend.Name(), func(t *testing.T) {
+			conformance.Run(t, func(method jwt.SigningMethod, key interface{}) buffalo.MiddlewareFunc {
+				if backend.SigningMethod(method.Alg()) == nil {
+					return nil
+				}
+				return tokenauth.New(tokenauth.Options{
+					SignMethod:    method,
+					CryptoBackend: backend,
+					GetKey: func(jwt.SigningMethod) (interface{}, error) {
+						return key, nil
+					},
+				})
+			})
+		})
+	}
+}
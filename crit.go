@@ -0,0 +1,51 @@
+package tokenauth
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupportedCrit is returned if the token has critical header parameters which aren't understood
+var ErrUnsupportedCrit = errors.New("unsupported critical header parameter")
+
+// CritHandler validates the value of a custom critical header parameter of a verified token
+type CritHandler func(c buffalo.Context, token *jwt.Token, value interface{}) error
+
+// registeredHeaders are the header parameters of RFC 7515 and RFC 7516,
+// which must not be listed as critical
+var registeredHeaders = map[string]bool{
+	"alg": true, "jku": true, "jwk": true, "kid": true, "x5u": true, "x5c": true, "x5t": true,
+	"x5t#S256": true, "typ": true, "cty": true, "crit": true, "enc": true, "zip": true,
+}
+
+// checkCrit rejects tokens with critical header parameters which have no
+// CritHandler, and runs the handlers of the others, RFC 7515 section 4.1.11
+func checkCrit(c buffalo.Context, token *jwt.Token, options Options) error {
+	crit, ok := token.Header["crit"]
+	if !ok {
+		return nil
+	}
+	names, ok := crit.([]interface{})
+	if !ok || len(names) == 0 {
+		return errors.Wrap(ErrUnsupportedCrit, "crit is not a list of header parameters")
+	}
+	for _, n := range names {
+		name, ok := n.(string)
+		if !ok || registeredHeaders[name] {
+			return errors.Wrapf(ErrUnsupportedCrit, "%v", n)
+		}
+		handler, ok := options.Crit[name]
+		if !ok {
+			return errors.Wrap(ErrUnsupportedCrit, name)
+		}
+		value, ok := token.Header[name]
+		if !ok {
+			return errors.Wrapf(ErrUnsupportedCrit, "%s is missing", name)
+		}
+		if err := handler(c, token, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
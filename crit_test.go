@@ -0,0 +1,66 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrit(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		Crit: map[string]tokenauth.CritHandler{
+			// the token is bound to the tenant of the host
+			"tenant": func(c buffalo.Context, token *jwt.Token, value interface{}) error {
+				if value != "acme" {
+					return errors.New("token of another tenant")
+				}
+				return nil
+			},
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String("ok"))
+	})
+	w := httptest.New(a)
+
+	sign := func(header map[string]interface{}) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()})
+		for k, v := range header {
+			token.Header[k] = v
+		}
+		tokenString, err := token.SignedString([]byte("secret"))
+		r.NoError(err)
+		return tokenString
+	}
+	for _, tt := range []struct {
+		header map[string]interface{}
+		status int
+	}{
+		{nil, http.StatusOK},
+		{map[string]interface{}{"tenant": "other"}, http.StatusOK},
+		{map[string]interface{}{"crit": []string{"tenant"}, "tenant": "acme"}, http.StatusOK},
+		{map[string]interface{}{"crit": []string{"tenant"}, "tenant": "other"}, http.StatusUnauthorized},
+		{map[string]interface{}{"crit": []string{"tenant"}}, http.StatusUnauthorized},
+		// RFC 7797 unencoded payloads are not supported
+		{map[string]interface{}{"crit": []string{"b64"}, "b64": false}, http.StatusUnauthorized},
+		{map[string]interface{}{"crit": []string{"tenant", "exp"}, "tenant": "acme", "exp": 1}, http.StatusUnauthorized},
+		{map[string]interface{}{"crit": []string{"alg"}}, http.StatusUnauthorized},
+		{map[string]interface{}{"crit": []string{}}, http.StatusUnauthorized},
+		{map[string]interface{}{"crit": "tenant", "tenant": "acme"}, http.StatusUnauthorized},
+	} {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + sign(tt.header)
+		r.Equal(tt.status, req.Get().Code, tt.header)
+	}
+}
@@ -0,0 +1,68 @@
+package tokenauth
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// CryptoBackend implements the signature verification of the sign methods,
+// e.g. for verification heavy deployments or FIPS builds. Backends beside
+// StdCrypto are gated by build tags, CryptoBackends lists the ones built in.
+type CryptoBackend interface {
+	// Name of the backend, e.g. "std"
+	Name() string
+	// SigningMethod returns the implementation of the alg,
+	// nil if the backend doesn't implement it
+	SigningMethod(alg string) jwt.SigningMethod
+}
+
+// StdCrypto verifies signatures with the sign methods of jwt-go,
+// which use the Go standard library. It is the default backend.
+var StdCrypto CryptoBackend = stdCrypto{}
+
+// backends are the backends built in
+var backends = []CryptoBackend{StdCrypto}
+
+// CryptoBackends returns the backends built in, e.g. for running the
+// conformance vectors against every backend
+func CryptoBackends() []CryptoBackend {
+	return append([]CryptoBackend(nil), backends...)
+}
+
+type stdCrypto struct{}
+
+func (stdCrypto) Name() string {
+	return "std"
+}
+
+func (stdCrypto) SigningMethod(alg string) jwt.SigningMethod {
+	return jwt.GetSigningMethod(alg)
+}
+
+// parseWith parses the token and verifies its signature with the sign method
+// of the backend, errors are reported like by jwt.Parser.Parse
+func parseWith(backend CryptoBackend, tokenString string, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
+	token, parts, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return token, err
+	}
+	method := backend.SigningMethod(token.Method.Alg())
+	if method == nil {
+		return token, &jwt.ValidationError{Inner: ErrBadSigningMethod, Errors: jwt.ValidationErrorUnverifiable}
+	}
+	token.Method = method
+	key, err := keyFunc(token)
+	if err != nil {
+		if verr, ok := err.(*jwt.ValidationError); ok {
+			return token, verr
+		}
+		return token, &jwt.ValidationError{Inner: err, Errors: jwt.ValidationErrorUnverifiable}
+	}
+	token.Signature = parts[2]
+	if err := method.Verify(strings.Join(parts[0:2], "."), token.Signature, key); err != nil {
+		return token, &jwt.ValidationError{Inner: err, Errors: jwt.ValidationErrorSignatureInvalid}
+	}
+	token.Valid = true
+	return token, nil
+}
@@ -0,0 +1,37 @@
+//go:build boringcrypto
+// +build boringcrypto
+
+package tokenauth
+
+import (
+	"crypto/boring"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// BoringCrypto verifies HMAC, RSA and ECDSA signatures with BoringSSL, it is
+// built into binaries built with GOEXPERIMENT=boringcrypto. Go doesn't verify
+// Ed25519 with BoringSSL, so EdDSA tokens are not supported.
+var BoringCrypto CryptoBackend = boringCrypto{}
+
+func init() {
+	backends = append(backends, BoringCrypto)
+}
+
+type boringCrypto struct{}
+
+func (boringCrypto) Name() string {
+	return "boringcrypto"
+}
+
+func (boringCrypto) SigningMethod(alg string) jwt.SigningMethod {
+	if !boring.Enabled() {
+		return nil
+	}
+	// the crypto packages of the standard library call into BoringSSL
+	switch method := jwt.GetSigningMethod(alg).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA, *jwt.SigningMethodHMAC:
+		return method
+	}
+	return nil
+}
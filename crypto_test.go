@@ -0,0 +1,70 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// hmacOnly implements HS256 only and counts the verifications
+type hmacOnly struct {
+	verified *int
+}
+
+func (hmacOnly) Name() string {
+	return "hmac-only"
+}
+
+func (b hmacOnly) SigningMethod(alg string) jwt.SigningMethod {
+	if alg != "HS256" {
+		return nil
+	}
+	return countingMethod{jwt.SigningMethodHS256, b.verified}
+}
+
+type countingMethod struct {
+	jwt.SigningMethod
+	verified *int
+}
+
+func (m countingMethod) Verify(signingString, signature string, key interface{}) error {
+	*m.verified++
+	return m.SigningMethod.Verify(signingString, signature, key)
+}
+
+func TestCryptoBackend(t *testing.T) {
+	r := require.New(t)
+	verified := 0
+	backend := hmacOnly{verified: &verified}
+
+	_, err := tokenauth.NewWithError(tokenauth.Options{
+		SignMethod:    jwt.SigningMethodRS256,
+		CryptoBackend: backend,
+		KeyFunc:       tokenauth.StaticKey(rsaTestKey(t)),
+	})
+	r.EqualError(err, "crypto backend hmac-only doesn't implement RS256")
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		CryptoBackend: backend,
+		KeyFunc:       tokenauth.StaticKey([]byte("secret")),
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+	req.Headers["Authorization"] = "Bearer " + signWith(claims, "other-secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+	r.Equal(2, verified)
+}
@@ -0,0 +1,166 @@
+package tokenauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gobuffalo/envy"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DiagnosticStatus is the outcome of a single Doctor check
+type DiagnosticStatus string
+
+const (
+	// DiagnosticOK is reported for checks that passed
+	DiagnosticOK DiagnosticStatus = "ok"
+	// DiagnosticWarn is reported for setups that work but are likely wrong
+	DiagnosticWarn DiagnosticStatus = "warn"
+	// DiagnosticFail is reported for setups that will reject every token
+	DiagnosticFail DiagnosticStatus = "fail"
+)
+
+// Diagnostic is a single finding reported by Doctor
+type Diagnostic struct {
+	Status DiagnosticStatus
+	Check  string
+	Detail string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("[%s] %s: %s", d.Status, d.Check, d.Detail)
+}
+
+// DoctorOptions for Doctor
+type DoctorOptions struct {
+	// SignMethod the middleware is configured with, defaults to HS256
+	SignMethod jwt.SigningMethod
+	// JWKSURL if set, the key set is fetched and inspected
+	JWKSURL string
+	// Token if set, is validated with the configured key
+	Token string
+}
+
+// Doctor inspects the environment the default key loaders read from, attempts to load the key,
+// fetches the JWKS and validates the sample token if provided, reporting actionable diagnostics.
+func Doctor(opts DoctorOptions) []Diagnostic {
+	if opts.SignMethod == nil {
+		opts.SignMethod = jwt.SigningMethodHS256
+	}
+	diags := []Diagnostic{{DiagnosticOK, "sign method", opts.SignMethod.Alg()}}
+	diags = append(diags, checkKeyEnv(opts.SignMethod)...)
+
+	key, err := selectGetKeyFunc(opts.SignMethod)(opts.SignMethod)
+	if err != nil {
+		diags = append(diags, Diagnostic{DiagnosticFail, "key", fmt.Sprintf("couldn't load key: %s", err)})
+	} else {
+		diags = append(diags, Diagnostic{DiagnosticOK, "key", fmt.Sprintf("loaded %T", key)})
+	}
+
+	if opts.JWKSURL != "" {
+		diags = append(diags, checkJWKS(opts.JWKSURL))
+	}
+	if opts.Token != "" {
+		diags = append(diags, checkToken(opts.Token, opts.SignMethod, key))
+	}
+	return diags
+}
+
+// checkKeyEnv checks the env variables read by the default GetKey funcs
+func checkKeyEnv(method jwt.SigningMethod) []Diagnostic {
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		if encoded := envy.Get("JWT_SECRET_BASE64", ""); encoded != "" {
+			secret, err := decodeBase64(encoded)
+			switch {
+			case err != nil:
+				return []Diagnostic{{DiagnosticFail, "JWT_SECRET_BASE64", err.Error()}}
+			case len(secret) < 32:
+				return []Diagnostic{{DiagnosticWarn, "JWT_SECRET_BASE64", fmt.Sprintf("only %d bytes long, use at least 32 bytes", len(secret))}}
+			}
+			return []Diagnostic{{DiagnosticOK, "JWT_SECRET_BASE64", "set"}}
+		}
+		secret := envy.Get("JWT_SECRET", "")
+		switch {
+		case secret == "":
+			return []Diagnostic{{DiagnosticFail, "JWT_SECRET", "not set"}}
+		case len(secret) < 32:
+			return []Diagnostic{{DiagnosticWarn, "JWT_SECRET", fmt.Sprintf("only %d bytes long, use at least 32 bytes", len(secret))}}
+		}
+		return []Diagnostic{{DiagnosticOK, "JWT_SECRET", "set"}}
+	}
+	file := envy.Get("JWT_PUBLIC_KEY", "")
+	if file == "" {
+		return []Diagnostic{{DiagnosticFail, "JWT_PUBLIC_KEY", "not set, it must point to the public key file or contain the key"}}
+	}
+	if isInlineKey(file) {
+		return []Diagnostic{{DiagnosticOK, "JWT_PUBLIC_KEY", "inline key"}}
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return []Diagnostic{{DiagnosticFail, "JWT_PUBLIC_KEY", fmt.Sprintf("%s: %s", file, err)}}
+	}
+	if info.IsDir() {
+		return []Diagnostic{{DiagnosticFail, "JWT_PUBLIC_KEY", fmt.Sprintf("%s is a directory", file)}}
+	}
+	return []Diagnostic{{DiagnosticOK, "JWT_PUBLIC_KEY", file}}
+}
+
+// checkJWKS fetches the key set and reports the keys it contains
+func checkJWKS(url string) Diagnostic {
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return Diagnostic{DiagnosticFail, "jwks", err.Error()}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Diagnostic{DiagnosticFail, "jwks", fmt.Sprintf("%s responded with %s", url, res.Status)}
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return Diagnostic{DiagnosticFail, "jwks", err.Error()}
+	}
+	set := struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Alg string `json:"alg"`
+		} `json:"keys"`
+	}{}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return Diagnostic{DiagnosticFail, "jwks", fmt.Sprintf("not a JWK set: %s", err)}
+	}
+	if len(set.Keys) == 0 {
+		return Diagnostic{DiagnosticFail, "jwks", "key set is empty"}
+	}
+	detail := fmt.Sprintf("%d keys:", len(set.Keys))
+	for _, k := range set.Keys {
+		detail += fmt.Sprintf(" kid=%s kty=%s alg=%s;", k.Kid, k.Kty, k.Alg)
+	}
+	return Diagnostic{DiagnosticOK, "jwks", detail}
+}
+
+// checkToken validates the sample token the same way the middleware does
+func checkToken(tokenString string, method jwt.SigningMethod, key interface{}) Diagnostic {
+	unverified, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return Diagnostic{DiagnosticFail, "token", fmt.Sprintf("malformed: %s", err)}
+	}
+	if unverified.Method.Alg() != method.Alg() {
+		return Diagnostic{DiagnosticFail, "token", fmt.Sprintf("signed with %s but the middleware expects %s", unverified.Method.Alg(), method.Alg())}
+	}
+	if key == nil {
+		return Diagnostic{DiagnosticWarn, "token", fmt.Sprintf("not verified since no key was loaded, claims: %v", unverified.Claims)}
+	}
+	_, err = jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) {
+		return key, nil
+	})
+	if err != nil {
+		return Diagnostic{DiagnosticFail, "token", err.Error()}
+	}
+	return Diagnostic{DiagnosticOK, "token", fmt.Sprintf("valid, claims: %v", unverified.Claims)}
+}
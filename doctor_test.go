@@ -0,0 +1,64 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/envy"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func statuses(diags []tokenauth.Diagnostic) map[string]tokenauth.DiagnosticStatus {
+	m := map[string]tokenauth.DiagnosticStatus{}
+	for _, d := range diags {
+		m[d.Check] = d.Status
+	}
+	return m
+}
+
+func TestDoctorHMAC(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+
+	s := statuses(tokenauth.Doctor(tokenauth.DoctorOptions{
+		Token: validToken(),
+	}))
+	r.Equal(tokenauth.DiagnosticWarn, s["JWT_SECRET"])
+	r.Equal(tokenauth.DiagnosticOK, s["key"])
+	r.Equal(tokenauth.DiagnosticOK, s["token"])
+
+	s = statuses(tokenauth.Doctor(tokenauth.DoctorOptions{
+		Token: "badcreds",
+	}))
+	r.Equal(tokenauth.DiagnosticFail, s["token"])
+}
+
+func TestDoctorRSA(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_PUBLIC_KEY", "test_certs/missing.pub")
+
+	s := statuses(tokenauth.Doctor(tokenauth.DoctorOptions{
+		SignMethod: jwt.SigningMethodRS256,
+		// HMAC signed token
+		Token: validToken(),
+	}))
+	r.Equal(tokenauth.DiagnosticFail, s["JWT_PUBLIC_KEY"])
+	r.Equal(tokenauth.DiagnosticFail, s["key"])
+	r.Equal(tokenauth.DiagnosticFail, s["token"])
+
+	envy.Set("JWT_PUBLIC_KEY", "test_certs/sample_key.pub")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[{"kid":"1","kty":"RSA","alg":"RS256"}]}`))
+	}))
+	defer ts.Close()
+	s = statuses(tokenauth.Doctor(tokenauth.DoctorOptions{
+		SignMethod: jwt.SigningMethodRS256,
+		JWKSURL:    ts.URL,
+	}))
+	r.Equal(tokenauth.DiagnosticOK, s["JWT_PUBLIC_KEY"])
+	r.Equal(tokenauth.DiagnosticOK, s["key"])
+	r.Equal(tokenauth.DiagnosticOK, s["jwks"])
+}
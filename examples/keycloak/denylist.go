@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Denylist holds the jti of revoked tokens in Redis, speaking the Redis
+// protocol directly to keep the example free of a Redis client
+type Denylist struct {
+	// Addr of the Redis server
+	Addr string
+}
+
+// Revoke adds the jti to the denylist for the ttl
+func (d *Denylist) Revoke(jti string, ttl time.Duration) error {
+	if jti == "" {
+		return errors.New("token has no jti")
+	}
+	seconds := int(ttl.Seconds()) + 1
+	reply, err := d.do("SET", "revoked:"+jti, "1", "EX", fmt.Sprint(seconds))
+	if err != nil {
+		return err
+	}
+	if reply != "+OK" {
+		return errors.Errorf("unexpected redis reply %q", reply)
+	}
+	return nil
+}
+
+// Revoked reports if the jti is on the denylist
+func (d *Denylist) Revoked(jti string) (bool, error) {
+	if jti == "" {
+		return false, nil
+	}
+	reply, err := d.do("EXISTS", "revoked:"+jti)
+	if err != nil {
+		return false, err
+	}
+	switch reply {
+	case ":1":
+		return true, nil
+	case ":0":
+		return false, nil
+	}
+	return false, errors.Errorf("unexpected redis reply %q", reply)
+}
+
+// do sends the command and returns the first line of the reply
+func (d *Denylist) do(args ...string) (string, error) {
+	conn, err := net.DialTimeout("tcp", d.Addr, 2*time.Second)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't connect to redis")
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := conn.Write([]byte(cmd)); err != nil {
+		return "", errors.Wrap(err, "couldn't send redis command")
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't read redis reply")
+	}
+	reply = strings.TrimRight(reply, "\r\n")
+	if strings.HasPrefix(reply, "-") {
+		return "", errors.Errorf("redis error: %s", reply[1:])
+	}
+	return reply, nil
+}
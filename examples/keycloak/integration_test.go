@@ -0,0 +1,163 @@
+//go:build integration
+// +build integration
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/client"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// the tests run against Keycloak and Redis of docker-compose.yml
+func TestMain(m *testing.M) {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// Keycloak takes a while to import the realm
+	deadline := time.Now().Add(3 * time.Minute)
+	for {
+		res, err := cfg.HTTPClient.Get(cfg.KeycloakURL + "/realms/" + cfg.Realm + "/.well-known/openid-configuration")
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			fmt.Println("Keycloak is not up, start it with docker compose up -d")
+			os.Exit(1)
+		}
+		time.Sleep(2 * time.Second)
+	}
+	os.Exit(m.Run())
+}
+
+type tokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// login returns the tokens of alice for the example-app
+func login(t *testing.T, cfg Config) tokenPair {
+	return tokenRequest(t, cfg, cfg.Realm, url.Values{
+		"grant_type": {"password"},
+		"client_id":  {cfg.ClientID},
+		"username":   {"alice"},
+		"password":   {"alice"},
+	})
+}
+
+func tokenRequest(t *testing.T, cfg Config, realm string, form url.Values) tokenPair {
+	res, err := cfg.HTTPClient.PostForm(cfg.KeycloakURL+"/realms/"+realm+"/protocol/openid-connect/token", form)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var tokens tokenPair
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&tokens))
+	return tokens
+}
+
+// call calls the app with the access token
+func call(t *testing.T, ts *httptest.Server, method, path, token string) *http.Response {
+	req, err := http.NewRequest(method, ts.URL+path, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	return res
+}
+
+func kid(t *testing.T, token string) string {
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestRefreshAndRevocation(t *testing.T) {
+	r := require.New(t)
+	cfg, err := ConfigFromEnv()
+	r.NoError(err)
+	ts := httptest.NewServer(App(cfg))
+	defer ts.Close()
+
+	tokens := login(t, cfg)
+	req, err := http.NewRequest("GET", ts.URL+"/api/me", nil)
+	r.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	res, err := ts.Client().Do(req)
+	r.NoError(err)
+	var me struct {
+		Username   string   `json:"username"`
+		RealmRoles []string `json:"realm_roles"`
+	}
+	r.NoError(json.NewDecoder(res.Body).Decode(&me))
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.Equal("alice", me.Username)
+	r.Contains(me.RealmRoles, "user")
+
+	// refresh through the app
+	source := client.NewRefreshSource(ts.URL+"/refresh", tokens.AccessToken, tokens.RefreshToken)
+	refreshed, err := source.Refresh()
+	r.NoError(err)
+	r.NotEqual(tokens.AccessToken, refreshed)
+	r.Equal(http.StatusOK, call(t, ts, "GET", "/api/me", refreshed).StatusCode)
+
+	// revocation
+	r.Equal(http.StatusNoContent, call(t, ts, "POST", "/api/logout", refreshed).StatusCode)
+	r.Equal(http.StatusUnauthorized, call(t, ts, "GET", "/api/me", refreshed).StatusCode)
+	r.Equal(http.StatusOK, call(t, ts, "GET", "/api/me", tokens.AccessToken).StatusCode)
+}
+
+func TestJWKSRotation(t *testing.T) {
+	r := require.New(t)
+	cfg, err := ConfigFromEnv()
+	r.NoError(err)
+	ts := httptest.NewServer(App(cfg))
+	defer ts.Close()
+
+	before := login(t, cfg).AccessToken
+	r.Equal(http.StatusOK, call(t, ts, "GET", "/api/me", before).StatusCode)
+	fetched := time.Now()
+
+	// add a key with a higher priority, Keycloak signs new tokens with it
+	admin := tokenRequest(t, cfg, "master", url.Values{
+		"grant_type": {"password"},
+		"client_id":  {"admin-cli"},
+		"username":   {"admin"},
+		"password":   {"admin"},
+	})
+	component := fmt.Sprintf(`{"name":"rotated-%d","providerId":"rsa-generated","providerType":"org.keycloak.keys.KeyProvider","parentId":%q,
+		"config":{"priority":["%d"],"enabled":["true"],"active":["true"],"keySize":["2048"],"algorithm":["RS256"]}}`,
+		time.Now().Unix(), cfg.Realm, time.Now().Unix())
+	req, err := http.NewRequest("POST", cfg.KeycloakURL+"/admin/realms/"+cfg.Realm+"/components", strings.NewReader(component))
+	r.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+admin.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := cfg.HTTPClient.Do(req)
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusCreated, res.StatusCode)
+
+	after := login(t, cfg).AccessToken
+	r.NotEqual(kid(t, before), kid(t, after))
+	// the key set is refetched for unknown kids at most once a minute
+	time.Sleep(time.Until(fetched.Add(time.Minute + time.Second)))
+	r.Equal(http.StatusOK, call(t, ts, "GET", "/api/me", after).StatusCode)
+	r.Equal(http.StatusOK, call(t, ts, "GET", "/api/me", before).StatusCode)
+}
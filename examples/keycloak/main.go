@@ -0,0 +1,159 @@
+// Command keycloak is an example app protected by the tokenauth middleware,
+// verifying the tokens of a Keycloak realm. Tokens are revoked on logout with
+// a denylist in Redis and refreshed through the app at /refresh.
+//
+// Starting Keycloak and Redis, the app and its integration tests
+//
+//	docker compose up -d
+//	go run .
+//	go test -tags=integration .
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrRevoked is returned for tokens revoked on logout
+var ErrRevoked = errors.New("token revoked")
+
+// Config of the app
+type Config struct {
+	// KeycloakURL is the URL of the Keycloak server
+	KeycloakURL string
+	Realm       string
+	// ClientID of the client refreshing tokens
+	ClientID string
+	// RedisAddr is the address of the Redis holding the denylist
+	RedisAddr string
+	// HTTPClient used to call Keycloak
+	HTTPClient *http.Client
+}
+
+// ConfigFromEnv returns the config of the env, defaulting
+// to Keycloak and Redis started with docker-compose.yml
+func ConfigFromEnv() (Config, error) {
+	client, err := httpClient(envy.Get("KEYCLOAK_CA", "certs/localhost.pem"))
+	if err != nil {
+		return Config{}, err
+	}
+	return Config{
+		KeycloakURL: envy.Get("KEYCLOAK_URL", "https://localhost:8443"),
+		Realm:       envy.Get("KEYCLOAK_REALM", "demo"),
+		ClientID:    envy.Get("KEYCLOAK_CLIENT_ID", "example-app"),
+		RedisAddr:   envy.Get("REDIS_ADDR", "localhost:6379"),
+		HTTPClient:  client,
+	}, nil
+}
+
+// httpClient returns a client trusting the certificate of the CA file
+func httpClient(caFile string) (*http.Client, error) {
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read Keycloak CA")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.Errorf("no certificates in %s", caFile)
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}, nil
+}
+
+// App returns the app
+func App(cfg Config) *buffalo.App {
+	oidc := tokenauth.NewKeycloakProvider(cfg.KeycloakURL, cfg.Realm)
+	oidc.Client = cfg.HTTPClient
+	denylist := &Denylist{Addr: cfg.RedisAddr}
+
+	app := buffalo.New(buffalo.Options{Env: "development", SessionName: "_keycloak_example_session"})
+	app.POST("/refresh", refresh(cfg, oidc.Issuer))
+	api := app.Group("/api")
+	api.Use(tokenauth.New(tokenauth.Options{
+		OIDC: oidc,
+		PreVerify: func(c buffalo.Context, token tokenauth.UnverifiedToken) error {
+			revoked, err := denylist.Revoked(token.Claims.String("jti"))
+			if err != nil {
+				return errors.Wrap(err, "couldn't check denylist")
+			}
+			if revoked {
+				return ErrRevoked
+			}
+			return nil
+		},
+	}))
+	api.GET("/me", me)
+	api.POST("/logout", logout(denylist))
+	return app
+}
+
+// me responds with the user and the realm roles of the token
+func me(c buffalo.Context) error {
+	claims := c.Value("claims").(jwt.MapClaims)
+	return c.Render(http.StatusOK, render.JSON(map[string]interface{}{
+		"sub":         claims["sub"],
+		"username":    claims["preferred_username"],
+		"realm_roles": tokenauth.KeycloakAccessFromContext(c).RealmRoles,
+	}))
+}
+
+// logout revokes the token until it expires
+func logout(denylist *Denylist) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		claims := c.Value("claims").(jwt.MapClaims)
+		jti, _ := claims["jti"].(string)
+		exp, _ := tokenauth.ExpiresAt(claims)
+		if err := denylist.Revoke(jti, time.Until(exp)); err != nil {
+			return errors.Wrap(err, "couldn't revoke token")
+		}
+		return c.Render(http.StatusNoContent, nil)
+	}
+}
+
+// refresh exchanges the refresh_token of the form at the token endpoint of
+// the realm, so clients like client.RefreshSource don't talk to Keycloak
+func refresh(cfg Config, issuer string) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		res, err := cfg.HTTPClient.PostForm(issuer+"/protocol/openid-connect/token", url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {cfg.ClientID},
+			"refresh_token": {c.Param("refresh_token")},
+		})
+		if err != nil {
+			return errors.Wrap(err, "couldn't refresh token")
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return errors.Wrap(err, "couldn't refresh token")
+		}
+		c.Response().Header().Set("Content-Type", "application/json")
+		c.Response().WriteHeader(res.StatusCode)
+		_, err = c.Response().Write(body)
+		return err
+	}
+}
+
+func main() {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("verifying tokens of %s", strings.TrimSuffix(cfg.KeycloakURL, "/")+"/realms/"+cfg.Realm)
+	log.Fatal(App(cfg).Serve())
+}
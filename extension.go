@@ -0,0 +1,104 @@
+package tokenauth
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/extractor"
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/gobuffalo/mw-tokenauth/v2/keysource"
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownExtension is returned if the options use an extension which isn't registered
+var ErrUnknownExtension = errors.New("unknown extension")
+
+// The core interfaces of the middleware, implemented by the
+// extensions of other packages, see RegisterExtension
+type (
+	// Extractor reads the token from the request
+	Extractor = extractor.Extractor
+	// KeyProvider returns the key a token is verified with
+	KeyProvider = keysource.KeyProvider
+	// KeyProviderFunc is a func implementing KeyProvider
+	KeyProviderFunc = keysource.KeyProviderFunc
+	// Validator checks the claims of a verified token, failing tokens are rejected with 401
+	Validator = guard.Validator
+	// ValidatorFunc is a func implementing Validator
+	ValidatorFunc = guard.ValidatorFunc
+	// Guard decides if the caller may access the route, denied requests are rejected with 403
+	Guard = guard.Guard
+	// GuardFunc is a func implementing Guard
+	GuardFunc = guard.GuardFunc
+	// Store keeps keys until they expire, e.g. the jti of seen tokens
+	Store = store.Store
+)
+
+// Extension configures the options with what a package provides, e.g. the key
+// provider of a secret manager, the validators of an identity provider or the
+// guards of an authorization service. The config are the settings of the app,
+// e.g. read from its env, their meaning is up to the extension.
+type Extension func(options *Options, config map[string]string) error
+
+var (
+	extensionsMu sync.RWMutex
+	extensions   = map[string]Extension{}
+)
+
+// RegisterExtension makes an extension available by name, usually from the init
+// func of the package providing it. Apps enable it in Options.Extensions, so
+// integrations can be published and mixed without changes to this package.
+// It panics if the name is already registered or the extension is nil.
+//
+//	func init() {
+//		tokenauth.RegisterExtension("vault", func(options *tokenauth.Options, config map[string]string) error {
+//			options.KeyProvider = newVaultProvider(config["path"])
+//			return nil
+//		})
+//	}
+func RegisterExtension(name string, ext Extension) {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	if ext == nil {
+		panic("tokenauth: RegisterExtension " + name + " is nil")
+	}
+	if _, dup := extensions[name]; dup {
+		panic("tokenauth: RegisterExtension called twice for " + name)
+	}
+	extensions[name] = ext
+}
+
+// Extensions returns the sorted names of the registered extensions
+func Extensions() []string {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+	names := make([]string, 0, len(extensions))
+	for name := range extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyExtensions configures the options with the extensions they enable,
+// in the order of their names so the result doesn't depend on map order
+func applyExtensions(options *Options) error {
+	names := make([]string, 0, len(options.Extensions))
+	for name := range options.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		extensionsMu.RLock()
+		ext, ok := extensions[name]
+		extensionsMu.RUnlock()
+		if !ok {
+			return errors.Wrap(ErrUnknownExtension, name)
+		}
+		if err := ext(options, options.Extensions[name]); err != nil {
+			return errors.Wrapf(err, "couldn't apply extension %s", name)
+		}
+	}
+	return nil
+}
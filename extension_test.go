@@ -0,0 +1,76 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	// an out of tree integration checking the tenant and role claims
+	tokenauth.RegisterExtension("test-tenants", func(options *tokenauth.Options, config map[string]string) error {
+		tenant := config["tenant"]
+		if tenant == "" {
+			return errors.New("tenant is required")
+		}
+		options.KeyFunc = tokenauth.StaticKey([]byte(config["secret"]))
+		options.Validators = append(options.Validators, tokenauth.ValidatorFunc(func(c buffalo.Context, claims jwt.Claims) error {
+			if claims.(jwt.MapClaims)["tenant"] != tenant {
+				return errors.New("unknown tenant")
+			}
+			return nil
+		}))
+		options.Guards = append(options.Guards, tokenauth.GuardFunc(func(c buffalo.Context, claims jwt.Claims) error {
+			if claims.(jwt.MapClaims)["role"] != "admin" {
+				return tokenauth.ErrInsufficientScope
+			}
+			return nil
+		}))
+		return nil
+	})
+}
+
+func TestExtensions(t *testing.T) {
+	r := require.New(t)
+	r.Contains(tokenauth.Extensions(), "test-tenants")
+	r.Panics(func() {
+		tokenauth.RegisterExtension("test-tenants", func(*tokenauth.Options, map[string]string) error { return nil })
+	})
+
+	_, err := tokenauth.NewWithError(tokenauth.Options{Extensions: map[string]map[string]string{"missing": nil}})
+	r.Equal(tokenauth.ErrUnknownExtension, errors.Cause(err))
+	_, err = tokenauth.NewWithError(tokenauth.Options{Extensions: map[string]map[string]string{"test-tenants": {}}})
+	r.Error(err)
+	r.Contains(err.Error(), "tenant is required")
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		Extensions: map[string]map[string]string{
+			"test-tenants": {"tenant": "acme", "secret": "secret"},
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	for _, tt := range []struct {
+		claims jwt.MapClaims
+		status int
+	}{
+		{jwt.MapClaims{"tenant": "acme", "role": "admin", "exp": exp}, http.StatusOK},
+		{jwt.MapClaims{"tenant": "other", "role": "admin", "exp": exp}, http.StatusUnauthorized},
+		{jwt.MapClaims{"tenant": "acme", "role": "user", "exp": exp}, http.StatusForbidden},
+	} {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signWith(tt.claims, "secret")
+		r.Equal(tt.status, req.Get().Code, tt.claims)
+	}
+}
@@ -0,0 +1,44 @@
+package tokenauth
+
+import (
+	"github.com/gobuffalo/mw-tokenauth/v2/extractor"
+)
+
+// TokenExtractor gets the token string from the request,
+// it returns ErrNoToken if the request does not carry a token
+type TokenExtractor = extractor.TokenExtractor
+
+// FromHeader returns a TokenExtractor which reads the token from the given header,
+// removing the authorisation scheme part (e.g. Bearer) from the header value
+func FromHeader(name, authScheme string) TokenExtractor {
+	return extractor.FromHeader(name, authScheme)
+}
+
+// FromCookie returns a TokenExtractor which reads the token from the cookie with the given name,
+// useful for browser based apps storing the token in an HttpOnly cookie
+func FromCookie(name string) TokenExtractor {
+	return extractor.FromCookie(name)
+}
+
+// FromQuery returns a TokenExtractor which reads the token from the given query string parameter,
+// for WebSocket and EventSource clients which can't set headers.
+// Tokens in URLs end up in logs and browser history, so the extractor only
+// reads the parameter when Options.AllowQueryToken is set
+func FromQuery(name string) TokenExtractor {
+	return extractor.FromQuery(name)
+}
+
+// FromForm returns a TokenExtractor which reads the token from the given parameter
+// of an application/x-www-form-urlencoded request body as described by RFC 6750,
+// for legacy clients which can't set headers. GET and HEAD requests are ignored.
+func FromForm(name string) TokenExtractor {
+	return extractor.FromForm(name)
+}
+
+// FromWebSocketProtocol returns a TokenExtractor which reads the token from the
+// Sec-WebSocket-Protocol header, where browsers send it as the subprotocol following
+// the marker (e.g. "Sec-WebSocket-Protocol: bearer, <token>"). The token is removed
+// from the header so the handler doesn't echo it when upgrading the connection.
+func FromWebSocketProtocol(marker string) TokenExtractor {
+	return extractor.FromWebSocketProtocol(marker)
+}
@@ -0,0 +1,158 @@
+// Package extractor reads the token from the request, e.g. from the
+// Authorization header, a cookie or the WebSocket subprotocols.
+package extractor
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoToken is returned if no token is supplied in the request.
+	ErrNoToken = errors.New("token not found in request")
+	// ErrTokenInvalid is returned when the token provided is invalid
+	ErrTokenInvalid = errors.New("token invalid")
+)
+
+// queryAllowedKey is the context key marking query string tokens as allowed
+const queryAllowedKey = "tokenauth_query_token_allowed"
+
+// TokenExtractor gets the token string from the request,
+// it returns ErrNoToken if the request does not carry a token
+type TokenExtractor func(c buffalo.Context) (string, error)
+
+// Extractor reads the token from the request, it is implemented by the token
+// sources of other packages. It returns ErrNoToken if the request does not carry a token
+type Extractor interface {
+	Extract(c buffalo.Context) (string, error)
+}
+
+// Extract calls e, so a TokenExtractor is an Extractor
+func (e TokenExtractor) Extract(c buffalo.Context) (string, error) {
+	return e(c)
+}
+
+// FromHeader returns a TokenExtractor which reads the token from the given header,
+// removing the authorisation scheme part (e.g. Bearer) from the header value
+func FromHeader(name, authScheme string) TokenExtractor {
+	return func(c buffalo.Context) (string, error) {
+		return schemeToken(c.Request().Header.Get(name), authScheme)
+	}
+}
+
+// FromCookie returns a TokenExtractor which reads the token from the cookie with the given name,
+// useful for browser based apps storing the token in an HttpOnly cookie
+func FromCookie(name string) TokenExtractor {
+	return func(c buffalo.Context) (string, error) {
+		cookie, err := c.Request().Cookie(name)
+		if err != nil || cookie.Value == "" {
+			return "", ErrNoToken
+		}
+		return cookie.Value, nil
+	}
+}
+
+// FromQuery returns a TokenExtractor which reads the token from the given query string parameter,
+// for WebSocket and EventSource clients which can't set headers.
+// Tokens in URLs end up in logs and browser history, so the extractor only
+// reads the parameter when Options.AllowQueryToken is set
+func FromQuery(name string) TokenExtractor {
+	return func(c buffalo.Context) (string, error) {
+		if allowed, _ := c.Value(queryAllowedKey).(bool); !allowed {
+			c.Logger().Warnf("tokenauth: ignoring query parameter %s, set AllowQueryToken to enable it", name)
+			return "", ErrNoToken
+		}
+		tokenString := c.Request().URL.Query().Get(name)
+		if tokenString == "" {
+			return "", ErrNoToken
+		}
+		return tokenString, nil
+	}
+}
+
+// FromForm returns a TokenExtractor which reads the token from the given parameter
+// of an application/x-www-form-urlencoded request body as described by RFC 6750,
+// for legacy clients which can't set headers. GET and HEAD requests are ignored.
+func FromForm(name string) TokenExtractor {
+	return func(c buffalo.Context) (string, error) {
+		req := c.Request()
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			return "", ErrNoToken
+		}
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if mediaType != "application/x-www-form-urlencoded" {
+			return "", ErrNoToken
+		}
+		tokenString := req.PostFormValue(name)
+		if tokenString == "" {
+			return "", ErrNoToken
+		}
+		return tokenString, nil
+	}
+}
+
+// FromWebSocketProtocol returns a TokenExtractor which reads the token from the
+// Sec-WebSocket-Protocol header, where browsers send it as the subprotocol following
+// the marker (e.g. "Sec-WebSocket-Protocol: bearer, <token>"). The token is removed
+// from the header so the handler doesn't echo it when upgrading the connection.
+func FromWebSocketProtocol(marker string) TokenExtractor {
+	return func(c buffalo.Context) (string, error) {
+		header := c.Request().Header
+		var protocols []string
+		for _, v := range header[http.CanonicalHeaderKey("Sec-WebSocket-Protocol")] {
+			for _, p := range strings.Split(v, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					protocols = append(protocols, p)
+				}
+			}
+		}
+		for i, p := range protocols {
+			if !strings.EqualFold(p, marker) || i+1 >= len(protocols) {
+				continue
+			}
+			tokenString := protocols[i+1]
+			protocols = append(protocols[:i+1], protocols[i+2:]...)
+			header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+			return tokenString, nil
+		}
+		return "", ErrNoToken
+	}
+}
+
+// First tries the extractors in order and returns the first token found,
+// an extractor returning ErrNoToken falls back to the next one
+func First(extractors ...TokenExtractor) TokenExtractor {
+	return func(c buffalo.Context) (string, error) {
+		for _, extract := range extractors {
+			tokenString, err := extract(c)
+			if err == ErrNoToken {
+				continue
+			}
+			return tokenString, err
+		}
+		return "", ErrNoToken
+	}
+}
+
+// AllowQuery lets FromQuery read the token of the request
+func AllowQuery(c buffalo.Context) {
+	c.Set(queryAllowedKey, true)
+}
+
+// schemeToken gets the token from the value of the Authorization header,
+// removing the given authorisation scheme part (e.g. Bearer). It returns
+// ErrNoToken if the value is empty and ErrTokenInvalid if it has another scheme.
+func schemeToken(authString, authScheme string) (string, error) {
+	if authString == "" {
+		return "", ErrNoToken
+	}
+	l := len(authScheme)
+	if len(authString) > l+1 && authString[:l] == authScheme {
+		return authString[l+1:], nil
+	}
+	return "", ErrTokenInvalid
+}
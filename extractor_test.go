@@ -0,0 +1,215 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func appExtractor(options tokenauth.Options) *buffalo.App {
+	h := func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	}
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(options))
+	a.GET("/", h)
+	a.POST("/", h)
+	return a
+}
+
+func validToken() string {
+	return signHMAC(jwt.MapClaims{
+		"sub": "1234567890",
+		"exp": time.Now().Add(time.Minute * 5).Unix(),
+	})
+}
+
+func TestFromCookie(t *testing.T) {
+	r := require.New(t)
+	w := httptest.New(appExtractor(tokenauth.Options{
+		TokenSource: tokenauth.FromCookie("access_token"),
+	}))
+
+	// Missing cookie and header
+	res := w.HTML("/").Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), "token not found in request")
+
+	// token in cookie, the handler sends the cookies of its jar and
+	// replaces them with the cookies the response sets
+	req := w.HTML("/")
+	w.Cookies = "access_token=" + validToken()
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+
+	// invalid token in cookie
+	req = w.HTML("/")
+	w.Cookies = "access_token=badcreds"
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+
+	// fallback to the Authorization header
+	req = w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + validToken()
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+}
+
+func TestFromQuery(t *testing.T) {
+	r := require.New(t)
+
+	// query tokens are ignored unless allowed
+	w := httptest.New(appExtractor(tokenauth.Options{
+		TokenSource: tokenauth.FromQuery("access_token"),
+	}))
+	res := w.HTML("/?access_token=%s", validToken()).Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), "token not found in request")
+
+	w = httptest.New(appExtractor(tokenauth.Options{
+		TokenSource:     tokenauth.FromQuery("access_token"),
+		AllowQueryToken: true,
+	}))
+	res = w.HTML("/?access_token=%s", validToken()).Get()
+	r.Equal(http.StatusOK, res.Code)
+
+	res = w.HTML("/?access_token=badcreds").Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+
+	// fallback to the Authorization header
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + validToken()
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+}
+
+func TestExtractors(t *testing.T) {
+	r := require.New(t)
+	w := httptest.New(appExtractor(tokenauth.Options{
+		Extractors: []tokenauth.TokenExtractor{
+			tokenauth.FromHeader("X-Access-Token", "Token"),
+			tokenauth.FromCookie("access_token"),
+		},
+	}))
+
+	// the Authorization header is not part of the chain
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + validToken()
+	res := req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), "token not found in request")
+
+	req = w.HTML("/")
+	req.Headers["X-Access-Token"] = "Token " + validToken()
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+
+	// the cookie is sent through the cookie jar of the handler
+	req = w.HTML("/")
+	w.Cookies = "access_token=" + validToken()
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+
+	// the first token found is used
+	req = w.HTML("/")
+	req.Headers["X-Access-Token"] = "Token badcreds"
+	w.Cookies = "access_token=" + validToken()
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+}
+
+func TestHeaderName(t *testing.T) {
+	r := require.New(t)
+	w := httptest.New(appExtractor(tokenauth.Options{
+		HeaderName: "X-Access-Token",
+	}))
+
+	// Authorization is reserved for the gateway
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + validToken()
+	res := req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+
+	req = w.HTML("/")
+	req.Headers["X-Access-Token"] = "Bearer " + validToken()
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+}
+
+func TestGetToken(t *testing.T) {
+	r := require.New(t)
+	w := httptest.New(appExtractor(tokenauth.Options{
+		GetToken: func(c buffalo.Context) (string, error) {
+			v := c.Request().Header.Get("X-Vendor-Auth")
+			if v == "" {
+				return "", tokenauth.ErrNoToken
+			}
+			return strings.TrimPrefix(v, "v1:"), nil
+		},
+	}))
+
+	res := w.HTML("/").Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), "token not found in request")
+
+	req := w.HTML("/")
+	req.Headers["X-Vendor-Auth"] = "v1:" + validToken()
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+}
+
+func TestFromForm(t *testing.T) {
+	r := require.New(t)
+	w := httptest.New(appExtractor(tokenauth.Options{
+		TokenSource: tokenauth.FromForm("access_token"),
+	}))
+
+	res := w.HTML("/").Post(map[string]string{"access_token": validToken()})
+	r.Equal(http.StatusOK, res.Code)
+
+	res = w.HTML("/").Post(map[string]string{"access_token": "badcreds"})
+	r.Equal(http.StatusUnauthorized, res.Code)
+
+	res = w.HTML("/").Post(map[string]string{})
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), "token not found in request")
+
+	// form tokens are not read for GET requests
+	res = w.HTML("/?access_token=%s", validToken()).Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+}
+
+func TestFromWebSocketProtocol(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		TokenSource: tokenauth.FromWebSocketProtocol("bearer"),
+	}))
+	a.GET("/ws", func(c buffalo.Context) error {
+		return c.Render(200, render.String(c.Request().Header.Get("Sec-WebSocket-Protocol")))
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/ws")
+	req.Headers["Sec-WebSocket-Protocol"] = "chat, bearer, " + validToken()
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	// the token is stripped before the handler runs
+	r.Equal("chat, bearer", res.Body.String())
+
+	req = w.HTML("/ws")
+	req.Headers["Sec-WebSocket-Protocol"] = "chat, bearer"
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+}
@@ -0,0 +1,44 @@
+package tokenauth
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/keysource"
+	"github.com/gobuffalo/mw-tokenauth/v2/presets"
+)
+
+var (
+	// ErrNoSubject is returned if the token has no sub claim
+	ErrNoSubject = presets.ErrNoSubject
+	// ErrInvalidAuthTime is returned if the auth_time claim of the token is missing or in the future
+	ErrInvalidAuthTime = presets.ErrInvalidAuthTime
+)
+
+// FirebaseCertsURL is where Google publishes the certificates
+// Firebase Auth ID tokens are signed with
+const FirebaseCertsURL = keysource.FirebaseCertsURL
+
+// GoogleCerts fetches Google's public signing certificates, a JSON object of
+// PEM certificates by kid, and caches them for the max-age of the response.
+// The cached certificates are used as long as a refresh fails.
+type GoogleCerts = keysource.GoogleCerts
+
+// NewGoogleCerts returns a GoogleCerts for the certificates at url,
+// they are fetched on first use
+func NewGoogleCerts(url string) *GoogleCerts {
+	return keysource.NewGoogleCerts(url)
+}
+
+// FirebasePolicy returns the Policy of the Firebase Auth ID tokens of the project, see presets.Firebase
+func FirebasePolicy(projectID string) Policy {
+	return presetPolicy(presets.Firebase(projectID))
+}
+
+// Firebase returns the middleware validating the Firebase Auth ID tokens of
+// the project, with the keys of Google's signing certificates
+//
+//	app.Use(tokenauth.Firebase("my-project"))
+func Firebase(projectID string) buffalo.MiddlewareFunc {
+	return FirebasePolicy(projectID).Middleware(Options{
+		KeyFunc: NewGoogleCerts(FirebaseCertsURL).Keyfunc,
+	})
+}
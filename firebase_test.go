@@ -0,0 +1,114 @@
+package tokenauth_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// googleCertsServer serves the test key as Google signing certificate
+// with the Cache-Control header and counts the requests
+func googleCertsServer(t *testing.T, cacheControl string) (*httptest.Server, *int32) {
+	key := rsaTestKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "securetoken.system.gserviceaccount.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	var hits int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", cacheControl)
+		json.NewEncoder(w).Encode(map[string]string{"key-1": cert})
+	}))
+	return ts, &hits
+}
+
+func TestGoogleCerts(t *testing.T) {
+	r := require.New(t)
+	ts, hits := googleCertsServer(t, "public, max-age=3600, must-revalidate, no-transform")
+	defer ts.Close()
+	certs := tokenauth.NewGoogleCerts(ts.URL)
+	certs.Client = ts.Client()
+
+	key, err := certs.Key("key-1")
+	r.NoError(err)
+	r.Equal(&rsaTestKey(t).PublicKey, key)
+	_, err = certs.Key("key-2")
+	r.Equal(tokenauth.ErrKeyNotFound, err)
+	r.Equal(int32(1), atomic.LoadInt32(hits))
+
+	// expired certificates are fetched again
+	ts, hits = googleCertsServer(t, "max-age=0")
+	defer ts.Close()
+	certs = tokenauth.NewGoogleCerts(ts.URL)
+	certs.Client = ts.Client()
+	_, err = certs.Key("key-1")
+	r.NoError(err)
+	time.Sleep(time.Millisecond)
+	_, err = certs.Key("key-1")
+	r.NoError(err)
+	r.Equal(int32(2), atomic.LoadInt32(hits))
+}
+
+func TestFirebasePolicy(t *testing.T) {
+	r := require.New(t)
+	ts, _ := googleCertsServer(t, "max-age=3600")
+	defer ts.Close()
+	certs := tokenauth.NewGoogleCerts(ts.URL)
+	certs.Client = ts.Client()
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.FirebasePolicy("my-project").Middleware(tokenauth.Options{KeyFunc: certs.Keyfunc}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := bhttptest.New(a)
+	key := rsaTestKey(t)
+
+	tcases := []struct {
+		name   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"valid", jwt.MapClaims{}, http.StatusOK},
+		{"other project", jwt.MapClaims{"aud": "other-project"}, http.StatusUnauthorized},
+		{"other issuer", jwt.MapClaims{"iss": "https://securetoken.google.com/other-project"}, http.StatusUnauthorized},
+		{"no subject", jwt.MapClaims{"sub": ""}, http.StatusUnauthorized},
+		{"no auth time", jwt.MapClaims{"auth_time": nil}, http.StatusUnauthorized},
+		{"future auth time", jwt.MapClaims{"auth_time": time.Now().Add(time.Hour).Unix()}, http.StatusUnauthorized},
+	}
+	for _, tc := range tcases {
+		claims := jwt.MapClaims{
+			"iss":       "https://securetoken.google.com/my-project",
+			"aud":       "my-project",
+			"sub":       "uid-1",
+			"auth_time": time.Now().Add(-time.Minute).Unix(),
+			"exp":       time.Now().Add(time.Minute * 5).Unix(),
+		}
+		for k, v := range tc.claims {
+			claims[k] = v
+		}
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signRS256(t, "key-1", key, claims)
+		r.Equal(tc.status, req.Get().Code, tc.name)
+	}
+}
@@ -0,0 +1,142 @@
+package tokenauth
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// Feature flags evaluated per request with the Flags of the options
+const (
+	// FlagReportOnly lets rejected requests through, the rejections are
+	// only logged, e.g. to try out a stricter config. Defaults to off
+	FlagReportOnly = "tokenauth-report-only"
+	// FlagOptional lets requests without token through unauthenticated,
+	// tokens they carry are verified. Defaults to off
+	FlagOptional = "tokenauth-optional"
+	// FlagCanary accepts the tokens of the Canary issuer. Defaults to on
+	FlagCanary = "tokenauth-canary"
+)
+
+// DefaultFlagTTL is how long CachedFlags uses an evaluation
+const DefaultFlagTTL = 30 * time.Second
+
+// FlagProvider evaluates feature flags for the request, e.g. an adapter
+// of a LaunchDarkly or OpenFeature client
+type FlagProvider interface {
+	// BoolFlag returns the value of the flag, fallback if it can't be evaluated
+	BoolFlag(c buffalo.Context, flag string, fallback bool) bool
+}
+
+// CachedFlags caches the evaluations of the Provider, so the
+// provider isn't asked for every request
+type CachedFlags struct {
+	Provider FlagProvider
+	// TTL of the evaluations, defaults to DefaultFlagTTL
+	TTL time.Duration
+	// Key returns the key the evaluations of the request are cached by,
+	// e.g. the tenant. By default a flag is evaluated once for all requests
+	Key func(c buffalo.Context) string
+
+	mu    sync.Mutex
+	cache map[string]cachedFlag
+}
+
+type cachedFlag struct {
+	value   bool
+	expires time.Time
+}
+
+// BoolFlag returns the cached value of the flag, it is evaluated
+// with the provider if it isn't cached or expired
+func (f *CachedFlags) BoolFlag(c buffalo.Context, flag string, fallback bool) bool {
+	key := flag
+	if f.Key != nil {
+		key += "\x00" + f.Key(c)
+	}
+	f.mu.Lock()
+	cached, ok := f.cache[key]
+	f.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value
+	}
+	value := f.Provider.BoolFlag(c, flag, fallback)
+	ttl := f.TTL
+	if ttl <= 0 {
+		ttl = DefaultFlagTTL
+	}
+	f.mu.Lock()
+	if f.cache == nil {
+		f.cache = map[string]cachedFlag{}
+	}
+	f.cache[key] = cachedFlag{value: value, expires: time.Now().Add(ttl)}
+	f.mu.Unlock()
+	return value
+}
+
+// togglesKey is the context key of the toggles of the request
+const togglesKey = "tokenauth_toggles"
+
+// toggles are the flags evaluated for the request
+type toggles struct {
+	reportOnly bool
+	optional   bool
+	canary     bool
+	// next is the handler rejected requests are let through to
+	next buffalo.Handler
+	// passed is set once the request is let through
+	passed bool
+}
+
+// evalToggles evaluates the flags for the request, nil without flag provider
+func evalToggles(c buffalo.Context, options Options, next buffalo.Handler) *toggles {
+	if options.Flags == nil {
+		return nil
+	}
+	t := &toggles{
+		reportOnly: options.Flags.BoolFlag(c, FlagReportOnly, false),
+		optional:   options.Flags.BoolFlag(c, FlagOptional, false),
+		canary:     options.Flags.BoolFlag(c, FlagCanary, true),
+		next:       next,
+	}
+	c.Set(togglesKey, t)
+	return t
+}
+
+// acceptsCanary reports if the tokens of the canary issuer are accepted
+func (t *toggles) acceptsCanary() bool {
+	return t == nil || t.canary
+}
+
+// letThrough sets the handler rejected requests are let through to
+func letThrough(c buffalo.Context, next buffalo.Handler) {
+	if t, ok := c.Value(togglesKey).(*toggles); ok && !t.passed {
+		t.next = next
+	}
+}
+
+// passedThrough reports if the request was let through although it was rejected
+func passedThrough(c buffalo.Context) bool {
+	t, ok := c.Value(togglesKey).(*toggles)
+	return ok && t.passed
+}
+
+// passThrough returns the handler the rejected request is let through to,
+// false if it is rejected. Server errors are never let through.
+func passThrough(c buffalo.Context, status int, err error) (buffalo.Handler, bool) {
+	t, ok := c.Value(togglesKey).(*toggles)
+	if !ok || t.passed || status >= 500 {
+		return nil, false
+	}
+	switch {
+	case t.optional && err == ErrNoToken:
+	case t.reportOnly:
+		log.Printf("tokenauth: report only, letting through request rejected with %d: %v", status, err)
+	default:
+		return nil, false
+	}
+	t.passed = true
+	return t.next, true
+}
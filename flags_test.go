@@ -0,0 +1,123 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// staticFlags evaluates the flags from the map and counts the evaluations
+type staticFlags struct {
+	flags map[string]bool
+	evals int
+}
+
+func (f *staticFlags) BoolFlag(c buffalo.Context, flag string, fallback bool) bool {
+	f.evals++
+	if v, ok := f.flags[flag]; ok {
+		return v
+	}
+	return fallback
+}
+
+func appFlags(flags tokenauth.FlagProvider) *buffalo.App {
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		Canary: &tokenauth.CanaryIssuer{
+			Issuer: "https://new-idp.example.com",
+			GetKey: func(jwt.SigningMethod) (interface{}, error) {
+				return []byte("canary-secret"), nil
+			},
+		},
+		Flags: flags,
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		if c.Value("claims") == nil {
+			return c.Render(200, render.String("anonymous"))
+		}
+		return c.Render(200, render.String("authenticated"))
+	})
+	return a
+}
+
+func TestFlags(t *testing.T) {
+	r := require.New(t)
+	flags := &staticFlags{flags: map[string]bool{}}
+	w := httptest.New(appFlags(flags))
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}
+	canaryClaims := jwt.MapClaims{"iss": "https://new-idp.example.com", "exp": claims["exp"]}
+
+	// enforced by default
+	req := w.HTML("/")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+	req.Headers["Authorization"] = "Bearer " + signWith(canaryClaims, "canary-secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	flags.flags[tokenauth.FlagOptional] = true
+	res := w.HTML("/").Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("anonymous", res.Body.String())
+	req.Headers["Authorization"] = "Bearer " + signWith(claims, "other-secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+
+	flags.flags[tokenauth.FlagReportOnly] = true
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("anonymous", res.Body.String())
+	req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret")
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("authenticated", res.Body.String())
+
+	flags.flags = map[string]bool{tokenauth.FlagCanary: false}
+	req.Headers["Authorization"] = "Bearer " + signWith(canaryClaims, "canary-secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+}
+
+func TestFlagsReportOnlyPolicy(t *testing.T) {
+	r := require.New(t)
+	flags := &staticFlags{flags: map[string]bool{tokenauth.FlagReportOnly: true}}
+	p := tokenauth.Policy{
+		Issuer: "https://idp.example.com",
+		Routes: []tokenauth.RoutePolicy{{Path: "*", Scopes: []string{"read"}}},
+	}
+	a := buffalo.New(buffalo.Options{})
+	a.Use(p.Middleware(tokenauth.Options{KeyFunc: tokenauth.StaticKey([]byte("secret")), Flags: flags}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+
+	req := w.HTML("/")
+	r.Equal(http.StatusOK, req.Get().Code)
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"iss": "https://other.example.com", "exp": exp}, "secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"iss": "https://idp.example.com", "scope": "write", "exp": exp}, "secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	flags.flags[tokenauth.FlagReportOnly] = false
+	r.Equal(http.StatusForbidden, req.Get().Code)
+}
+
+func TestCachedFlags(t *testing.T) {
+	r := require.New(t)
+	flags := &staticFlags{flags: map[string]bool{tokenauth.FlagOptional: true}}
+	cached := &tokenauth.CachedFlags{Provider: flags, TTL: time.Hour}
+	w := httptest.New(appFlags(cached))
+
+	r.Equal(http.StatusOK, w.HTML("/").Get().Code)
+	evals := flags.evals
+	// cached evaluations are used although the flag changed
+	flags.flags[tokenauth.FlagOptional] = false
+	r.Equal(http.StatusOK, w.HTML("/").Get().Code)
+	r.Equal(evals, flags.evals)
+}
@@ -0,0 +1,279 @@
+package tokenauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/envy"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// gcpScope is the OAuth2 scope the Google Cloud APIs are called with
+const gcpScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// GCPConfig is the credentials the Google Cloud APIs are called with, they
+// default to the application default credentials: the credentials file in
+// GOOGLE_APPLICATION_CREDENTIALS or of gcloud auth application-default login,
+// else the service account of the metadata server on GCE, GKE and Cloud Run
+type GCPConfig struct {
+	// AccessToken if set, is the OAuth2 access token the APIs are called with
+	AccessToken string
+	// CredentialsFile is a service account key or authorized user file,
+	// defaults to GOOGLE_APPLICATION_CREDENTIALS
+	CredentialsFile string
+	// Endpoint overrides the endpoint of the APIs, e.g. for Private Service Connect
+	Endpoint string
+	// Client used to call the APIs, defaults to a client with a 10s timeout
+	Client *http.Client
+}
+
+// withDefaults fills the unset fields from the env
+func (cfg GCPConfig) withDefaults() GCPConfig {
+	if cfg.CredentialsFile == "" {
+		cfg.CredentialsFile = envy.Get("GOOGLE_APPLICATION_CREDENTIALS", "")
+	}
+	if cfg.CredentialsFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			file := filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(file); err == nil {
+				cfg.CredentialsFile = file
+			}
+		}
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return cfg
+}
+
+// gcpCredentials is a service_account or authorized_user credentials file
+type gcpCredentials struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// accessToken returns the access token of the credentials. Tokens are not
+// cached, since the keys are only loaded once and on every KeyRefreshInterval.
+func (cfg GCPConfig) accessToken(ctx context.Context) (string, error) {
+	if cfg.AccessToken != "" {
+		return cfg.AccessToken, nil
+	}
+	if cfg.CredentialsFile == "" {
+		host := envy.Get("GCE_METADATA_HOST", "metadata.google.internal")
+		req, err := http.NewRequest(http.MethodGet, "http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+		return cfg.token(req.WithContext(ctx))
+	}
+	data, err := ioutil.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't read Google credentials")
+	}
+	var creds gcpCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", errors.Wrap(err, "couldn't parse Google credentials")
+	}
+	if creds.TokenURI == "" {
+		creds.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	form := url.Values{}
+	switch creds.Type {
+	case "service_account":
+		key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(creds.PrivateKey))
+		if err != nil {
+			return "", errors.Wrap(err, "couldn't parse the key of the service account")
+		}
+		now := time.Now()
+		assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   creds.ClientEmail,
+			"scope": gcpScope,
+			"aud":   creds.TokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}).SignedString(key)
+		if err != nil {
+			return "", err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+	default:
+		return "", errors.Errorf("unsupported Google credentials type %q", creds.Type)
+	}
+	req, err := http.NewRequest(http.MethodPost, creds.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "invalid token_uri")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return cfg.token(req.WithContext(ctx))
+}
+
+// token requests an access token
+func (cfg GCPConfig) token(req *http.Request) (string, error) {
+	res, err := cfg.Client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't get Google access token")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("couldn't get Google access token: %s", res.Status)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil || out.AccessToken == "" {
+		return "", errors.New("couldn't get Google access token: no access_token in response")
+	}
+	return out.AccessToken, nil
+}
+
+// get calls a method of a Google Cloud API, e.g. the
+// secretmanager service with the path of the secret version
+func (cfg GCPConfig) get(ctx context.Context, service, path string, out interface{}) error {
+	cfg = cfg.withDefaults()
+	token, err := cfg.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://" + service + ".googleapis.com"
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s endpoint", service)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "couldn't call %s", service)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't call %s", service)
+	}
+	if res.StatusCode != http.StatusOK {
+		var gcpErr struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &gcpErr)
+		return errors.Errorf("%s %s failed: %s %s %s", service, path, res.Status, gcpErr.Error.Status, gcpErr.Error.Message)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// checkCRC32C verifies the CRC32C checksum Google sends with payloads,
+// a decimal int64 in the JSON encoding of the APIs
+func checkCRC32C(data []byte, checksum, name string) error {
+	if checksum == "" {
+		return nil
+	}
+	want, err := strconv.ParseUint(checksum, 10, 64)
+	if err != nil || uint64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))) != want {
+		return errors.Errorf("checksum of %s doesn't match, the response is corrupted", name)
+	}
+	return nil
+}
+
+// SecretManagerKey returns a GetKey loading the key from the Google Secret
+// Manager secret version, e.g. "projects/my-project/secrets/jwt-key/versions/3",
+// the latest version if name is the secret. The secret of HMAC methods is the
+// payload itself, public keys are PEM, DER or JWK encoded. To pick up new
+// versions of the secret, set the KeyRefreshInterval of the options.
+//
+//	GetKey:             tokenauth.SecretManagerKey(tokenauth.GCPConfig{}, "projects/my-project/secrets/jwt-secret"),
+//	KeyRefreshInterval: time.Hour,
+func SecretManagerKey(cfg GCPConfig, name string) func(jwt.SigningMethod) (interface{}, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	return func(method jwt.SigningMethod) (interface{}, error) {
+		var out struct {
+			Payload struct {
+				Data       string `json:"data"`
+				DataCrc32c string `json:"dataCrc32c"`
+			} `json:"payload"`
+		}
+		if err := cfg.get(context.Background(), "secretmanager", name+":access", &out); err != nil {
+			return nil, err
+		}
+		data, err := base64.StdEncoding.DecodeString(out.Payload.Data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't decode payload of %s", name)
+		}
+		if err := checkCRC32C(data, out.Payload.DataCrc32c, name); err != nil {
+			return nil, err
+		}
+		return parseKey(method, data)
+	}
+}
+
+// CloudKMSKey returns a GetKey loading the public key of the asymmetric signing
+// key version of Google Cloud KMS, e.g. "projects/my-project/locations/global/
+// keyRings/auth/cryptoKeys/jwt/cryptoKeyVersions/1". The private key never leaves
+// KMS, tokens signed with the asymmetricSign of the version are verified with the
+// public key. The algorithm of the key version must match the sign method.
+func CloudKMSKey(cfg GCPConfig, keyVersion string) func(jwt.SigningMethod) (interface{}, error) {
+	return func(method jwt.SigningMethod) (interface{}, error) {
+		var out struct {
+			PEM       string `json:"pem"`
+			PEMCrc32c string `json:"pemCrc32c"`
+			Algorithm string `json:"algorithm"`
+		}
+		if err := cfg.get(context.Background(), "cloudkms", keyVersion+"/publicKey", &out); err != nil {
+			return nil, err
+		}
+		if err := checkCRC32C([]byte(out.PEM), out.PEMCrc32c, keyVersion); err != nil {
+			return nil, err
+		}
+		if !cloudKMSAlgorithm(method.Alg(), out.Algorithm) {
+			return nil, errors.Errorf("Cloud KMS key %s is %s, it can't sign %s tokens", keyVersion, out.Algorithm, method.Alg())
+		}
+		return parseKey(method, []byte(out.PEM))
+	}
+}
+
+// cloudKMSAlgorithm reports if the tokens of the JWT alg can be signed
+// with the algorithm of a Cloud KMS key, e.g. RSA_SIGN_PKCS1_2048_SHA256
+func cloudKMSAlgorithm(alg, kmsAlgorithm string) bool {
+	hash := "_SHA" + strings.TrimLeft(alg, "RSEP")
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		return strings.HasPrefix(kmsAlgorithm, "RSA_SIGN_PKCS1_") && strings.HasSuffix(kmsAlgorithm, hash)
+	case strings.HasPrefix(alg, "PS"):
+		return strings.HasPrefix(kmsAlgorithm, "RSA_SIGN_PSS_") && strings.HasSuffix(kmsAlgorithm, hash)
+	case alg == "ES256":
+		return kmsAlgorithm == "EC_SIGN_P256_SHA256"
+	case alg == "ES384":
+		return kmsAlgorithm == "EC_SIGN_P384_SHA384"
+	case alg == "EdDSA":
+		return kmsAlgorithm == "EC_SIGN_ED25519"
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package tokenauth_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+const gcpKeyVersion = "projects/p/locations/global/keyRings/auth/cryptoKeys/jwt/cryptoKeyVersions/1"
+
+func crc32c(data []byte) string {
+	return strconv.FormatUint(uint64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))), 10)
+}
+
+// gcpServer answers the token endpoint of service accounts, Secret Manager
+// and Cloud KMS, the APIs require the access token of the token endpoint
+func gcpServer(t *testing.T) *httptest.Server {
+	secret := []byte("gcp-secret")
+	pub, err := ioutil.ReadFile("test_certs/sample_key.pub")
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		key := rsaTestKey(t)
+		_, err := jwt.Parse(r.PostFormValue("assertion"), func(*jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+		if r.PostFormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "ya29.test"})
+	})
+	api := func(res interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer ya29.test" {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"status": "UNAUTHENTICATED"}})
+				return
+			}
+			json.NewEncoder(w).Encode(res)
+		}
+	}
+	mux.HandleFunc("/v1/projects/p/secrets/jwt/versions/latest:access", api(map[string]interface{}{
+		"payload": map[string]string{"data": base64.StdEncoding.EncodeToString(secret), "dataCrc32c": crc32c(secret)},
+	}))
+	mux.HandleFunc("/v1/projects/p/secrets/corrupted/versions/2:access", api(map[string]interface{}{
+		"payload": map[string]string{"data": base64.StdEncoding.EncodeToString(secret), "dataCrc32c": "1"},
+	}))
+	mux.HandleFunc("/v1/"+gcpKeyVersion+"/publicKey", api(map[string]string{
+		"pem": string(pub), "pemCrc32c": crc32c(pub), "algorithm": "RSA_SIGN_PKCS1_2048_SHA256",
+	}))
+	return httptest.NewTLSServer(mux)
+}
+
+func TestSecretManagerKey(t *testing.T) {
+	r := require.New(t)
+	ts := gcpServer(t)
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "gcp")
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+	key, err := ioutil.ReadFile("test_certs/sample_key")
+	r.NoError(err)
+	creds, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "api@p.iam.gserviceaccount.com",
+		"private_key":  string(key),
+		"token_uri":    ts.URL + "/token",
+	})
+	r.NoError(err)
+	file := filepath.Join(dir, "credentials.json")
+	r.NoError(ioutil.WriteFile(file, creds, 0600))
+	cfg := tokenauth.GCPConfig{CredentialsFile: file, Endpoint: ts.URL, Client: ts.Client()}
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{GetKey: tokenauth.SecretManagerKey(cfg, "projects/p/secrets/jwt")}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := bhttptest.New(a)
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}, "gcp-secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	_, err = tokenauth.SecretManagerKey(cfg, "projects/p/secrets/corrupted/versions/2")(jwt.SigningMethodHS256)
+	r.Error(err)
+	r.Contains(err.Error(), "checksum")
+
+	cfg.AccessToken = "expired"
+	_, err = tokenauth.SecretManagerKey(cfg, "projects/p/secrets/jwt")(jwt.SigningMethodHS256)
+	r.Error(err)
+	r.Contains(err.Error(), "UNAUTHENTICATED")
+}
+
+func TestCloudKMSKey(t *testing.T) {
+	r := require.New(t)
+	ts := gcpServer(t)
+	defer ts.Close()
+	cfg := tokenauth.GCPConfig{AccessToken: "ya29.test", Endpoint: ts.URL, Client: ts.Client()}
+
+	key, err := tokenauth.CloudKMSKey(cfg, gcpKeyVersion)(jwt.SigningMethodRS256)
+	r.NoError(err)
+	r.Equal(&rsaTestKey(t).PublicKey, key)
+
+	_, err = tokenauth.CloudKMSKey(cfg, gcpKeyVersion)(jwt.SigningMethodPS256)
+	r.Error(err)
+	r.Contains(err.Error(), "RSA_SIGN_PKCS1_2048_SHA256")
+}
+
+func TestGCPMetadataServer(t *testing.T) {
+	r := require.New(t)
+	ts := gcpServer(t)
+	defer ts.Close()
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Metadata-Flavor") != "Google" || req.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "ya29.test", "expires_in": 3599})
+	}))
+	defer metadata.Close()
+	u, err := url.Parse(metadata.URL)
+	r.NoError(err)
+	envy.Set("GCE_METADATA_HOST", u.Host)
+	defer envy.Set("GCE_METADATA_HOST", "")
+	// no application default credentials of gcloud
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", os.TempDir())
+	defer os.Setenv("HOME", home)
+
+	cfg := tokenauth.GCPConfig{Endpoint: ts.URL, Client: ts.Client()}
+	key, err := tokenauth.CloudKMSKey(cfg, gcpKeyVersion)(jwt.SigningMethodRS256)
+	r.NoError(err)
+	r.Equal(&rsaTestKey(t).PublicKey, key)
+}
@@ -0,0 +1,49 @@
+//go:build go1.18
+// +build go1.18
+
+package tokenauth
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoClaims is returned by ClaimsAs if the request isn't authenticated
+	ErrNoClaims = errors.New("request has no verified claims")
+	// ErrClaimsType is returned by ClaimsAs if the claims are of another type
+	ErrClaimsType = errors.New("claims are of another type")
+)
+
+// ClaimsAs returns the verified claims of the request as T, the type of the
+// Claims option, or jwt.MapClaims if it isn't set
+//
+//	claims, err := tokenauth.ClaimsAs[*UserClaims](c)
+func ClaimsAs[T jwt.Claims](c buffalo.Context) (T, error) {
+	var zero T
+	v := c.Value("claims")
+	if v == nil {
+		return zero, ErrNoClaims
+	}
+	claims, ok := v.(T)
+	if !ok {
+		return zero, errors.Wrapf(ErrClaimsType, "%T", v)
+	}
+	return claims, nil
+}
+
+// NewWithClaims is New with the claims decoded into a T, whose pointer must
+// implement jwt.Claims, e.g. a struct embedding jwt.RegisteredClaims. The
+// handlers get the claims with ClaimsAs[*T].
+//
+//	app.Use(tokenauth.NewWithClaims[UserClaims](tokenauth.Options{}))
+func NewWithClaims[T any, PT interface {
+	*T
+	jwt.Claims
+}](options Options) buffalo.MiddlewareFunc {
+	options.Claims = func() jwt.Claims {
+		return PT(new(T))
+	}
+	return New(options)
+}
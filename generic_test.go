@@ -0,0 +1,51 @@
+//go:build go1.18
+// +build go1.18
+
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithClaims(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.NewWithClaims[userClaims](tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		claims, err := tokenauth.ClaimsAs[*userClaims](c)
+		if err != nil {
+			return err
+		}
+		_, err = tokenauth.ClaimsAs[jwt.MapClaims](c)
+		r.Equal(tokenauth.ErrClaimsType, errors.Cause(err))
+		return c.Render(200, render.String(claims.Username))
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"username": "ada", "exp": time.Now().Add(time.Minute * 5).Unix()}, "secret")
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("ada", res.Body.String())
+
+	// without the middleware
+	public := buffalo.New(buffalo.Options{})
+	public.GET("/", func(c buffalo.Context) error {
+		_, err := tokenauth.ClaimsAs[*userClaims](c)
+		r.Equal(tokenauth.ErrNoClaims, err)
+		return c.Render(200, nil)
+	})
+	r.Equal(http.StatusOK, httptest.New(public).HTML("/").Get().Code)
+}
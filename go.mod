@@ -1,4 +1,4 @@
-module github.com/gobuffalo/mw-tokenauth
+module github.com/gobuffalo/mw-tokenauth/v2
 
 go 1.13
 
@@ -6,7 +6,10 @@ require (
 	github.com/gobuffalo/buffalo v0.15.4
 	github.com/gobuffalo/envy v1.8.1
 	github.com/gobuffalo/httptest v1.4.0
+	github.com/gobuffalo/pop v4.13.1+incompatible
 	github.com/golang-jwt/jwt/v4 v4.4.2
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/crypto v0.0.0-20191122220453-ac88ee75c92c
+	gopkg.in/yaml.v2 v2.2.7
 )
@@ -0,0 +1,123 @@
+package tokenauth
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrMissingClaim is returned if a token lacks one of the RequiredClaims,
+// it is wrapped with the name of the claim
+var ErrMissingClaim = errors.New("required claim missing")
+
+// echoClaims writes the claims selected in ClaimsEcho into response headers,
+// for correlating edge logs. The headers are set before the handler runs,
+// since they can't be changed once the handler wrote the response.
+func echoClaims(c buffalo.Context, options Options, claims jwt.Claims) {
+	mc, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return
+	}
+	for claim, header := range options.ClaimsEcho {
+		if v, ok := mc[claim]; ok {
+			c.Response().Header().Set(header, fmt.Sprint(v))
+		}
+	}
+}
+
+// guardClaims calls the next handler and reports to ClaimsGuard if it replaced
+// the claims in the context or changed their top level values
+func guardClaims(c buffalo.Context, options Options, claims jwt.Claims, next buffalo.Handler) error {
+	if options.ClaimsGuard == nil {
+		return next(c)
+	}
+	verified := copyClaims(claims)
+	err := next(c)
+	current, _ := c.Value("claims").(jwt.Claims)
+	if !sameClaims(claims, current) || !reflect.DeepEqual(verified, current) {
+		options.ClaimsGuard(c, verified, current)
+	}
+	return err
+}
+
+// copyClaims returns a shallow copy of map claims and of the struct
+// typed claims point to, other claims are values and returned as is
+func copyClaims(claims jwt.Claims) jwt.Claims {
+	if mc, ok := claims.(jwt.MapClaims); ok {
+		cp := make(jwt.MapClaims, len(mc))
+		for k, v := range mc {
+			cp[k] = v
+		}
+		return cp
+	}
+	v := reflect.ValueOf(claims)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return claims
+	}
+	cp := reflect.New(v.Elem().Type())
+	cp.Elem().Set(v.Elem())
+	return cp.Interface().(jwt.Claims)
+}
+
+// sameClaims reports if the claims are the same map or pointer, not just equal
+func sameClaims(a, b jwt.Claims) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	if av.Type() != bv.Type() {
+		return false
+	}
+	switch av.Kind() {
+	case reflect.Map, reflect.Ptr:
+		return av.Pointer() == bv.Pointer()
+	}
+	// other values are compared with reflect.DeepEqual
+	return true
+}
+
+// checkClaims checks the RequiredClaims and runs the Validators on the claims of
+// a verified token, and ValidateClaims and the Guards on the claims decoded with
+// the Claims option. It returns the status the request is rejected with on failure
+func checkClaims(c buffalo.Context, options Options, claims jwt.MapClaims, typed jwt.Claims) (int, error) {
+	for _, name := range options.RequiredClaims {
+		if claims[name] == nil {
+			return http.StatusUnauthorized, errors.Wrap(ErrMissingClaim, name)
+		}
+	}
+	for _, v := range options.Validators {
+		if err := v.Validate(c, claims); err != nil {
+			return http.StatusUnauthorized, err
+		}
+	}
+	if options.ValidateClaims != nil {
+		if err := options.ValidateClaims(c, typed); err != nil {
+			return validateStatus(err), err
+		}
+	}
+	for _, g := range options.Guards {
+		if err := g.Allow(c, typed); err != nil {
+			if authErr, ok := AsAuthError(err); ok && authErr.HTTPStatus != 0 {
+				return authErr.HTTPStatus, err
+			}
+			return http.StatusForbidden, err
+		}
+	}
+	return 0, nil
+}
+
+// validateStatus is the status a request failing ValidateClaims is rejected with,
+// the status of an AuthError, 403 for ErrInsufficientScope or ErrInsufficientRole and 401 otherwise
+func validateStatus(err error) int {
+	if authErr, ok := AsAuthError(err); ok && authErr.HTTPStatus != 0 {
+		return authErr.HTTPStatus
+	}
+	if cause := errors.Cause(err); cause == ErrInsufficientScope || cause == ErrInsufficientRole {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
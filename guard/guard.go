@@ -0,0 +1,208 @@
+// Package guard has the checks of the claims of verified tokens shared by
+// the middleware, its policies and the presets of identity providers, and
+// the errors tokens failing them are rejected with.
+package guard
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidIssuer is returned if the iss claim of the token is not the expected issuer
+	ErrInvalidIssuer = errors.New("token issuer not accepted")
+	// ErrInvalidAudience is returned if the aud claim of the token has none of the expected audiences
+	ErrInvalidAudience = errors.New("token audience not accepted")
+	// ErrInsufficientScope is returned if the token lacks the scopes required by the route
+	ErrInsufficientScope = errors.New("insufficient scope")
+	// ErrInsufficientRole is returned if the token has none of the roles required by the route
+	ErrInsufficientRole = errors.New("insufficient role")
+	// ErrInvalidSPIFFEID is returned if the sub claim of a JWT-SVID is not a valid SPIFFE ID
+	ErrInvalidSPIFFEID = errors.New("invalid SPIFFE ID")
+)
+
+// Validator checks the claims of a verified token, tokens
+// failing it are rejected with 401 Unauthorized
+type Validator interface {
+	Validate(c buffalo.Context, claims jwt.Claims) error
+}
+
+// ValidatorFunc is a func implementing Validator
+type ValidatorFunc func(c buffalo.Context, claims jwt.Claims) error
+
+// Validate calls f
+func (f ValidatorFunc) Validate(c buffalo.Context, claims jwt.Claims) error {
+	return f(c, claims)
+}
+
+// Guard decides if the caller of a verified token may access the route,
+// e.g. by its scopes. Requests it denies are rejected with 403 Forbidden
+type Guard interface {
+	Allow(c buffalo.Context, claims jwt.Claims) error
+}
+
+// GuardFunc is a func implementing Guard
+type GuardFunc func(c buffalo.Context, claims jwt.Claims) error
+
+// Allow calls f
+func (f GuardFunc) Allow(c buffalo.Context, claims jwt.Claims) error {
+	return f(c, claims)
+}
+
+// Strings returns the values of a claim which can either be
+// a space separated string (e.g. scope) or an array of strings (e.g. aud)
+func Strings(claims jwt.MapClaims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// StringsAt is Strings of a claim nested in objects, the names in the path are
+// separated by dots, e.g. realm_access.roles. Names containing dots, like the
+// namespaced claims of Auth0, are matched as well.
+func StringsAt(claims jwt.MapClaims, path string) []string {
+	return Strings(locate(claims, path))
+}
+
+// Claim returns the value of the claim at path, see StringsAt
+func Claim(claims jwt.MapClaims, path string) interface{} {
+	nested, name := locate(claims, path)
+	return nested[name]
+}
+
+// locate returns the claims the claim at path is in and its name
+func locate(claims jwt.MapClaims, path string) (jwt.MapClaims, string) {
+	if _, ok := claims[path]; ok {
+		return claims, path
+	}
+	for i := strings.Index(path, "."); i >= 0; i = nextDot(path, i) {
+		if nested, ok := claims[path[:i]].(map[string]interface{}); ok {
+			return locate(nested, path[i+1:])
+		}
+	}
+	return nil, path
+}
+
+// nextDot returns the index of the dot in path after i, -1 if there is none
+func nextDot(path string, i int) int {
+	if j := strings.Index(path[i+1:], "."); j >= 0 {
+		return i + 1 + j
+	}
+	return -1
+}
+
+// ContainsAny reports if any of the wanted values is in values
+func ContainsAny(values []string, wanted ...string) bool {
+	for _, w := range wanted {
+		for _, v := range values {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ContainsAll reports if all of the wanted values are in values
+func ContainsAll(values []string, wanted ...string) bool {
+	for _, w := range wanted {
+		if !ContainsAny(values, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// Scopes returns the OAuth2 scopes of the scope claim and of the scp
+// claim some issuers (e.g. Azure AD and Okta) send instead
+func Scopes(claims jwt.MapClaims) []string {
+	return append(Strings(claims, "scope"), Strings(claims, "scp")...)
+}
+
+// Audience returns the audiences of the aud claim, which issuers
+// send either as a single string or as an array of strings
+func Audience(claims jwt.MapClaims) []string {
+	if aud, ok := claims["aud"].(string); ok {
+		return []string{aud}
+	}
+	return Strings(claims, "aud")
+}
+
+// NumericDate returns the time of a claim in seconds since the epoch,
+// whether it is encoded as integer, float or string
+func NumericDate(claims jwt.MapClaims, name string) (time.Time, bool) {
+	var f float64
+	switch v := claims[name].(type) {
+	case float64:
+		f = v
+	case int64:
+		f = float64(v)
+	case int:
+		f = float64(v)
+	case json.Number:
+		var err error
+		if f, err = v.Float64(); err != nil {
+			return time.Time{}, false
+		}
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+			return time.Time{}, false
+		}
+	default:
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// ParseSPIFFEID returns the trust domain and path of a SPIFFE ID as defined by
+// the SPIFFE-ID spec, e.g. "example.org" and "/ns/prod/sa/billing" of
+// spiffe://example.org/ns/prod/sa/billing. It returns ErrInvalidSPIFFEID if
+// the ID is malformed, e.g. has upper case letters in the trust domain, a
+// port, user info, query, fragment, or empty, "." or ".." path segments.
+func ParseSPIFFEID(id string) (trustDomain, path string, err error) {
+	const scheme = "spiffe://"
+	if len(id) > 2048 || !strings.HasPrefix(id, scheme) {
+		return "", "", ErrInvalidSPIFFEID
+	}
+	trustDomain = strings.TrimPrefix(id, scheme)
+	if i := strings.IndexByte(trustDomain, '/'); i >= 0 {
+		trustDomain, path = trustDomain[:i], trustDomain[i:]
+	}
+	if trustDomain == "" || strings.IndexFunc(trustDomain, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_')
+	}) >= 0 {
+		return "", "", ErrInvalidSPIFFEID
+	}
+	if path == "" {
+		return trustDomain, "", nil
+	}
+	for _, segment := range strings.Split(path[1:], "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.IndexFunc(segment, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_')
+		}) >= 0 {
+			return "", "", ErrInvalidSPIFFEID
+		}
+	}
+	return trustDomain, path, nil
+}
@@ -0,0 +1,92 @@
+package guard_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrings(t *testing.T) {
+	r := require.New(t)
+	claims := jwt.MapClaims{
+		"scope": "read:users  write:users",
+		"scp":   []interface{}{"read:users", 1, "write:users"},
+		"aud":   "api",
+	}
+	r.Equal([]string{"read:users", "write:users"}, guard.Strings(claims, "scope"))
+	r.Equal([]string{"read:users", "write:users"}, guard.Strings(claims, "scp"))
+	r.Nil(guard.Strings(claims, "roles"))
+	r.Equal([]string{"api"}, guard.Audience(claims))
+	r.True(guard.ContainsAny(guard.Strings(claims, "scope"), "admin", "write:users"))
+	r.False(guard.ContainsAny(guard.Strings(claims, "scope"), "admin"))
+	r.True(guard.ContainsAll(guard.Scopes(claims), "read:users", "write:users"))
+	r.False(guard.ContainsAll(guard.Scopes(claims), "read:users", "admin"))
+}
+
+func TestStringsAt(t *testing.T) {
+	r := require.New(t)
+	claims := jwt.MapClaims{
+		"roles":          []interface{}{"admin"},
+		"cognito:groups": []interface{}{"editors"},
+		"realm_access":   map[string]interface{}{"roles": []interface{}{"user"}},
+		"resource_access": map[string]interface{}{
+			"billing.api": map[string]interface{}{"roles": []interface{}{"payer"}},
+		},
+		"https://example.com/roles": []interface{}{"auditor"},
+	}
+	r.Equal([]string{"admin"}, guard.StringsAt(claims, "roles"))
+	r.Equal([]string{"editors"}, guard.StringsAt(claims, "cognito:groups"))
+	r.Equal([]string{"user"}, guard.StringsAt(claims, "realm_access.roles"))
+	r.Equal([]string{"payer"}, guard.StringsAt(claims, "resource_access.billing.api.roles"))
+	r.Equal([]string{"auditor"}, guard.StringsAt(claims, "https://example.com/roles"))
+	r.Nil(guard.StringsAt(claims, "realm_access.groups"))
+	r.Nil(guard.StringsAt(claims, "roles.admin"))
+	r.Equal([]interface{}{"payer"}, guard.Claim(claims, "resource_access.billing.api.roles"))
+	r.Nil(guard.Claim(claims, "realm_access.groups"))
+}
+
+func TestNumericDate(t *testing.T) {
+	r := require.New(t)
+	want := time.Unix(1577836800, 500000000)
+	for _, v := range []interface{}{1577836800.5, "1577836800.5", json.Number("1577836800.5")} {
+		got, ok := guard.NumericDate(jwt.MapClaims{"exp": v}, "exp")
+		r.True(ok, "%v", v)
+		r.True(want.Equal(got), "%v", v)
+	}
+	_, ok := guard.NumericDate(jwt.MapClaims{"exp": "tomorrow"}, "exp")
+	r.False(ok)
+}
+
+func TestParseSPIFFEID(t *testing.T) {
+	r := require.New(t)
+	td, path, err := guard.ParseSPIFFEID("spiffe://example.org/ns/prod/sa/billing")
+	r.NoError(err)
+	r.Equal("example.org", td)
+	r.Equal("/ns/prod/sa/billing", path)
+	td, path, err = guard.ParseSPIFFEID("spiffe://example.org")
+	r.NoError(err)
+	r.Equal("example.org", td)
+	r.Equal("", path)
+
+	for _, id := range []string{
+		"",
+		"https://example.org/billing",
+		"spiffe://",
+		"spiffe:///billing",
+		"spiffe://Example.org/billing",
+		"spiffe://example.org:8443/billing",
+		"spiffe://user@example.org/billing",
+		"spiffe://example.org/",
+		"spiffe://example.org//billing",
+		"spiffe://example.org/ns/../billing",
+		"spiffe://example.org/billing?x=1",
+		"spiffe://example.org/billing#x",
+	} {
+		_, _, err := guard.ParseSPIFFEID(id)
+		r.Equal(guard.ErrInvalidSPIFFEID, err, id)
+	}
+}
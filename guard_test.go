@@ -0,0 +1,153 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimsEchoAndGuard(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+	tampered := 0
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		ClaimsEcho: map[string]string{"sub": "X-Auth-Subject", "tenant": "X-Auth-Tenant"},
+		ClaimsGuard: func(c buffalo.Context, verified, current jwt.Claims) {
+			tampered++
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	a.GET("/escalate", func(c buffalo.Context) error {
+		claims := c.Value("claims").(jwt.MapClaims)
+		claims["role"] = "admin"
+		return c.Render(200, nil)
+	})
+	a.GET("/replace", func(c buffalo.Context) error {
+		c.Set("claims", jwt.MapClaims{"sub": "someone-else"})
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	token := signHMAC(jwt.MapClaims{"sub": "1", "tenant": "eu-1", "exp": time.Now().Add(time.Minute * 5).Unix()})
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + token
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("1", res.Header().Get("X-Auth-Subject"))
+	r.Equal("eu-1", res.Header().Get("X-Auth-Tenant"))
+	r.Equal(0, tampered)
+
+	for _, path := range []string{"/escalate", "/replace"} {
+		req = w.HTML(path)
+		req.Headers["Authorization"] = "Bearer " + token
+		r.Equal(http.StatusOK, req.Get().Code)
+	}
+	r.Equal(2, tampered)
+}
+
+func TestClaimsGuardTyped(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+	var verified jwt.Claims
+	tampered := 0
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		Claims: func() jwt.Claims { return &userClaims{} },
+		ClaimsGuard: func(c buffalo.Context, v, current jwt.Claims) {
+			verified = v
+			tampered++
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	a.GET("/escalate", func(c buffalo.Context) error {
+		claims := c.Value("claims").(*userClaims)
+		claims.Roles = append(claims.Roles, "admin")
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	token := signHMAC(jwt.MapClaims{"sub": "1", "roles": []string{"user"}, "exp": time.Now().Add(time.Minute * 5).Unix()})
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + token
+	r.Equal(http.StatusOK, req.Get().Code)
+	r.Equal(0, tampered)
+
+	// changes of the struct the claims point to are reported with the verified claims
+	req = w.HTML("/escalate")
+	req.Headers["Authorization"] = "Bearer " + token
+	r.Equal(http.StatusOK, req.Get().Code)
+	r.Equal(1, tampered)
+	r.Equal([]string{"user"}, verified.(*userClaims).Roles)
+}
+
+func TestRequiredClaims(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc:        tokenauth.StaticKey([]byte("secret")),
+		RequiredClaims: []string{"sub", "tenant_id"},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"sub": "user-1", "tenant_id": 42, "exp": exp}, "secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"sub": "user-1", "exp": exp}, "secret")
+	res := req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Header().Get("WWW-Authenticate"), "tenant_id: required claim missing")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"sub": nil, "tenant_id": 42, "exp": exp}, "secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+}
+
+func TestValidateClaims(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		ValidateClaims: func(c buffalo.Context, claims jwt.Claims) error {
+			switch claims.(jwt.MapClaims)["plan"] {
+			case "pro":
+				return nil
+			case "free":
+				return tokenauth.ErrInsufficientScope
+			case "suspended":
+				return &tokenauth.AuthError{Code: "suspended", HTTPStatus: http.StatusPaymentRequired, Cause: errors.New("subscription suspended")}
+			}
+			return errors.New("no subscription")
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	for plan, status := range map[string]int{
+		"pro":       http.StatusOK,
+		"free":      http.StatusForbidden,
+		"suspended": http.StatusPaymentRequired,
+		"":          http.StatusUnauthorized,
+	} {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"plan": plan, "exp": exp}, "secret")
+		r.Equal(status, req.Get().Code, plan)
+	}
+}
@@ -0,0 +1,105 @@
+package tokenauth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// inspectTokenKey is the context key of the token InspectHandler verifies
+const inspectTokenKey = "tokenauth_inspect_token"
+
+// InspectHandler returns a handler for development which decodes the token of
+// the request, from the token parameter or the Authorization header, and responds
+// with its header, claims and the verdict of the middleware configured with the
+// options, including the reason a token is rejected
+//
+//	app.POST("/_tokenauth/inspect", tokenauth.InspectHandler(options))
+//
+// It responds with 404 Not Found unless GO_ENV is set to development or test,
+// so tokens are never echoed in production or where GO_ENV isn't set. The
+// token is not used up, e.g. by PreventReplay, and not renewed.
+func InspectHandler(options Options) buffalo.Handler {
+	// the verdict has no side effects besides the checks themselves
+	options.PreventReplay = false
+	options.ReplayStore = nil
+	options.RenewWindow = 0
+	options.IssuerMetrics = nil
+	options.PhaseMetrics = nil
+	options.Snapshots = nil
+	options.RetryHints = nil
+	options.NoRejectBody = false
+	options.GetToken = func(c buffalo.Context) (string, error) {
+		token, _ := c.Value(inspectTokenKey).(string)
+		return token, nil
+	}
+	// the keys are loaded once, if they can't be NewWithError returns the error
+	if options.RequireEncryption && options.GetDecryptionKey == nil {
+		options.GetDecryptionKey, _ = DecryptionKeyFromEnv()
+	}
+	mw, mwErr := NewWithError(options)
+	return func(c buffalo.Context) error {
+		if env := envy.Get("GO_ENV", ""); env != "development" && env != "test" {
+			return c.Error(http.StatusNotFound, ErrNoToken)
+		}
+		if mwErr != nil {
+			return c.Error(http.StatusInternalServerError, mwErr)
+		}
+		token := c.Param("token")
+		if token == "" {
+			token, _ = FromHeader("Authorization", "Bearer")(c)
+		}
+		c.Response().Header().Set("Cache-Control", "no-store")
+		if token == "" {
+			return c.Render(http.StatusBadRequest, render.JSON(map[string]interface{}{
+				"error": ErrNoToken.Error(),
+			}))
+		}
+		result := map[string]interface{}{}
+		// encrypted tokens are shown with the header and claims of the token they wrap
+		inner, unverified, err := token, UnverifiedToken{}, error(nil)
+		if options.GetDecryptionKey != nil && isJWE(token) {
+			result["encryption"], _ = jweHeader(token)
+			var bare *jwt.Token
+			if inner, bare, err = decryptToken(token, options); bare != nil {
+				unverified = UnverifiedToken{Raw: token, Header: bare.Header, Claims: UntrustedClaims{claims: bare.Claims.(jwt.MapClaims)}}
+			}
+		}
+		if err == nil && unverified.Header == nil {
+			unverified, err = peekToken(inner)
+		}
+		if err != nil {
+			result["decode_error"] = err.Error()
+		} else {
+			result["header"] = unverified.Header
+			result["claims"] = unverified.Claims.claims
+			times := map[string]string{}
+			for _, name := range numericDateClaims {
+				if t, ok := guard.NumericDate(unverified.Claims.claims, name); ok {
+					times[name] = t.UTC().Format(time.RFC3339)
+				}
+			}
+			result["times"] = times
+		}
+		c.Set(inspectTokenKey, token)
+		verr := mw(func(buffalo.Context) error { return nil })(c)
+		// the headers of a rejection belong to the inspected token, not to this response
+		c.Response().Header().Del("WWW-Authenticate")
+		result["valid"] = verr == nil
+		if verr != nil {
+			result["status"] = http.StatusInternalServerError
+			result["error"] = verr.Error()
+			if authErr, ok := AsAuthError(verr); ok {
+				result["status"] = authErr.HTTPStatus
+				result["error_code"] = authErr.Code
+				result["error"] = authErr.Error()
+			}
+		}
+		return c.Render(http.StatusOK, render.JSON(result))
+	}
+}
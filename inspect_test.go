@@ -0,0 +1,104 @@
+package tokenauth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectHandler(t *testing.T) {
+	r := require.New(t)
+	envy.Set("GO_ENV", "test")
+	a := buffalo.New(buffalo.Options{})
+	a.POST("/_tokenauth/inspect", tokenauth.InspectHandler(tokenauth.Options{
+		KeyFunc:       tokenauth.StaticKey([]byte("secret")),
+		PreventReplay: true,
+	}))
+	w := httptest.New(a)
+	type result struct {
+		Header    map[string]interface{} `json:"header"`
+		Claims    map[string]interface{} `json:"claims"`
+		Times     map[string]string      `json:"times"`
+		Valid     bool                   `json:"valid"`
+		Status    int                    `json:"status"`
+		ErrorCode string                 `json:"error_code"`
+		Error     string                 `json:"error"`
+	}
+	inspect := func(token string) result {
+		res := w.HTML("/_tokenauth/inspect").Post(url.Values{"token": {token}})
+		r.Equal(http.StatusOK, res.Code)
+		var body result
+		r.NoError(json.Unmarshal(res.Body.Bytes(), &body))
+		return body
+	}
+
+	valid := signWith(jwt.MapClaims{"sub": "ada", "jti": "a", "exp": time.Now().Add(time.Minute).Unix()}, "secret")
+	body := inspect(valid)
+	r.True(body.Valid)
+	r.Equal("HS256", body.Header["alg"])
+	r.Equal("ada", body.Claims["sub"])
+	r.NotEmpty(body.Times["exp"])
+	// the token is not used up
+	r.True(inspect(valid).Valid)
+
+	body = inspect(signWith(jwt.MapClaims{"sub": "ada", "exp": time.Now().Add(-time.Minute).Unix()}, "secret"))
+	r.False(body.Valid)
+	r.Equal(http.StatusUnauthorized, body.Status)
+	r.Equal(tokenauth.ErrorCodeExpired, body.ErrorCode)
+
+	body = inspect(signWith(jwt.MapClaims{"sub": "ada"}, "other"))
+	r.False(body.Valid)
+	r.Equal(tokenauth.ErrorCodeSignature, body.ErrorCode)
+	// the claims are decoded although they can't be trusted
+	r.Equal("ada", body.Claims["sub"])
+
+	// the header is inspected without token parameter
+	req := w.HTML("/_tokenauth/inspect")
+	req.Headers["Authorization"] = "Bearer " + valid
+	r.Equal(http.StatusOK, req.Post(nil).Code)
+	r.Equal(http.StatusBadRequest, w.HTML("/_tokenauth/inspect").Post(nil).Code)
+
+	envy.Set("GO_ENV", "production")
+	defer envy.Set("GO_ENV", "test")
+	r.Equal(http.StatusNotFound, w.HTML("/_tokenauth/inspect").Post(url.Values{"token": {valid}}).Code)
+	// the handler is disabled unless GO_ENV is set
+	envy.Set("GO_ENV", "")
+	r.Equal(http.StatusNotFound, w.HTML("/_tokenauth/inspect").Post(url.Values{"token": {valid}}).Code)
+}
+
+func TestInspectHandlerEncrypted(t *testing.T) {
+	r := require.New(t)
+	envy.Set("GO_ENV", "test")
+	shared := []byte("0123456789abcdef")
+	a := buffalo.New(buffalo.Options{})
+	a.POST("/_tokenauth/inspect", tokenauth.InspectHandler(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		GetDecryptionKey: func(map[string]interface{}) (interface{}, error) {
+			return shared, nil
+		},
+	}))
+	signed := signWith(jwt.MapClaims{"sub": "ada", "exp": time.Now().Add(time.Minute).Unix()}, "secret")
+	token := encrypt(t, map[string]interface{}{"alg": "dir", "enc": "A128GCM", "cty": "JWT"}, shared, []byte(signed))
+	res := httptest.New(a).HTML("/_tokenauth/inspect").Post(url.Values{"token": {token}})
+	r.Equal(http.StatusOK, res.Code)
+	var body struct {
+		Encryption map[string]interface{} `json:"encryption"`
+		Header     map[string]interface{} `json:"header"`
+		Claims     map[string]interface{} `json:"claims"`
+		Valid      bool                   `json:"valid"`
+	}
+	r.NoError(json.Unmarshal(res.Body.Bytes(), &body))
+	r.True(body.Valid)
+	r.Equal("dir", body.Encryption["alg"])
+	r.Equal("HS256", body.Header["alg"])
+	r.Equal("ada", body.Claims["sub"])
+}
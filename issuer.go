@@ -0,0 +1,96 @@
+package tokenauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// DefaultTokenTTL is how long the tokens of an Issuer are valid
+const DefaultTokenTTL = 15 * time.Minute
+
+// Issuer signs tokens the middleware verifies, e.g. in the login handler of
+// the app, so the signing method and the registered claims are configured
+// once next to the Options the tokens are verified with
+//
+//	issuer := &tokenauth.Issuer{
+//		SignMethod: jwt.SigningMethodRS256,
+//		Key:        privateKey,
+//		Issuer:     "https://example.com",
+//		Audience:   []string{"api"},
+//	}
+//	app.Use(tokenauth.New(tokenauth.Options{
+//		SignMethod: jwt.SigningMethodRS256,
+//		Issuer:     []string{"https://example.com"},
+//		Audience:   []string{"api"},
+//	}))
+//	token, err := issuer.Issue(jwt.MapClaims{"sub": user.ID.String()})
+type Issuer struct {
+	// SignMethod signs the tokens
+	SignMethod jwt.SigningMethod
+	// Key is the key of the SignMethod, e.g. the HMAC secret or the private key
+	Key interface{}
+	// KeyID is the kid header of the tokens
+	KeyID string
+	// TTL is how long the tokens are valid, defaults to DefaultTokenTTL
+	TTL time.Duration
+	// Issuer is the iss claim of the tokens
+	Issuer string
+	// Audience is the aud claim of the tokens
+	Audience []string
+}
+
+// Issue signs a token with the claims, the iss, aud, iat, exp and jti claims
+// are set unless the claims have them
+func (i *Issuer) Issue(claims jwt.MapClaims) (string, error) {
+	if i.SignMethod == nil || i.SignMethod == jwt.SigningMethodNone {
+		return "", errors.New("issuer has no SignMethod")
+	}
+	now := jwt.TimeFunc()
+	ttl := i.TTL
+	if ttl == 0 {
+		ttl = DefaultTokenTTL
+	}
+	token := jwt.MapClaims{}
+	if i.Issuer != "" {
+		token["iss"] = i.Issuer
+	}
+	switch len(i.Audience) {
+	case 0:
+	case 1:
+		token["aud"] = i.Audience[0]
+	default:
+		token["aud"] = i.Audience
+	}
+	token["iat"] = now.Unix()
+	token["exp"] = now.Add(ttl).Unix()
+	jti, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	token["jti"] = jti
+	for k, v := range claims {
+		token[k] = v
+	}
+	t := jwt.NewWithClaims(i.SignMethod, token)
+	if i.KeyID != "" {
+		t.Header["kid"] = i.KeyID
+	}
+	signed, err := t.SignedString(i.Key)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't sign token with %s", i.SignMethod.Alg())
+	}
+	return signed, nil
+}
+
+// NewTokenID returns a random token id, e.g. for the jti claim
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,94 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuerIssue(t *testing.T) {
+	r := require.New(t)
+	issuer := &tokenauth.Issuer{
+		SignMethod: jwt.SigningMethodHS256,
+		Key:        []byte("secret"),
+		Issuer:     "https://example.com",
+		Audience:   []string{"api"},
+	}
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc:  tokenauth.StaticKey([]byte("secret")),
+		Issuer:   []string{"https://example.com"},
+		Audience: []string{"api"},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	token, err := issuer.Issue(jwt.MapClaims{"sub": "ada"})
+	r.NoError(err)
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + token
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(token, claims)
+	r.NoError(err)
+	r.Equal("api", claims["aud"])
+	r.NotEmpty(claims["jti"])
+	exp, _ := tokenauth.ExpiresAt(claims)
+	r.WithinDuration(time.Now().Add(tokenauth.DefaultTokenTTL), exp, 5*time.Second)
+
+	// the claims take precedence
+	token, err = issuer.Issue(jwt.MapClaims{"sub": "ada", "aud": "admin"})
+	r.NoError(err)
+	req = w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + token
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+
+	// the key must match the SignMethod
+	_, err = (&tokenauth.Issuer{SignMethod: jwt.SigningMethodRS256, Key: []byte("secret")}).Issue(nil)
+	r.Error(err)
+	_, err = (&tokenauth.Issuer{SignMethod: jwt.SigningMethodNone, Key: jwt.UnsafeAllowNoneSignatureType}).Issue(nil)
+	r.Error(err)
+}
+
+func TestClaimsBuilder(t *testing.T) {
+	r := require.New(t)
+	claims, err := tokenauth.NewClaims().
+		Subject("ada").
+		TTL(time.Hour).
+		Audience("api").
+		Add("role", "admin").
+		Add("exp", 0).
+		Build()
+	r.NoError(err)
+	r.Equal("ada", claims["sub"])
+	r.Equal("api", claims["aud"])
+	r.Equal("admin", claims["role"])
+	r.NotEmpty(claims["jti"])
+	r.Equal(claims["iat"], claims["nbf"])
+	// the times are set by Build
+	r.Equal(claims["iat"].(int64)+3600, claims["exp"])
+
+	other, err := tokenauth.NewClaims().Audience("api", "admin").Build()
+	r.NoError(err)
+	r.Equal([]string{"api", "admin"}, other["aud"])
+	r.NotEqual(claims["jti"], other["jti"])
+
+	// the claims are valid once signed
+	token, err := (&tokenauth.Issuer{SignMethod: jwt.SigningMethodHS256, Key: []byte("secret")}).Issue(claims)
+	r.NoError(err)
+	parsed := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, parsed, func(*jwt.Token) (interface{}, error) {
+		return []byte("secret"), nil
+	})
+	r.NoError(err)
+	r.Equal(claims["jti"], parsed["jti"])
+}
@@ -0,0 +1,120 @@
+package tokenauth
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// istioResource holds the fields of Istio RequestAuthentication
+// and AuthorizationPolicy resources the middleware can enforce
+type istioResource struct {
+	Kind string `yaml:"kind"`
+	Spec struct {
+		JWTRules []struct {
+			Issuer      string   `yaml:"issuer"`
+			Audiences   []string `yaml:"audiences"`
+			JWKSURI     string   `yaml:"jwksUri"`
+			FromHeaders []struct {
+				Name   string `yaml:"name"`
+				Prefix string `yaml:"prefix"`
+			} `yaml:"fromHeaders"`
+		} `yaml:"jwtRules"`
+		Action string `yaml:"action"`
+		Rules  []struct {
+			From []interface{} `yaml:"from"`
+			To   []struct {
+				Operation struct {
+					Methods []string `yaml:"methods"`
+					Paths   []string `yaml:"paths"`
+				} `yaml:"operation"`
+			} `yaml:"to"`
+			When []struct {
+				Key    string   `yaml:"key"`
+				Values []string `yaml:"values"`
+			} `yaml:"when"`
+		} `yaml:"rules"`
+	} `yaml:"spec"`
+}
+
+// ImportIstio reads Istio RequestAuthentication and AuthorizationPolicy resources
+// from a (multi document) YAML and returns the Policy they describe, so the mesh
+// configuration can be enforced in the app as well with Policy.Middleware.
+// Only the first jwtRule is used. The rules of ALLOW policies become routes, with
+// the scopes of their conditions on the scope or scp claim, and like in Istio
+// requests to routes no rule covers are denied. Rules with sources or other
+// conditions are rejected, they can't be enforced by the app. Other resources
+// are ignored.
+func ImportIstio(data []byte) (Policy, error) {
+	p := Policy{HeaderName: "Authorization", AuthScheme: "Bearer"}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		res := istioResource{}
+		err := dec.Decode(&res)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return p, errors.Wrap(err, "couldn't parse istio resource")
+		}
+		switch res.Kind {
+		case "RequestAuthentication":
+			if len(res.Spec.JWTRules) == 0 {
+				continue
+			}
+			rule := res.Spec.JWTRules[0]
+			p.Issuer = rule.Issuer
+			p.Audiences = rule.Audiences
+			p.JWKSURI = rule.JWKSURI
+			if len(rule.FromHeaders) > 0 {
+				p.HeaderName = rule.FromHeaders[0].Name
+				p.AuthScheme = strings.TrimSpace(rule.FromHeaders[0].Prefix)
+			}
+		case "AuthorizationPolicy":
+			if res.Spec.Action != "" && res.Spec.Action != "ALLOW" {
+				continue
+			}
+			// an ALLOW policy denies the requests none of its rules match
+			p.DenyUnmatched = true
+			for _, rule := range res.Spec.Rules {
+				if len(rule.From) > 0 {
+					return p, errors.New("istio rules with sources aren't supported")
+				}
+				var scopes []string
+				for _, when := range rule.When {
+					if when.Key != "request.auth.claims[scope]" && when.Key != "request.auth.claims[scp]" {
+						return p, errors.Errorf("istio condition %s isn't supported", when.Key)
+					}
+					scopes = append(scopes, when.Values...)
+				}
+				if len(rule.To) == 0 {
+					p.Routes = append(p.Routes, istioRoutes(nil, nil, scopes)...)
+				}
+				for _, to := range rule.To {
+					p.Routes = append(p.Routes, istioRoutes(to.Operation.Methods, to.Operation.Paths, scopes)...)
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// istioRoutes expands the methods and paths of an operation to route policies
+func istioRoutes(methods, paths, scopes []string) []RoutePolicy {
+	if len(methods) == 0 {
+		methods = []string{""}
+	}
+	if len(paths) == 0 {
+		paths = []string{"*"}
+	}
+	var routes []RoutePolicy
+	for _, m := range methods {
+		for _, path := range paths {
+			routes = append(routes, RoutePolicy{Method: m, Path: path, Scopes: scopes})
+		}
+	}
+	return routes
+}
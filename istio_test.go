@@ -0,0 +1,131 @@
+package tokenauth_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportIstio(t *testing.T) {
+	r := require.New(t)
+	data, err := ioutil.ReadFile("testdata/istio.yaml")
+	r.NoError(err)
+	p, err := tokenauth.ImportIstio(data)
+	r.NoError(err)
+	r.Equal("https://idp.example.com/", p.Issuer)
+	r.Equal([]string{"api"}, p.Audiences)
+	r.Equal("https://idp.example.com/.well-known/jwks.json", p.JWKSURI)
+	r.Equal("X-Access-Token", p.HeaderName)
+	r.Equal("Bearer", p.AuthScheme)
+	r.Equal([]tokenauth.RoutePolicy{
+		{Method: "GET", Path: "/users/*", Scopes: []string{"read:users"}},
+	}, p.Routes)
+	r.True(p.DenyUnmatched)
+
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(p.Middleware(tokenauth.Options{
+		SignMethod: jwt.SigningMethodHS256,
+		GetKey:     tokenauth.GetHMACKey,
+	}))
+	a.GET("/users/{id}", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	a.GET("/admin", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	tests := []struct {
+		claims jwt.MapClaims
+		code   int
+	}{
+		{jwt.MapClaims{"iss": "https://idp.example.com/", "aud": "api", "scope": "openid read:users"}, http.StatusOK},
+		{jwt.MapClaims{"iss": "https://idp.example.com/", "aud": []string{"other", "api"}, "scp": []string{"read:users"}}, http.StatusOK},
+		{jwt.MapClaims{"iss": "https://idp.example.com/", "aud": "api", "scope": "openid"}, http.StatusForbidden},
+		{jwt.MapClaims{"iss": "https://idp.example.com/", "aud": "other", "scope": "read:users"}, http.StatusUnauthorized},
+		{jwt.MapClaims{"iss": "https://evil.example.com/", "aud": "api", "scope": "read:users"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		tt.claims["exp"] = time.Now().Add(time.Minute * 5).Unix()
+		req := w.HTML("/users/1")
+		req.Headers["X-Access-Token"] = "Bearer " + signHMAC(tt.claims)
+		res := req.Get()
+		r.Equal(tt.code, res.Code)
+	}
+
+	// routes no rule of the ALLOW policy covers are denied
+	req := w.HTML("/admin")
+	req.Headers["X-Access-Token"] = "Bearer " + signHMAC(jwt.MapClaims{
+		"iss": "https://idp.example.com/", "aud": "api", "scope": "read:users",
+		"exp": time.Now().Add(time.Minute * 5).Unix(),
+	})
+	res := req.Get()
+	r.Equal(http.StatusForbidden, res.Code)
+	r.Contains(res.Body.String(), tokenauth.ErrRouteNotAllowed.Error())
+}
+
+func TestImportIstioRules(t *testing.T) {
+	r := require.New(t)
+	policy := func(rule string) string {
+		return "kind: AuthorizationPolicy\nspec:\n  action: ALLOW\n  rules:\n" + rule
+	}
+
+	// rules without conditions allow any token
+	p, err := tokenauth.ImportIstio([]byte(policy("  - to:\n    - operation:\n        paths: [\"/health\"]\n")))
+	r.NoError(err)
+	r.Equal([]tokenauth.RoutePolicy{{Path: "/health"}}, p.Routes)
+	r.True(p.DenyUnmatched)
+
+	// sources and conditions which can't be enforced are rejected
+	_, err = tokenauth.ImportIstio([]byte(policy("  - from:\n    - source:\n        namespaces: [\"prod\"]\n")))
+	r.Error(err)
+	_, err = tokenauth.ImportIstio([]byte(policy("  - when:\n    - key: source.ip\n      values: [\"10.0.0.1\"]\n")))
+	r.Error(err)
+
+	// the rules are alternatives, a route allowed by one rule needs no scope of another
+	p, err = tokenauth.ImportIstio([]byte(policy(`  - to:
+    - operation:
+        paths: ["/public/*"]
+  - to:
+    - operation:
+        paths: ["*"]
+    when:
+    - key: request.auth.claims[scope]
+      values: ["admin"]
+`)))
+	r.NoError(err)
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(p.Middleware(tokenauth.Options{
+		SignMethod: jwt.SigningMethodHS256,
+		GetKey:     tokenauth.GetHMACKey,
+	}))
+	ok := func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	}
+	a.GET("/public/x", ok)
+	a.GET("/admin", ok)
+	w := httptest.New(a)
+	get := func(path, scope string) int {
+		req := w.HTML(path)
+		req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{"scope": scope, "exp": time.Now().Add(time.Minute * 5).Unix()})
+		return req.Get().Code
+	}
+	r.Equal(http.StatusOK, get("/public/x", ""))
+	r.Equal(http.StatusForbidden, get("/admin", ""))
+	r.Equal(http.StatusOK, get("/admin", "admin"))
+
+	// without ALLOW policies every route is allowed
+	p, err = tokenauth.ImportIstio([]byte("kind: AuthorizationPolicy\nspec:\n  action: DENY\n"))
+	r.NoError(err)
+	r.False(p.DenyUnmatched)
+}
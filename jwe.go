@@ -0,0 +1,300 @@
+package tokenauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash"
+	"io/ioutil"
+	"strings"
+
+	"github.com/gobuffalo/envy"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrDecryption is returned if an encrypted token can't be decrypted,
+	// e.g. it was encrypted for another key or was tampered with
+	ErrDecryption = errors.New("couldn't decrypt token")
+	// ErrNotEncrypted is returned for tokens which aren't encrypted if RequireEncryption is set
+	ErrNotEncrypted = errors.New("token not encrypted")
+	// ErrUnsignedJWE is returned for encrypted tokens carrying claims instead of a
+	// signed JWT whose key is public, anyone could have encrypted them
+	ErrUnsignedJWE = errors.New("encrypted token carries no signed JWT")
+)
+
+// isJWE reports if the token is in the compact serialization of a JWE,
+// which has five parts unlike the three of a JWS
+func isJWE(tokenString string) bool {
+	return strings.Count(tokenString, ".") == 4
+}
+
+// jweHeader decodes the protected header of the JWE
+func jweHeader(tokenString string) (map[string]interface{}, error) {
+	var header map[string]interface{}
+	data, err := base64.RawURLEncoding.DecodeString(strings.SplitN(tokenString, ".", 2)[0])
+	if err != nil || json.Unmarshal(data, &header) != nil {
+		return nil, errors.Wrap(ErrDecryption, "invalid header")
+	}
+	return header, nil
+}
+
+// decryptToken decrypts the JWE, it returns the signed JWT the JWE wraps, or
+// the token of the claims it carries itself, with validated times
+func decryptToken(tokenString string, options Options) (string, *jwt.Token, error) {
+	parts := strings.Split(tokenString, ".")
+	header, err := jweHeader(tokenString)
+	if err != nil {
+		return "", nil, err
+	}
+	// the parameters of the envelope are not passed to the Crit handlers,
+	// which are given the header of the signed token
+	if crit, ok := header["crit"]; ok {
+		return "", nil, errors.Wrapf(ErrUnsupportedCrit, "%v", crit)
+	}
+	alg, _ := header["alg"].(string)
+	enc, _ := header["enc"].(string)
+	if _, ok := header["zip"]; ok {
+		// compressed plaintexts leak their content through their length
+		return "", nil, errors.Wrap(ErrDecryption, "compressed tokens aren't supported")
+	}
+	var segments [4][]byte
+	for i := range segments {
+		if segments[i], err = base64.RawURLEncoding.DecodeString(parts[i+1]); err != nil {
+			return "", nil, errors.Wrap(ErrDecryption, "invalid encoding")
+		}
+	}
+	key, err := options.GetDecryptionKey(header)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "couldn't get decryption key")
+	}
+	cek, err := contentKey(alg, key, segments[0])
+	if err != nil {
+		return "", nil, err
+	}
+	// the protected header is authenticated with the ciphertext
+	plaintext, err := decryptContent(enc, cek, segments[1], segments[2], segments[3], []byte(parts[0]))
+	if err != nil {
+		return "", nil, err
+	}
+	if cty, _ := header["cty"].(string); strings.EqualFold(cty, "JWT") {
+		// the wrapped token is verified by the middleware, which
+		// doesn't decrypt it again, envelopes are not nested twice
+		if strings.Count(string(plaintext), ".") != 2 {
+			return "", nil, errors.Wrap(ErrDecryption, "wrapped token is not a signed JWT")
+		}
+		return string(plaintext), nil, nil
+	}
+	if strings.HasPrefix(alg, "RSA") {
+		return "", nil, ErrUnsignedJWE
+	}
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(plaintext, &claims); err != nil {
+		return "", nil, errors.Wrap(ErrDecryption, "invalid claims")
+	}
+	claims = NormalizeClaims(claims)
+	if err := validTimes(claims, options); err != nil {
+		return "", nil, err
+	}
+	return "", &jwt.Token{
+		Raw:    tokenString,
+		Method: claimsMethod(alg),
+		Header: header,
+		Claims: claims,
+		Valid:  true,
+	}, nil
+}
+
+// contentKey decrypts the content encryption key with the key of the alg
+func contentKey(alg string, key interface{}, encryptedKey []byte) ([]byte, error) {
+	switch alg {
+	case "dir":
+		secret, ok := key.([]byte)
+		if !ok || len(encryptedKey) != 0 {
+			return nil, errors.Wrap(ErrDecryption, "dir requires a shared key")
+		}
+		return secret, nil
+	case "RSA-OAEP", "RSA-OAEP-256":
+		private, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.Wrapf(ErrDecryption, "%s requires an RSA private key", alg)
+		}
+		var h hash.Hash = sha1.New()
+		if alg == "RSA-OAEP-256" {
+			h = sha256.New()
+		}
+		cek, err := rsa.DecryptOAEP(h, rand.Reader, private, encryptedKey, nil)
+		if err != nil {
+			return nil, ErrDecryption
+		}
+		return cek, nil
+	case "A128KW", "A192KW", "A256KW":
+		kek, ok := key.([]byte)
+		if !ok || len(kek)*8 != kwBits(alg) {
+			return nil, errors.Wrapf(ErrDecryption, "%s requires a %d bit shared key", alg, kwBits(alg))
+		}
+		return aesKeyUnwrap(kek, encryptedKey)
+	}
+	return nil, errors.Wrapf(ErrDecryption, "unsupported alg %q", alg)
+}
+
+// kwBits returns the key size of the AES key wrap alg
+func kwBits(alg string) int {
+	switch alg {
+	case "A128KW":
+		return 128
+	case "A192KW":
+		return 192
+	}
+	return 256
+}
+
+// decryptContent decrypts and authenticates the ciphertext with the content encryption key
+func decryptContent(enc string, cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	switch enc {
+	case "A128GCM", "A192GCM", "A256GCM":
+		if len(cek)*8 != map[string]int{"A128GCM": 128, "A192GCM": 192, "A256GCM": 256}[enc] {
+			return nil, errors.Wrap(ErrDecryption, "invalid content key size")
+		}
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, ErrDecryption
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil || len(iv) != gcm.NonceSize() {
+			return nil, ErrDecryption
+		}
+		plaintext, err := gcm.Open(nil, iv, append(append([]byte{}, ciphertext...), tag...), aad)
+		if err != nil {
+			return nil, ErrDecryption
+		}
+		return plaintext, nil
+	case "A128CBC-HS256", "A192CBC-HS384", "A256CBC-HS512":
+		newHash := map[string]func() hash.Hash{"A128CBC-HS256": sha256.New, "A192CBC-HS384": sha512.New384, "A256CBC-HS512": sha512.New}[enc]
+		// the first half of the key authenticates, the second half encrypts
+		size := newHash().Size() / 2
+		if len(cek) != 2*size || len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+			return nil, ErrDecryption
+		}
+		al := make([]byte, 8)
+		binary.BigEndian.PutUint64(al, uint64(len(aad))*8)
+		mac := hmac.New(newHash, cek[:size])
+		for _, b := range [][]byte{aad, iv, ciphertext, al} {
+			mac.Write(b)
+		}
+		if subtle.ConstantTimeCompare(mac.Sum(nil)[:size], tag) != 1 {
+			return nil, ErrDecryption
+		}
+		block, err := aes.NewCipher(cek[size:])
+		if err != nil {
+			return nil, ErrDecryption
+		}
+		plaintext := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+		// PKCS #7 padding
+		pad := int(plaintext[len(plaintext)-1])
+		if pad == 0 || pad > aes.BlockSize {
+			return nil, ErrDecryption
+		}
+		return plaintext[:len(plaintext)-pad], nil
+	}
+	return nil, errors.Wrapf(ErrDecryption, "unsupported enc %q", enc)
+}
+
+// aesKeyUnwrap unwraps the key wrapped with the key encryption key, RFC 3394
+func aesKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, ErrDecryption
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	n := len(wrapped)/8 - 1
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+	r := make([]byte, len(wrapped)-8)
+	copy(r, wrapped[8:])
+	b := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(a)^t)
+			copy(b[8:], r[(i-1)*8:i*8])
+			block.Decrypt(b, b)
+			copy(a, b[:8])
+			copy(r[(i-1)*8:i*8], b[8:])
+		}
+	}
+	// the default initial value of RFC 3394 section 2.2.3.1
+	if subtle.ConstantTimeCompare(a, []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}) != 1 {
+		return nil, ErrDecryption
+	}
+	return r, nil
+}
+
+// claimsMethod is the Method of the tokens of claims which are authenticated
+// without a JWS signature, e.g. by their encryption or as PASETO token
+type claimsMethod string
+
+func (m claimsMethod) Alg() string {
+	return string(m)
+}
+
+func (m claimsMethod) Verify(string, string, interface{}) error {
+	return ErrBadSigningMethod
+}
+
+func (m claimsMethod) Sign(string, interface{}) (string, error) {
+	return "", ErrBadSigningMethod
+}
+
+// DecryptionKeyFromEnv loads the keys encrypted tokens are decrypted with once,
+// the RSA private key in the PEM file of JWT_DECRYPTION_KEY for RSA-OAEP and
+// RSA-OAEP-256, and the base64 encoded shared key in JWT_DECRYPTION_SECRET_BASE64
+// for dir, A128KW, A192KW and A256KW, and returns the GetDecryptionKey func
+// selecting the cached key by the alg of the header
+func DecryptionKeyFromEnv() (func(header map[string]interface{}) (interface{}, error), error) {
+	var private interface{}
+	var secret []byte
+	if path := envy.Get("JWT_DECRYPTION_KEY", ""); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if private, err = jwt.ParseRSAPrivateKeyFromPEM(data); err != nil {
+			return nil, err
+		}
+	}
+	if encoded := envy.Get("JWT_DECRYPTION_SECRET_BASE64", ""); encoded != "" {
+		var err error
+		if secret, err = decodeBase64(encoded); err != nil {
+			return nil, err
+		}
+	}
+	if private == nil && secret == nil {
+		return nil, errors.New("JWT_DECRYPTION_KEY or JWT_DECRYPTION_SECRET_BASE64 must be set")
+	}
+	return func(header map[string]interface{}) (interface{}, error) {
+		if alg, _ := header["alg"].(string); strings.HasPrefix(alg, "RSA") {
+			if private == nil {
+				return nil, errors.New("JWT_DECRYPTION_KEY is not set")
+			}
+			return private, nil
+		}
+		if secret == nil {
+			return nil, errors.New("JWT_DECRYPTION_SECRET_BASE64 is not set")
+		}
+		return secret, nil
+	}, nil
+}
@@ -0,0 +1,283 @@
+package tokenauth_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// encrypt returns the compact JWE of the plaintext, the content key is
+// encrypted by the alg with the key
+func encrypt(t *testing.T, header map[string]interface{}, key interface{}, plaintext []byte) string {
+	r := require.New(t)
+	data, err := json.Marshal(header)
+	r.NoError(err)
+	protected := base64.RawURLEncoding.EncodeToString(data)
+	aad := []byte(protected)
+
+	var cek, encryptedKey []byte
+	switch header["alg"] {
+	case "dir":
+		cek = key.([]byte)
+	case "RSA-OAEP-256":
+		cek = random(t, 16)
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, key.(*rsa.PublicKey), cek, nil)
+		r.NoError(err)
+	case "A128KW":
+		cek = random(t, 32)
+		encryptedKey = keyWrap(t, key.([]byte), cek)
+	}
+
+	var iv, ciphertext, tag []byte
+	switch header["enc"] {
+	case "A128GCM", "A256GCM":
+		block, err := aes.NewCipher(cek)
+		r.NoError(err)
+		gcm, err := cipher.NewGCM(block)
+		r.NoError(err)
+		iv = random(t, gcm.NonceSize())
+		sealed := gcm.Seal(nil, iv, plaintext, aad)
+		ciphertext, tag = sealed[:len(plaintext)], sealed[len(plaintext):]
+	case "A128CBC-HS256":
+		iv = random(t, aes.BlockSize)
+		pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+		padded := append(append([]byte{}, plaintext...), []byte(strings.Repeat(string(rune(pad)), pad))...)
+		block, err := aes.NewCipher(cek[16:])
+		r.NoError(err)
+		ciphertext = make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+		al := make([]byte, 8)
+		binary.BigEndian.PutUint64(al, uint64(len(aad))*8)
+		mac := hmac.New(sha256.New, cek[:16])
+		for _, b := range [][]byte{aad, iv, ciphertext, al} {
+			mac.Write(b)
+		}
+		tag = mac.Sum(nil)[:16]
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	return strings.Join([]string{protected, enc(encryptedKey), enc(iv), enc(ciphertext), enc(tag)}, ".")
+}
+
+// keyWrap wraps the key with the key encryption key, RFC 3394
+func keyWrap(t *testing.T, kek, key []byte) []byte {
+	block, err := aes.NewCipher(kek)
+	require.NoError(t, err)
+	n := len(key) / 8
+	a := []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+	r := append([]byte{}, key...)
+	b := make([]byte, 16)
+	for j := 0; j <= 5; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b, a)
+			copy(b[8:], r[(i-1)*8:i*8])
+			block.Encrypt(b, b)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(b[:8])^uint64(n*j+i))
+			copy(r[(i-1)*8:i*8], b[8:])
+		}
+	}
+	return append(a, r...)
+}
+
+func random(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	return b
+}
+
+func TestEncryptedTokens(t *testing.T) {
+	r := require.New(t)
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	r.NoError(err)
+	shared := random(t, 32)
+	kek := random(t, 16)
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		GetDecryptionKey: func(header map[string]interface{}) (interface{}, error) {
+			switch header["alg"] {
+			case "RSA-OAEP-256":
+				return private, nil
+			case "A128KW":
+				return kek, nil
+			}
+			return shared, nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		claims := tokenauth.ClaimsMap(c)
+		return c.Render(200, render.String("%v", claims["email"]))
+	})
+	w := httptest.New(a)
+	get := func(token string) *httptest.Response {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + token
+		return req.Get()
+	}
+	claims, err := json.Marshal(jwt.MapClaims{"sub": "ada", "email": "ada@example.com", "exp": time.Now().Add(time.Hour).Unix()})
+	r.NoError(err)
+
+	// claims encrypted with a shared key are authenticated by the encryption
+	res := get(encrypt(t, map[string]interface{}{"alg": "dir", "enc": "A256GCM"}, shared, claims))
+	r.Equal(http.StatusOK, res.Code)
+	r.Contains(res.Body.String(), "ada@example.com")
+	res = get(encrypt(t, map[string]interface{}{"alg": "A128KW", "enc": "A128CBC-HS256"}, kek, claims))
+	r.Equal(http.StatusOK, res.Code)
+	r.Contains(res.Body.String(), "ada@example.com")
+
+	// the signed token wrapped with the public key is verified after decryption
+	signed := signWith(jwt.MapClaims{"sub": "ada", "email": "ada@example.com", "exp": time.Now().Add(time.Hour).Unix()}, "secret")
+	nested := map[string]interface{}{"alg": "RSA-OAEP-256", "enc": "A128GCM", "cty": "JWT"}
+	res = get(encrypt(t, nested, &private.PublicKey, []byte(signed)))
+	r.Equal(http.StatusOK, res.Code)
+	r.Contains(res.Body.String(), "ada@example.com")
+	forged := signWith(jwt.MapClaims{"sub": "ada"}, "other")
+	r.Equal(http.StatusUnauthorized, get(encrypt(t, nested, &private.PublicKey, []byte(forged))).Code)
+
+	// anyone can encrypt claims with the public key
+	header := map[string]interface{}{"alg": "RSA-OAEP-256", "enc": "A128GCM"}
+	r.Equal(http.StatusUnauthorized, get(encrypt(t, header, &private.PublicKey, claims)).Code)
+
+	// tampered and expired tokens are rejected
+	token := encrypt(t, map[string]interface{}{"alg": "dir", "enc": "A256GCM"}, shared, claims)
+	parts := strings.Split(token, ".")
+	parts[3] = base64.RawURLEncoding.EncodeToString(random(t, len(claims)))
+	r.Equal(http.StatusUnauthorized, get(strings.Join(parts, ".")).Code)
+	expired, err := json.Marshal(jwt.MapClaims{"sub": "ada", "exp": time.Now().Add(-time.Hour).Unix()})
+	r.NoError(err)
+	r.Equal(http.StatusUnauthorized, get(encrypt(t, map[string]interface{}{"alg": "dir", "enc": "A256GCM"}, shared, expired)).Code)
+	r.Equal(http.StatusUnauthorized, get(encrypt(t, map[string]interface{}{"alg": "dir", "enc": "A256GCM", "zip": "DEF"}, shared, claims)).Code)
+
+	// tokens which aren't encrypted are still accepted
+	r.Equal(http.StatusOK, get(signed).Code)
+}
+
+func TestRequireEncryption(t *testing.T) {
+	r := require.New(t)
+	shared := random(t, 16)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc:           tokenauth.StaticKey([]byte("secret")),
+		RequireEncryption: true,
+		GetDecryptionKey: func(map[string]interface{}) (interface{}, error) {
+			return shared, nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	get := func(token string) *httptest.Response {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + token
+		return req.Get()
+	}
+	signed := signWith(jwt.MapClaims{"sub": "ada", "exp": time.Now().Add(time.Hour).Unix()}, "secret")
+	res := get(signed)
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), tokenauth.ErrNotEncrypted.Error())
+	r.Equal(http.StatusOK, get(encrypt(t, map[string]interface{}{"alg": "dir", "enc": "A128GCM", "cty": "JWT"}, shared, []byte(signed))).Code)
+}
+
+func TestDecryptionKeyFromEnv(t *testing.T) {
+	r := require.New(t)
+	defer envy.Set("JWT_DECRYPTION_KEY", "")
+	defer envy.Set("JWT_DECRYPTION_SECRET_BASE64", "")
+	options := tokenauth.Options{
+		KeyFunc:           tokenauth.StaticKey([]byte("secret")),
+		RequireEncryption: true,
+	}
+
+	// keys which can't be loaded fail the construction, not the requests
+	_, err := tokenauth.NewWithError(options)
+	r.Error(err)
+	envy.Set("JWT_DECRYPTION_KEY", "test_certs/missing.pem")
+	_, err = tokenauth.NewWithError(options)
+	r.Error(err)
+	envy.Set("JWT_DECRYPTION_KEY", "")
+
+	shared := random(t, 16)
+	envy.Set("JWT_DECRYPTION_SECRET_BASE64", base64.StdEncoding.EncodeToString(shared))
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(options))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	// the key is loaded once
+	envy.Set("JWT_DECRYPTION_SECRET_BASE64", "")
+	req := httptest.New(a).HTML("/")
+	signed := signWith(jwt.MapClaims{"sub": "ada", "exp": time.Now().Add(time.Hour).Unix()}, "secret")
+	req.Headers["Authorization"] = "Bearer " + encrypt(t, map[string]interface{}{"alg": "dir", "enc": "A128GCM", "cty": "JWT"}, shared, []byte(signed))
+	r.Equal(http.StatusOK, req.Get().Code)
+	// RSA encrypted tokens are rejected without JWT_DECRYPTION_KEY
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	r.NoError(err)
+	req.Headers["Authorization"] = "Bearer " + encrypt(t, map[string]interface{}{"alg": "RSA-OAEP-256", "enc": "A128GCM", "cty": "JWT"}, &private.PublicKey, []byte(signed))
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+}
+
+func TestNestedToken(t *testing.T) {
+	r := require.New(t)
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	r.NoError(err)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		Type:    "at+jwt",
+		GetDecryptionKey: func(map[string]interface{}) (interface{}, error) {
+			return private, nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.JSON(tokenauth.ClaimsMap(c)))
+	})
+	w := httptest.New(a)
+	get := func(token string) *httptest.Response {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + token
+		return req.Get()
+	}
+	sign := func(typ string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "ada", "exp": time.Now().Add(time.Hour).Unix()})
+		token.Header["typ"] = typ
+		signed, err := token.SignedString([]byte("secret"))
+		r.NoError(err)
+		return signed
+	}
+	envelope := map[string]interface{}{"alg": "RSA-OAEP-256", "enc": "A128GCM", "cty": "JWT", "typ": "JWT"}
+
+	// the header of the signed token is checked, not the one of the envelope
+	res := get(encrypt(t, envelope, &private.PublicKey, []byte(sign("at+jwt"))))
+	r.Equal(http.StatusOK, res.Code)
+	claims := map[string]interface{}{}
+	r.NoError(json.Unmarshal(res.Body.Bytes(), &claims))
+	r.Equal("ada", claims["sub"])
+	r.NotContains(claims, "enc")
+	r.Equal(http.StatusUnauthorized, get(encrypt(t, envelope, &private.PublicKey, []byte(sign("JWT")))).Code)
+
+	// envelopes are not nested twice
+	inner := encrypt(t, envelope, &private.PublicKey, []byte(sign("at+jwt")))
+	r.Equal(http.StatusUnauthorized, get(encrypt(t, envelope, &private.PublicKey, []byte(inner))).Code)
+
+	critical := map[string]interface{}{"alg": "RSA-OAEP-256", "enc": "A128GCM", "cty": "JWT", "crit": []string{"exp"}, "exp": 1}
+	r.Equal(http.StatusUnauthorized, get(encrypt(t, critical, &private.PublicKey, []byte(sign("at+jwt")))).Code)
+}
@@ -0,0 +1,33 @@
+package tokenauth
+
+import (
+	"encoding/json"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/keysource"
+	"github.com/pkg/errors"
+)
+
+// parseJWK parses a key file in JWK format, either a single JWK
+// or a JWK Set containing one key
+func parseJWK(data []byte) (interface{}, error) {
+	var probe struct {
+		Keys json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, errors.Wrap(err, "couldn't parse JWK")
+	}
+	if probe.Keys == nil {
+		return keysource.ParseJWK(data)
+	}
+	keys, err := keysource.ParseJWKSet(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > 1 {
+		return nil, errors.Errorf("JWK Set contains %d keys, use Options.Keys or JWKS to verify with several keys", len(keys))
+	}
+	for _, key := range keys {
+		return key, nil
+	}
+	return nil, nil
+}
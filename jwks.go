@@ -0,0 +1,21 @@
+package tokenauth
+
+import (
+	"github.com/gobuffalo/mw-tokenauth/v2/keysource"
+)
+
+// ErrKeyNotFound is returned if no key matches the kid of the token
+var ErrKeyNotFound = keysource.ErrKeyNotFound
+
+// DefaultJWKSTTL is how long a fetched key set is used before it is refreshed
+const DefaultJWKSTTL = keysource.DefaultJWKSTTL
+
+// JWKSProvider fetches the verification keys from a JWKS endpoint, caches them for TTL,
+// refreshes them in the background and selects the key by the kid header of the token.
+type JWKSProvider = keysource.JWKSProvider
+
+// NewJWKSProvider returns a JWKSProvider for the key set at url,
+// the key set is fetched on first use
+func NewJWKSProvider(url string) *JWKSProvider {
+	return keysource.NewJWKSProvider(url)
+}
@@ -0,0 +1,171 @@
+package tokenauth_test
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// rsaTestKey loads the private key of the test certs
+func rsaTestKey(t testing.TB) *rsa.PrivateKey {
+	data, err := ioutil.ReadFile("test_certs/sample_key")
+	require.NoError(t, err)
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	require.NoError(t, err)
+	return key
+}
+
+// rsaJWK returns the public key as JWK
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// jwksServer serves the keys as JWK Set and counts the requests
+func jwksServer(keys ...map[string]string) (*httptest.Server, *int32) {
+	var hits int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	return ts, &hits
+}
+
+func signRS256(t testing.TB, kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	tokenString, err := token.SignedString(key)
+	require.NoError(t, err)
+	return tokenString
+}
+
+func TestJWKSProvider(t *testing.T) {
+	r := require.New(t)
+	key := rsaTestKey(t)
+	ts, hits := jwksServer(rsaJWK("key-1", &key.PublicKey))
+	defer ts.Close()
+
+	jwks := tokenauth.NewJWKSProvider(ts.URL)
+	jwks.Client = ts.Client()
+	defer jwks.Close()
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		SignMethod: jwt.SigningMethodRS256,
+		JWKS:       jwks,
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := bhttptest.New(a)
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signRS256(t, "key-1", key, claims)
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	// the key set is cached
+	r.Equal(int32(1), atomic.LoadInt32(hits))
+
+	// unknown kids don't refetch the key set right away
+	req.Headers["Authorization"] = "Bearer " + signRS256(t, "key-2", key, claims)
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Equal(int32(1), atomic.LoadInt32(hits))
+}
+
+func TestJWKSProviderOutage(t *testing.T) {
+	r := require.New(t)
+	key := rsaTestKey(t)
+	var hits, failing int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{rsaJWK("key-1", &key.PublicKey)}})
+	}))
+	defer ts.Close()
+
+	jwks := tokenauth.NewJWKSProvider(ts.URL)
+	jwks.Client = ts.Client()
+	jwks.TTL = 50 * time.Millisecond
+	defer jwks.Close()
+	_, err := jwks.Key("key-1")
+	r.NoError(err)
+
+	// the cached keys are used after their TTL while the key set can't be fetched
+	atomic.StoreInt32(&failing, 1)
+	time.Sleep(100 * time.Millisecond)
+	r.True(atomic.LoadInt32(&hits) > 1)
+	before := atomic.LoadInt32(&hits)
+	for i := 0; i < 10; i++ {
+		_, err := jwks.Key("key-1")
+		r.NoError(err)
+	}
+	// the failed fetch is retried once per half TTL, not by every request
+	r.True(atomic.LoadInt32(&hits)-before <= 1)
+}
+
+func TestJWKSProviderHTTPS(t *testing.T) {
+	r := require.New(t)
+	jwks := tokenauth.NewJWKSProvider("http://idp.example.com/jwks.json")
+	defer jwks.Close()
+	_, err := jwks.Key("")
+	r.Error(err)
+	r.Contains(err.Error(), "must use https")
+}
+
+func TestJWKKeyFile(t *testing.T) {
+	r := require.New(t)
+	defer envy.Set("JWT_PUBLIC_KEY", "test_certs/sample_key.pub")
+	key := rsaTestKey(t)
+	single, err := json.Marshal(rsaJWK("key-1", &key.PublicKey))
+	r.NoError(err)
+	set, err := json.Marshal(map[string]interface{}{"keys": []interface{}{rsaJWK("key-1", &key.PublicKey)}})
+	r.NoError(err)
+
+	for _, data := range [][]byte{single, set} {
+		f, err := ioutil.TempFile("", "jwk")
+		r.NoError(err)
+		defer os.Remove(f.Name())
+		_, err = f.Write(data)
+		r.NoError(err)
+		r.NoError(f.Close())
+
+		envy.Set("JWT_PUBLIC_KEY", f.Name())
+		got, err := tokenauth.GetKeyRSA(jwt.SigningMethodRS256)
+		r.NoError(err)
+		r.Equal(&key.PublicKey, got)
+
+		// inline
+		envy.Set("JWT_PUBLIC_KEY", string(data))
+		got, err = tokenauth.GetKeyRSA(jwt.SigningMethodRS256)
+		r.NoError(err)
+		r.Equal(&key.PublicKey, got)
+	}
+}
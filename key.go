@@ -0,0 +1,181 @@
+package tokenauth
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/keysource"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// keyLoader loads the verification key with GetKey and caches it,
+// failed loads are not cached so they are retried on the next call
+type keyLoader struct {
+	mu     sync.RWMutex
+	key    interface{}
+	loaded bool
+	method jwt.SigningMethod
+	getKey func(jwt.SigningMethod) (interface{}, error)
+}
+
+func newKeyLoader(method jwt.SigningMethod, getKey func(jwt.SigningMethod) (interface{}, error)) *keyLoader {
+	return &keyLoader{method: method, getKey: getKey}
+}
+
+// GetKeyProvider adapts a GetKey func to a KeyProvider, the key is loaded on
+// first use and cached, Refresh loads it again. Tokens are verified with the
+// key whatever their kid.
+//
+//	KeyProvider: tokenauth.GetKeyProvider(jwt.SigningMethodRS256, tokenauth.SecretsManagerKey(cfg, "prod/jwt")),
+func GetKeyProvider(method jwt.SigningMethod, getKey func(jwt.SigningMethod) (interface{}, error)) KeyProvider {
+	return newKeyLoader(method, getKey)
+}
+
+// FromKeyfunc returns a KeyProvider calling the jwt.Keyfunc, e.g. the Keyfunc of
+// a JWKSProvider, which refreshes its keys itself
+func FromKeyfunc(keyFunc jwt.Keyfunc) KeyProvider {
+	return keysource.FromKeyfunc(keyFunc)
+}
+
+// Key returns the cached key, loading it on first use
+func (k *keyLoader) Key() (interface{}, error) {
+	k.mu.RLock()
+	if k.loaded {
+		defer k.mu.RUnlock()
+		return k.key, nil
+	}
+	k.mu.RUnlock()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.loaded {
+		return k.key, nil
+	}
+	key, err := k.getKey(k.method)
+	if err != nil {
+		return nil, err
+	}
+	k.key, k.loaded = keysource.VerificationKey(key), true
+	return k.key, nil
+}
+
+// contextKeyProvider calls GetKeyContext with the context of the request for every token
+type contextKeyProvider struct {
+	method jwt.SigningMethod
+	getKey func(ctx context.Context, method jwt.SigningMethod) (interface{}, error)
+}
+
+// KeyFor loads the key with the context of the request
+func (p contextKeyProvider) KeyFor(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	key, err := p.getKey(ctx, p.method)
+	if err != nil {
+		return nil, err
+	}
+	return keysource.VerificationKey(key), nil
+}
+
+// Refresh checks the key can be loaded, nothing is cached
+func (p contextKeyProvider) Refresh(ctx context.Context) error {
+	_, err := p.getKey(ctx, p.method)
+	return err
+}
+
+// KeyFor returns the cached key, loading it on first use
+func (k *keyLoader) KeyFor(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	return k.Key()
+}
+
+// Refresh loads the key again and swaps it in, the
+// current key is kept if loading fails
+func (k *keyLoader) Refresh(ctx context.Context) error {
+	key, err := k.getKey(k.method)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	k.key, k.loaded = keysource.VerificationKey(key), true
+	k.mu.Unlock()
+	return nil
+}
+
+// refreshEvery refreshes the keys of the provider in the background until stop is closed
+func refreshEvery(p KeyProvider, interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.Refresh(context.Background()); err != nil {
+					log.Printf("tokenauth: couldn't refresh key, keeping the current key: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// watchFile reloads the key when the file changes, polling its modification
+// time and size until stop is closed. Failed loads, e.g. of a half
+// written file, are retried on the next poll.
+func (k *keyLoader) watchFile(path string, interval time.Duration, stop <-chan struct{}) {
+	stat := func() (time.Time, int64, bool) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, 0, false
+		}
+		return fi.ModTime(), fi.Size(), true
+	}
+	modTime, size, _ := stat()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+			m, s, ok := stat()
+			if !ok || (m.Equal(modTime) && s == size) {
+				continue
+			}
+			if err := k.Refresh(context.Background()); err != nil {
+				log.Printf("tokenauth: couldn't reload key from %s, keeping the current key: %v", path, err)
+				continue
+			}
+			modTime, size = m, s
+		}
+	}()
+}
+
+// KeysByKid returns a jwt.Keyfunc selecting the verification key by the kid
+// header of the token, tokens with an unknown or without kid are rejected.
+// During a rotation both the old and the new key are registered.
+func KeysByKid(keys map[string]interface{}) jwt.Keyfunc {
+	return keysource.KeysByKid(keys)
+}
+
+// KeysByIssuer returns a jwt.Keyfunc resolving the key by the iss claim of
+// the token, e.g. for multi-tenant apps where every tenant has its own IdP.
+// Tokens of issuers not in the map are rejected with ErrInvalidIssuer. The
+// iss claim is read before the signature is verified, it is trusted once
+// the token is verified with the key of that issuer.
+//
+//	KeyFunc: tokenauth.KeysByIssuer(map[string]jwt.Keyfunc{
+//		"https://tenant-a.example.com": tokenauth.NewJWKSProvider("https://tenant-a.example.com/jwks.json").Keyfunc,
+//		"https://tenant-b.example.com": tokenauth.NewOIDCProvider("https://tenant-b.example.com").Keyfunc,
+//		"https://legacy.example.com":   tokenauth.StaticKey(legacyKey),
+//	})
+func KeysByIssuer(issuers map[string]jwt.Keyfunc) jwt.Keyfunc {
+	return keysource.KeysByIssuer(issuers)
+}
+
+// StaticKey returns a jwt.Keyfunc always returning the key
+func StaticKey(key interface{}) jwt.Keyfunc {
+	return keysource.StaticKey(key)
+}
@@ -0,0 +1,37 @@
+package tokenauth
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/presets"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// NewKeycloakProvider returns the OIDCProvider of the Keycloak realm, baseURL
+// is the URL of the Keycloak server, e.g. "https://sso.example.com", or
+// "https://sso.example.com/auth" for Keycloak before 17
+func NewKeycloakProvider(baseURL, realm string) *OIDCProvider {
+	return NewOIDCProvider(presets.KeycloakIssuer(baseURL, realm))
+}
+
+// Keycloak returns the middleware validating the tokens of the Keycloak realm,
+// the roles of the tokens are read with KeycloakAccessFromContext
+//
+//	app.Use(tokenauth.Keycloak("https://sso.example.com", "shop"))
+func Keycloak(baseURL, realm string) buffalo.MiddlewareFunc {
+	return New(Options{OIDC: NewKeycloakProvider(baseURL, realm)})
+}
+
+// KeycloakAccess are the roles granted by a Keycloak token in the nested
+// realm_access and resource_access claims
+type KeycloakAccess = presets.KeycloakAccess
+
+// KeycloakAccessFromClaims returns the roles granted by the claims
+func KeycloakAccessFromClaims(claims jwt.MapClaims) KeycloakAccess {
+	return presets.KeycloakAccessFromClaims(claims)
+}
+
+// KeycloakAccessFromContext returns the roles granted by the verified
+// token of the request, none if the request isn't authenticated
+func KeycloakAccessFromContext(c buffalo.Context) KeycloakAccess {
+	return presets.KeycloakAccessFromClaims(ClaimsMap(c))
+}
@@ -0,0 +1,57 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeycloakProvider(t *testing.T) {
+	r := require.New(t)
+	r.Equal("https://sso.example.com/realms/shop", tokenauth.NewKeycloakProvider("https://sso.example.com/", "shop").Issuer)
+	r.Equal("https://sso.example.com/auth/realms/shop", tokenauth.NewKeycloakProvider("https://sso.example.com/auth", "shop").Issuer)
+}
+
+func TestKeycloakAccess(t *testing.T) {
+	r := require.New(t)
+	var access tokenauth.KeycloakAccess
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{KeyFunc: tokenauth.StaticKey([]byte("secret"))}))
+	a.GET("/", func(c buffalo.Context) error {
+		access = tokenauth.KeycloakAccessFromContext(c)
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{
+		"exp":          time.Now().Add(time.Minute * 5).Unix(),
+		"realm_access": map[string]interface{}{"roles": []string{"offline_access", "admin"}},
+		"resource_access": map[string]interface{}{
+			"shop-api": map[string]interface{}{"roles": []string{"orders:write"}},
+			"account":  map[string]interface{}{"roles": []string{"view-profile"}},
+		},
+	}, "secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+	r.Equal([]string{"offline_access", "admin"}, access.RealmRoles)
+	r.True(access.HasRealmRole("admin"))
+	r.False(access.HasRealmRole("orders:write"))
+	r.True(access.HasResourceRole("shop-api", "orders:write"))
+	r.False(access.HasResourceRole("account", "orders:write"))
+	r.False(access.HasResourceRole("billing", "orders:write"))
+
+	// tokens of other IdPs grant no roles
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{
+		"exp":          time.Now().Add(time.Minute * 5).Unix(),
+		"realm_access": "admin",
+	}, "secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+	r.Empty(access.RealmRoles)
+	r.False(access.HasRealmRole("admin"))
+}
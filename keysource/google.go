@@ -0,0 +1,120 @@
+package keysource
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// FirebaseCertsURL is where Google publishes the certificates
+// Firebase Auth ID tokens are signed with
+const FirebaseCertsURL = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+
+// GoogleCerts fetches Google's public signing certificates, a JSON object of
+// PEM certificates by kid, and caches them for the max-age of the response.
+// The cached certificates are used as long as a refresh fails.
+type GoogleCerts struct {
+	// URL of the certificates, it must use https
+	URL string
+	// Client used to fetch the certificates, defaults to a client with a 10s timeout
+	Client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	expires time.Time
+}
+
+// NewGoogleCerts returns a GoogleCerts for the certificates at url,
+// they are fetched on first use
+func NewGoogleCerts(url string) *GoogleCerts {
+	return &GoogleCerts{URL: url}
+}
+
+// Keyfunc is a jwt.Keyfunc returning the key for the kid header of the token
+func (g *GoogleCerts) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	return g.Key(kid)
+}
+
+// Key returns the key of the certificate with the kid
+func (g *GoogleCerts) Key(kid string) (interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.keys == nil || time.Now().After(g.expires) {
+		if err := g.fetch(); err != nil && g.keys == nil {
+			return nil, err
+		}
+	}
+	if key, ok := g.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// fetch gets the certificates, g.mu is held by the caller
+func (g *GoogleCerts) fetch() error {
+	u, err := url.Parse(g.URL)
+	if err != nil {
+		return errors.Wrap(err, "invalid certificates url")
+	}
+	if u.Scheme != "https" {
+		return errors.Errorf("certificates url %s must use https", g.URL)
+	}
+	client := g.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res, err := client.Get(g.URL)
+	if err != nil {
+		return errors.Wrap(err, "couldn't fetch certificates")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("couldn't fetch certificates: %s", res.Status)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "couldn't fetch certificates")
+	}
+	certs := map[string]string{}
+	if err := json.Unmarshal(body, &certs); err != nil {
+		return errors.Wrap(err, "couldn't parse certificates")
+	}
+	keys := make(map[string]interface{}, len(certs))
+	for kid, cert := range certs {
+		block, _ := pem.Decode([]byte(cert))
+		if block == nil {
+			return errors.Errorf("couldn't parse certificate %s", kid)
+		}
+		key, err := CertificateKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+		keys[kid] = key
+	}
+	g.keys, g.expires = keys, time.Now().Add(maxAge(res.Header.Get("Cache-Control")))
+	return nil
+}
+
+// maxAge returns the max-age of the Cache-Control header, DefaultJWKSTTL if it has none
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return DefaultJWKSTTL
+}
@@ -0,0 +1,216 @@
+package keysource
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrKeyNotFound is returned if no key matches the kid of the token
+var ErrKeyNotFound = errors.New("verification key not found")
+
+const (
+	// DefaultJWKSTTL is how long a fetched key set is used before it is refreshed
+	DefaultJWKSTTL = 10 * time.Minute
+	// jwksMinRefresh limits refetching on unknown kids, which can't be used to hammer the IdP
+	jwksMinRefresh = time.Minute
+)
+
+// JWKSProvider fetches the verification keys from a JWKS endpoint, caches them for TTL,
+// refreshes them in the background and selects the key by the kid header of the token.
+// The cached keys are used past their TTL while the endpoint fails, failed fetches
+// are retried at most once per minute, or per half TTL if that is shorter.
+type JWKSProvider struct {
+	// URL of the key set, it must use https
+	URL string
+	// TTL of the cached key set, defaults to DefaultJWKSTTL
+	TTL time.Duration
+	// Client used to fetch the key set, defaults to a client with a 10s timeout
+	Client *http.Client
+
+	mu      sync.RWMutex
+	keys    map[string]interface{}
+	fetched time.Time
+	fetchMu sync.Mutex
+	// attempted is the time of the last fetch, fetchErr its error
+	attempted time.Time
+	fetchErr  error
+	once      sync.Once
+	stop      chan struct{}
+}
+
+// NewJWKSProvider returns a JWKSProvider for the key set at url,
+// the key set is fetched on first use
+func NewJWKSProvider(url string) *JWKSProvider {
+	return &JWKSProvider{
+		URL:  url,
+		stop: make(chan struct{}),
+	}
+}
+
+// Keyfunc is a jwt.Keyfunc returning the key for the kid header of the token
+func (p *JWKSProvider) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	return p.Key(kid)
+}
+
+// Key returns the key with the given kid, if the kid is empty and the set
+// contains a single key that key is returned. Unknown kids trigger a refetch
+// of the key set, since the IdP might have rotated its keys.
+func (p *JWKSProvider) Key(kid string) (interface{}, error) {
+	p.once.Do(p.startRefresh)
+	keys, fetched := p.cached()
+	if keys == nil || time.Since(fetched) > p.ttl() {
+		// stale keys are better than none while the IdP is unavailable
+		if err := p.fetch(fetched); err != nil && keys == nil {
+			return nil, err
+		}
+		keys, fetched = p.cached()
+	}
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+	if time.Since(fetched) < jwksMinRefresh {
+		return nil, ErrKeyNotFound
+	}
+	if err := p.fetch(fetched); err != nil {
+		return nil, err
+	}
+	keys, _ = p.cached()
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// Refresh fetches the key set now
+func (p *JWKSProvider) Refresh() error {
+	_, fetched := p.cached()
+	return p.fetch(fetched)
+}
+
+// Close stops the background refresh
+func (p *JWKSProvider) Close() {
+	p.once.Do(func() {})
+	if p.stop == nil {
+		return
+	}
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+}
+
+func (p *JWKSProvider) cached() (map[string]interface{}, time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.keys, p.fetched
+}
+
+func (p *JWKSProvider) ttl() time.Duration {
+	if p.TTL > 0 {
+		return p.TTL
+	}
+	return DefaultJWKSTTL
+}
+
+// retryAfter is how long a failed fetch is not retried, keys
+// of short lived sets aren't used long after their TTL
+func (p *JWKSProvider) retryAfter() time.Duration {
+	if p.ttl()/2 < jwksMinRefresh {
+		return p.ttl() / 2
+	}
+	return jwksMinRefresh
+}
+
+// fetch gets the key set, concurrent callers which saw the same
+// fetch time wait for a single request instead of sending their own.
+// After a failed fetch, the error is returned without fetching again
+// for retryAfter, so requests don't queue up behind the timeouts
+func (p *JWKSProvider) fetch(seen time.Time) error {
+	p.fetchMu.Lock()
+	defer p.fetchMu.Unlock()
+	if _, fetched := p.cached(); fetched.After(seen) {
+		return nil
+	}
+	if p.fetchErr != nil && time.Since(p.attempted) < p.retryAfter() {
+		return p.fetchErr
+	}
+	p.attempted = time.Now()
+	p.fetchErr = p.get()
+	return p.fetchErr
+}
+
+// get fetches and parses the key set
+func (p *JWKSProvider) get() error {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return errors.Wrap(err, "invalid JWKS url")
+	}
+	if u.Scheme != "https" {
+		return errors.Errorf("JWKS url %s must use https", p.URL)
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res, err := client.Get(p.URL)
+	if err != nil {
+		return errors.Wrap(err, "couldn't fetch JWKS")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("couldn't fetch JWKS: %s", res.Status)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "couldn't fetch JWKS")
+	}
+	keys, err := ParseJWKSet(body)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.keys, p.fetched = keys, time.Now()
+	p.mu.Unlock()
+	return nil
+}
+
+// startRefresh refreshes the key set in the background,
+// so requests don't wait for the IdP when the cache expires
+func (p *JWKSProvider) startRefresh() {
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+	}
+	go func() {
+		ticker := time.NewTicker(p.ttl() / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				// errors are retried on the next tick or request
+				_ = p.Refresh()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+func lookupKey(keys map[string]interface{}, kid string) (interface{}, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,126 @@
+// Package keysource provides the keys tokens are verified with: key sets
+// fetched from JWKS endpoints, OpenID Connect discovery, Google's signing
+// certificates and SPIFFE trust bundles, and jwt.Keyfuncs selecting the key
+// by kid or issuer.
+package keysource
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"time"
+
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// KeyProvider returns the key a token is verified with, e.g. selected by the
+// kid header of the token from a key set. The context is the one of the request.
+// Refresh reloads the keys, it is called before the first request to fail early
+// and on every refresh interval. Implementations must be safe for concurrent use
+type KeyProvider interface {
+	KeyFor(ctx context.Context, token *jwt.Token) (interface{}, error)
+	Refresh(ctx context.Context) error
+}
+
+// KeyProviderFunc is a func implementing KeyProvider, it has nothing to refresh
+type KeyProviderFunc func(ctx context.Context, token *jwt.Token) (interface{}, error)
+
+// KeyFor calls f
+func (f KeyProviderFunc) KeyFor(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	return f(ctx, token)
+}
+
+// Refresh does nothing
+func (f KeyProviderFunc) Refresh(ctx context.Context) error {
+	return nil
+}
+
+// FromKeyfunc returns a KeyProvider calling the jwt.Keyfunc, e.g. the Keyfunc of
+// a JWKSProvider, which refreshes its keys itself
+func FromKeyfunc(keyFunc jwt.Keyfunc) KeyProvider {
+	return KeyProviderFunc(func(ctx context.Context, token *jwt.Token) (interface{}, error) {
+		return keyFunc(token)
+	})
+}
+
+// KeysByKid returns a jwt.Keyfunc selecting the verification key by the kid
+// header of the token, tokens with an unknown or without kid are rejected.
+// During a rotation both the old and the new key are registered.
+func KeysByKid(keys map[string]interface{}) jwt.Keyfunc {
+	prepared := make(map[string]interface{}, len(keys))
+	for kid, key := range keys {
+		prepared[kid] = VerificationKey(key)
+	}
+	keys = prepared
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		return nil, ErrKeyNotFound
+	}
+}
+
+// KeysByIssuer returns a jwt.Keyfunc resolving the key by the iss claim of
+// the token, e.g. for multi-tenant apps where every tenant has its own IdP.
+// Tokens of issuers not in the map are rejected with ErrInvalidIssuer. The
+// iss claim is read before the signature is verified, it is trusted once
+// the token is verified with the key of that issuer.
+//
+//	KeyFunc: keysource.KeysByIssuer(map[string]jwt.Keyfunc{
+//		"https://tenant-a.example.com": keysource.NewJWKSProvider("https://tenant-a.example.com/jwks.json").Keyfunc,
+//		"https://tenant-b.example.com": keysource.NewOIDCProvider("https://tenant-b.example.com").Keyfunc,
+//		"https://legacy.example.com":   keysource.StaticKey(legacyKey),
+//	})
+func KeysByIssuer(issuers map[string]jwt.Keyfunc) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		mc, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return nil, guard.ErrInvalidIssuer
+		}
+		iss, _ := mc["iss"].(string)
+		keyFunc, ok := issuers[iss]
+		if !ok {
+			return nil, guard.ErrInvalidIssuer
+		}
+		return keyFunc(token)
+	}
+}
+
+// StaticKey returns a jwt.Keyfunc always returning the key
+func StaticKey(key interface{}) jwt.Keyfunc {
+	key = VerificationKey(key)
+	return func(*jwt.Token) (interface{}, error) {
+		return key, nil
+	}
+}
+
+// VerificationKey derives the key the signature is verified with once when the
+// key is loaded instead of on every request, e.g. the public key of a private
+// key or certificate. The verifiers of the sign methods only accept public keys.
+func VerificationKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case *x509.Certificate:
+		return k.PublicKey
+	case crypto.Signer:
+		// e.g. *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey
+		return k.Public()
+	}
+	return key
+}
+
+// CertificateKey returns the public key of the X.509 certificate, if JWT_CERT_CHECK_EXPIRY
+// is true expired certificates are rejected
+func CertificateKey(der []byte) (interface{}, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse certificate")
+	}
+	if envy.Get("JWT_CERT_CHECK_EXPIRY", "false") == "true" && time.Now().After(cert.NotAfter) {
+		return nil, errors.Errorf("certificate %q expired on %s", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+	}
+	return cert.PublicKey, nil
+}
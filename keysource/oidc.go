@@ -0,0 +1,116 @@
+package keysource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// OIDCProvider verifies the tokens of an OpenID Connect IdP, the JWKS is
+// resolved from the discovery document of the issuer and the iss claim of
+// the tokens must be the issuer.
+//
+//	app.Use(tokenauth.New(tokenauth.Options{
+//		OIDC: keysource.NewOIDCProvider("https://accounts.example.com"),
+//	}))
+type OIDCProvider struct {
+	// Issuer is the issuer URL, the discovery document is
+	// fetched from Issuer/.well-known/openid-configuration
+	Issuer string
+	// Client used to fetch the discovery document and
+	// the key set, defaults to a client with a 10s timeout
+	Client *http.Client
+
+	mu   sync.Mutex
+	jwks *JWKSProvider
+}
+
+// NewOIDCProvider returns an OIDCProvider for the issuer,
+// the discovery document is fetched on first use
+func NewOIDCProvider(issuer string) *OIDCProvider {
+	return &OIDCProvider{Issuer: issuer}
+}
+
+// Keyfunc is a jwt.Keyfunc rejecting tokens of other issuers and
+// returning the key for the kid header from the key set of the IdP
+func (p *OIDCProvider) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if mc, ok := token.Claims.(jwt.MapClaims); !ok || mc["iss"] != p.Issuer {
+		return nil, guard.ErrInvalidIssuer
+	}
+	jwks, err := p.keySet()
+	if err != nil {
+		return nil, err
+	}
+	return jwks.Keyfunc(token)
+}
+
+// Close stops the background refresh of the key set
+func (p *OIDCProvider) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.jwks != nil {
+		p.jwks.Close()
+	}
+}
+
+// keySet returns the JWKSProvider of the IdP, discovering it on first use,
+// failed discoveries are retried on the next call
+func (p *OIDCProvider) keySet() (*JWKSProvider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.jwks != nil {
+		return p.jwks, nil
+	}
+	jwksURI, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	p.jwks = NewJWKSProvider(jwksURI)
+	p.jwks.Client = p.Client
+	return p.jwks, nil
+}
+
+// discover fetches the discovery document and returns the jwks_uri
+func (p *OIDCProvider) discover() (string, error) {
+	u, err := url.Parse(p.Issuer)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid OIDC issuer")
+	}
+	if u.Scheme != "https" {
+		return "", errors.Errorf("OIDC issuer %s must use https", p.Issuer)
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res, err := client.Get(strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't fetch OIDC discovery document")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("couldn't fetch OIDC discovery document: %s", res.Status)
+	}
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return "", errors.Wrap(err, "couldn't parse OIDC discovery document")
+	}
+	// OpenID Connect Discovery section 4.3
+	if doc.Issuer != p.Issuer {
+		return "", errors.Errorf("OIDC discovery document is for issuer %q, expected %q", doc.Issuer, p.Issuer)
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("OIDC discovery document has no jwks_uri")
+	}
+	return doc.JWKSURI, nil
+}
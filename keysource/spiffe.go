@@ -0,0 +1,160 @@
+package keysource
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultSPIFFERefresh is how long a bundle without spiffe_refresh_hint is used
+const defaultSPIFFERefresh = 5 * time.Minute
+
+// ParseSPIFFEBundle parses the JWT-SVID keys of a SPIFFE bundle by kid and its
+// refresh hint. Keys of other uses, e.g. the x509-svid CA certificates, are skipped.
+func ParseSPIFFEBundle(data []byte) (map[string]interface{}, time.Duration, error) {
+	var bundle struct {
+		Keys        []json.RawMessage `json:"keys"`
+		RefreshHint int64             `json:"spiffe_refresh_hint"`
+	}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, 0, errors.Wrap(err, "couldn't parse SPIFFE bundle")
+	}
+	keys := map[string]interface{}{}
+	for _, raw := range bundle.Keys {
+		k := jwk{}
+		if err := json.Unmarshal(raw, &k); err != nil || k.Use != "jwt-svid" || k.Kid == "" || k.Kty == "oct" {
+			continue
+		}
+		key, err := k.Key()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, 0, errors.New("SPIFFE bundle contains no JWT-SVID keys")
+	}
+	return keys, time.Duration(bundle.RefreshHint) * time.Second, nil
+}
+
+// SPIFFEBundle is the trust bundle of a SPIFFE trust domain, the keys the JWT-SVIDs
+// of its workloads are signed with. It is fetched from the bundle endpoint of the
+// domain or read from a file, e.g. the bundle spiffe-helper writes from the Workload
+// API, and reloaded after its refresh hint. The current keys are kept if reloading fails.
+type SPIFFEBundle struct {
+	// TrustDomain is the name of the domain, e.g. "example.org"
+	TrustDomain string
+	// URL of the bundle endpoint of the domain, it must use https
+	URL string
+	// File the bundle is read from if URL is empty
+	File string
+	// Client used to fetch the bundle, defaults to a client with a 10s timeout
+	Client *http.Client
+
+	mu      sync.RWMutex
+	keys    map[string]interface{}
+	expires time.Time
+	fetchMu sync.Mutex
+}
+
+// Key returns the JWT-SVID key with the kid, the bundle is loaded on first
+// use and when its refresh hint passed
+func (b *SPIFFEBundle) Key(ctx context.Context, kid string) (interface{}, error) {
+	keys, expires := b.cached()
+	if keys == nil || time.Now().After(expires) {
+		if err := b.load(ctx, expires); err != nil {
+			if keys == nil {
+				return nil, err
+			}
+			// retry later instead of on every request
+			b.mu.Lock()
+			b.expires = time.Now().Add(jwksMinRefresh)
+			b.mu.Unlock()
+		}
+		keys, _ = b.cached()
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// Refresh loads the bundle now
+func (b *SPIFFEBundle) Refresh(ctx context.Context) error {
+	_, expires := b.cached()
+	return b.load(ctx, expires)
+}
+
+func (b *SPIFFEBundle) cached() (map[string]interface{}, time.Time) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.keys, b.expires
+}
+
+// load reads the bundle, concurrent callers which saw the same
+// expiry wait for a single load instead of loading it again
+func (b *SPIFFEBundle) load(ctx context.Context, seen time.Time) error {
+	b.fetchMu.Lock()
+	defer b.fetchMu.Unlock()
+	if _, expires := b.cached(); !expires.Equal(seen) {
+		return nil
+	}
+	var data []byte
+	var err error
+	switch {
+	case b.URL != "":
+		data, err = b.fetch(ctx)
+	case b.File != "":
+		data, err = ioutil.ReadFile(b.File)
+	default:
+		err = errors.Errorf("SPIFFE bundle of %s has neither URL nor File", b.TrustDomain)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "couldn't load SPIFFE bundle of %s", b.TrustDomain)
+	}
+	keys, refresh, err := ParseSPIFFEBundle(data)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't load SPIFFE bundle of %s", b.TrustDomain)
+	}
+	if refresh <= 0 {
+		refresh = defaultSPIFFERefresh
+	}
+	b.mu.Lock()
+	b.keys, b.expires = keys, time.Now().Add(refresh)
+	b.mu.Unlock()
+	return nil
+}
+
+// fetch gets the bundle from the bundle endpoint
+func (b *SPIFFEBundle) fetch(ctx context.Context) ([]byte, error) {
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid bundle endpoint url")
+	}
+	if u.Scheme != "https" {
+		return nil, errors.Errorf("bundle endpoint url %s must use https", b.URL)
+	}
+	client := b.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequest(http.MethodGet, b.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
@@ -0,0 +1,237 @@
+package tokenauth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/envy"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// keyVaultResource is the resource access tokens of Key Vault are issued for
+	keyVaultResource = "https://vault.azure.net"
+	// keyVaultAPIVersion is the version of the Key Vault REST API
+	keyVaultAPIVersion = "7.4"
+)
+
+// AzureConfig is the credentials Azure Key Vault is called with, the fields
+// default to the env variables of the Azure SDKs. Without a client secret the
+// managed identity of the App Service, Functions app or VM is used, ClientID
+// selects a user-assigned identity.
+type AzureConfig struct {
+	// TenantID defaults to AZURE_TENANT_ID
+	TenantID string
+	// ClientID defaults to AZURE_CLIENT_ID
+	ClientID string
+	// ClientSecret of a service principal, defaults to AZURE_CLIENT_SECRET
+	ClientSecret string
+	// Client used to call the APIs, defaults to a client with a 10s timeout
+	Client *http.Client
+}
+
+// withDefaults fills the unset fields from the env
+func (cfg AzureConfig) withDefaults() AzureConfig {
+	if cfg.TenantID == "" {
+		cfg.TenantID = envy.Get("AZURE_TENANT_ID", "")
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = envy.Get("AZURE_CLIENT_ID", "")
+	}
+	if cfg.ClientSecret == "" {
+		cfg.ClientSecret = envy.Get("AZURE_CLIENT_SECRET", "")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return cfg
+}
+
+// azureToken caches the access token of a key loader, the token endpoint of
+// managed identities is throttled, so tokens are reused until shortly before
+// they expire
+type azureToken struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// get returns the cached token or requests a new one
+func (t *azureToken) get(ctx context.Context, cfg AzureConfig) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Add(5*time.Minute).Before(t.expires) {
+		return t.token, nil
+	}
+	req, err := cfg.tokenRequest()
+	if err != nil {
+		return "", err
+	}
+	res, err := cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't get Azure access token")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("couldn't get Azure access token: %s", res.Status)
+	}
+	// managed identities send the times as strings, Azure AD as numbers
+	var out struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresOn   interface{} `json:"expires_on"`
+		ExpiresIn   interface{} `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil || out.AccessToken == "" {
+		return "", errors.New("couldn't get Azure access token: no access_token in response")
+	}
+	t.token, t.expires = out.AccessToken, time.Now().Add(5*time.Minute)
+	if on, ok := seconds(out.ExpiresOn); ok {
+		t.expires = time.Unix(on, 0)
+	} else if in, ok := seconds(out.ExpiresIn); ok {
+		t.expires = time.Now().Add(time.Duration(in) * time.Second)
+	}
+	return t.token, nil
+}
+
+// seconds reads a number of seconds encoded as JSON number or string
+func seconds(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return int64(v), true
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// tokenRequest returns the request of an access token for Key Vault: the client
+// credentials grant of Azure AD for service principals, else the managed identity
+// endpoint of App Service and Functions in IDENTITY_ENDPOINT or the one of VMs
+func (cfg AzureConfig) tokenRequest() (*http.Request, error) {
+	if cfg.ClientSecret != "" {
+		if cfg.TenantID == "" || cfg.ClientID == "" {
+			return nil, errors.New("Azure client secret requires AZURE_TENANT_ID and AZURE_CLIENT_ID")
+		}
+		authority := strings.TrimSuffix(envy.Get("AZURE_AUTHORITY_HOST", "https://login.microsoftonline.com"), "/")
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {cfg.ClientID},
+			"client_secret": {cfg.ClientSecret},
+			"scope":         {keyVaultResource + "/.default"},
+		}
+		req, err := http.NewRequest(http.MethodPost, authority+"/"+url.PathEscape(cfg.TenantID)+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid AZURE_AUTHORITY_HOST")
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}
+	query := url.Values{"resource": {keyVaultResource}}
+	if cfg.ClientID != "" {
+		query.Set("client_id", cfg.ClientID)
+	}
+	if endpoint := envy.Get("IDENTITY_ENDPOINT", ""); endpoint != "" {
+		query.Set("api-version", "2019-08-01")
+		req, err := http.NewRequest(http.MethodGet, endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid IDENTITY_ENDPOINT")
+		}
+		req.Header.Set("X-IDENTITY-HEADER", envy.Get("IDENTITY_HEADER", ""))
+		return req, nil
+	}
+	query.Set("api-version", "2018-02-01")
+	req, err := http.NewRequest(http.MethodGet, "http://169.254.169.254/metadata/identity/oauth2/token?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	return req, nil
+}
+
+// keyVault gets an object of the vault, e.g. secrets/name, with the cached token
+func (cfg AzureConfig) keyVault(ctx context.Context, token *azureToken, vaultURL, path string, out interface{}) error {
+	cfg = cfg.withDefaults()
+	accessToken, err := token.get(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(vaultURL, "/")+"/"+path+"?api-version="+keyVaultAPIVersion, nil)
+	if err != nil {
+		return errors.Wrap(err, "invalid Key Vault url")
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	res, err := cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "couldn't call Key Vault")
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "couldn't call Key Vault")
+	}
+	if res.StatusCode != http.StatusOK {
+		var kvErr struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &kvErr)
+		return errors.Errorf("Key Vault %s failed: %s %s %s", path, res.Status, kvErr.Error.Code, kvErr.Error.Message)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// KeyVaultSecret returns a GetKey loading the key from the Azure Key Vault
+// secret at vaultURL (e.g. "https://my-vault.vault.azure.net"), the current
+// version unless name is "name/version". The secret of HMAC methods is the
+// value itself, public keys are PEM or JWK encoded. The access token is
+// cached, to pick up new versions of the secret set the KeyRefreshInterval.
+//
+//	GetKey:             tokenauth.KeyVaultSecret(tokenauth.AzureConfig{}, "https://my-vault.vault.azure.net", "jwt-secret"),
+//	KeyRefreshInterval: time.Hour,
+func KeyVaultSecret(cfg AzureConfig, vaultURL, name string) func(jwt.SigningMethod) (interface{}, error) {
+	token := &azureToken{}
+	return func(method jwt.SigningMethod) (interface{}, error) {
+		var out struct {
+			Value string `json:"value"`
+		}
+		if err := cfg.keyVault(context.Background(), token, vaultURL, "secrets/"+name, &out); err != nil {
+			return nil, err
+		}
+		return parseKey(method, []byte(out.Value))
+	}
+}
+
+// KeyVaultKey returns a GetKey loading the public key of the Azure Key Vault
+// key at vaultURL, the current version unless name is "name/version". The
+// private key never leaves the vault, including keys protected by an HSM.
+func KeyVaultKey(cfg AzureConfig, vaultURL, name string) func(jwt.SigningMethod) (interface{}, error) {
+	token := &azureToken{}
+	return func(method jwt.SigningMethod) (interface{}, error) {
+		var out struct {
+			Key map[string]interface{} `json:"key"`
+		}
+		if err := cfg.keyVault(context.Background(), token, vaultURL, "keys/"+name, &out); err != nil {
+			return nil, err
+		}
+		// the kty of HSM keys is RSA-HSM or EC-HSM, their public keys are plain JWKs
+		if kty, ok := out.Key["kty"].(string); ok {
+			out.Key["kty"] = strings.TrimSuffix(kty, "-HSM")
+		}
+		data, err := json.Marshal(out.Key)
+		if err != nil {
+			return nil, err
+		}
+		return parseKey(method, data)
+	}
+}
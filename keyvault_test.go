@@ -0,0 +1,110 @@
+package tokenauth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// keyVaultServer answers Azure AD, the managed identity endpoint and Key Vault,
+// it counts the issued access tokens
+func keyVaultServer(t *testing.T) (*httptest.Server, *int32) {
+	var tokens int32
+	key := rsaJWK("", &rsaTestKey(t).PublicKey)
+	key["kty"] = "RSA-HSM"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		atomic.AddInt32(&tokens, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "aad-token", "expires_in": 3599})
+	})
+	mux.HandleFunc("/msi/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-IDENTITY-HEADER") != "identity" || r.URL.Query().Get("resource") != "https://vault.azure.net" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&tokens, 1)
+		expires := strconv.FormatInt(time.Now().Add(24*time.Hour).Unix(), 10)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "msi-token", "expires_on": expires})
+	})
+	vault := func(res interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			if (auth != "Bearer aad-token" && auth != "Bearer msi-token") || r.URL.Query().Get("api-version") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"code": "Unauthorized"}})
+				return
+			}
+			json.NewEncoder(w).Encode(res)
+		}
+	}
+	mux.HandleFunc("/secrets/jwt-secret", vault(map[string]string{"value": "azure-secret"}))
+	mux.HandleFunc("/keys/jwt/1", vault(map[string]interface{}{"key": key}))
+	return httptest.NewTLSServer(mux), &tokens
+}
+
+func TestKeyVaultSecret(t *testing.T) {
+	r := require.New(t)
+	ts, tokens := keyVaultServer(t)
+	defer ts.Close()
+	envy.Set("AZURE_AUTHORITY_HOST", ts.URL)
+	defer envy.Set("AZURE_AUTHORITY_HOST", "")
+	cfg := tokenauth.AzureConfig{TenantID: "tenant", ClientID: "app", ClientSecret: "secret", Client: ts.Client()}
+
+	getKey := tokenauth.KeyVaultSecret(cfg, ts.URL, "jwt-secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{GetKey: getKey}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := bhttptest.New(a)
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}, "azure-secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	// the access token is reused on refreshes
+	_, err := getKey(jwt.SigningMethodHS256)
+	r.NoError(err)
+	r.Equal(int32(1), atomic.LoadInt32(tokens))
+
+	cfg.ClientSecret = "wrong"
+	_, err = tokenauth.KeyVaultSecret(cfg, ts.URL, "jwt-secret")(jwt.SigningMethodHS256)
+	r.Error(err)
+	r.Contains(err.Error(), "access token")
+}
+
+func TestKeyVaultKeyManagedIdentity(t *testing.T) {
+	r := require.New(t)
+	ts, tokens := keyVaultServer(t)
+	defer ts.Close()
+	envy.Set("IDENTITY_ENDPOINT", ts.URL+"/msi/token")
+	envy.Set("IDENTITY_HEADER", "identity")
+	defer envy.Set("IDENTITY_ENDPOINT", "")
+	cfg := tokenauth.AzureConfig{Client: ts.Client()}
+
+	getKey := tokenauth.KeyVaultKey(cfg, ts.URL, "jwt/1")
+	key, err := getKey(jwt.SigningMethodRS256)
+	r.NoError(err)
+	r.Equal(&rsaTestKey(t).PublicKey, key)
+	_, err = getKey(jwt.SigningMethodRS256)
+	r.NoError(err)
+	r.Equal(int32(1), atomic.LoadInt32(tokens))
+
+	_, err = tokenauth.KeyVaultKey(cfg, ts.URL, "jwt/2")(jwt.SigningMethodRS256)
+	r.Error(err)
+	r.Contains(err.Error(), "404")
+}
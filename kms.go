@@ -0,0 +1,139 @@
+package tokenauth
+
+import (
+	"context"
+	"crypto"
+	// the hashes of the KMS signing algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// KMSKey is the AWS KMS key tokens are verified with by the KMS backend,
+// its key ARN, alias ARN, key ID or alias name. The region of ARNs is used
+// for the call to KMS, the region of the AWSConfig otherwise.
+type KMSKey string
+
+// KMS is a CryptoBackend verifying the signatures with the Verify call of AWS KMS,
+// for asymmetric keys which can't be exported. Every token is verified with a call
+// to KMS, consider a VerifyLimiter to bound them. Tokens are rejected with 401 if
+// KMS can't be called.
+//
+//	app.Use(tokenauth.New(tokenauth.Options{
+//		SignMethod:    jwt.SigningMethodRS256,
+//		CryptoBackend: tokenauth.KMS{},
+//		KeyFunc:       tokenauth.StaticKey(tokenauth.KMSKey("arn:aws:kms:eu-west-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab")),
+//	}))
+type KMS struct {
+	AWSConfig
+}
+
+// kmsAlgorithms are the KMS signing algorithms of the JWS algs
+var kmsAlgorithms = map[string]struct {
+	name string
+	hash crypto.Hash
+}{
+	"RS256": {"RSASSA_PKCS1_V1_5_SHA_256", crypto.SHA256},
+	"RS384": {"RSASSA_PKCS1_V1_5_SHA_384", crypto.SHA384},
+	"RS512": {"RSASSA_PKCS1_V1_5_SHA_512", crypto.SHA512},
+	"PS256": {"RSASSA_PSS_SHA_256", crypto.SHA256},
+	"PS384": {"RSASSA_PSS_SHA_384", crypto.SHA384},
+	"PS512": {"RSASSA_PSS_SHA_512", crypto.SHA512},
+	"ES256": {"ECDSA_SHA_256", crypto.SHA256},
+	"ES384": {"ECDSA_SHA_384", crypto.SHA384},
+	"ES512": {"ECDSA_SHA_512", crypto.SHA512},
+}
+
+// Name returns "aws-kms"
+func (k KMS) Name() string {
+	return "aws-kms"
+}
+
+// SigningMethod returns the method verifying the alg with KMS, RSA and ECDSA algs are supported
+func (k KMS) SigningMethod(alg string) jwt.SigningMethod {
+	a, ok := kmsAlgorithms[alg]
+	if !ok {
+		return nil
+	}
+	return &kmsMethod{alg: alg, kmsAlg: a.name, hash: a.hash, cfg: k.AWSConfig}
+}
+
+// kmsMethod verifies the signatures of the alg with KMS
+type kmsMethod struct {
+	alg    string
+	kmsAlg string
+	hash   crypto.Hash
+	cfg    AWSConfig
+}
+
+func (m *kmsMethod) Alg() string {
+	return m.alg
+}
+
+// Verify verifies the signature of the digest of the signing string with
+// the KMSKey, ECDSA signatures are converted to the DER encoding of KMS
+func (m *kmsMethod) Verify(signingString, signature string, key interface{}) error {
+	keyID, ok := key.(KMSKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(m.alg, "ES") {
+		if sig, err = ecdsaDER(sig); err != nil {
+			return err
+		}
+	}
+	h := m.hash.New()
+	h.Write([]byte(signingString))
+
+	cfg := m.cfg
+	// arn:aws:kms:region:account:key/id
+	if parts := strings.Split(string(keyID), ":"); len(parts) > 3 && parts[0] == "arn" {
+		cfg.Region = parts[3]
+	}
+	in := map[string]interface{}{
+		"KeyId":            string(keyID),
+		"Message":          h.Sum(nil),
+		"MessageType":      "DIGEST",
+		"Signature":        sig,
+		"SigningAlgorithm": m.kmsAlg,
+	}
+	var out struct {
+		SignatureValid bool
+	}
+	if err := cfg.call(context.Background(), "kms", "TrentService.Verify", in, &out); err != nil {
+		if strings.Contains(err.Error(), "KMSInvalidSignatureException") {
+			return jwt.ErrSignatureInvalid
+		}
+		return err
+	}
+	if !out.SignatureValid {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Sign is not supported, the tokens are signed by the issuer
+func (m *kmsMethod) Sign(string, interface{}) (string, error) {
+	return "", errors.New("signing with AWS KMS is not supported")
+}
+
+// ecdsaDER converts the JWS encoding of an ECDSA signature, R and S
+// concatenated, to the ASN.1 DER encoding
+func ecdsaDER(sig []byte) ([]byte, error) {
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, jwt.ErrECDSAVerification
+	}
+	n := len(sig) / 2
+	return asn1.Marshal(struct {
+		R, S *big.Int
+	}{new(big.Int).SetBytes(sig[:n]), new(big.Int).SetBytes(sig[n:])})
+}
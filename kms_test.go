@@ -0,0 +1,116 @@
+package tokenauth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// kmsServer verifies signatures like the Verify call of AWS KMS
+// with the public keys of the key ids
+func kmsServer(t *testing.T, keys map[string]crypto.PublicKey) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			KeyId            string
+			Message          []byte
+			MessageType      string
+			Signature        []byte
+			SigningAlgorithm string
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		require.Equal(t, "TrentService.Verify", r.Header.Get("X-Amz-Target"))
+		require.Equal(t, "DIGEST", in.MessageType)
+		var err error
+		switch key := keys[in.KeyId].(type) {
+		case *rsa.PublicKey:
+			require.Equal(t, "RSASSA_PKCS1_V1_5_SHA_256", in.SigningAlgorithm)
+			err = rsa.VerifyPKCS1v15(key, crypto.SHA256, in.Message, in.Signature)
+		case *ecdsa.PublicKey:
+			require.Equal(t, "ECDSA_SHA_256", in.SigningAlgorithm)
+			var sig struct{ R, S *big.Int }
+			if _, err = asn1.Unmarshal(in.Signature, &sig); err == nil && !ecdsa.Verify(key, in.Message, sig.R, sig.S) {
+				err = rsa.ErrVerification
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "NotFoundException"})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "KMSInvalidSignatureException"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"KeyId": in.KeyId, "SignatureValid": true})
+	}))
+}
+
+func TestKMS(t *testing.T) {
+	r := require.New(t)
+	rsaKey := rsaTestKey(t)
+	data, err := ioutil.ReadFile("test_certs/ec256-private.pem")
+	r.NoError(err)
+	ecKey, err := jwt.ParseECPrivateKeyFromPEM(data)
+	r.NoError(err)
+	const rsaARN = "arn:aws:kms:eu-west-1:111122223333:key/rsa"
+	ts := kmsServer(t, map[string]crypto.PublicKey{rsaARN: &rsaKey.PublicKey, "alias/ec": &ecKey.PublicKey})
+	defer ts.Close()
+	backend := tokenauth.KMS{AWSConfig: tokenauth.AWSConfig{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		Region:          "us-east-1",
+		Endpoint:        ts.URL,
+		Client:          ts.Client(),
+	}}
+	r.Nil(backend.SigningMethod("HS256"))
+	r.Nil(backend.SigningMethod("EdDSA"))
+
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}
+	tcases := []struct {
+		method jwt.SigningMethod
+		key    tokenauth.KMSKey
+		signer crypto.Signer
+	}{
+		{jwt.SigningMethodRS256, rsaARN, rsaKey},
+		{jwt.SigningMethodES256, "alias/ec", ecKey},
+	}
+	for _, tc := range tcases {
+		a := buffalo.New(buffalo.Options{})
+		a.Use(tokenauth.New(tokenauth.Options{
+			SignMethod:    tc.method,
+			CryptoBackend: backend,
+			KeyFunc:       tokenauth.StaticKey(tc.key),
+		}))
+		a.GET("/", func(c buffalo.Context) error {
+			return c.Render(200, nil)
+		})
+		w := bhttptest.New(a)
+
+		token, err := jwt.NewWithClaims(tc.method, claims).SignedString(tc.signer)
+		r.NoError(err)
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + token
+		r.Equal(http.StatusOK, req.Get().Code, tc.method.Alg())
+
+		// the signature of other claims
+		other, err := jwt.NewWithClaims(tc.method, jwt.MapClaims{"sub": "other"}).SignedString(tc.signer)
+		r.NoError(err)
+		req.Headers["Authorization"] = "Bearer " + token[:strings.LastIndex(token, ".")] + other[strings.LastIndex(other, "."):]
+		r.Equal(http.StatusUnauthorized, req.Get().Code, tc.method.Alg())
+	}
+}
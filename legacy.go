@@ -0,0 +1,35 @@
+package tokenauth
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// IssuerLegacySession is the source of claims minted from a legacy session cookie
+const IssuerLegacySession = "legacy-session"
+
+// LegacySession bridges clients still authenticating with a session cookie,
+// requests without token carrying the cookie get claims minted by Validate,
+// so handlers serve both kinds of clients through the same claims contract
+type LegacySession struct {
+	// Cookie is the name of the legacy session cookie
+	Cookie string
+	// Validate checks the cookie value and returns the claims of its session
+	Validate func(c buffalo.Context, value string) (jwt.MapClaims, error)
+}
+
+// claims returns the claims of the legacy session, or nil if the request has no session cookie
+func (ls *LegacySession) claims(c buffalo.Context) (jwt.MapClaims, error) {
+	cookie, err := c.Request().Cookie(ls.Cookie)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+	claims, err := ls.Validate(c, cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+	if claims == nil {
+		return nil, ErrTokenInvalid
+	}
+	return claims, nil
+}
@@ -0,0 +1,55 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegacySession(t *testing.T) {
+	r := require.New(t)
+	a := appExtractor(tokenauth.Options{
+		LegacySession: &tokenauth.LegacySession{
+			Cookie: "_app_session",
+			Validate: func(c buffalo.Context, value string) (jwt.MapClaims, error) {
+				if value != "valid-session" {
+					return nil, errors.New("session expired")
+				}
+				return jwt.MapClaims{"sub": "legacy-user"}, nil
+			},
+		},
+	})
+	a.GET("/me", func(c buffalo.Context) error {
+		claims := c.Value("claims").(jwt.MapClaims)
+		return c.Render(200, render.String(claims["sub"].(string)+"|"+c.Value(tokenauth.IssuerSourceKey).(string)))
+	})
+	w := httptest.New(a)
+
+	// the session cookie is sent through the cookie jar of the handler
+	req := w.HTML("/me")
+	w.Cookies = "_app_session=valid-session"
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("legacy-user|legacy-session", res.Body.String())
+
+	w.Cookies = "_app_session=stale"
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), "session expired")
+
+	// token clients are served as before
+	req = w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + validToken()
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+
+	res = w.HTML("/").Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+}
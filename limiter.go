@@ -0,0 +1,91 @@
+package tokenauth
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrOverloaded is returned if a request is shed because the
+// VerifyLimiter has no free slot to verify its token
+var ErrOverloaded = errors.New("too many tokens being verified")
+
+// DefaultVerifyRetryAfter is the Retry-After of shed requests
+const DefaultVerifyRetryAfter = time.Second
+
+// VerifyLimiter bounds the number of tokens verified concurrently, so a flood
+// of requests with garbage RSA tokens can't saturate the CPU and starve the
+// legitimate traffic. Requests beyond the limit are shed with 503 and Retry-After.
+type VerifyLimiter struct {
+	// Limit of concurrent verifications, defaults to GOMAXPROCS
+	Limit int
+	// Wait is how long a request waits for a free slot before it is shed,
+	// by default requests are shed right away
+	Wait time.Duration
+	// RetryAfter is sent as Retry-After header of shed requests,
+	// defaults to DefaultVerifyRetryAfter
+	RetryAfter time.Duration
+
+	once  sync.Once
+	slots chan struct{}
+	shed  uint64
+}
+
+// NewVerifyLimiter returns a VerifyLimiter allowing multiple times
+// GOMAXPROCS concurrent verifications
+func NewVerifyLimiter(multiple int) *VerifyLimiter {
+	return &VerifyLimiter{Limit: multiple * runtime.GOMAXPROCS(0)}
+}
+
+// Shed returns the number of requests shed
+func (l *VerifyLimiter) Shed() uint64 {
+	return atomic.LoadUint64(&l.shed)
+}
+
+// acquire takes a slot, false if the request has to be shed
+func (l *VerifyLimiter) acquire() bool {
+	if l == nil {
+		return true
+	}
+	l.once.Do(func() {
+		limit := l.Limit
+		if limit <= 0 {
+			limit = runtime.GOMAXPROCS(0)
+		}
+		l.slots = make(chan struct{}, limit)
+	})
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if l.Wait > 0 {
+		timer := time.NewTimer(l.Wait)
+		defer timer.Stop()
+		select {
+		case l.slots <- struct{}{}:
+			return true
+		case <-timer.C:
+		}
+	}
+	atomic.AddUint64(&l.shed, 1)
+	return false
+}
+
+// release frees the slot taken by acquire
+func (l *VerifyLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+func (l *VerifyLimiter) retryAfter() time.Duration {
+	if l == nil || l.RetryAfter <= 0 {
+		return DefaultVerifyRetryAfter
+	}
+	return l.RetryAfter
+}
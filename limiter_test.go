@@ -0,0 +1,60 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyLimiter(t *testing.T) {
+	r := require.New(t)
+	limiter := &tokenauth.VerifyLimiter{Limit: 1, RetryAfter: 2 * time.Second}
+	verifying := make(chan struct{})
+	unblock := make(chan struct{})
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		VerifyLimiter: limiter,
+		KeyFunc: func(token *jwt.Token) (interface{}, error) {
+			if token.Header["kid"] == "slow" {
+				verifying <- struct{}{}
+				<-unblock
+			}
+			return []byte("secret"), nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}
+
+	slow := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	slow.Header["kid"] = "slow"
+	slowToken, err := slow.SignedString([]byte("secret"))
+	r.NoError(err)
+	done := make(chan int)
+	go func() {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + slowToken
+		done <- req.Get().Code
+	}()
+	<-verifying
+
+	// the only slot is taken, the request is shed
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret")
+	res := req.Get()
+	r.Equal(http.StatusServiceUnavailable, res.Code)
+	r.Equal("2", res.Header().Get("Retry-After"))
+	r.Equal(uint64(1), limiter.Shed())
+
+	close(unblock)
+	r.Equal(http.StatusOK, <-done)
+	r.Equal(http.StatusOK, req.Get().Code)
+}
@@ -0,0 +1,75 @@
+package tokenauth
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCredentials is returned by the authenticate function of
+// LoginHandler if the credentials are wrong
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// LoginHandler returns a handler which checks the credentials of the request
+// with authenticate and responds with a token the issuer signs with the returned
+// claims, as {"access_token": ..., "token_type": "Bearer", "expires_in": ...}.
+// If a cookie is given, the token is set as HttpOnly cookie instead and the
+// handler responds with 204 No Content, read it with FromCookie and delete it
+// with LogoutHandler
+//
+//	app.POST("/login", tokenauth.LoginHandler(func(c buffalo.Context) (jwt.MapClaims, error) {
+//		user, err := models.FindUserByEmail(c.Param("email"))
+//		if err != nil || !user.CheckPassword(c.Param("password")) {
+//			return nil, tokenauth.ErrInvalidCredentials
+//		}
+//		return jwt.MapClaims{"sub": user.ID.String()}, nil
+//	}, issuer))
+//
+// Requests are rejected with 401 Unauthorized if authenticate returns
+// ErrInvalidCredentials, the HTTPStatus of a returned AuthError, or
+// 500 Internal Server Error for other errors.
+func LoginHandler(authenticate func(c buffalo.Context) (jwt.MapClaims, error), issuer *Issuer, cookie ...string) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		claims, err := authenticate(c)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if authErr, ok := AsAuthError(err); ok && authErr.HTTPStatus != 0 {
+				status = authErr.HTTPStatus
+			} else if errors.Cause(err) == ErrInvalidCredentials {
+				status = http.StatusUnauthorized
+			}
+			return c.Error(status, err)
+		}
+		token, err := issuer.Issue(claims)
+		if err != nil {
+			return c.Error(http.StatusInternalServerError, err)
+		}
+		ttl := issuer.TTL
+		if ttl == 0 {
+			ttl = DefaultTokenTTL
+		}
+		// the token must not be cached, RFC 6749 section 5.1
+		c.Response().Header().Set("Cache-Control", "no-store")
+		if len(cookie) > 0 {
+			req := c.Request()
+			http.SetCookie(c.Response(), &http.Cookie{
+				Name:     cookie[0],
+				Value:    token,
+				Path:     "/",
+				MaxAge:   int(ttl.Seconds()),
+				HttpOnly: true,
+				Secure:   req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https",
+				SameSite: http.SameSiteLaxMode,
+			})
+			return c.Render(http.StatusNoContent, nil)
+		}
+		return c.Render(http.StatusOK, render.JSON(map[string]interface{}{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   int(ttl.Seconds()),
+		}))
+	}
+}
@@ -0,0 +1,64 @@
+package tokenauth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginHandler(t *testing.T) {
+	r := require.New(t)
+	issuer := &tokenauth.Issuer{SignMethod: jwt.SigningMethodHS256, Key: []byte("secret")}
+	authenticate := func(c buffalo.Context) (jwt.MapClaims, error) {
+		switch {
+		case c.Param("password") == "down":
+			return nil, errors.New("connection refused")
+		case c.Param("login") != "ada" || c.Param("password") != "s3cret":
+			return nil, tokenauth.ErrInvalidCredentials
+		}
+		return jwt.MapClaims{"sub": "ada"}, nil
+	}
+	a := buffalo.New(buffalo.Options{})
+	a.POST("/login", tokenauth.LoginHandler(authenticate, issuer))
+	a.POST("/session", tokenauth.LoginHandler(authenticate, issuer, "access_token"))
+	w := httptest.New(a)
+	login := func(path, password string) *httptest.Response {
+		return w.HTML(path).Post(url.Values{"login": {"ada"}, "password": {password}})
+	}
+
+	res := login("/login", "s3cret")
+	r.Equal(http.StatusOK, res.Code)
+	var body struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	r.NoError(json.Unmarshal(res.Body.Bytes(), &body))
+	r.Equal("Bearer", body.TokenType)
+	r.Equal(int(tokenauth.DefaultTokenTTL.Seconds()), body.ExpiresIn)
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(body.AccessToken, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("secret"), nil
+	})
+	r.NoError(err)
+	r.Equal("ada", claims["sub"])
+
+	r.Equal(http.StatusUnauthorized, login("/login", "wrong").Code)
+	r.Equal(http.StatusInternalServerError, login("/login", "down").Code)
+
+	// the token can be set as cookie
+	res = login("/session", "s3cret")
+	r.Equal(http.StatusNoContent, res.Code)
+	cookie := res.Header().Get("Set-Cookie")
+	r.Contains(cookie, "access_token=ey")
+	r.Contains(cookie, "HttpOnly")
+	r.Contains(cookie, "SameSite=Lax")
+}
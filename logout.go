@@ -0,0 +1,44 @@
+package tokenauth
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/pkg/errors"
+)
+
+// LogoutHandler returns a handler which revokes the verified token of the
+// request and deletes the cookies, e.g. the one the token is read from with
+// FromCookie, and responds with 204 No Content. It must be used behind the
+// tokenauth middleware with the same revoker
+//
+//	revoker := tokenauth.NewMemoryRevoker()
+//	app.Use(tokenauth.New(tokenauth.Options{Revoker: revoker}))
+//	app.POST("/logout", tokenauth.LogoutHandler(revoker, "access_token"))
+//
+// Tokens need a jti, or a sub and iat, and an exp claim to be revoked.
+func LogoutHandler(revoker Revoker, cookies ...string) buffalo.Handler {
+	options := Options{AuthScheme: "Bearer"}
+	return func(c buffalo.Context) error {
+		claims := ClaimsMap(c)
+		if claims == nil {
+			return reject(c, options, http.StatusUnauthorized, ErrNoToken)
+		}
+		id := TokenID(claims)
+		if id == "" {
+			return reject(c, options, http.StatusBadRequest, errors.Wrap(ErrMissingClaim, "jti"))
+		}
+		// the revocation is kept until the token expires
+		exp, ok := ExpiresAt(claims)
+		if !ok {
+			return reject(c, options, http.StatusBadRequest, errors.Wrap(ErrMissingClaim, "exp"))
+		}
+		if err := revoker.Revoke(c, id, exp); err != nil {
+			return reject(c, options, http.StatusServiceUnavailable, errors.Wrap(err, "couldn't revoke token"))
+		}
+		for _, name := range cookies {
+			c.Cookies().Delete(name)
+		}
+		return c.Render(http.StatusNoContent, nil)
+	}
+}
@@ -0,0 +1,20 @@
+package tokenauth
+
+import (
+	"github.com/gobuffalo/mw-tokenauth/v2/keysource"
+)
+
+// OIDCProvider verifies the tokens of an OpenID Connect IdP, the JWKS is
+// resolved from the discovery document of the issuer and the iss claim of
+// the tokens must be the issuer.
+//
+//	app.Use(tokenauth.New(tokenauth.Options{
+//		OIDC: tokenauth.NewOIDCProvider("https://accounts.example.com"),
+//	}))
+type OIDCProvider = keysource.OIDCProvider
+
+// NewOIDCProvider returns an OIDCProvider for the issuer,
+// the discovery document is fetched on first use
+func NewOIDCProvider(issuer string) *OIDCProvider {
+	return keysource.NewOIDCProvider(issuer)
+}
@@ -0,0 +1,73 @@
+package tokenauth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func oidcServer(t *testing.T, issuer *string) *httptest.Server {
+	key := rsaTestKey(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   *issuer,
+			"jwks_uri": "https://" + r.Host + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []interface{}{rsaJWK("key-1", &key.PublicKey)}})
+	})
+	return httptest.NewTLSServer(mux)
+}
+
+func TestOIDCProvider(t *testing.T) {
+	r := require.New(t)
+	var issuer string
+	ts := oidcServer(t, &issuer)
+	defer ts.Close()
+	issuer = ts.URL
+
+	oidc := tokenauth.NewOIDCProvider(issuer)
+	oidc.Client = ts.Client()
+	defer oidc.Close()
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{OIDC: oidc}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := bhttptest.New(a)
+	key := rsaTestKey(t)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signRS256(t, "key-1", key, jwt.MapClaims{"iss": issuer, "exp": exp})
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	req.Headers["Authorization"] = "Bearer " + signRS256(t, "key-1", key, jwt.MapClaims{"iss": "https://evil.example.com", "exp": exp})
+	res := req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), "token issuer not accepted")
+}
+
+func TestOIDCProviderIssuerMismatch(t *testing.T) {
+	r := require.New(t)
+	issuer := "https://other.example.com"
+	ts := oidcServer(t, &issuer)
+	defer ts.Close()
+
+	oidc := tokenauth.NewOIDCProvider(ts.URL)
+	oidc.Client = ts.Client()
+	defer oidc.Close()
+	_, err := jwt.Parse(signRS256(t, "key-1", rsaTestKey(t), jwt.MapClaims{"iss": ts.URL}), oidc.Keyfunc)
+	r.Error(err)
+	r.Contains(err.Error(), "discovery document is for issuer")
+}
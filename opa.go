@@ -0,0 +1,150 @@
+package tokenauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrPolicyDenied is returned if the OPA policy or the Casbin enforcer denies the request
+var ErrPolicyDenied = errors.New("denied by policy")
+
+// OPA authorizes requests with an Open Policy Agent policy, the decision is
+// queried with the verified claims and the method and path of the request as input
+//
+//	{"input": {"method": "GET", "path": "/users/42", "claims": {"sub": "42", ...}}}
+//
+// The path is the path of the request, not the pattern of its route, without
+// the trailing slash buffalo adds to it for routing.
+//
+// The policy decides with a boolean result, or an object with an allow field.
+// Use it as Guard for all routes or with Authorize for single routes
+//
+//	opa := &tokenauth.OPA{URL: "http://localhost:8181/v1/data/httpapi/authz/allow"}
+//	app.Use(tokenauth.New(tokenauth.Options{Guards: []tokenauth.Guard{opa}}))
+//
+// Requests are denied if OPA can't be queried, with 503 Service Unavailable.
+// To evaluate an embedded Rego policy instead, set Eval, e.g. with a prepared
+// query of the OPA Go SDK, which is not a dependency of this package
+//
+//	query, _ := rego.New(rego.Query("data.httpapi.authz.allow"), rego.Module("authz.rego", policy)).PrepareForEval(ctx)
+//	opa := &tokenauth.OPA{Eval: func(ctx context.Context, input map[string]interface{}) (bool, error) {
+//		rs, err := query.Eval(ctx, rego.EvalInput(input))
+//		return err == nil && rs.Allowed(), err
+//	}}
+type OPA struct {
+	// URL of the decision in the Data API, e.g. http://localhost:8181/v1/data/httpapi/authz/allow
+	URL string
+	// Client used to query OPA, defaults to a client with a 2s timeout
+	Client *http.Client
+	// Eval if set, decides instead of querying URL
+	Eval func(ctx context.Context, input map[string]interface{}) (bool, error)
+}
+
+// opaClient is the default client, decisions are on the path of every request
+var opaClient = &http.Client{Timeout: 2 * time.Second}
+
+// Allow queries the decision of the policy for the request
+func (o *OPA) Allow(c buffalo.Context, claims jwt.Claims) error {
+	input := map[string]interface{}{
+		"method": c.Request().Method,
+		"path":   requestPath(c.Request()),
+		"claims": claims,
+	}
+	if o.Eval != nil {
+		allowed, err := o.Eval(c, input)
+		if err != nil {
+			return opaUnavailable(err)
+		}
+		if !allowed {
+			return ErrPolicyDenied
+		}
+		return nil
+	}
+	allowed, decisionID, err := o.query(c, input)
+	if err != nil {
+		return opaUnavailable(err)
+	}
+	if !allowed {
+		if decisionID != "" {
+			// the id of the decision in the decision logs of OPA
+			return errors.Wrapf(ErrPolicyDenied, "decision %s", decisionID)
+		}
+		return ErrPolicyDenied
+	}
+	return nil
+}
+
+// requestPath returns the path of the request without the trailing
+// slash buffalo adds to paths before they are routed
+func requestPath(req *http.Request) string {
+	if req.URL.Path == "/" {
+		return req.URL.Path
+	}
+	return strings.TrimSuffix(req.URL.Path, "/")
+}
+
+// query posts the input to the Data API
+func (o *OPA) query(ctx context.Context, input map[string]interface{}) (bool, string, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return false, "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, o.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, "", errors.Wrap(err, "invalid OPA URL")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	client := o.Client
+	if client == nil {
+		client = opaClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return false, "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return false, "", errors.Errorf("OPA responded with %d: %s", res.StatusCode, data)
+	}
+	var decision struct {
+		DecisionID string          `json:"decision_id"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &decision); err != nil {
+		return false, "", errors.Wrap(err, "invalid OPA response")
+	}
+	// the result is missing if the policy is undefined for the input
+	var allowed bool
+	if json.Unmarshal(decision.Result, &allowed) != nil {
+		var result struct {
+			Allow bool `json:"allow"`
+		}
+		json.Unmarshal(decision.Result, &result)
+		allowed = result.Allow
+	}
+	return allowed, decision.DecisionID, nil
+}
+
+// opaUnavailable is the error of requests OPA couldn't decide on
+func opaUnavailable(err error) error {
+	return &AuthError{
+		Code:       ErrorCodePolicyUnavailable,
+		HTTPStatus: http.StatusServiceUnavailable,
+		Cause:      errors.Wrap(err, "couldn't query OPA"),
+		oauthError: "temporarily_unavailable",
+	}
+}
@@ -0,0 +1,135 @@
+package tokenauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOPA(t *testing.T) {
+	r := require.New(t)
+	// admins may do anything, everybody else may only read
+	type input struct {
+		Method string
+		Path   string
+		Claims map[string]interface{}
+	}
+	var inputs []input
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Input input
+		}
+		if req.URL.Path != "/v1/data/httpapi/authz" || json.NewDecoder(req.Body).Decode(&body) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		inputs = append(inputs, body.Input)
+		mu.Unlock()
+		allow := body.Input.Method == "GET" || body.Input.Claims["role"] == "admin"
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"decision_id": "4ca636c1",
+			"result":      map[string]interface{}{"allow": allow},
+		})
+	}))
+	defer ts.Close()
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		Guards:  []tokenauth.Guard{&tokenauth.OPA{URL: ts.URL + "/v1/data/httpapi/authz"}},
+	}))
+	handler := func(c buffalo.Context) error {
+		return c.Render(200, render.String("ok"))
+	}
+	a.GET("/posts", handler)
+	a.POST("/posts", handler)
+	w := bhttptest.New(a)
+
+	for _, tt := range []struct {
+		method string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"GET", jwt.MapClaims{"role": "user"}, http.StatusOK},
+		{"POST", jwt.MapClaims{"role": "admin"}, http.StatusOK},
+		{"POST", jwt.MapClaims{"role": "user"}, http.StatusForbidden},
+	} {
+		tt.claims["exp"] = time.Now().Add(time.Minute * 5).Unix()
+		req := w.HTML("/posts")
+		req.Headers["Authorization"] = "Bearer " + signWith(tt.claims, "secret")
+		var res *bhttptest.Response
+		if tt.method == "GET" {
+			res = req.Get()
+		} else {
+			res = req.Post(nil)
+		}
+		r.Equal(tt.status, res.Code, tt.claims)
+		if tt.status == http.StatusForbidden {
+			r.Contains(res.Header().Get("WWW-Authenticate"), `error_code="denied"`)
+			r.Contains(res.Header().Get("WWW-Authenticate"), "decision 4ca636c1")
+		}
+	}
+
+	// the input carries the path of the request without the trailing slash of buffalo
+	mu.Lock()
+	defer mu.Unlock()
+	r.Len(inputs, 3)
+	for _, in := range inputs {
+		r.Equal("/posts", in.Path)
+	}
+}
+
+func TestOPAUnavailable(t *testing.T) {
+	r := require.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "policy compile error", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+	}))
+	a.GET("/", tokenauth.Authorize((&tokenauth.OPA{URL: ts.URL}).Allow)(func(c buffalo.Context) error {
+		return c.Render(200, render.String("ok"))
+	}))
+	req := bhttptest.New(a).HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}, "secret")
+	r.Equal(http.StatusServiceUnavailable, req.Get().Code)
+}
+
+func TestOPAEval(t *testing.T) {
+	r := require.New(t)
+	opa := &tokenauth.OPA{Eval: func(ctx context.Context, input map[string]interface{}) (bool, error) {
+		claims := input["claims"].(jwt.MapClaims)
+		return claims["sub"] == "ada", nil
+	}}
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		Guards:  []tokenauth.Guard{opa},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String("ok"))
+	})
+	w := bhttptest.New(a)
+
+	for sub, status := range map[string]int{"ada": http.StatusOK, "bob": http.StatusForbidden} {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"sub": sub, "exp": time.Now().Add(time.Minute * 5).Unix()}, "secret")
+		r.Equal(status, req.Get().Code, sub)
+	}
+}
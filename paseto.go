@@ -0,0 +1,228 @@
+package tokenauth
+
+import (
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// PASETO verifies PASETO tokens instead of JWTs, https://paseto.io. The
+// v2 and v4 local tokens are decrypted with LocalKey, and the public tokens
+// are verified with PublicKey. Their claims are set in the context like the
+// claims of JWTs, with the exp, nbf and iat times converted to NumericDates,
+// so handlers, Validators and Guards work with either
+//
+//	tokenauth.New(tokenauth.Options{
+//		PASETO: &tokenauth.PASETO{PublicKey: publicKey},
+//	})
+//
+// JWTs are rejected, the options for their keys are not used.
+type PASETO struct {
+	// LocalKey is the 32 byte shared key of local tokens
+	LocalKey []byte
+	// PublicKey is the Ed25519 key of public tokens
+	PublicKey ed25519.PublicKey
+	// Versions are the accepted versions, v2 and v4, defaults to both
+	Versions []string
+	// ImplicitAssertion is the data v4 tokens are bound to besides their footer
+	ImplicitAssertion []byte
+	// Footer if set, is called with the authenticated footer of the tokens,
+	// e.g. to check its kid, tokens are rejected if it returns an error
+	Footer func(footer []byte) error
+}
+
+func (p *PASETO) validate() error {
+	if len(p.LocalKey) == 0 && len(p.PublicKey) == 0 {
+		return errors.New("PASETO requires LocalKey or PublicKey")
+	}
+	if len(p.LocalKey) != 0 && len(p.LocalKey) != chacha20poly1305.KeySize {
+		return errors.Errorf("PASETO LocalKey must be %d bytes", chacha20poly1305.KeySize)
+	}
+	if len(p.PublicKey) != 0 && len(p.PublicKey) != ed25519.PublicKeySize {
+		return errors.Errorf("PASETO PublicKey must be %d bytes", ed25519.PublicKeySize)
+	}
+	for _, v := range p.Versions {
+		if v != "v2" && v != "v4" {
+			return errors.Errorf("unsupported PASETO version %q", v)
+		}
+	}
+	return nil
+}
+
+// verify authenticates the token and returns the token of its claims, with validated times
+func (p *PASETO) verify(tokenString string, options Options) (*jwt.Token, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 && len(parts) != 4 {
+		return nil, jwt.NewValidationError("not a PASETO token", jwt.ValidationErrorMalformed)
+	}
+	version, purpose := parts[0], parts[1]
+	if !p.accepts(version) {
+		return nil, jwt.NewValidationError("unsupported PASETO version "+version, jwt.ValidationErrorMalformed)
+	}
+	header := version + "." + purpose + "."
+	payload, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, jwt.NewValidationError("invalid PASETO payload", jwt.ValidationErrorMalformed)
+	}
+	var footer []byte
+	if len(parts) == 4 {
+		if footer, err = base64.RawURLEncoding.DecodeString(parts[3]); err != nil {
+			return nil, jwt.NewValidationError("invalid PASETO footer", jwt.ValidationErrorMalformed)
+		}
+	}
+
+	var message []byte
+	switch {
+	case purpose == "local" && len(p.LocalKey) != 0:
+		message, err = p.decrypt(version, header, payload, footer)
+	case purpose == "public" && len(p.PublicKey) != 0:
+		message, err = p.open(version, header, payload, footer)
+	default:
+		return nil, jwt.NewValidationError("unsupported PASETO purpose "+purpose, jwt.ValidationErrorUnverifiable)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.Footer != nil {
+		if err := p.Footer(footer); err != nil {
+			return nil, err
+		}
+	}
+
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(message, &claims); err != nil {
+		return nil, jwt.NewValidationError("invalid PASETO claims", jwt.ValidationErrorMalformed)
+	}
+	// PASETO times are RFC 3339 strings
+	for _, name := range numericDateClaims {
+		if s, ok := claims[name].(string); ok {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, jwt.NewValidationError("invalid PASETO "+name, jwt.ValidationErrorClaimsInvalid)
+			}
+			claims[name] = float64(t.Unix())
+		}
+	}
+	if err := validTimes(claims, options); err != nil {
+		return nil, err
+	}
+	return &jwt.Token{
+		Raw:    tokenString,
+		Method: claimsMethod(version + "." + purpose),
+		Header: map[string]interface{}{"alg": version + "." + purpose},
+		Claims: claims,
+		Valid:  true,
+	}, nil
+}
+
+func (p *PASETO) accepts(version string) bool {
+	if len(p.Versions) == 0 {
+		return version == "v2" || version == "v4"
+	}
+	for _, v := range p.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// decrypt decrypts the payload of v2.local and v4.local tokens
+func (p *PASETO) decrypt(version, header string, payload, footer []byte) ([]byte, error) {
+	invalid := jwt.NewValidationError("invalid PASETO token", jwt.ValidationErrorSignatureInvalid)
+	if version == "v2" {
+		aead, err := chacha20poly1305.NewX(p.LocalKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) < aead.NonceSize()+aead.Overhead() {
+			return nil, invalid
+		}
+		nonce := payload[:chacha20poly1305.NonceSizeX]
+		message, err := aead.Open(nil, nonce, payload[len(nonce):], pae([]byte(header), nonce, footer))
+		if err != nil {
+			return nil, invalid
+		}
+		return message, nil
+	}
+
+	// v4.local is XChaCha20 with a BLAKE2b MAC, keyed with keys derived from the nonce
+	if len(payload) < 32+32 {
+		return nil, invalid
+	}
+	nonce, ciphertext, tag := payload[:32], payload[32:len(payload)-32], payload[len(payload)-32:]
+	derived, err := keyedBlake2b(56, p.LocalKey, []byte("paseto-encryption-key"), nonce)
+	if err != nil {
+		return nil, err
+	}
+	authKey, err := keyedBlake2b(32, p.LocalKey, []byte("paseto-auth-key-for-aead"), nonce)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := keyedBlake2b(32, authKey, pae([]byte(header), nonce, ciphertext, footer, p.ImplicitAssertion))
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(mac, tag) != 1 {
+		return nil, invalid
+	}
+	stream, err := chacha20.NewUnauthenticatedCipher(derived[:32], derived[32:])
+	if err != nil {
+		return nil, err
+	}
+	message := make([]byte, len(ciphertext))
+	stream.XORKeyStream(message, ciphertext)
+	return message, nil
+}
+
+// open verifies the signature of v2.public and v4.public tokens
+func (p *PASETO) open(version, header string, payload, footer []byte) ([]byte, error) {
+	if len(payload) < ed25519.SignatureSize {
+		return nil, jwt.NewValidationError("invalid PASETO token", jwt.ValidationErrorMalformed)
+	}
+	message, signature := payload[:len(payload)-ed25519.SignatureSize], payload[len(payload)-ed25519.SignatureSize:]
+	signed := pae([]byte(header), message, footer)
+	if version == "v4" {
+		signed = pae([]byte(header), message, footer, p.ImplicitAssertion)
+	}
+	if !ed25519.Verify(p.PublicKey, signed, signature) {
+		return nil, jwt.NewValidationError("invalid PASETO signature", jwt.ValidationErrorSignatureInvalid)
+	}
+	return message, nil
+}
+
+// pae is the pre-authentication encoding of the pieces, which
+// are prefixed with their little endian 64 bit lengths
+func pae(pieces ...[]byte) []byte {
+	out := make([]byte, 8)
+	binary.LittleEndian.PutUint64(out, uint64(len(pieces)))
+	for _, piece := range pieces {
+		n := make([]byte, 8)
+		// the most significant bit is cleared for languages without unsigned integers
+		binary.LittleEndian.PutUint64(n, uint64(len(piece))&^(1<<63))
+		out = append(append(out, n...), piece...)
+	}
+	return out
+}
+
+// keyedBlake2b returns the keyed BLAKE2b hash of the data of the size
+func keyedBlake2b(size int, key []byte, data ...[]byte) ([]byte, error) {
+	h, err := blake2b.New(size, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil), nil
+}
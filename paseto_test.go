@@ -0,0 +1,171 @@
+package tokenauth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func pae(pieces ...[]byte) []byte {
+	out := make([]byte, 8)
+	binary.LittleEndian.PutUint64(out, uint64(len(pieces)))
+	for _, piece := range pieces {
+		n := make([]byte, 8)
+		binary.LittleEndian.PutUint64(n, uint64(len(piece)))
+		out = append(append(out, n...), piece...)
+	}
+	return out
+}
+
+func pasetoToken(header string, payload, footer []byte) string {
+	token := header + base64.RawURLEncoding.EncodeToString(payload)
+	if len(footer) > 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token
+}
+
+// pasetoSign returns the v2.public or v4.public token of the claims
+func pasetoSign(t *testing.T, version string, key ed25519.PrivateKey, claims map[string]interface{}, footer, implicit []byte) string {
+	message, err := json.Marshal(claims)
+	require.NoError(t, err)
+	header := version + ".public."
+	signed := pae([]byte(header), message, footer)
+	if version == "v4" {
+		signed = pae([]byte(header), message, footer, implicit)
+	}
+	return pasetoToken(header, append(message, ed25519.Sign(key, signed)...), footer)
+}
+
+// pasetoEncrypt returns the v2.local or v4.local token of the claims
+func pasetoEncrypt(t *testing.T, version string, key []byte, claims map[string]interface{}, footer, implicit []byte) string {
+	r := require.New(t)
+	message, err := json.Marshal(claims)
+	r.NoError(err)
+	header := version + ".local."
+	if version == "v2" {
+		aead, err := chacha20poly1305.NewX(key)
+		r.NoError(err)
+		nonce := random(t, aead.NonceSize())
+		return pasetoToken(header, append(nonce, aead.Seal(nil, nonce, message, pae([]byte(header), nonce, footer))...), footer)
+	}
+	nonce := random(t, 32)
+	keyed := func(size int, key []byte, data ...[]byte) []byte {
+		h, err := blake2b.New(size, key)
+		r.NoError(err)
+		for _, d := range data {
+			h.Write(d)
+		}
+		return h.Sum(nil)
+	}
+	derived := keyed(56, key, []byte("paseto-encryption-key"), nonce)
+	stream, err := chacha20.NewUnauthenticatedCipher(derived[:32], derived[32:])
+	r.NoError(err)
+	ciphertext := make([]byte, len(message))
+	stream.XORKeyStream(ciphertext, message)
+	tag := keyed(32, keyed(32, key, []byte("paseto-auth-key-for-aead"), nonce), pae([]byte(header), nonce, ciphertext, footer, implicit))
+	return pasetoToken(header, append(append(nonce, ciphertext...), tag...), footer)
+}
+
+func TestPASETO(t *testing.T) {
+	r := require.New(t)
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	r.NoError(err)
+	local := random(t, 32)
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		PASETO: &tokenauth.PASETO{
+			LocalKey:          local,
+			PublicKey:         public,
+			ImplicitAssertion: []byte("tenant-a"),
+			Footer: func(footer []byte) error {
+				if string(footer) == "revoked" {
+					return errors.New("revoked key")
+				}
+				return nil
+			},
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		claims := tokenauth.ClaimsMap(c)
+		exp, _ := tokenauth.ExpiresAt(claims)
+		return c.Render(200, render.String("%v %d", claims["sub"], exp.Unix()))
+	})
+	w := httptest.New(a)
+	get := func(token string) *httptest.Response {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + token
+		return req.Get()
+	}
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	claims := map[string]interface{}{"sub": "ada", "exp": exp.Format(time.RFC3339)}
+
+	for _, version := range []string{"v2", "v4"} {
+		for _, token := range []string{
+			pasetoSign(t, version, private, claims, nil, []byte("tenant-a")),
+			pasetoSign(t, version, private, claims, []byte(`{"kid":"1"}`), []byte("tenant-a")),
+			pasetoEncrypt(t, version, local, claims, nil, []byte("tenant-a")),
+			pasetoEncrypt(t, version, local, claims, []byte(`{"kid":"1"}`), []byte("tenant-a")),
+		} {
+			res := get(token)
+			r.Equal(http.StatusOK, res.Code, token)
+			// the times are NumericDates like those of JWTs
+			r.Equal(fmt.Sprintf("ada %d", exp.Unix()), res.Body.String())
+		}
+	}
+
+	// v4 tokens are bound to the implicit assertion
+	r.Equal(http.StatusUnauthorized, get(pasetoSign(t, "v4", private, claims, nil, []byte("tenant-b"))).Code)
+	r.Equal(http.StatusUnauthorized, get(pasetoEncrypt(t, "v4", local, claims, nil, []byte("tenant-b"))).Code)
+
+	// tokens of other keys, with tampered footers, or expired are rejected
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	r.NoError(err)
+	res := get(pasetoSign(t, "v4", other, claims, nil, []byte("tenant-a")))
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Header().Get("WWW-Authenticate"), `error_code="`+tokenauth.ErrorCodeSignature+`"`)
+	r.Equal(http.StatusUnauthorized, get(pasetoEncrypt(t, "v4", random(t, 32), claims, nil, []byte("tenant-a"))).Code)
+	token := pasetoEncrypt(t, "v2", local, claims, []byte("a"), nil)
+	r.Equal(http.StatusUnauthorized, get(strings.TrimSuffix(token, "YQ")+"Yg").Code)
+	r.Equal(http.StatusUnauthorized, get(pasetoSign(t, "v4", private, claims, []byte("revoked"), []byte("tenant-a"))).Code)
+	expired := map[string]interface{}{"sub": "ada", "exp": time.Now().Add(-time.Hour).Format(time.RFC3339)}
+	res = get(pasetoSign(t, "v4", private, expired, nil, []byte("tenant-a")))
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Header().Get("WWW-Authenticate"), `error_code="`+tokenauth.ErrorCodeExpired+`"`)
+
+	// JWTs and other PASETO versions are rejected
+	r.Equal(http.StatusUnauthorized, get(signWith(jwt.MapClaims{"sub": "ada"}, "secret")).Code)
+	r.Equal(http.StatusUnauthorized, get("v3.public."+base64.RawURLEncoding.EncodeToString(random(t, 128))).Code)
+}
+
+func TestPASETOOptions(t *testing.T) {
+	r := require.New(t)
+	_, err := tokenauth.NewWithError(tokenauth.Options{PASETO: &tokenauth.PASETO{}})
+	r.Error(err)
+	_, err = tokenauth.NewWithError(tokenauth.Options{PASETO: &tokenauth.PASETO{LocalKey: []byte("short")}})
+	r.Error(err)
+	_, err = tokenauth.NewWithError(tokenauth.Options{PASETO: &tokenauth.PASETO{LocalKey: random(t, 32), Versions: []string{"v3"}}})
+	r.Error(err)
+	// the key of JWTs is not needed
+	_, err = tokenauth.NewWithError(tokenauth.Options{PASETO: &tokenauth.PASETO{LocalKey: random(t, 32)}})
+	r.NoError(err)
+}
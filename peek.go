@@ -0,0 +1,60 @@
+package tokenauth
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// UntrustedClaims are the claims of a token whose signature has not been
+// verified. Anyone can forge them, so they must only be used for routing
+// decisions, e.g. selecting the tenant shard or the issuer a token is
+// verified against, never to grant access.
+type UntrustedClaims struct {
+	claims jwt.MapClaims
+}
+
+// UnverifiedToken is a token before its signature is verified,
+// its header and claims must be treated like UntrustedClaims
+type UnverifiedToken struct {
+	Raw string
+	// Header of the token, e.g. alg and kid
+	Header map[string]interface{}
+	Claims UntrustedClaims
+}
+
+// PeekClaims returns the claims of the token without verifying it,
+// the verified claims are set in the context by the middleware
+func PeekClaims(tokenString string) (UntrustedClaims, error) {
+	token, err := peekToken(tokenString)
+	return token.Claims, err
+}
+
+// peekToken parses the token without verifying it
+func peekToken(tokenString string) (UnverifiedToken, error) {
+	claims := jwt.MapClaims{}
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims)
+	if err != nil {
+		return UnverifiedToken{}, err
+	}
+	return UnverifiedToken{
+		Raw:    tokenString,
+		Header: token.Header,
+		Claims: UntrustedClaims{claims: claims},
+	}, nil
+}
+
+// Get returns the unverified value of the claim
+func (u UntrustedClaims) Get(name string) interface{} {
+	return u.claims[name]
+}
+
+// String returns the unverified value of a string claim,
+// "" if the token has no such claim or it isn't a string
+func (u UntrustedClaims) String(name string) string {
+	s, _ := u.claims[name].(string)
+	return s
+}
+
+// Issuer returns the unverified iss claim
+func (u UntrustedClaims) Issuer() string {
+	return u.String("iss")
+}
@@ -0,0 +1,98 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeekClaims(t *testing.T) {
+	r := require.New(t)
+	// the signature is not verified
+	token := signWith(jwt.MapClaims{"iss": "https://idp.example.com", "tenant": "eu-1", "n": 1}, "unknown-secret")
+	claims, err := tokenauth.PeekClaims(token)
+	r.NoError(err)
+	r.Equal("https://idp.example.com", claims.Issuer())
+	r.Equal("eu-1", claims.String("tenant"))
+	r.Equal("", claims.String("n"))
+	r.Equal(float64(1), claims.Get("n"))
+	r.Nil(claims.Get("sub"))
+
+	_, err = tokenauth.PeekClaims("not-a-token")
+	r.Error(err)
+}
+
+func TestPreVerify(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		PreVerify: func(c buffalo.Context, unverified tokenauth.UnverifiedToken) error {
+			tenant := unverified.Claims.String("tenant")
+			if tenant == "blocked" {
+				return errors.New("tenant blocked")
+			}
+			c.Set("tenant", tenant)
+			return nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String(c.Value("tenant").(string)))
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{"tenant": "eu-1", "exp": exp})
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("eu-1", res.Body.String())
+
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{"tenant": "blocked", "exp": exp})
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), "tenant blocked")
+}
+
+func TestPreVerifyBeforeKey(t *testing.T) {
+	r := require.New(t)
+	loads := 0
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		LazyKey: true,
+		GetKey: func(jwt.SigningMethod) (interface{}, error) {
+			loads++
+			return []byte("secret"), nil
+		},
+		PreVerify: func(c buffalo.Context, unverified tokenauth.UnverifiedToken) error {
+			if unverified.Claims.String("tenant") == "blocked" {
+				return errors.New("tenant blocked")
+			}
+			return nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	// tokens rejected by PreVerify don't load the key
+	req := w.HTML("/")
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{"tenant": "blocked", "exp": exp})
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+	r.Equal(0, loads)
+
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{"tenant": "eu-1", "exp": exp})
+	r.Equal(http.StatusOK, req.Get().Code)
+	r.Equal(1, loads)
+}
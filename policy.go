@@ -0,0 +1,308 @@
+package tokenauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidIssuer is returned if the iss claim of the token is not the expected issuer
+	ErrInvalidIssuer = guard.ErrInvalidIssuer
+	// ErrInvalidAudience is returned if the aud claim of the token has none of the expected audiences
+	ErrInvalidAudience = guard.ErrInvalidAudience
+	// ErrInsufficientScope is returned if the token lacks the scopes required by the route
+	ErrInsufficientScope = guard.ErrInsufficientScope
+	// ErrInsufficientRole is returned if the token has none of the roles required by the route
+	ErrInsufficientRole = guard.ErrInsufficientRole
+	// ErrRouteNotAllowed is returned for requests to routes no route policy
+	// covers if the policy has DenyUnmatched set
+	ErrRouteNotAllowed = errors.New("route not allowed by policy")
+)
+
+// Policy is the effective validation config of the middleware, it can be exported
+// as configuration for edge gateways so edge and app enforce identical rules
+type Policy struct {
+	Issuer     string
+	Audiences  []string
+	Algorithms []string
+	// JWKSURI is where the gateway fetches the verification keys from
+	JWKSURI    string
+	HeaderName string
+	AuthScheme string
+	Routes     []RoutePolicy
+	// DenyUnmatched rejects requests to routes none of the Routes match,
+	// like the ALLOW policies of Istio
+	DenyUnmatched bool
+	// Validate if set, additionally checks the claims of verified tokens, e.g.
+	// the claims specific to an identity provider. It can't be exported for gateways
+	Validate func(claims jwt.MapClaims) error
+}
+
+// RoutePolicy lists the scopes a route requires, tokens need any of them. If
+// several route policies match a request, the scopes of any of them suffice
+type RoutePolicy struct {
+	Method string
+	// Path of the route, buffalo style path parameters like /users/{id} are allowed
+	// as well as a leading or trailing * matching any suffix or prefix
+	Path   string
+	Scopes []string
+}
+
+// Middleware returns the tokenauth middleware configured with the options which
+// additionally enforces the issuer, audiences and route scopes of the policy,
+// keys are fetched from the JWKSURI unless the options configure a key
+func (p Policy) Middleware(options Options) buffalo.MiddlewareFunc {
+	if options.HeaderName == "" {
+		options.HeaderName = p.HeaderName
+	}
+	if options.AuthScheme == "" {
+		options.AuthScheme = p.AuthScheme
+	}
+	if options.SignMethod == nil && len(p.Algorithms) > 0 {
+		options.SignMethod = jwt.GetSigningMethod(p.Algorithms[0])
+	}
+	if options.JWKS == nil && options.OIDC == nil && options.KeyFunc == nil && len(options.Keys) == 0 && options.GetKey == nil && p.JWKSURI != "" {
+		options.JWKS = NewJWKSProvider(p.JWKSURI)
+	}
+	authenticate := New(options)
+	if options.AuthScheme == "" {
+		options.AuthScheme = "Bearer"
+	}
+	return func(next buffalo.Handler) buffalo.Handler {
+		return authenticate(func(c buffalo.Context) error {
+			// the middleware let the request through, see FlagReportOnly
+			if passedThrough(c) {
+				return next(c)
+			}
+			claims := ClaimsMap(c)
+			if err := p.check(c.Request(), claims); err != nil {
+				status := http.StatusUnauthorized
+				if err == ErrInsufficientScope || err == ErrRouteNotAllowed {
+					status = http.StatusForbidden
+				}
+				letThrough(c, next)
+				return reject(c, options, status, err)
+			}
+			return next(c)
+		})
+	}
+}
+
+// check validates the claims of a verified token against the policy
+func (p Policy) check(req *http.Request, claims jwt.MapClaims) error {
+	if p.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != p.Issuer {
+			return ErrInvalidIssuer
+		}
+	}
+	if len(p.Audiences) > 0 && !guard.ContainsAny(Audience(claims), p.Audiences...) {
+		return ErrInvalidAudience
+	}
+	if p.Validate != nil {
+		if err := p.Validate(claims); err != nil {
+			return err
+		}
+	}
+	// the routes matching the request are alternatives, like the rules of an
+	// Istio ALLOW policy, the token needs the scopes of any of them
+	matched := false
+	for _, r := range p.Routes {
+		if !r.matches(req) {
+			continue
+		}
+		if len(r.Scopes) == 0 || guard.ContainsAny(guard.Scopes(claims), r.Scopes...) {
+			return nil
+		}
+		matched = true
+	}
+	if matched {
+		return ErrInsufficientScope
+	}
+	if p.DenyUnmatched {
+		return ErrRouteNotAllowed
+	}
+	return nil
+}
+
+// matches reports if the route policy applies to the request
+func (r RoutePolicy) matches(req *http.Request) bool {
+	if r.Method != "" && !strings.EqualFold(r.Method, req.Method) {
+		return false
+	}
+	path := req.URL.Path
+	switch {
+	case r.Path == "" || r.Path == "*":
+		return true
+	case strings.HasSuffix(r.Path, "*"):
+		return strings.HasPrefix(path, strings.TrimSuffix(r.Path, "*"))
+	case strings.HasPrefix(r.Path, "*"):
+		return strings.HasSuffix(path, strings.TrimPrefix(r.Path, "*"))
+	}
+	want := strings.Split(strings.Trim(r.Path, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if strings.HasPrefix(want[i], "{") && strings.HasSuffix(want[i], "}") {
+			continue
+		}
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// PolicyFromOptions returns the Policy of the middleware configured with the options,
+// the fields the options don't carry (e.g. JWKSURI, Routes) are left for the caller to fill
+func PolicyFromOptions(options Options) Policy {
+	p := Policy{
+		HeaderName: options.HeaderName,
+		AuthScheme: options.AuthScheme,
+	}
+	if p.HeaderName == "" {
+		p.HeaderName = "Authorization"
+	}
+	if p.AuthScheme == "" {
+		p.AuthScheme = "Bearer"
+	}
+	if options.SignMethod != nil {
+		p.Algorithms = append(p.Algorithms, options.SignMethod.Alg())
+	} else {
+		p.Algorithms = append(p.Algorithms, "HS256")
+	}
+	return p
+}
+
+// EnvoyJWTAuthn returns the policy as Envoy jwt_authn http filter configuration,
+// cluster is the Envoy cluster serving the JWKSURI. Envoy's jwt_authn filter has
+// no notion of scopes, they have to be enforced with an RBAC filter.
+func (p Policy) EnvoyJWTAuthn(cluster string) ([]byte, error) {
+	type httpURI struct {
+		URI     string `json:"uri"`
+		Cluster string `json:"cluster"`
+		Timeout string `json:"timeout"`
+	}
+	type header struct {
+		Name        string `json:"name"`
+		ValuePrefix string `json:"value_prefix,omitempty"`
+	}
+	provider := map[string]interface{}{
+		"issuer":    p.Issuer,
+		"audiences": p.Audiences,
+		"remote_jwks": map[string]interface{}{
+			"http_uri":       httpURI{URI: p.JWKSURI, Cluster: cluster, Timeout: "5s"},
+			"cache_duration": "300s",
+		},
+		"from_headers": []header{{Name: p.HeaderName, ValuePrefix: p.AuthScheme + " "}},
+		"forward":      true,
+	}
+	rules := []map[string]interface{}{}
+	for _, r := range p.Routes {
+		match := envoyRouteMatch(r.Path)
+		if r.Method != "" {
+			match["headers"] = []map[string]interface{}{{
+				"name":         ":method",
+				"string_match": map[string]string{"exact": strings.ToUpper(r.Method)},
+			}}
+		}
+		rules = append(rules, map[string]interface{}{
+			"match":    match,
+			"requires": map[string]string{"provider_name": "tokenauth"},
+		})
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"providers": map[string]interface{}{"tokenauth": provider},
+		"rules":     rules,
+	}, "", "  ")
+}
+
+// APIGatewayAuthorizer returns the policy as an AWS API Gateway (HTTP API) JWT authorizer
+// and the routes referencing it with their authorization scopes, routes matching a
+// suffix with a leading * can't be exported
+func (p Policy) APIGatewayAuthorizer() ([]byte, error) {
+	type route struct {
+		RouteKey            string   `json:"RouteKey"`
+		AuthorizationType   string   `json:"AuthorizationType"`
+		AuthorizationScopes []string `json:"AuthorizationScopes,omitempty"`
+	}
+	routes := []route{}
+	for _, r := range p.Routes {
+		method := strings.ToUpper(r.Method)
+		if method == "" {
+			method = "ANY"
+		}
+		path, err := apiGatewayPath(r.Path)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route{
+			RouteKey:            method + " " + path,
+			AuthorizationType:   "JWT",
+			AuthorizationScopes: r.Scopes,
+		})
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"Authorizer": map[string]interface{}{
+			"Name":           "tokenauth",
+			"AuthorizerType": "JWT",
+			"IdentitySource": []string{"$request.header." + p.HeaderName},
+			"JwtConfiguration": map[string]interface{}{
+				"Issuer":   p.Issuer,
+				"Audience": p.Audiences,
+			},
+		},
+		"Routes": routes,
+	}, "", "  ")
+}
+
+// routePrefix strips the path parameters and a trailing * from a route path
+func routePrefix(path string) string {
+	path = strings.TrimSuffix(path, "*")
+	if i := strings.Index(path, "{"); i >= 0 {
+		path = path[:i]
+	}
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// envoyRouteMatch returns the Envoy route match of a route path, a
+// leading * matches the suffix of the path, which Envoy matches by regex
+func envoyRouteMatch(path string) map[string]interface{} {
+	if strings.HasPrefix(path, "*") && path != "*" {
+		return map[string]interface{}{
+			"safe_regex": map[string]interface{}{
+				"regex": ".*" + regexp.QuoteMeta(strings.TrimPrefix(path, "*")),
+			},
+		}
+	}
+	return map[string]interface{}{"prefix": routePrefix(path)}
+}
+
+// apiGatewayPath returns the path of an API Gateway route key, a trailing *
+// becomes the greedy {proxy+} parameter. API Gateway can't match suffixes.
+func apiGatewayPath(path string) (string, error) {
+	switch {
+	case path == "" || path == "*":
+		return "/{proxy+}", nil
+	case strings.HasPrefix(path, "*"):
+		return "", errors.Errorf("route %s can't be exported to API Gateway, it has no suffix routes", path)
+	case strings.HasSuffix(path, "*"):
+		path = strings.TrimSuffix(path, "*")
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+		return path + "{proxy+}", nil
+	}
+	return path, nil
+}
@@ -0,0 +1,131 @@
+package tokenauth_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func testPolicy() tokenauth.Policy {
+	p := tokenauth.PolicyFromOptions(tokenauth.Options{
+		SignMethod: jwt.SigningMethodRS256,
+	})
+	p.Issuer = "https://idp.example.com/"
+	p.Audiences = []string{"api"}
+	p.JWKSURI = "https://idp.example.com/.well-known/jwks.json"
+	p.Routes = []tokenauth.RoutePolicy{
+		{Method: "get", Path: "/users/{id}", Scopes: []string{"read:users"}},
+	}
+	return p
+}
+
+func TestPolicyEnvoy(t *testing.T) {
+	r := require.New(t)
+	b, err := testPolicy().EnvoyJWTAuthn("idp")
+	r.NoError(err)
+
+	cfg := struct {
+		Providers map[string]struct {
+			Issuer      string   `json:"issuer"`
+			Audiences   []string `json:"audiences"`
+			FromHeaders []struct {
+				Name        string `json:"name"`
+				ValuePrefix string `json:"value_prefix"`
+			} `json:"from_headers"`
+		} `json:"providers"`
+		Rules []struct {
+			Match struct {
+				Prefix string `json:"prefix"`
+			} `json:"match"`
+		} `json:"rules"`
+	}{}
+	r.NoError(json.Unmarshal(b, &cfg))
+	provider := cfg.Providers["tokenauth"]
+	r.Equal("https://idp.example.com/", provider.Issuer)
+	r.Equal([]string{"api"}, provider.Audiences)
+	r.Equal("Authorization", provider.FromHeaders[0].Name)
+	r.Equal("Bearer ", provider.FromHeaders[0].ValuePrefix)
+	r.Equal("/users/", cfg.Rules[0].Match.Prefix)
+}
+
+func TestPolicyEnvoyWildcards(t *testing.T) {
+	r := require.New(t)
+	p := testPolicy()
+	p.Routes = []tokenauth.RoutePolicy{
+		{Path: "/api/*"},
+		{Path: "*"},
+		{Path: "*.json"},
+	}
+	b, err := p.EnvoyJWTAuthn("idp")
+	r.NoError(err)
+
+	cfg := struct {
+		Rules []struct {
+			Match struct {
+				Prefix    string `json:"prefix"`
+				SafeRegex struct {
+					Regex string `json:"regex"`
+				} `json:"safe_regex"`
+			} `json:"match"`
+		} `json:"rules"`
+	}{}
+	r.NoError(json.Unmarshal(b, &cfg))
+	r.Equal("/api/", cfg.Rules[0].Match.Prefix)
+	r.Equal("/", cfg.Rules[1].Match.Prefix)
+	// Envoy has no suffix match, suffixes are matched by regex
+	r.Empty(cfg.Rules[2].Match.Prefix)
+	r.Equal(`.*\.json`, cfg.Rules[2].Match.SafeRegex.Regex)
+}
+
+func TestPolicyAPIGateway(t *testing.T) {
+	r := require.New(t)
+	b, err := testPolicy().APIGatewayAuthorizer()
+	r.NoError(err)
+
+	cfg := struct {
+		Authorizer struct {
+			IdentitySource   []string
+			JwtConfiguration struct {
+				Issuer   string
+				Audience []string
+			}
+		}
+		Routes []struct {
+			RouteKey            string
+			AuthorizationScopes []string
+		}
+	}{}
+	r.NoError(json.Unmarshal(b, &cfg))
+	r.Equal([]string{"$request.header.Authorization"}, cfg.Authorizer.IdentitySource)
+	r.Equal("https://idp.example.com/", cfg.Authorizer.JwtConfiguration.Issuer)
+	r.Equal("GET /users/{id}", cfg.Routes[0].RouteKey)
+	r.Equal([]string{"read:users"}, cfg.Routes[0].AuthorizationScopes)
+}
+
+func TestPolicyAPIGatewayWildcards(t *testing.T) {
+	r := require.New(t)
+	p := testPolicy()
+	p.Routes = []tokenauth.RoutePolicy{
+		{Method: "GET", Path: "/api/*", Scopes: []string{"read"}},
+		{Path: "*"},
+	}
+	b, err := p.APIGatewayAuthorizer()
+	r.NoError(err)
+
+	cfg := struct {
+		Routes []struct {
+			RouteKey string
+		}
+	}{}
+	r.NoError(json.Unmarshal(b, &cfg))
+	r.Equal("GET /api/{proxy+}", cfg.Routes[0].RouteKey)
+	r.Equal("ANY /{proxy+}", cfg.Routes[1].RouteKey)
+
+	// API Gateway can't match suffixes
+	p.Routes = []tokenauth.RoutePolicy{{Path: "*.json"}}
+	_, err = p.APIGatewayAuthorizer()
+	r.Error(err)
+}
@@ -0,0 +1,48 @@
+package tokenauth
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/presets"
+)
+
+// ErrInvalidTokenUse is returned if the token_use claim of a Cognito token is neither access nor id
+var ErrInvalidTokenUse = presets.ErrInvalidTokenUse
+
+// presetPolicy returns the Policy enforcing the preset of an identity provider
+func presetPolicy(p presets.Preset) Policy {
+	return Policy{
+		Issuer:     p.Issuer,
+		Audiences:  p.Audiences,
+		Algorithms: p.Algorithms,
+		JWKSURI:    p.JWKSURI,
+		Validate:   p.Validate,
+	}
+}
+
+// Auth0Policy returns the Policy of access tokens of the Auth0 tenant at domain
+// (e.g. "example.eu.auth0.com") for the API with the audience identifier, see presets.Auth0
+func Auth0Policy(domain, audience string) Policy {
+	return presetPolicy(presets.Auth0(domain, audience))
+}
+
+// Auth0 returns the middleware validating the access tokens of the Auth0 tenant
+// at domain for the API with the audience identifier
+//
+//	app.Use(tokenauth.Auth0("example.eu.auth0.com", "https://api.example.com"))
+func Auth0(domain, audience string) buffalo.MiddlewareFunc {
+	return Auth0Policy(domain, audience).Middleware(Options{})
+}
+
+// CognitoPolicy returns the Policy of the tokens of the Cognito user pool
+// for the app client clientID, see presets.Cognito
+func CognitoPolicy(region, userPoolID, clientID string) Policy {
+	return presetPolicy(presets.Cognito(region, userPoolID, clientID))
+}
+
+// Cognito returns the middleware validating the access and id tokens of the
+// Cognito user pool for the app client clientID
+//
+//	app.Use(tokenauth.Cognito("eu-west-1", "eu-west-1_AbCdEf", "1example23456789"))
+func Cognito(region, userPoolID, clientID string) buffalo.MiddlewareFunc {
+	return CognitoPolicy(region, userPoolID, clientID).Middleware(Options{})
+}
@@ -0,0 +1,48 @@
+package presets
+
+import (
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidClient is returned if the token was issued to a client app which is not accepted
+var ErrInvalidClient = errors.New("token client not accepted")
+
+// AzureAD returns the Preset of the access tokens the Microsoft identity
+// platform (Entra ID) tenant issues for the API with the application clientID.
+// Tokens of both the v1 (https://sts.windows.net/tenant/) and the v2
+// (https://login.microsoftonline.com/tenant/v2.0) format are accepted, their
+// aud is the clientID or api://clientID and the tid claim the tenant. The keys
+// are fetched from the JWKS of the tenant, which is refetched when Microsoft
+// rolls its keys. If clients are given, the tokens must be issued to one of
+// these client apps, the appid claim of v1 and the azp claim of v2 tokens.
+// The tenantID must be a tenant, not "common" or "organizations".
+func AzureAD(tenantID, clientID string, clients ...string) Preset {
+	issuers := []string{
+		"https://sts.windows.net/" + tenantID + "/",
+		"https://login.microsoftonline.com/" + tenantID + "/v2.0",
+	}
+	return Preset{
+		Audiences:  []string{clientID, "api://" + clientID},
+		Algorithms: []string{"RS256"},
+		JWKSURI:    "https://login.microsoftonline.com/" + tenantID + "/discovery/v2.0/keys",
+		Validate: func(claims jwt.MapClaims) error {
+			iss, _ := claims["iss"].(string)
+			if tid, _ := claims["tid"].(string); !guard.ContainsAny(issuers, iss) || tid != tenantID {
+				return guard.ErrInvalidIssuer
+			}
+			if len(clients) == 0 {
+				return nil
+			}
+			client, _ := claims["azp"].(string)
+			if iss == issuers[0] {
+				client, _ = claims["appid"].(string)
+			}
+			if !guard.ContainsAny(clients, client) {
+				return ErrInvalidClient
+			}
+			return nil
+		},
+	}
+}
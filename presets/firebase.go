@@ -0,0 +1,42 @@
+package presets
+
+import (
+	"time"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoSubject is returned if the token has no sub claim
+	ErrNoSubject = errors.New("token has no subject")
+	// ErrInvalidAuthTime is returned if the auth_time claim of the token is missing or in the future
+	ErrInvalidAuthTime = errors.New("token auth_time not accepted")
+)
+
+// FirebaseJWKSURL is the key set of Firebase Auth ID tokens, the same keys
+// as the certificates at keysource.FirebaseCertsURL
+const FirebaseJWKSURL = "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
+
+// Firebase returns the Preset of the Firebase Auth ID tokens of the project,
+// as documented by Firebase: RS256 signatures, the iss claim
+// https://securetoken.google.com/projectID, the aud claim projectID,
+// a non-empty sub claim and an auth_time claim in the past
+func Firebase(projectID string) Preset {
+	return Preset{
+		Issuer:     "https://securetoken.google.com/" + projectID,
+		Audiences:  []string{projectID},
+		Algorithms: []string{"RS256"},
+		JWKSURI:    FirebaseJWKSURL,
+		Validate: func(claims jwt.MapClaims) error {
+			if sub, _ := claims["sub"].(string); sub == "" {
+				return ErrNoSubject
+			}
+			if authTime, ok := guard.NumericDate(claims, "auth_time"); !ok || authTime.After(time.Now()) {
+				return ErrInvalidAuthTime
+			}
+			return nil
+		},
+	}
+}
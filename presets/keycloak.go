@@ -0,0 +1,51 @@
+package presets
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// KeycloakIssuer returns the issuer of the Keycloak realm, baseURL is
+// the URL of the Keycloak server, e.g. "https://sso.example.com", or
+// "https://sso.example.com/auth" for Keycloak before 17
+func KeycloakIssuer(baseURL, realm string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/realms/" + url.PathEscape(realm)
+}
+
+// KeycloakAccess are the roles granted by a Keycloak token in the nested
+// realm_access and resource_access claims
+type KeycloakAccess struct {
+	// RealmRoles are the roles of realm_access
+	RealmRoles []string
+	// ResourceRoles are the roles of resource_access by client
+	ResourceRoles map[string][]string
+}
+
+// KeycloakAccessFromClaims returns the roles granted by the claims
+func KeycloakAccessFromClaims(claims jwt.MapClaims) KeycloakAccess {
+	access := KeycloakAccess{ResourceRoles: map[string][]string{}}
+	if realm, ok := claims["realm_access"].(map[string]interface{}); ok {
+		access.RealmRoles = guard.Strings(realm, "roles")
+	}
+	if resources, ok := claims["resource_access"].(map[string]interface{}); ok {
+		for client, v := range resources {
+			if resource, ok := v.(map[string]interface{}); ok {
+				access.ResourceRoles[client] = guard.Strings(resource, "roles")
+			}
+		}
+	}
+	return access
+}
+
+// HasRealmRole reports if the realm role is granted
+func (a KeycloakAccess) HasRealmRole(role string) bool {
+	return guard.ContainsAny(a.RealmRoles, role)
+}
+
+// HasResourceRole reports if the role of the client is granted
+func (a KeycloakAccess) HasResourceRole(client, role string) bool {
+	return guard.ContainsAny(a.ResourceRoles[client], role)
+}
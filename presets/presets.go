@@ -0,0 +1,71 @@
+// Package presets describes how the tokens of the common identity providers
+// are verified: their issuers, audiences, algorithms and key sets, and the
+// checks of the claims specific to a provider. The tokenauth middleware turns
+// them into policies, e.g. tokenauth.Auth0 and tokenauth.Cognito.
+package presets
+
+import (
+	"strings"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidTokenUse is returned if the token_use claim of a Cognito token is neither access nor id
+var ErrInvalidTokenUse = errors.New("token use not accepted")
+
+// Preset is how the tokens of an identity provider are verified
+type Preset struct {
+	// Issuer is the iss claim of the tokens, empty if Validate checks it
+	Issuer     string
+	Audiences  []string
+	Algorithms []string
+	// JWKSURI is the key set of the provider
+	JWKSURI string
+	// Validate if set, checks the claims specific to the provider
+	Validate func(claims jwt.MapClaims) error
+}
+
+// Auth0 returns the Preset of access tokens of the Auth0 tenant at domain
+// (e.g. "example.eu.auth0.com") for the API with the audience identifier, as
+// documented by Auth0: RS256 signatures verified with the keys of the tenant's
+// JWKS, the iss claim https://domain/ and the aud claim containing the audience.
+func Auth0(domain, audience string) Preset {
+	domain = strings.TrimSuffix(strings.TrimPrefix(domain, "https://"), "/")
+	issuer := "https://" + domain + "/"
+	return Preset{
+		Issuer:     issuer,
+		Audiences:  []string{audience},
+		Algorithms: []string{"RS256"},
+		JWKSURI:    issuer + ".well-known/jwks.json",
+	}
+}
+
+// Cognito returns the Preset of the tokens of the Cognito user pool for the
+// app client clientID, as documented by AWS: RS256 signatures verified with the
+// keys of the JWKS of the user pool, the iss claim of the user pool and a token_use
+// of either access, whose client_id claim is the client, or id, whose aud is the client.
+func Cognito(region, userPoolID, clientID string) Preset {
+	issuer := "https://cognito-idp." + region + ".amazonaws.com/" + userPoolID
+	return Preset{
+		Issuer:     issuer,
+		Algorithms: []string{"RS256"},
+		JWKSURI:    issuer + "/.well-known/jwks.json",
+		Validate: func(claims jwt.MapClaims) error {
+			switch claims["token_use"] {
+			case "access":
+				if client, _ := claims["client_id"].(string); client == clientID {
+					return nil
+				}
+				return guard.ErrInvalidAudience
+			case "id":
+				if guard.ContainsAny(guard.Audience(claims), clientID) {
+					return nil
+				}
+				return guard.ErrInvalidAudience
+			}
+			return ErrInvalidTokenUse
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuth0Policy(t *testing.T) {
+	r := require.New(t)
+	p := tokenauth.Auth0Policy("https://example.eu.auth0.com/", "https://api.example.com")
+	r.Equal("https://example.eu.auth0.com/", p.Issuer)
+	r.Equal("https://example.eu.auth0.com/.well-known/jwks.json", p.JWKSURI)
+	r.Equal([]string{"RS256"}, p.Algorithms)
+
+	key := rsaTestKey(t)
+	ts, _ := jwksServer(rsaJWK("key-1", &key.PublicKey))
+	defer ts.Close()
+	jwks := tokenauth.NewJWKSProvider(ts.URL)
+	jwks.Client = ts.Client()
+	defer jwks.Close()
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(p.Middleware(tokenauth.Options{JWKS: jwks}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := bhttptest.New(a)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signRS256(t, "key-1", key, jwt.MapClaims{
+		"iss": "https://example.eu.auth0.com/",
+		"aud": []string{"https://api.example.com", "https://example.eu.auth0.com/userinfo"},
+		"exp": exp,
+	})
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	req.Headers["Authorization"] = "Bearer " + signRS256(t, "key-1", key, jwt.MapClaims{
+		"iss": "https://example.eu.auth0.com/",
+		"aud": "https://other-api.example.com",
+		"exp": exp,
+	})
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+}
+
+func TestCognitoPolicy(t *testing.T) {
+	r := require.New(t)
+	issuer := "https://cognito-idp.eu-west-1.amazonaws.com/eu-west-1_AbCdEf"
+	p := tokenauth.CognitoPolicy("eu-west-1", "eu-west-1_AbCdEf", "client-1")
+	r.Equal(issuer, p.Issuer)
+	r.Equal(issuer+"/.well-known/jwks.json", p.JWKSURI)
+	r.Equal([]string{"RS256"}, p.Algorithms)
+
+	key := rsaTestKey(t)
+	ts, _ := jwksServer(rsaJWK("key-1", &key.PublicKey))
+	defer ts.Close()
+	jwks := tokenauth.NewJWKSProvider(ts.URL)
+	jwks.Client = ts.Client()
+	defer jwks.Close()
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(p.Middleware(tokenauth.Options{JWKS: jwks}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := bhttptest.New(a)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+
+	tcases := []struct {
+		name   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"access token", jwt.MapClaims{"token_use": "access", "client_id": "client-1"}, http.StatusOK},
+		{"id token", jwt.MapClaims{"token_use": "id", "aud": "client-1"}, http.StatusOK},
+		{"access token of other client", jwt.MapClaims{"token_use": "access", "client_id": "client-2"}, http.StatusUnauthorized},
+		{"id token of other client", jwt.MapClaims{"token_use": "id", "aud": "client-2"}, http.StatusUnauthorized},
+		{"access token with client as aud only", jwt.MapClaims{"token_use": "access", "aud": "client-1"}, http.StatusUnauthorized},
+		{"no token use", jwt.MapClaims{"client_id": "client-1", "aud": "client-1"}, http.StatusUnauthorized},
+		{"other issuer", jwt.MapClaims{"iss": "https://example.com", "token_use": "access", "client_id": "client-1"}, http.StatusUnauthorized},
+	}
+	for _, tc := range tcases {
+		claims := jwt.MapClaims{"iss": issuer, "exp": exp}
+		for k, v := range tc.claims {
+			claims[k] = v
+		}
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signRS256(t, "key-1", key, claims)
+		r.Equal(tc.status, req.Get().Code, tc.name)
+	}
+}
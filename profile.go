@@ -0,0 +1,46 @@
+package tokenauth
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidType is returned if the typ header of the token is not the expected type
+var ErrInvalidType = errors.New("token type not accepted")
+
+// accessTokenClaims are the claims RFC 9068 requires in JWT access tokens
+var accessTokenClaims = []string{"iss", "exp", "aud", "sub", "client_id", "iat", "jti"}
+
+// checkProfile checks the typ header and the claims of the access token profile
+func checkProfile(token *jwt.Token, options Options) error {
+	want := options.Type
+	if want == "" && options.AccessTokenProfile {
+		want = "at+jwt"
+	}
+	if want != "" {
+		// the application/ prefix of the media type is optional, RFC 7515 section 4.1.9
+		typ, _ := token.Header["typ"].(string)
+		if !strings.EqualFold(mediaType(typ), mediaType(want)) {
+			return errors.Wrapf(ErrInvalidType, "%q", typ)
+		}
+	}
+	if options.AccessTokenProfile {
+		claims := token.Claims.(jwt.MapClaims)
+		for _, name := range accessTokenClaims {
+			if claims[name] == nil {
+				return errors.Wrap(ErrMissingClaim, name)
+			}
+		}
+	}
+	return nil
+}
+
+// mediaType returns the typ header without the application/ prefix
+func mediaType(typ string) string {
+	if len(typ) > len("application/") && strings.EqualFold(typ[:len("application/")], "application/") {
+		return typ[len("application/"):]
+	}
+	return typ
+}
@@ -0,0 +1,76 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// signTyped signs the claims with the typ header, no typ header if it is empty
+func signTyped(claims jwt.MapClaims, typ string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if typ == "" {
+		delete(token.Header, "typ")
+	} else {
+		token.Header["typ"] = typ
+	}
+	tokenString, _ := token.SignedString([]byte("secret"))
+	return tokenString
+}
+
+func TestAccessTokenProfile(t *testing.T) {
+	r := require.New(t)
+	app := func(options tokenauth.Options) *httptest.Handler {
+		options.KeyFunc = tokenauth.StaticKey([]byte("secret"))
+		a := buffalo.New(buffalo.Options{})
+		a.Use(tokenauth.New(options))
+		a.GET("/", func(c buffalo.Context) error {
+			return c.Render(200, render.String("ok"))
+		})
+		return httptest.New(a)
+	}
+	accessToken := func(without string) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"iss":       "https://idp.example.com",
+			"exp":       time.Now().Add(time.Minute * 5).Unix(),
+			"aud":       "api",
+			"sub":       "ada",
+			"client_id": "web",
+			"iat":       time.Now().Unix(),
+			"jti":       "8c1f2b",
+		}
+		delete(claims, without)
+		return claims
+	}
+	typed := app(tokenauth.Options{Type: "at+jwt"})
+	profile := app(tokenauth.Options{AccessTokenProfile: true, Audience: []string{"api"}})
+
+	for _, tt := range []struct {
+		w      *httptest.Handler
+		token  string
+		status int
+	}{
+		{typed, signTyped(accessToken(""), "at+jwt"), http.StatusOK},
+		{typed, signTyped(accessToken(""), "application/AT+JWT"), http.StatusOK},
+		// ID tokens of the same issuer
+		{typed, signTyped(accessToken(""), "JWT"), http.StatusUnauthorized},
+		{typed, signTyped(accessToken(""), ""), http.StatusUnauthorized},
+		{profile, signTyped(accessToken(""), "at+jwt"), http.StatusOK},
+		{profile, signTyped(accessToken(""), "JWT"), http.StatusUnauthorized},
+		{profile, signTyped(accessToken("client_id"), "at+jwt"), http.StatusUnauthorized},
+		{profile, signTyped(accessToken("jti"), "at+jwt"), http.StatusUnauthorized},
+		{profile, signTyped(accessToken("iat"), "at+jwt"), http.StatusUnauthorized},
+	} {
+		req := tt.w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + tt.token
+		res := req.Get()
+		r.Equal(tt.status, res.Code, tt.token)
+	}
+}
@@ -0,0 +1,195 @@
+package tokenauth
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// Error codes of rejected tokens, sent in the error_code of the response
+const (
+	ErrorCodeMissing        = "missing"
+	ErrorCodeMalformed      = "malformed"
+	ErrorCodeExpired        = "expired"
+	ErrorCodeNotValidYet    = "not_valid_yet"
+	ErrorCodeSignature      = "invalid_signature"
+	ErrorCodeInvalid        = "invalid"
+	ErrorCodeInsufficient   = "insufficient_scope"
+	ErrorCodeKeyUnavailable = "key_unavailable"
+	ErrorCodeOverloaded     = "overloaded"
+	// ErrorCodeDenied is sent if an authorization policy denied the request
+	ErrorCodeDenied = "denied"
+	// ErrorCodePolicyUnavailable is sent if the authorization policy couldn't be evaluated
+	ErrorCodePolicyUnavailable = "policy_unavailable"
+)
+
+// RetryHints makes the middleware answer rejected requests with RFC 6750 error
+// details and a machine readable body, so client SDKs can uniformly refresh
+// their token and retry, e.g. with client.Do
+//
+//	WWW-Authenticate: Bearer error="invalid_token", error_code="expired", error_description="Token is expired"
+//	{"error":"invalid_token","error_code":"expired","error_description":"Token is expired"}
+type RetryHints struct {
+	// RetryAfter if set, is sent as Retry-After header of 401 responses
+	RetryAfter time.Duration
+}
+
+// errorCode classifies why the token was rejected
+func errorCode(err error) string {
+	if authErr, ok := err.(*AuthError); ok {
+		return authErr.Code
+	}
+	switch errors.Cause(err) {
+	case ErrPolicyDenied:
+		return ErrorCodeDenied
+	case ErrNoToken:
+		return ErrorCodeMissing
+	case ErrInsufficientScope, ErrInsufficientRole:
+		return ErrorCodeInsufficient
+	case ErrOverloaded:
+		return ErrorCodeOverloaded
+	case ErrTokenTooLarge:
+		return ErrorCodeMalformed
+	}
+	if verr, ok := err.(*jwt.ValidationError); ok {
+		switch {
+		case verr.Errors&jwt.ValidationErrorMalformed != 0:
+			return ErrorCodeMalformed
+		case verr.Errors&jwt.ValidationErrorExpired != 0:
+			return ErrorCodeExpired
+		case verr.Errors&jwt.ValidationErrorNotValidYet != 0:
+			return ErrorCodeNotValidYet
+		case verr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			return ErrorCodeSignature
+		}
+	}
+	return ErrorCodeInvalid
+}
+
+// AuthError is the error of requests rejected by the middleware, it is passed
+// to the buffalo error handlers wrapped in a buffalo.HTTPError
+//
+//	app.ErrorHandlers[http.StatusUnauthorized] = func(status int, err error, c buffalo.Context) error {
+//		if authErr, ok := tokenauth.AsAuthError(err); ok {
+//			return c.Render(status, r.JSON(map[string]string{"code": authErr.Code}))
+//		}
+//		...
+//	}
+type AuthError struct {
+	// Code is one of the ErrorCode values
+	Code       string
+	HTTPStatus int
+	Cause      error
+	// WWWAuthenticate is the challenge sent in the WWW-Authenticate header
+	WWWAuthenticate string
+
+	// oauthError is the RFC 6750 error code
+	oauthError string
+}
+
+// Error returns the message of the cause
+func (e *AuthError) Error() string {
+	return e.Cause.Error()
+}
+
+// Unwrap returns the cause
+func (e *AuthError) Unwrap() error {
+	return e.Cause
+}
+
+// AsAuthError returns the AuthError of a rejected request, err is
+// either the AuthError or the buffalo.HTTPError wrapping it
+func AsAuthError(err error) (*AuthError, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *AuthError:
+			return e, true
+		case buffalo.HTTPError:
+			err = e.Cause
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		case interface{ Cause() error }:
+			err = e.Cause()
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// newAuthError classifies the error of a rejected request
+func newAuthError(options Options, status int, err error) *AuthError {
+	if authErr, ok := err.(*AuthError); ok {
+		if authErr.HTTPStatus == 0 {
+			cp := *authErr
+			cp.HTTPStatus = status
+			return &cp
+		}
+		return authErr
+	}
+	authErr := &AuthError{
+		Code:       errorCode(err),
+		HTTPStatus: status,
+		Cause:      err,
+		oauthError: "invalid_token",
+	}
+	switch {
+	case status == http.StatusForbidden:
+		authErr.oauthError = "insufficient_scope"
+	case status >= http.StatusInternalServerError:
+		if authErr.Code != ErrorCodeOverloaded {
+			authErr.Code = ErrorCodeKeyUnavailable
+		}
+		authErr.oauthError = "temporarily_unavailable"
+		// not a challenge to the client
+		return authErr
+	}
+	if authErr.Code == ErrorCodeMissing {
+		// no error details if the request carries no token, RFC 6750 section 3
+		authErr.WWWAuthenticate = options.AuthScheme
+	} else {
+		authErr.WWWAuthenticate = fmt.Sprintf("%s error=%q, error_code=%q, error_description=%q",
+			options.AuthScheme, authErr.oauthError, authErr.Code, err.Error())
+	}
+	return authErr
+}
+
+// reject responds to a request the middleware doesn't let through
+func reject(c buffalo.Context, options Options, status int, err error) error {
+	finishSnapshot(c, options, "", status, err)
+	options.PhaseMetrics.observe(c)
+	if next, ok := passThrough(c, status, err); ok {
+		return next(c)
+	}
+	authErr := newAuthError(options, status, err)
+	// the headers are only set with the final response, so they are not
+	// sent with informational responses like 103 Early Hints
+	header := c.Response().Header()
+	if authErr.WWWAuthenticate != "" {
+		header.Set("WWW-Authenticate", authErr.WWWAuthenticate)
+	}
+	if options.RetryHints != nil && authErr.HTTPStatus == http.StatusUnauthorized && options.RetryHints.RetryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(int(options.RetryHints.RetryAfter.Seconds())))
+	}
+	if authErr.Code == ErrorCodeOverloaded {
+		header.Set("Retry-After", strconv.Itoa(int(options.VerifyLimiter.retryAfter().Seconds())))
+	}
+	if options.NoRejectBody || (options.RetryHints != nil && c.Request().Method == http.MethodHead) {
+		c.Response().WriteHeader(authErr.HTTPStatus)
+		return nil
+	}
+	if options.RetryHints == nil {
+		return c.Error(authErr.HTTPStatus, authErr)
+	}
+	return c.Render(authErr.HTTPStatus, render.JSON(map[string]string{
+		"error":             authErr.oauthError,
+		"error_code":        authErr.Code,
+		"error_description": authErr.Error(),
+	}))
+}
@@ -0,0 +1,134 @@
+package tokenauth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	nhttptest "net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func appRetryHints() *buffalo.App {
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		RetryHints: &tokenauth.RetryHints{RetryAfter: 2 * time.Second},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String("ok"))
+	})
+	a.HEAD("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	return a
+}
+
+func TestRetryHints(t *testing.T) {
+	r := require.New(t)
+	w := httptest.New(appRetryHints())
+
+	// expired token
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{"sub": "1", "exp": time.Now().Add(-time.Minute).Unix()})
+	res := req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Header().Get("WWW-Authenticate"), `Bearer error="invalid_token", error_code="expired"`)
+	r.Equal("2", res.Header().Get("Retry-After"))
+	body := map[string]string{}
+	r.NoError(json.Unmarshal(res.Body.Bytes(), &body))
+	r.Equal("invalid_token", body["error"])
+	r.Equal(tokenauth.ErrorCodeExpired, body["error_code"])
+
+	// bad signature
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"}).SignedString([]byte("other"))
+	r.NoError(err)
+	req.Headers["Authorization"] = "Bearer " + token
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Header().Get("WWW-Authenticate"), `error_code="invalid_signature"`)
+
+	// no token, no error details
+	res = w.HTML("/").Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Equal("Bearer", res.Header().Get("WWW-Authenticate"))
+	body = map[string]string{}
+	r.NoError(json.Unmarshal(res.Body.Bytes(), &body))
+	r.Equal(tokenauth.ErrorCodeMissing, body["error_code"])
+}
+
+func TestAuthError(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.ErrorHandlers[http.StatusUnauthorized] = func(status int, err error, c buffalo.Context) error {
+		authErr, ok := tokenauth.AsAuthError(err)
+		if !ok {
+			return c.Render(status, render.String("not an auth error"))
+		}
+		c.Response().Header().Set("WWW-Authenticate", authErr.WWWAuthenticate)
+		return c.Render(authErr.HTTPStatus, render.String(authErr.Code))
+	}
+	a.Use(tokenauth.New(tokenauth.Options{}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})
+	res := req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Equal(tokenauth.ErrorCodeExpired, res.Body.String())
+	r.Contains(res.Header().Get("WWW-Authenticate"), `error_code="expired"`)
+
+	res = w.HTML("/").Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Equal(tokenauth.ErrorCodeMissing, res.Body.String())
+	r.Equal("Bearer", res.Header().Get("WWW-Authenticate"))
+
+	authErr, ok := tokenauth.AsAuthError(buffalo.HTTPError{Status: 401, Cause: &tokenauth.AuthError{Code: "x", Cause: tokenauth.ErrTokenInvalid}})
+	r.True(ok)
+	r.Equal("x", authErr.Code)
+	r.Equal("token invalid", authErr.Error())
+	_, ok = tokenauth.AsAuthError(tokenauth.ErrTokenInvalid)
+	r.False(ok)
+}
+
+func TestRejectHead(t *testing.T) {
+	r := require.New(t)
+	// the httptest of buffalo can't send HEAD requests
+	req := nhttptest.NewRequest("HEAD", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signHMAC(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}))
+	res := nhttptest.NewRecorder()
+	appRetryHints().ServeHTTP(res, req)
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Header().Get("WWW-Authenticate"), `error_code="expired"`)
+	r.Equal("2", res.Header().Get("Retry-After"))
+	r.Empty(res.Body.String())
+}
+
+func TestNoRejectBody(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{NoRejectBody: true}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String("ok"))
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})
+	res := req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Header().Get("WWW-Authenticate"), `error_code="expired"`)
+	r.Empty(res.Body.String())
+}
@@ -0,0 +1,101 @@
+package tokenauth
+
+import (
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// Reloadable is the middleware with options which can be replaced at runtime,
+// e.g. by config management adding an audience, without restarting the app
+//
+//	auth, err := tokenauth.NewReloadable(options)
+//	app.Use(auth.Middleware)
+//	...
+//	err = auth.ApplyConfig(newOptions)
+type Reloadable struct {
+	// OnChange if set, is called with the names of the changed Options fields
+	// when a config is applied, by default they are logged
+	OnChange func(changed []string)
+
+	mu    sync.Mutex
+	state atomic.Value
+}
+
+// reloadState is the applied config and its middleware, closing
+// stop ends the background key refreshes of the config
+type reloadState struct {
+	options Options
+	mw      buffalo.MiddlewareFunc
+	stop    chan struct{}
+}
+
+// NewReloadable returns a Reloadable middleware configured with the options
+func NewReloadable(options Options) (*Reloadable, error) {
+	stop := make(chan struct{})
+	mw, err := newMiddleware(options, stop)
+	if err != nil {
+		close(stop)
+		return nil, err
+	}
+	r := &Reloadable{}
+	r.state.Store(reloadState{options: options, mw: mw, stop: stop})
+	return r, nil
+}
+
+// Middleware verifies the request with the config applied last
+func (r *Reloadable) Middleware(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		return r.state.Load().(reloadState).mw(next)(c)
+	}
+}
+
+// ApplyConfig validates the options and swaps them in for subsequent requests,
+// if they are invalid the current config is kept. Requests in flight finish
+// with the config they started with. Background key refreshes of the replaced
+// config (KeyRefreshInterval, KeyFileWatchInterval) are stopped.
+func (r *Reloadable) ApplyConfig(options Options) error {
+	stop := make(chan struct{})
+	mw, err := newMiddleware(options, stop)
+	if err != nil {
+		close(stop)
+		return err
+	}
+	r.mu.Lock()
+	old := r.state.Load().(reloadState)
+	r.state.Store(reloadState{options: options, mw: mw, stop: stop})
+	r.mu.Unlock()
+	close(old.stop)
+
+	changed := changedOptions(old.options, options)
+	if r.OnChange != nil {
+		r.OnChange(changed)
+	} else if len(changed) > 0 {
+		log.Printf("tokenauth: config applied, changed %s", strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// changedOptions returns the names of the fields which differ, functions
+// are compared by their code, so closures of one function are equal
+func changedOptions(old, new Options) []string {
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	changed := []string{}
+	for i := 0; i < ov.NumField(); i++ {
+		a, b := ov.Field(i), nv.Field(i)
+		var equal bool
+		if a.Kind() == reflect.Func {
+			equal = a.IsNil() == b.IsNil() && a.Pointer() == b.Pointer()
+		} else {
+			equal = reflect.DeepEqual(a.Interface(), b.Interface())
+		}
+		if !equal {
+			changed = append(changed, ov.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
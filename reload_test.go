@@ -0,0 +1,91 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadable(t *testing.T) {
+	r := require.New(t)
+	auth, err := tokenauth.NewReloadable(tokenauth.Options{
+		Keys: map[string]interface{}{"key-1": []byte("old-secret")},
+	})
+	r.NoError(err)
+	var changed []string
+	auth.OnChange = func(c []string) {
+		changed = c
+	}
+	a := buffalo.New(buffalo.Options{})
+	a.Use(auth.Middleware)
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	sign := func(secret string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"exp": time.Now().Add(time.Minute * 5).Unix(),
+		})
+		token.Header["kid"] = "key-1"
+		tokenString, err := token.SignedString([]byte(secret))
+		r.NoError(err)
+		return tokenString
+	}
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + sign("old-secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	r.NoError(auth.ApplyConfig(tokenauth.Options{
+		Keys:       map[string]interface{}{"key-1": []byte("new-secret")},
+		HeaderName: "Authorization",
+	}))
+	r.Equal([]string{"HeaderName", "Keys"}, changed)
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+	req.Headers["Authorization"] = "Bearer " + sign("new-secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	// invalid configs are not applied
+	verified := 0
+	err = auth.ApplyConfig(tokenauth.Options{
+		SignMethod:    jwt.SigningMethodRS256,
+		CryptoBackend: hmacOnly{verified: &verified},
+		Keys:          map[string]interface{}{"key-1": []byte("other-secret")},
+	})
+	r.Error(err)
+	r.Equal(http.StatusOK, req.Get().Code)
+}
+
+func TestReloadableStopsKeyRefresh(t *testing.T) {
+	r := require.New(t)
+	var loads int32
+	getKey := func(jwt.SigningMethod) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return []byte("secret"), nil
+	}
+	auth, err := tokenauth.NewReloadable(tokenauth.Options{
+		GetKey:             getKey,
+		KeyRefreshInterval: 5 * time.Millisecond,
+	})
+	r.NoError(err)
+	time.Sleep(20 * time.Millisecond)
+	r.True(atomic.LoadInt32(&loads) > 1)
+
+	// the refreshes of the replaced config stop
+	r.NoError(auth.ApplyConfig(tokenauth.Options{
+		GetKey: func(jwt.SigningMethod) (interface{}, error) {
+			return []byte("secret"), nil
+		},
+	}))
+	time.Sleep(10 * time.Millisecond)
+	stopped := atomic.LoadInt32(&loads)
+	time.Sleep(20 * time.Millisecond)
+	r.Equal(stopped, atomic.LoadInt32(&loads))
+}
@@ -0,0 +1,48 @@
+package tokenauth
+
+import (
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// DefaultRenewHeader is the response header carrying renewed tokens
+const DefaultRenewHeader = "X-Renewed-Token"
+
+// renewToken sends a renewed token in the RenewHeader if the token of the
+// request expires within the RenewWindow. The renewed token carries the claims
+// of the token and is valid as long as it was, tokens without iat and exp
+// aren't renewed, since their lifetime is unknown
+func renewToken(c buffalo.Context, options Options, claims jwt.MapClaims) error {
+	exp, ok := ExpiresAt(claims)
+	if !ok || time.Until(exp) > options.RenewWindow {
+		return nil
+	}
+	iat, ok := IssuedAt(claims)
+	if !ok || !iat.Before(exp) {
+		return nil
+	}
+	renewed := jwt.MapClaims{}
+	for k, v := range claims {
+		renewed[k] = v
+	}
+	// the renewed token is another token, e.g. for PreventReplay
+	delete(renewed, "jti")
+	delete(renewed, "iat")
+	delete(renewed, "exp")
+	if _, ok := claims["nbf"]; ok {
+		renewed["nbf"] = jwt.TimeFunc().Unix()
+	}
+	issuer := &Issuer{SignMethod: options.SignMethod, Key: options.RenewKey, KeyID: options.RenewKeyID, TTL: exp.Sub(iat)}
+	signed, err := issuer.Issue(renewed)
+	if err != nil {
+		return errors.Wrap(err, "couldn't renew token")
+	}
+	header := c.Response().Header()
+	header.Set(options.RenewHeader, signed)
+	// cross-origin clients can only read exposed headers
+	header.Add("Access-Control-Expose-Headers", options.RenewHeader)
+	return nil
+}
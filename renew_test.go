@@ -0,0 +1,96 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenewWindow(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc:     tokenauth.StaticKey([]byte("secret")),
+		RenewWindow: 5 * time.Minute,
+		RenewKey:    []byte("secret"),
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	get := func(claims jwt.MapClaims) *httptest.Response {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret")
+		return req.Get()
+	}
+
+	// tokens far from expiry are not renewed
+	now := time.Now()
+	res := get(jwt.MapClaims{"sub": "ada", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix()})
+	r.Equal(http.StatusOK, res.Code)
+	r.Empty(res.Header().Get(tokenauth.DefaultRenewHeader))
+
+	issued := now.Add(-time.Hour + 2*time.Minute)
+	res = get(jwt.MapClaims{"sub": "ada", "jti": "a", "iat": issued.Unix(), "exp": now.Add(2 * time.Minute).Unix()})
+	r.Equal(http.StatusOK, res.Code)
+	renewed := res.Header().Get(tokenauth.DefaultRenewHeader)
+	r.NotEmpty(renewed)
+	r.Equal(tokenauth.DefaultRenewHeader, res.Header().Get("Access-Control-Expose-Headers"))
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(renewed, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("secret"), nil
+	})
+	r.NoError(err)
+	r.Equal("ada", claims["sub"])
+	r.NotEqual("a", claims["jti"])
+	// the renewed token lives as long as the token did
+	exp, _ := tokenauth.ExpiresAt(claims)
+	r.WithinDuration(now.Add(time.Hour), exp, 5*time.Second)
+
+	// tokens without iat have an unknown lifetime
+	res = get(jwt.MapClaims{"sub": "ada", "exp": now.Add(2 * time.Minute).Unix()})
+	r.Equal(http.StatusOK, res.Code)
+	r.Empty(res.Header().Get(tokenauth.DefaultRenewHeader))
+
+	_, err = tokenauth.NewWithError(tokenauth.Options{
+		KeyFunc:     tokenauth.StaticKey([]byte("secret")),
+		RenewWindow: time.Minute,
+	})
+	r.Error(err)
+}
+
+func TestRenewWindowOptions(t *testing.T) {
+	r := require.New(t)
+	// the renewed tokens would be rejected by the middleware itself
+	for msg, configure := range map[string]func(o *tokenauth.Options){
+		"PASETO": func(o *tokenauth.Options) { o.PASETO = &tokenauth.PASETO{LocalKey: random(t, 32)} },
+		"Branca": func(o *tokenauth.Options) { o.Branca = &tokenauth.Branca{Key: random(t, 32)} },
+		"RequireEncryption": func(o *tokenauth.Options) {
+			o.RequireEncryption = true
+			o.GetDecryptionKey = func(map[string]interface{}) (interface{}, error) {
+				return random(t, 16), nil
+			}
+		},
+		"Canary": func(o *tokenauth.Options) {
+			o.Canary = &tokenauth.CanaryIssuer{SignMethod: jwt.SigningMethodHS256, GetKey: func(jwt.SigningMethod) (interface{}, error) {
+				return []byte("canary"), nil
+			}}
+		},
+	} {
+		o := tokenauth.Options{
+			KeyFunc:     tokenauth.StaticKey([]byte("secret")),
+			RenewWindow: time.Minute,
+			RenewKey:    []byte("secret"),
+		}
+		configure(&o)
+		_, err := tokenauth.NewWithError(o)
+		r.Error(err, msg)
+		r.Contains(err.Error(), msg)
+	}
+}
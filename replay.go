@@ -0,0 +1,39 @@
+package tokenauth
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// DefaultReplayCacheSize is the number of jti values the default ReplayStore keeps
+const DefaultReplayCacheSize = 100000
+
+// ErrTokenReplayed is returned if a token with the jti was already accepted
+var ErrTokenReplayed = errors.New("token already used")
+
+// checkReplay adds the jti of the token to the ReplayStore, it returns the
+// status the request is rejected with if the token was already accepted
+func checkReplay(c buffalo.Context, options Options, claims jwt.MapClaims) (int, error) {
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return http.StatusUnauthorized, errors.Wrap(ErrMissingClaim, "jti")
+	}
+	exp, ok := ExpiresAt(claims)
+	if !ok {
+		return http.StatusUnauthorized, errors.Wrap(ErrMissingClaim, "exp")
+	}
+	// the jti is unique per issuer, the token is accepted until exp plus Leeway
+	iss, _ := claims["iss"].(string)
+	err := options.ReplayStore.Add(c, iss+" "+jti, exp.Add(options.Leeway))
+	switch {
+	case errors.Cause(err) == store.ErrExists:
+		return http.StatusUnauthorized, ErrTokenReplayed
+	case err != nil:
+		return http.StatusServiceUnavailable, errors.Wrap(err, "couldn't check token replay")
+	}
+	return 0, nil
+}
@@ -0,0 +1,74 @@
+package tokenauth_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore is a ReplayStore which is down
+type failingStore struct{}
+
+func (failingStore) Add(context.Context, string, time.Time) error {
+	return errors.New("connection refused")
+}
+
+func (failingStore) Contains(context.Context, string) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestPreventReplay(t *testing.T) {
+	r := require.New(t)
+	app := func(options tokenauth.Options) *httptest.Handler {
+		options.KeyFunc = tokenauth.StaticKey([]byte("secret"))
+		a := buffalo.New(buffalo.Options{})
+		a.Use(tokenauth.New(options))
+		a.POST("/password", func(c buffalo.Context) error {
+			return c.Render(200, nil)
+		})
+		return httptest.New(a)
+	}
+	w := app(tokenauth.Options{PreventReplay: true})
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	post := func(w *httptest.Handler, claims jwt.MapClaims) int {
+		req := w.HTML("/password")
+		req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret")
+		return req.Post(nil).Code
+	}
+
+	reset := jwt.MapClaims{"iss": "accounts", "jti": "reset-1", "exp": exp}
+	r.Equal(http.StatusOK, post(w, reset))
+	r.Equal(http.StatusUnauthorized, post(w, reset))
+	// the jti is unique per issuer
+	r.Equal(http.StatusOK, post(w, jwt.MapClaims{"iss": "billing", "jti": "reset-1", "exp": exp}))
+	r.Equal(http.StatusUnauthorized, post(w, jwt.MapClaims{"iss": "accounts", "exp": exp}))
+	r.Equal(http.StatusUnauthorized, post(w, jwt.MapClaims{"iss": "accounts", "jti": "reset-2"}))
+
+	// concurrent requests with the same token are accepted once
+	var accepted int64
+	var wg sync.WaitGroup
+	concurrent := jwt.MapClaims{"iss": "accounts", "jti": "reset-3", "exp": exp}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if post(w, concurrent) == http.StatusOK {
+				atomic.AddInt64(&accepted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	r.Equal(int64(1), accepted)
+
+	r.Equal(http.StatusServiceUnavailable, post(app(tokenauth.Options{ReplayStore: failingStore{}}), reset))
+}
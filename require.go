@@ -0,0 +1,79 @@
+package tokenauth
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Authorize returns a middleware which calls the policy with the claims of the
+// verified token, so the authorization of a route is defined next to it. Requests
+// are rejected with 403 Forbidden if it returns an error, or the HTTPStatus of a
+// returned AuthError. It must be used after the tokenauth middleware
+//
+//	app.Use(tokenauth.New(tokenauth.Options{}))
+//	app.DELETE("/posts/{id}", tokenauth.Authorize(func(c buffalo.Context, claims jwt.Claims) error {
+//		if !isAuthor(claims, c.Param("id")) {
+//			return errors.New("not the author of the post")
+//		}
+//		return nil
+//	})(deletePost))
+func Authorize(policy func(c buffalo.Context, claims jwt.Claims) error) buffalo.MiddlewareFunc {
+	options := Options{AuthScheme: "Bearer"}
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			// the middleware let the request through, see FlagReportOnly
+			if passedThrough(c) {
+				return next(c)
+			}
+			claims, ok := c.Value("claims").(jwt.Claims)
+			if !ok {
+				letThrough(c, next)
+				return reject(c, options, http.StatusUnauthorized, ErrNoToken)
+			}
+			if err := policy(c, claims); err != nil {
+				status := http.StatusForbidden
+				if authErr, ok := AsAuthError(err); ok && authErr.HTTPStatus != 0 {
+					status = authErr.HTTPStatus
+				}
+				letThrough(c, next)
+				return reject(c, options, status, err)
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireScopes returns a middleware which rejects requests with 403 Forbidden
+// unless the scope or scp claim of the verified token contains all the scopes.
+// Like Authorize it must be used after the tokenauth middleware, e.g. on a group of routes
+//
+//	users := app.Group("/users")
+//	users.Use(tokenauth.RequireScopes("read:users"))
+func RequireScopes(scopes ...string) buffalo.MiddlewareFunc {
+	return Authorize(func(c buffalo.Context, _ jwt.Claims) error {
+		if !guard.ContainsAll(guard.Scopes(ClaimsMap(c)), scopes...) {
+			return ErrInsufficientScope
+		}
+		return nil
+	})
+}
+
+// RequireRoles returns a middleware which rejects requests with 403 Forbidden
+// unless the claim at path has any of the roles. The path separates the names
+// of nested claims by dots, which covers the layouts of the major identity providers
+//
+//	tokenauth.RequireRoles("roles", "admin")                     // Auth0 RBAC, Azure AD
+//	tokenauth.RequireRoles("realm_access.roles", "admin")        // Keycloak
+//	tokenauth.RequireRoles("cognito:groups", "admin")            // Cognito
+//	tokenauth.RequireRoles("https://example.com/roles", "admin") // Auth0 namespaced claims
+func RequireRoles(path string, roles ...string) buffalo.MiddlewareFunc {
+	return Authorize(func(c buffalo.Context, _ jwt.Claims) error {
+		if !guard.ContainsAny(guard.StringsAt(ClaimsMap(c), path), roles...) {
+			return ErrInsufficientRole
+		}
+		return nil
+	})
+}
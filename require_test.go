@@ -0,0 +1,133 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireScopes(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String("ok"))
+	})
+	users := a.Group("/users")
+	users.Use(tokenauth.RequireScopes("read:users", "write:users"))
+	users.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String("users"))
+	})
+	w := httptest.New(a)
+
+	for _, tt := range []struct {
+		path   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"/", jwt.MapClaims{}, http.StatusOK},
+		{"/users/", jwt.MapClaims{"scope": "read:users write:users"}, http.StatusOK},
+		{"/users/", jwt.MapClaims{"scp": []string{"write:users", "read:users"}}, http.StatusOK},
+		{"/users/", jwt.MapClaims{"scope": "read:users"}, http.StatusForbidden},
+		{"/users/", jwt.MapClaims{}, http.StatusForbidden},
+	} {
+		tt.claims["exp"] = time.Now().Add(time.Minute * 5).Unix()
+		req := w.HTML(tt.path)
+		req.Headers["Authorization"] = "Bearer " + signWith(tt.claims, "secret")
+		res := req.Get()
+		r.Equal(tt.status, res.Code, tt.claims)
+		if tt.status == http.StatusForbidden {
+			r.Contains(res.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+		}
+	}
+
+	// without the tokenauth middleware
+	b := buffalo.New(buffalo.Options{})
+	b.Use(tokenauth.RequireScopes("read:users"))
+	b.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String("ok"))
+	})
+	r.Equal(http.StatusUnauthorized, httptest.New(b).HTML("/").Get().Code)
+}
+
+func TestRequireRoles(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+	}))
+	admin := a.Group("/admin")
+	admin.Use(tokenauth.RequireRoles("realm_access.roles", "admin", "owner"))
+	admin.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String("admin"))
+	})
+	groups := a.Group("/groups")
+	groups.Use(tokenauth.RequireRoles("cognito:groups", "editors"))
+	groups.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String("groups"))
+	})
+	w := httptest.New(a)
+
+	for _, tt := range []struct {
+		path   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"/admin/", jwt.MapClaims{"realm_access": map[string]interface{}{"roles": []string{"user", "owner"}}}, http.StatusOK},
+		{"/admin/", jwt.MapClaims{"realm_access": map[string]interface{}{"roles": []string{"user"}}}, http.StatusForbidden},
+		{"/admin/", jwt.MapClaims{"roles": []string{"admin"}}, http.StatusForbidden},
+		{"/groups/", jwt.MapClaims{"cognito:groups": []string{"editors"}}, http.StatusOK},
+		{"/groups/", jwt.MapClaims{}, http.StatusForbidden},
+	} {
+		tt.claims["exp"] = time.Now().Add(time.Minute * 5).Unix()
+		req := w.HTML(tt.path)
+		req.Headers["Authorization"] = "Bearer " + signWith(tt.claims, "secret")
+		r.Equal(tt.status, req.Get().Code, tt.claims)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+	}))
+	a.GET("/posts/{author}", tokenauth.Authorize(func(c buffalo.Context, claims jwt.Claims) error {
+		mc := claims.(jwt.MapClaims)
+		if mc["suspended"] == true {
+			return &tokenauth.AuthError{Code: "suspended", HTTPStatus: http.StatusUnauthorized, Cause: errors.New("account suspended")}
+		}
+		if mc["sub"] != c.Param("author") {
+			return errors.New("not the author")
+		}
+		return nil
+	})(func(c buffalo.Context) error {
+		return c.Render(200, render.String(c.Param("author")))
+	}))
+	w := httptest.New(a)
+
+	for _, tt := range []struct {
+		path   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"/posts/ada", jwt.MapClaims{"sub": "ada"}, http.StatusOK},
+		{"/posts/ada", jwt.MapClaims{"sub": "bob"}, http.StatusForbidden},
+		{"/posts/ada", jwt.MapClaims{"sub": "ada", "suspended": true}, http.StatusUnauthorized},
+	} {
+		tt.claims["exp"] = time.Now().Add(time.Minute * 5).Unix()
+		req := w.HTML(tt.path)
+		req.Headers["Authorization"] = "Bearer " + signWith(tt.claims, "secret")
+		r.Equal(tt.status, req.Get().Code, tt.claims)
+	}
+}
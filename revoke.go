@@ -0,0 +1,50 @@
+package tokenauth
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrTokenRevoked is returned if the token was revoked by the Revoker
+var ErrTokenRevoked = errors.New("token revoked")
+
+// Revoker invalidates tokens before they expire, e.g. on logout
+type Revoker = store.Revoker
+
+// TokenID returns the jti of the claims, or the sub and iat claims for tokens without jti
+func TokenID(claims jwt.MapClaims) string {
+	return store.TokenID(claims)
+}
+
+// NewMemoryRevoker returns a Revoker keeping the jti of the revoked tokens in
+// memory until they expire, it suits apps running a single instance
+//
+//	revoker := tokenauth.NewMemoryRevoker()
+//	app.Use(tokenauth.New(tokenauth.Options{Revoker: revoker}))
+//	app.POST("/logout", func(c buffalo.Context) error {
+//		claims := tokenauth.ClaimsMap(c)
+//		exp, _ := tokenauth.ExpiresAt(claims)
+//		if err := revoker.Revoke(c, tokenauth.TokenID(claims), exp); err != nil {
+//			return err
+//		}
+//		return c.Render(http.StatusNoContent, nil)
+//	})
+func NewMemoryRevoker() Revoker {
+	return store.NewRevoker(store.NewMemory(0))
+}
+
+// checkRevoked returns the status the request is rejected with if the token was revoked
+func checkRevoked(c buffalo.Context, options Options, claims jwt.MapClaims) (int, error) {
+	revoked, err := options.Revoker.IsRevoked(c, claims)
+	if err != nil {
+		return http.StatusServiceUnavailable, errors.Wrap(err, "couldn't check token revocation")
+	}
+	if revoked {
+		return http.StatusUnauthorized, ErrTokenRevoked
+	}
+	return 0, nil
+}
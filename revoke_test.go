@@ -0,0 +1,110 @@
+package tokenauth_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevoker(t *testing.T) {
+	r := require.New(t)
+	revoker := tokenauth.NewMemoryRevoker()
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		Revoker: revoker,
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	a.POST("/logout", func(c buffalo.Context) error {
+		claims := tokenauth.ClaimsMap(c)
+		exp, _ := tokenauth.ExpiresAt(claims)
+		if err := revoker.Revoke(c, tokenauth.TokenID(claims), exp); err != nil {
+			return err
+		}
+		return c.Render(http.StatusNoContent, nil)
+	})
+	w := httptest.New(a)
+
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	session := signWith(jwt.MapClaims{"jti": "session-1", "exp": exp}, "secret")
+	other := signWith(jwt.MapClaims{"jti": "session-2", "exp": exp}, "secret")
+	anonymous := signWith(jwt.MapClaims{"exp": exp}, "secret")
+	issued := signWith(jwt.MapClaims{"sub": "ada", "iat": time.Now().Unix(), "exp": exp}, "secret")
+	status := func(token string) int {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + token
+		return req.Get().Code
+	}
+
+	r.Equal(http.StatusOK, status(session))
+	req := w.HTML("/logout")
+	req.Headers["Authorization"] = "Bearer " + session
+	r.Equal(http.StatusNoContent, req.Post(nil).Code)
+	r.Equal(http.StatusUnauthorized, status(session))
+	r.Equal(http.StatusOK, status(other))
+	r.Equal(http.StatusOK, status(anonymous))
+	// tokens without jti are revoked by their sub and iat
+	r.Equal(http.StatusOK, status(issued))
+	req = w.HTML("/logout")
+	req.Headers["Authorization"] = "Bearer " + issued
+	r.Equal(http.StatusNoContent, req.Post(nil).Code)
+	r.Equal(http.StatusUnauthorized, status(issued))
+
+	// revocations of several instances are shared with a shared store
+	shared := store.NewMemory(0)
+	r.NoError(store.NewRevoker(shared).Revoke(context.Background(), "session-2", time.Now().Add(time.Minute)))
+	revoked, err := store.NewRevoker(shared).IsRevoked(context.Background(), jwt.MapClaims{"jti": "session-2"})
+	r.NoError(err)
+	r.True(revoked)
+}
+
+func TestLogoutHandler(t *testing.T) {
+	r := require.New(t)
+	revoker := tokenauth.NewMemoryRevoker()
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc:     tokenauth.StaticKey([]byte("secret")),
+		Revoker:     revoker,
+		TokenSource: tokenauth.FromCookie("access_token"),
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	a.POST("/logout", tokenauth.LogoutHandler(revoker, "access_token"))
+	w := httptest.New(a)
+
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	session := signWith(jwt.MapClaims{"jti": "session-1", "exp": exp}, "secret")
+	req := w.HTML("/logout")
+	req.Headers["Authorization"] = "Bearer " + session
+	res := req.Post(nil)
+	r.Equal(http.StatusNoContent, res.Code)
+	// the cookie expires, besides it the session cookie of buffalo is set
+	var deleted *http.Cookie
+	for _, cookie := range res.Result().Cookies() {
+		if cookie.Name == "access_token" {
+			deleted = cookie
+		}
+	}
+	r.NotNil(deleted)
+	r.True(deleted.Expires.Before(time.Unix(1, 0)))
+
+	req = w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + session
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+
+	// tokens without exp can't be revoked
+	req = w.HTML("/logout")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"jti": "session-2"}, "secret")
+	r.Equal(http.StatusBadRequest, req.Post(nil).Code)
+}
@@ -0,0 +1,132 @@
+package tokenauth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrSessionVersion is returned if the session version of the token is
+// older than the current session version of its subject
+var ErrSessionVersion = errors.New("session version outdated")
+
+// DefaultSessionVersionCacheTTL is how long the session versions are cached
+const DefaultSessionVersionCacheTTL = 5 * time.Second
+
+// sessionVersionClaims are the claims holding the session version of a token
+var sessionVersionClaims = []string{"sver", "token_version"}
+
+// SessionVersions returns the current session version of the subjects, e.g. a
+// column of the users table which is incremented to log a user out everywhere
+// or after a password reset. Tokens carry the version they were issued with in
+// the sver or token_version claim, and tokens with older versions are rejected.
+type SessionVersions interface {
+	SessionVersion(ctx context.Context, sub string) (int64, error)
+}
+
+// SessionVersionFunc is a function implementing SessionVersions
+//
+//	app.Use(tokenauth.New(tokenauth.Options{
+//		SessionVersions: tokenauth.SessionVersionFunc(func(ctx context.Context, sub string) (int64, error) {
+//			user := &models.User{}
+//			err := models.DB.Select("session_version").Find(user, sub)
+//			return user.SessionVersion, err
+//		}),
+//	}))
+type SessionVersionFunc func(ctx context.Context, sub string) (int64, error)
+
+// SessionVersion calls the function
+func (f SessionVersionFunc) SessionVersion(ctx context.Context, sub string) (int64, error) {
+	return f(ctx, sub)
+}
+
+// checkSessionVersion returns the status the request is rejected with if the
+// session version of the token is older than the one of its subject
+func checkSessionVersion(c buffalo.Context, options Options, claims jwt.MapClaims) (int, error) {
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return http.StatusUnauthorized, errors.Wrap(ErrMissingClaim, "sub")
+	}
+	version, ok := sessionVersion(claims)
+	if !ok {
+		return http.StatusUnauthorized, errors.Wrap(ErrMissingClaim, "sver")
+	}
+	current, err := options.SessionVersions.SessionVersion(c, sub)
+	if err != nil {
+		return http.StatusServiceUnavailable, errors.Wrap(err, "couldn't look up session version")
+	}
+	// tokens issued after the version was incremented may be
+	// newer than the cached version
+	if version < current {
+		return http.StatusUnauthorized, ErrSessionVersion
+	}
+	return 0, nil
+}
+
+// sessionVersion returns the session version of the token,
+// issuers send it either as number or as string
+func sessionVersion(claims jwt.MapClaims) (int64, bool) {
+	for _, name := range sessionVersionClaims {
+		switch v := claims[name].(type) {
+		case float64:
+			return int64(v), true
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// maxCachedSessionVersions is the number of subjects whose session version is cached
+const maxCachedSessionVersions = 10000
+
+// cachedSessionVersions caches the session versions of the subjects for ttl
+type cachedSessionVersions struct {
+	SessionVersions
+	ttl time.Duration
+
+	mu       sync.Mutex
+	versions map[string]cachedSessionVersion
+}
+
+type cachedSessionVersion struct {
+	version int64
+	expires time.Time
+}
+
+func (s *cachedSessionVersions) SessionVersion(ctx context.Context, sub string) (int64, error) {
+	now := time.Now()
+	s.mu.Lock()
+	cached, ok := s.versions[sub]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.version, nil
+	}
+	version, err := s.SessionVersions.SessionVersion(ctx, sub)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.versions) >= maxCachedSessionVersions {
+		for k, v := range s.versions {
+			if !now.Before(v.expires) {
+				delete(s.versions, k)
+			}
+		}
+		// all versions are fresh, the cache starts over
+		if len(s.versions) >= maxCachedSessionVersions {
+			s.versions = map[string]cachedSessionVersion{}
+		}
+	}
+	s.versions[sub] = cachedSessionVersion{version: version, expires: now.Add(s.ttl)}
+	return version, nil
+}
@@ -0,0 +1,82 @@
+package tokenauth_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionVersions(t *testing.T) {
+	r := require.New(t)
+	var mu sync.Mutex
+	versions := map[string]int64{"ada": 1}
+	lookups := 0
+	users := tokenauth.SessionVersionFunc(func(_ context.Context, sub string) (int64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		lookups++
+		v, ok := versions[sub]
+		if !ok {
+			return 0, errors.New("connection refused")
+		}
+		return v, nil
+	})
+	app := func(ttl time.Duration) *httptest.Handler {
+		a := buffalo.New(buffalo.Options{})
+		a.Use(tokenauth.New(tokenauth.Options{
+			KeyFunc:                tokenauth.StaticKey([]byte("secret")),
+			SessionVersions:        users,
+			SessionVersionCacheTTL: ttl,
+		}))
+		a.GET("/", func(c buffalo.Context) error {
+			return c.Render(200, nil)
+		})
+		return httptest.New(a)
+	}
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	status := func(w *httptest.Handler, claims jwt.MapClaims) int {
+		claims["exp"] = exp
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret")
+		return req.Get().Code
+	}
+
+	w := app(-1)
+	r.Equal(http.StatusOK, status(w, jwt.MapClaims{"sub": "ada", "sver": 1}))
+	r.Equal(http.StatusOK, status(w, jwt.MapClaims{"sub": "ada", "token_version": "1"}))
+	r.Equal(http.StatusUnauthorized, status(w, jwt.MapClaims{"sub": "ada"}))
+	r.Equal(http.StatusUnauthorized, status(w, jwt.MapClaims{"sver": 1}))
+	r.Equal(http.StatusServiceUnavailable, status(w, jwt.MapClaims{"sub": "bob", "sver": 1}))
+
+	// logging out everywhere increments the version
+	mu.Lock()
+	versions["ada"] = 2
+	mu.Unlock()
+	r.Equal(http.StatusUnauthorized, status(w, jwt.MapClaims{"sub": "ada", "sver": 1}))
+	r.Equal(http.StatusOK, status(w, jwt.MapClaims{"sub": "ada", "sver": 2}))
+
+	// the versions are cached
+	w = app(time.Hour)
+	mu.Lock()
+	lookups = 0
+	mu.Unlock()
+	r.Equal(http.StatusOK, status(w, jwt.MapClaims{"sub": "ada", "sver": 2}))
+	mu.Lock()
+	versions["ada"] = 3
+	mu.Unlock()
+	r.Equal(http.StatusOK, status(w, jwt.MapClaims{"sub": "ada", "sver": 2}))
+	// tokens newer than the cached version are accepted
+	r.Equal(http.StatusOK, status(w, jwt.MapClaims{"sub": "ada", "sver": 3}))
+	mu.Lock()
+	r.Equal(1, lookups)
+	mu.Unlock()
+}
@@ -0,0 +1,4 @@
+// Package signer is the home of issuing tokens, e.g. minting and refreshing
+// the tokens the tokenauth middleware verifies, kept apart from verification
+// so apps which only verify tokens don't carry the signing code.
+package signer
@@ -0,0 +1,39 @@
+package signer
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/pkg/errors"
+)
+
+// RefreshHandler returns a handler exchanging the posted refresh_token for a
+// new token pair, like the refresh grant of an OAuth 2.0 token endpoint, as
+// client.RefreshSource expects it. Invalid and reused refresh tokens are
+// rejected with 400 Bad Request and the invalid_grant error.
+//
+//	app.POST("/auth/refresh", signer.RefreshHandler(issuer))
+func RefreshHandler(issuer *Issuer) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		if grant := c.Param("grant_type"); grant != "" && grant != "refresh_token" {
+			return c.Render(http.StatusBadRequest, render.JSON(map[string]string{
+				"error": "unsupported_grant_type",
+			}))
+		}
+		tokens, err := issuer.Refresh(c, c.Param("refresh_token"))
+		switch errors.Cause(err) {
+		case nil:
+		case ErrInvalidRefreshToken, ErrRefreshTokenReused:
+			return c.Render(http.StatusBadRequest, render.JSON(map[string]string{
+				"error":             "invalid_grant",
+				"error_description": err.Error(),
+			}))
+		default:
+			return c.Error(http.StatusServiceUnavailable, err)
+		}
+		// the tokens must not be cached, RFC 6749 section 5.1
+		c.Response().Header().Set("Cache-Control", "no-store")
+		return c.Render(http.StatusOK, render.JSON(tokens))
+	}
+}
@@ -0,0 +1,225 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned if a refresh token is malformed, expired,
+	// not signed with the RefreshSecret or belongs to a revoked family
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned if a refresh token was already exchanged,
+	// the tokens rotated from it are revoked since it may have been stolen
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+const (
+	// DefaultAccessTTL is how long access tokens are valid
+	DefaultAccessTTL = 15 * time.Minute
+	// DefaultRefreshTTL is how long refresh tokens are valid
+	DefaultRefreshTTL = 7 * 24 * time.Hour
+)
+
+// refreshClaims are the claims of refresh tokens which are not copied into access tokens
+var refreshClaims = []string{"jti", "iat", "nbf", "exp", "typ", "fam"}
+
+// Tokens is a token pair, encoded as the response of an OAuth 2.0 token endpoint
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// Issuer mints access tokens and the refresh tokens they are renewed with.
+// Refresh tokens are rotated, each one is exchanged once for a new pair. They
+// are signed with the separate RefreshSecret, so they can't be used as access
+// tokens, and carry the id of their family, the tokens rotated from one login.
+// If a refresh token is exchanged twice, it was presumably stolen, and the
+// whole family is revoked, logging out both the thief and the user.
+//
+//	issuer := &signer.Issuer{
+//		Method:        jwt.SigningMethodRS256,
+//		Key:           privateKey,
+//		RefreshSecret: []byte(envy.Get("REFRESH_SECRET", "")),
+//		Store:         rs,
+//	}
+//	app.POST("/auth/refresh", signer.RefreshHandler(issuer))
+type Issuer struct {
+	// Method and Key sign the access tokens
+	Method jwt.SigningMethod
+	Key    interface{}
+	// KeyID is the kid header of the access tokens
+	KeyID string
+	// Issuer is the iss claim of the tokens
+	Issuer string
+	// AccessTTL is how long access tokens are valid, defaults to DefaultAccessTTL
+	AccessTTL time.Duration
+	// RefreshSecret signs the refresh tokens with HS256, it must differ from
+	// the key of the access tokens
+	RefreshSecret []byte
+	// RefreshTTL is how long refresh tokens are valid, defaults to DefaultRefreshTTL
+	RefreshTTL time.Duration
+	// Store keeps the exchanged refresh tokens and the revoked families, use a
+	// shared one for apps with several instances, defaults to an in-memory store
+	Store store.Store
+	// Claims if set, returns the current claims of the subject of a refreshed
+	// token, e.g. its roles, the claims of the login are kept otherwise
+	Claims func(ctx context.Context, sub string) (jwt.MapClaims, error)
+
+	once         sync.Once
+	defaultStore store.Store
+}
+
+// Issue returns a token pair with the claims, starting a new family of refresh tokens
+func (i *Issuer) Issue(ctx context.Context, claims jwt.MapClaims) (*Tokens, error) {
+	fam, err := tokenauth.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	return i.issue(claims, fam)
+}
+
+// Refresh exchanges the refresh token for a new token pair of its family
+func (i *Issuer) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	// checked before the token is exchanged, so it isn't used up
+	if err := i.checkKeys(); err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return i.RefreshSecret, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidRefreshToken, err.Error())
+	}
+	jti, _ := claims["jti"].(string)
+	fam, _ := claims["fam"].(string)
+	exp, ok := claims["exp"].(float64)
+	if claims["typ"] != "refresh" || jti == "" || fam == "" || !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+	if iss, _ := claims["iss"].(string); iss != i.Issuer {
+		return nil, ErrInvalidRefreshToken
+	}
+	s := i.store()
+	revoked, err := s.Contains(ctx, "refresh:family:"+fam)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't check refresh token family")
+	}
+	if revoked {
+		return nil, ErrInvalidRefreshToken
+	}
+	// the token is exchanged once, atomically, so concurrent exchanges fail but one
+	err = s.Add(ctx, "refresh:used:"+jti, time.Unix(int64(exp), 0))
+	if errors.Cause(err) == store.ErrExists {
+		// the tokens of the family expire at the latest a RefreshTTL after the last rotation
+		if err := s.Add(ctx, "refresh:family:"+fam, time.Now().Add(i.refreshTTL())); err != nil && errors.Cause(err) != store.ErrExists {
+			return nil, errors.Wrap(err, "couldn't revoke refresh token family")
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't rotate refresh token")
+	}
+	if i.Claims != nil {
+		sub, _ := claims["sub"].(string)
+		current, err := i.Claims(ctx, sub)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't look up claims")
+		}
+		return i.issue(current, fam)
+	}
+	for _, name := range refreshClaims {
+		delete(claims, name)
+	}
+	return i.issue(claims, fam)
+}
+
+// issue signs an access token with the claims and a refresh token of the family,
+// both are issued by a tokenauth.Issuer which sets the iss, iat, exp and jti claims
+func (i *Issuer) issue(claims jwt.MapClaims, fam string) (*Tokens, error) {
+	if err := i.checkKeys(); err != nil {
+		return nil, err
+	}
+	accessTTL := i.AccessTTL
+	if accessTTL == 0 {
+		accessTTL = DefaultAccessTTL
+	}
+	access := &tokenauth.Issuer{
+		SignMethod: i.Method,
+		Key:        i.Key,
+		KeyID:      i.KeyID,
+		TTL:        accessTTL,
+		Issuer:     i.Issuer,
+	}
+	accessToken, err := access.Issue(claims)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't sign access token")
+	}
+
+	refresh := jwt.MapClaims{}
+	for k, v := range claims {
+		refresh[k] = v
+	}
+	refresh["typ"] = "refresh"
+	refresh["fam"] = fam
+	refreshIssuer := &tokenauth.Issuer{
+		SignMethod: jwt.SigningMethodHS256,
+		Key:        i.RefreshSecret,
+		TTL:        i.refreshTTL(),
+		Issuer:     i.Issuer,
+	}
+	refreshToken, err := refreshIssuer.Issue(refresh)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't sign refresh token")
+	}
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTTL.Seconds()),
+	}, nil
+}
+
+// checkKeys returns an error if the RefreshSecret is not set or is the HMAC key
+// of the access tokens, refresh tokens would be accepted as access tokens then
+func (i *Issuer) checkKeys() error {
+	if len(i.RefreshSecret) == 0 {
+		return errors.New("refresh secret is not set")
+	}
+	if _, ok := i.Method.(*jwt.SigningMethodHMAC); ok {
+		if key, ok := i.Key.([]byte); ok && bytes.Equal(key, i.RefreshSecret) {
+			return errors.New("refresh secret must differ from the key of the access tokens")
+		}
+	}
+	return nil
+}
+
+func (i *Issuer) refreshTTL() time.Duration {
+	if i.RefreshTTL == 0 {
+		return DefaultRefreshTTL
+	}
+	return i.RefreshTTL
+}
+
+func (i *Issuer) store() store.Store {
+	if i.Store != nil {
+		return i.Store
+	}
+	i.once.Do(func() {
+		i.defaultStore = store.NewMemory(0)
+	})
+	return i.defaultStore
+}
@@ -0,0 +1,134 @@
+package signer_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/gobuffalo/mw-tokenauth/v2/signer"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuer(t *testing.T) {
+	r := require.New(t)
+	issuer := &signer.Issuer{
+		Method:        jwt.SigningMethodHS256,
+		Key:           []byte("access-secret"),
+		Issuer:        "accounts",
+		RefreshSecret: []byte("refresh-secret"),
+	}
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{KeyFunc: tokenauth.StaticKey([]byte("access-secret"))}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	status := func(token string) int {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + token
+		return req.Get().Code
+	}
+	refreshApp := buffalo.New(buffalo.Options{})
+	refreshApp.POST("/auth/refresh", signer.RefreshHandler(issuer))
+	refresh := func(token string) (*signer.Tokens, int) {
+		res := httptest.New(refreshApp).HTML("/auth/refresh").Post(url.Values{"refresh_token": {token}})
+		tokens := &signer.Tokens{}
+		json.Unmarshal(res.Body.Bytes(), tokens)
+		return tokens, res.Code
+	}
+
+	login, err := issuer.Issue(context.Background(), jwt.MapClaims{"sub": "ada", "role": "admin"})
+	r.NoError(err)
+	r.Equal("Bearer", login.TokenType)
+	r.Equal(int(signer.DefaultAccessTTL.Seconds()), login.ExpiresIn)
+	r.Equal(http.StatusOK, status(login.AccessToken))
+	// refresh tokens are no access tokens
+	r.Equal(http.StatusUnauthorized, status(login.RefreshToken))
+
+	rotated, code := refresh(login.RefreshToken)
+	r.Equal(http.StatusOK, code)
+	r.Equal(http.StatusOK, status(rotated.AccessToken))
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(rotated.AccessToken, claims)
+	r.NoError(err)
+	r.Equal("ada", claims["sub"])
+	r.Equal("admin", claims["role"])
+	r.Equal("accounts", claims["iss"])
+	r.Nil(claims["fam"])
+
+	// a reused refresh token revokes its family
+	_, code = refresh(login.RefreshToken)
+	r.Equal(http.StatusBadRequest, code)
+	_, code = refresh(rotated.RefreshToken)
+	r.Equal(http.StatusBadRequest, code)
+
+	// other logins are not affected
+	other, err := issuer.Issue(context.Background(), jwt.MapClaims{"sub": "ada"})
+	r.NoError(err)
+	_, code = refresh(other.RefreshToken)
+	r.Equal(http.StatusOK, code)
+
+	// access tokens and tokens of other secrets are no refresh tokens
+	_, code = refresh(login.AccessToken)
+	r.Equal(http.StatusBadRequest, code)
+	_, code = refresh("garbage")
+	r.Equal(http.StatusBadRequest, code)
+}
+
+func TestIssuerClaims(t *testing.T) {
+	r := require.New(t)
+	roles := map[string]string{"ada": "admin"}
+	issuer := &signer.Issuer{
+		Method:        jwt.SigningMethodHS256,
+		Key:           []byte("access-secret"),
+		RefreshSecret: []byte("refresh-secret"),
+		RefreshTTL:    time.Hour,
+		Claims: func(_ context.Context, sub string) (jwt.MapClaims, error) {
+			return jwt.MapClaims{"sub": sub, "role": roles[sub]}, nil
+		},
+	}
+	login, err := issuer.Issue(context.Background(), jwt.MapClaims{"sub": "ada", "role": "admin"})
+	r.NoError(err)
+
+	// the refreshed access token carries the current claims of the subject
+	roles["ada"] = "viewer"
+	rotated, err := issuer.Refresh(context.Background(), login.RefreshToken)
+	r.NoError(err)
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(rotated.AccessToken, claims)
+	r.NoError(err)
+	r.Equal("viewer", claims["role"])
+
+	_, err = issuer.Refresh(context.Background(), login.RefreshToken)
+	r.Equal(signer.ErrRefreshTokenReused, err)
+	_, err = issuer.Refresh(context.Background(), rotated.RefreshToken)
+	r.Equal(signer.ErrInvalidRefreshToken, err)
+}
+
+func TestIssuerRefreshSecret(t *testing.T) {
+	r := require.New(t)
+	issuer := &signer.Issuer{
+		Method:        jwt.SigningMethodHS256,
+		Key:           []byte("access-secret"),
+		RefreshSecret: []byte("access-secret"),
+	}
+	_, err := issuer.Issue(context.Background(), jwt.MapClaims{"sub": "ada"})
+	r.Error(err)
+	r.Contains(err.Error(), "refresh secret must differ")
+
+	// refresh tokens of an issuer with the access key as RefreshSecret aren't exchanged
+	issuer.RefreshSecret = []byte("refresh-secret")
+	login, err := issuer.Issue(context.Background(), jwt.MapClaims{"sub": "ada"})
+	r.NoError(err)
+	issuer.Key = []byte("refresh-secret")
+	_, err = issuer.Refresh(context.Background(), login.RefreshToken)
+	r.Error(err)
+	r.Contains(err.Error(), "refresh secret must differ")
+}
@@ -0,0 +1,109 @@
+package tokenauth
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// snapshotKey is the context key of the snapshot of a sampled request
+const snapshotKey = "tokenauth_snapshot"
+
+// redacted replaces the values of claims not kept in snapshots
+const redacted = "[redacted]"
+
+// snapshotClaims are the registered claims always kept in snapshots
+var snapshotClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti", "ver"}
+
+// Snapshot is a redacted record of the inputs and the outcome of the
+// validation of a request. The token signature is never recorded.
+type Snapshot struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	// Header is the token header, e.g. alg and kid
+	Header map[string]interface{} `json:"header,omitempty"`
+	// Claims of the token as sent, claims which are not kept are redacted
+	Claims jwt.MapClaims `json:"claims,omitempty"`
+	// Source is the issuer which accepted the token
+	Source string `json:"source,omitempty"`
+	// Status is the status of rejected requests, 0 if the request was let through
+	Status    int    `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// SnapshotSink persists snapshots, it is called on the request goroutine
+// so slow sinks should hand the snapshots off, e.g. to a channel
+type SnapshotSink func(Snapshot)
+
+// SnapshotRecorder records snapshots of the validation of a sample of the
+// requests, to replay auth decisions offline when investigating reports
+type SnapshotRecorder struct {
+	// Rate is the share of requests recorded, from 0 to 1
+	Rate float64
+	// Sink receives the snapshots
+	Sink SnapshotSink
+	// Keep are the claims recorded as is next to the registered claims,
+	// the values of all other claims are redacted
+	Keep []string
+}
+
+// start tags sampled requests for recording
+func (r *SnapshotRecorder) start(c buffalo.Context) {
+	if r == nil || r.Sink == nil || rand.Float64() >= r.Rate {
+		return
+	}
+	req := c.Request()
+	c.Set(snapshotKey, &Snapshot{
+		Time:   time.Now(),
+		Method: req.Method,
+		Path:   req.URL.Path,
+	})
+}
+
+// snapshotToken records the redacted header and claims of the token
+func snapshotToken(c buffalo.Context, options Options, tokenString string) {
+	s, ok := c.Value(snapshotKey).(*Snapshot)
+	if !ok {
+		return
+	}
+	claims := jwt.MapClaims{}
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims)
+	if err != nil {
+		return
+	}
+	s.Header = token.Header
+	s.Claims = jwt.MapClaims{}
+	for name, value := range claims {
+		if guard.ContainsAny(snapshotClaims, name) || guard.ContainsAny(options.Snapshots.Keep, name) {
+			s.Claims[name] = value
+		} else {
+			s.Claims[name] = redacted
+		}
+	}
+}
+
+// finishSnapshot records the outcome and hands the snapshot to the sink,
+// only the first decision on a request is recorded
+func finishSnapshot(c buffalo.Context, options Options, source string, status int, err error) {
+	s, ok := c.Value(snapshotKey).(*Snapshot)
+	if !ok || options.Snapshots == nil {
+		return
+	}
+	c.Set(snapshotKey, nil)
+	s.Source = source
+	if err != nil {
+		s.Status = status
+		s.Error = err.Error()
+		s.ErrorCode = errorCode(err)
+		if status >= http.StatusInternalServerError {
+			s.ErrorCode = ErrorCodeKeyUnavailable
+		}
+	}
+	options.Snapshots.Sink(*s)
+}
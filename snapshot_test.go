@@ -0,0 +1,82 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshots(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+	var snapshots []tokenauth.Snapshot
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		Snapshots: &tokenauth.SnapshotRecorder{
+			Rate: 1,
+			Sink: func(s tokenauth.Snapshot) { snapshots = append(snapshots, s) },
+			Keep: []string{"role"},
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{
+		"sub":   "1",
+		"role":  "admin",
+		"email": "jane@example.com",
+		"exp":   time.Now().Add(time.Minute * 5).Unix(),
+	})
+	r.Equal(http.StatusOK, req.Get().Code)
+	r.Len(snapshots, 1)
+	s := snapshots[0]
+	r.Equal("GET", s.Method)
+	r.Equal("/", s.Path)
+	r.Equal(tokenauth.IssuerPrimary, s.Source)
+	r.Equal(0, s.Status)
+	r.Equal("HS256", s.Header["alg"])
+	r.Equal("1", s.Claims["sub"])
+	r.Equal("admin", s.Claims["role"])
+	r.Equal("[redacted]", s.Claims["email"])
+
+	req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{
+		"sub": "1",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	})
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+	r.Len(snapshots, 2)
+	s = snapshots[1]
+	r.Equal(http.StatusUnauthorized, s.Status)
+	r.Equal(tokenauth.ErrorCodeExpired, s.ErrorCode)
+	r.Equal("1", s.Claims["sub"])
+}
+
+func TestSnapshotsSampling(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+	recorded := 0
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		Snapshots: &tokenauth.SnapshotRecorder{
+			Sink: func(tokenauth.Snapshot) { recorded++ },
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	for i := 0; i < 10; i++ {
+		r.Equal(http.StatusUnauthorized, w.HTML("/").Get().Code)
+	}
+	r.Equal(0, recorded)
+}
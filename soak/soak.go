@@ -0,0 +1,411 @@
+// Package soak is a soak and chaos test of key rotation. It serves a JWK Set,
+// rotates the signing key continuously and hammers the middleware with tokens
+// signed with the old and new keys from concurrent workers, asserting that no
+// valid token is rejected and no forged, tampered, expired or retired token is
+// accepted. It validates the key rotation, the caching of the key set and the
+// deduplication of concurrent fetches of a key provider.
+//
+// Keys are rotated the way an IdP should: a key is published TTL before it
+// signs tokens, so caches know it by then, and it is retired once the tokens
+// it signed are no longer in use.
+//
+//	func TestRotationSoak(t *testing.T) {
+//		soak.Run(t, func(url string, client *http.Client, ttl time.Duration) buffalo.MiddlewareFunc {
+//			jwks := tokenauth.NewJWKSProvider(url)
+//			jwks.Client, jwks.TTL = client, ttl
+//			return tokenauth.New(tokenauth.Options{SignMethod: jwt.SigningMethodES256, JWKS: jwks})
+//		}, soak.Options{Duration: time.Minute, FailureRate: 0.1})
+//	}
+package soak
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Options of a soak run, zero values are replaced by the defaults
+type Options struct {
+	// Duration of the run, defaults to 2s
+	Duration time.Duration
+	// Workers sending requests concurrently, defaults to 8
+	Workers int
+	// RotateEvery is how often a new key is published, defaults to 100ms
+	RotateEvery time.Duration
+	// TTL the middleware caches the key set for, defaults to 100ms
+	TTL time.Duration
+	// Lifetime of the issued tokens, the workers replay tokens as long as they
+	// are in use and a key is retired once its tokens are out of use, defaults to 500ms
+	Lifetime time.Duration
+	// FailureRate is the fraction of requests to the key set which fail with 500
+	FailureRate float64
+	// Latency of the responses of the key set
+	Latency time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Duration <= 0 {
+		o.Duration = 2 * time.Second
+	}
+	if o.Workers <= 0 {
+		o.Workers = 8
+	}
+	if o.RotateEvery <= 0 {
+		o.RotateEvery = 100 * time.Millisecond
+	}
+	if o.TTL <= 0 {
+		o.TTL = 100 * time.Millisecond
+	}
+	if o.Lifetime <= 0 {
+		o.Lifetime = 500 * time.Millisecond
+	}
+	return o
+}
+
+// lead is how long before a key signs tokens it is published, and how long after
+// it is retired tokens signed with it are expected to be rejected: the key set
+// cached by the middleware is at most TTL plus the latency of the fetch old
+func (o Options) lead() time.Duration {
+	return o.TTL + o.Latency + o.TTL/2
+}
+
+// Result counts the requests of a soak run
+type Result struct {
+	Requests int64
+	// FalseRejections are valid tokens which were rejected
+	FalseRejections int64
+	// FalseAcceptances are forged, tampered, expired or retired tokens which were accepted
+	FalseAcceptances int64
+	// Unavailable are requests answered with a 5xx status and valid tokens rejected
+	// within lead of a failed fetch of the key set, expected only with a FailureRate
+	Unavailable int64
+	// Fetches of the key set
+	Fetches int64
+	// Rotations is the number of keys published after the first
+	Rotations int64
+	// RetiredChecks are the requests with tokens of retired keys
+	RetiredChecks int64
+}
+
+// Middleware returns the middleware under test, verifying ES256 tokens with
+// the keys of the JWK Set at url, fetched with client and cached for ttl
+type Middleware func(url string, client *http.Client, ttl time.Duration) buffalo.MiddlewareFunc
+
+// Run runs the soak test against the middleware and fails t on any false
+// rejection or acceptance. The middleware is expected to read the token from the
+// Authorization header with the Bearer scheme.
+func Run(t testing.TB, mw Middleware, options Options) Result {
+	options = options.withDefaults()
+	s := &soak{options: options, t: t}
+	first, err := s.newKey(time.Now().Add(-options.lead()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.keys = []*key{first}
+	if s.rogue, err = s.newKey(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(s.serveKeys))
+	defer ts.Close()
+	app := buffalo.New(buffalo.Options{})
+	app.Use(mw(ts.URL, ts.Client(), options.TTL))
+	app.GET("/", func(c buffalo.Context) error {
+		return c.Render(http.StatusOK, nil)
+	})
+
+	deadline := time.Now().Add(options.Duration)
+	done := make(chan struct{})
+	go s.rotate(done)
+	var wg sync.WaitGroup
+	for i := 0; i < options.Workers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			s.work(app, mrand.New(mrand.NewSource(seed)), deadline)
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+	close(done)
+
+	s.mu.Lock()
+	res := s.result
+	s.mu.Unlock()
+	res.Fetches = atomic.LoadInt64(&s.fetches)
+	if res.FalseRejections > 0 || res.FalseAcceptances > 0 || (options.FailureRate == 0 && res.Unavailable > 0) {
+		t.Errorf("%d false rejections, %d false acceptances, %d unavailable of %d requests:\n%s",
+			res.FalseRejections, res.FalseAcceptances, res.Unavailable, res.Requests, s.failures)
+	}
+	return res
+}
+
+type key struct {
+	kid       string
+	private   *ecdsa.PrivateKey
+	published time.Time
+	// retired is when the key was removed from the key set, zero while published
+	retired time.Time
+}
+
+type issued struct {
+	token    string
+	kid      string
+	issuedAt time.Time
+}
+
+type soak struct {
+	options Options
+	t       testing.TB
+	rogue   *key
+	fetches int64
+
+	mu       sync.Mutex
+	keys     []*key
+	result   Result
+	failures string
+	seq      int
+	// failed is when a fetch of the key set failed last
+	failed time.Time
+}
+
+func (s *soak) newKey(published time.Time) (*key, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	s.seq++
+	return &key{kid: fmt.Sprintf("soak-%d", s.seq), private: private, published: published}, nil
+}
+
+// serveKeys serves the published keys, failing with the failure rate
+func (s *soak) serveKeys(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&s.fetches, 1)
+	s.mu.Lock()
+	fail := mrand.Float64() < s.options.FailureRate
+	if fail {
+		s.failed = time.Now()
+	}
+	keys := []map[string]string{}
+	for _, k := range s.keys {
+		if k.retired.IsZero() {
+			keys = append(keys, jwk(k))
+		}
+	}
+	s.mu.Unlock()
+	// the key set is taken before the delay, so the cache of the
+	// middleware is as old as the latency when the response arrives
+	time.Sleep(s.options.Latency)
+	if fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+// rotate publishes a new key every RotateEvery and retires the
+// keys which no longer sign tokens once their tokens are out of use
+func (s *soak) rotate(done chan struct{}) {
+	ticker := time.NewTicker(s.options.RotateEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			// the time the key set changes, the tick is earlier if this goroutine was
+			// slow to be scheduled, and keys retired then were still served since
+			now := time.Now()
+			k, err := s.newKey(now)
+			if err != nil {
+				s.mu.Unlock()
+				s.t.Error(err)
+				return
+			}
+			s.keys = append(s.keys, k)
+			s.result.Rotations++
+			for i, k := range s.keys[:len(s.keys)-1] {
+				// a key stops signing when its successor starts, which is lead after the
+				// successor was published, its tokens are in use for Lifetime, plus a
+				// rotation for requests which were slow to be verified
+				if k.retired.IsZero() &&
+					now.Sub(s.keys[i+1].published) > s.options.lead()+s.options.Lifetime+s.options.RotateEvery {
+					k.retired = now
+				}
+			}
+			// keys are retired in the order they were published, only the
+			// four most recently retired keys are kept for checks
+			for len(s.keys) > 4 && !s.keys[4].retired.IsZero() {
+				s.keys = s.keys[1:]
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// signer returns the newest key published at least lead ago, must be called with mu held
+func (s *soak) signer(now time.Time) *key {
+	signer := s.keys[0]
+	for _, k := range s.keys {
+		if now.Sub(k.published) >= s.options.lead() && k.retired.IsZero() {
+			signer = k
+		}
+	}
+	return signer
+}
+
+// work sends requests until the deadline, mixing fresh tokens,
+// replayed tokens of older keys and tokens which must be rejected
+func (s *soak) work(app *buffalo.App, rnd *mrand.Rand, deadline time.Time) {
+	var replay []issued
+	for time.Now().Before(deadline) {
+		now := time.Now()
+		var token, kind, kid string
+		valid := true
+		switch n := rnd.Intn(10); {
+		case n < 5 || len(replay) == 0:
+			s.mu.Lock()
+			signer := s.signer(now)
+			s.mu.Unlock()
+			token, kind, kid = s.sign(signer.private, signer.kid, now.Add(time.Hour)), "fresh token of "+signer.kid, signer.kid
+			replay = append(replay, issued{token, kid, now})
+		case n < 7:
+			// tokens are replayed as long as they are in use
+			for len(replay) > 0 && now.Sub(replay[0].issuedAt) > s.options.Lifetime {
+				replay = replay[1:]
+			}
+			if len(replay) == 0 {
+				continue
+			}
+			i := replay[rnd.Intn(len(replay))]
+			token, kind, kid = i.token, "replayed token of "+i.kid, i.kid
+		default:
+			token, kind = s.invalid(rnd, now)
+			if token == "" {
+				continue
+			}
+			valid = false
+		}
+		s.check(app, token, kind, kid, valid)
+	}
+}
+
+// invalid returns a token which must be rejected
+func (s *soak) invalid(rnd *mrand.Rand, now time.Time) (string, string) {
+	s.mu.Lock()
+	signer := s.signer(now)
+	var retired *key
+	for _, k := range s.keys {
+		if !k.retired.IsZero() && now.Sub(k.retired) > s.options.lead() {
+			retired = k
+		}
+	}
+	s.mu.Unlock()
+	switch rnd.Intn(5) {
+	case 0:
+		return s.sign(s.rogue.private, "soak-rogue", now.Add(time.Hour)), "token of an unknown key"
+	case 1:
+		return s.sign(s.rogue.private, signer.kid, now.Add(time.Hour)), "forged token with the kid of " + signer.kid
+	case 2:
+		return s.sign(signer.private, signer.kid, now.Add(-time.Hour)), "expired token of " + signer.kid
+	case 3:
+		token := []byte(s.sign(signer.private, signer.kid, now.Add(time.Hour)))
+		// flips a bit of the claims
+		token[len(token)-100] ^= 1
+		return string(token), "tampered token of " + signer.kid
+	}
+	if retired == nil {
+		return "", ""
+	}
+	s.mu.Lock()
+	s.result.RetiredChecks++
+	s.mu.Unlock()
+	return s.sign(retired.private, retired.kid, now.Add(time.Hour)), "token of retired key " + retired.kid
+}
+
+func (s *soak) sign(private *ecdsa.PrivateKey, kid string, exp time.Time) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": "soak", "exp": exp.Unix()})
+	token.Header["kid"] = kid
+	tokenString, err := token.SignedString(private)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return tokenString
+}
+
+// retiredKey reports if the key of kid was removed from the key set, must be called with mu held
+func (s *soak) retiredKey(kid string) bool {
+	for _, k := range s.keys {
+		if k.kid == kid {
+			return !k.retired.IsZero()
+		}
+	}
+	return true
+}
+
+// check sends the token, kid is the key of valid tokens
+func (s *soak) check(app *buffalo.App, token, kind, kid string, valid bool) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, req)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.result.Requests++
+	var failure string
+	switch {
+	case res.Code >= http.StatusInternalServerError,
+		valid && res.Code != http.StatusOK && time.Since(s.failed) < s.options.lead():
+		s.result.Unavailable++
+		if s.options.FailureRate == 0 {
+			failure = "unavailable"
+		}
+	case valid && res.Code != http.StatusOK && s.retiredKey(kid):
+		// the worker was descheduled for longer than the margin of the retirement,
+		// and its key was already retired when the token was verified
+	case valid && res.Code != http.StatusOK:
+		s.result.FalseRejections++
+		failure = "rejected"
+	case !valid && res.Code == http.StatusOK:
+		s.result.FalseAcceptances++
+		failure = "accepted"
+	}
+	// the first failures are enough to debug a run, unavailable
+	// requests are expected in chaos runs and don't use up the log
+	if failure != "" && (failure == "unavailable" || s.result.FalseRejections+s.result.FalseAcceptances <= 5) && strings.Count(s.failures, "\n") < 10 {
+		s.failures += fmt.Sprintf("%s %s: %d %s\n", failure, kind, res.Code, res.Body.String())
+	}
+}
+
+// jwk returns the public key as JWK
+func jwk(k *key) map[string]string {
+	size := (k.private.Curve.Params().BitSize + 7) / 8
+	return map[string]string{
+		"kty": "EC",
+		"kid": k.kid,
+		"use": "sig",
+		"alg": "ES256",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(pad(k.private.X.Bytes(), size)),
+		"y":   base64.RawURLEncoding.EncodeToString(pad(k.private.Y.Bytes(), size)),
+	}
+}
+
+func pad(b []byte, size int) []byte {
+	return append(make([]byte, size-len(b)), b...)
+}
@@ -0,0 +1,52 @@
+package tokenauth_test
+
+import (
+	"flag"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/gobuffalo/mw-tokenauth/v2/soak"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// soakDuration runs the rotation soak test for longer, e.g. go test -run Soak -soak 10m
+var soakDuration = flag.Duration("soak", 2*time.Second, "duration of the key rotation soak test")
+
+func TestRotationSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak test")
+	}
+	var providers []*tokenauth.JWKSProvider
+	defer func() {
+		for _, p := range providers {
+			p.Close()
+		}
+	}()
+	mw := func(url string, client *http.Client, ttl time.Duration) buffalo.MiddlewareFunc {
+		jwks := tokenauth.NewJWKSProvider(url)
+		jwks.Client, jwks.TTL = client, ttl
+		providers = append(providers, jwks)
+		return tokenauth.New(tokenauth.Options{SignMethod: jwt.SigningMethodES256, JWKS: jwks})
+	}
+
+	t.Run("rotation", func(t *testing.T) {
+		options := soak.Options{Duration: *soakDuration}
+		res := soak.Run(t, mw, options)
+		t.Logf("%+v", res)
+		require.NotZero(t, res.Rotations)
+		require.NotZero(t, res.RetiredChecks)
+		// the background refresh fetches the key set every TTL/2, concurrent
+		// requests seeing an expired key set wait for a single fetch
+		require.True(t, res.Fetches <= 2*int64(options.Duration/(100*time.Millisecond))+4, "%d fetches", res.Fetches)
+	})
+
+	t.Run("chaos", func(t *testing.T) {
+		res := soak.Run(t, mw, soak.Options{Duration: *soakDuration, FailureRate: 0.2, Latency: 20 * time.Millisecond})
+		t.Logf("%+v", res)
+		require.NotZero(t, res.Rotations)
+	})
+}
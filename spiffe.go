@@ -0,0 +1,102 @@
+package tokenauth
+
+import (
+	"context"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/gobuffalo/mw-tokenauth/v2/keysource"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// SPIFFEIDKey is the context key of the SPIFFE ID of the workload of a verified JWT-SVID
+const SPIFFEIDKey = "spiffe_id"
+
+var (
+	// ErrInvalidSPIFFEID is returned if the sub claim of a JWT-SVID is not a valid SPIFFE ID
+	ErrInvalidSPIFFEID = guard.ErrInvalidSPIFFEID
+	// ErrUntrustedDomain is returned if the SPIFFE ID of a JWT-SVID is of a trust domain without bundle
+	ErrUntrustedDomain = errors.New("SPIFFE trust domain not trusted")
+)
+
+// SPIFFEBundle is the trust bundle of a SPIFFE trust domain, fetched from its
+// bundle endpoint or read from a file written from the Workload API
+type SPIFFEBundle = keysource.SPIFFEBundle
+
+// SPIFFE verifies JWT-SVIDs, the tokens workloads of a SPIFFE mesh (e.g. SPIRE)
+// authenticate with. The sub claim must be a SPIFFE ID, the token is verified with
+// the key of its kid in the bundle of the trust domain of the ID, and the aud claim
+// must contain one of the Audiences. The SPIFFE ID is set in the context under
+// SPIFFEIDKey, use Guards to authorize the workloads.
+//
+//	app.Use(tokenauth.New(tokenauth.Options{
+//		SPIFFE: &tokenauth.SPIFFE{
+//			Bundles:   []*tokenauth.SPIFFEBundle{{TrustDomain: "example.org", File: "/run/spiffe/bundle.json"}},
+//			Audiences: []string{"spiffe://example.org/billing"},
+//		},
+//	}))
+//
+// The bundles are not fetched from the Workload API directly, it is a gRPC API,
+// run spiffe-helper next to the app to write the bundle of the Workload API to the
+// file, or use the bundle endpoint of the trust domain.
+type SPIFFE struct {
+	// Bundles are the trusted domains, JWT-SVIDs of other domains are rejected
+	Bundles []*SPIFFEBundle
+	// Audiences the aud claim must contain one of, JWT-SVIDs are always audience bound
+	Audiences []string
+}
+
+// bundle returns the bundle of the trust domain of a SPIFFE ID
+func (s *SPIFFE) bundle(id string) (*SPIFFEBundle, error) {
+	trustDomain, _, err := guard.ParseSPIFFEID(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range s.Bundles {
+		if b.TrustDomain == trustDomain {
+			return b, nil
+		}
+	}
+	return nil, ErrUntrustedDomain
+}
+
+// KeyFor returns the key of the kid of the token in the bundle of its trust domain
+func (s *SPIFFE) KeyFor(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	claims, _ := token.Claims.(jwt.MapClaims)
+	sub, _ := claims["sub"].(string)
+	b, err := s.bundle(sub)
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := token.Header["kid"].(string)
+	return b.Key(ctx, kid)
+}
+
+// Refresh loads the bundles
+func (s *SPIFFE) Refresh(ctx context.Context) error {
+	for _, b := range s.Bundles {
+		if err := b.Refresh(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the sub, aud and exp claims of a verified JWT-SVID
+// and sets the SPIFFE ID in the context
+func (s *SPIFFE) Validate(c buffalo.Context, claims jwt.Claims) error {
+	mc, _ := claims.(jwt.MapClaims)
+	sub, _ := mc["sub"].(string)
+	if _, err := s.bundle(sub); err != nil {
+		return err
+	}
+	if !guard.ContainsAny(guard.Audience(mc), s.Audiences...) {
+		return ErrInvalidAudience
+	}
+	if _, ok := guard.NumericDate(mc, "exp"); !ok {
+		return errors.New("JWT-SVID has no exp claim")
+	}
+	c.Set(SPIFFEIDKey, sub)
+	return nil
+}
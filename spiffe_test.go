@@ -0,0 +1,128 @@
+package tokenauth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	bhttptest "github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// spiffeBundle returns a SPIFFE bundle with the key as JWT-SVID key of kid
+func spiffeBundle(kid, use string, key *ecdsa.PublicKey) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"spiffe_refresh_hint": 300,
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": kid,
+			"use": use,
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+		}},
+	})
+	return data
+}
+
+func TestSPIFFE(t *testing.T) {
+	r := require.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+	partnerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+
+	// the bundle endpoint of example.org also serves the x509-svid CA key
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var bundle map[string]interface{}
+		json.Unmarshal(spiffeBundle("jwt-1", "jwt-svid", &key.PublicKey), &bundle)
+		var ca map[string]interface{}
+		json.Unmarshal(spiffeBundle("ca-1", "x509-svid", &caKey.PublicKey), &ca)
+		bundle["keys"] = append(bundle["keys"].([]interface{}), ca["keys"].([]interface{})...)
+		json.NewEncoder(w).Encode(bundle)
+	}))
+	defer ts.Close()
+	// the bundle of partner.org is written by spiffe-helper
+	file, err := ioutil.TempFile("", "bundle")
+	r.NoError(err)
+	defer os.Remove(file.Name())
+	_, err = file.Write(spiffeBundle("partner-1", "jwt-svid", &partnerKey.PublicKey))
+	r.NoError(err)
+	file.Close()
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		SPIFFE: &tokenauth.SPIFFE{
+			Bundles: []*tokenauth.SPIFFEBundle{
+				{TrustDomain: "example.org", URL: ts.URL, Client: ts.Client()},
+				{TrustDomain: "partner.org", File: file.Name()},
+			},
+			Audiences: []string{"spiffe://example.org/billing"},
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String(c.Value(tokenauth.SPIFFEIDKey).(string)))
+	})
+	w := bhttptest.New(a)
+
+	sign := func(kid string, key *ecdsa.PrivateKey, claims jwt.MapClaims) string {
+		if _, ok := claims["exp"]; !ok {
+			claims["exp"] = time.Now().Add(time.Minute * 5).Unix()
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = kid
+		tokenString, err := token.SignedString(key)
+		r.NoError(err)
+		return tokenString
+	}
+	for _, tt := range []struct {
+		token  string
+		status int
+	}{
+		{sign("jwt-1", key, jwt.MapClaims{"sub": "spiffe://example.org/ns/prod/sa/web", "aud": "spiffe://example.org/billing"}), http.StatusOK},
+		{sign("partner-1", partnerKey, jwt.MapClaims{"sub": "spiffe://partner.org/checkout", "aud": []string{"other", "spiffe://example.org/billing"}}), http.StatusOK},
+		// other audience
+		{sign("jwt-1", key, jwt.MapClaims{"sub": "spiffe://example.org/ns/prod/sa/web", "aud": "spiffe://example.org/payments"}), http.StatusUnauthorized},
+		// key of another trust domain
+		{sign("partner-1", partnerKey, jwt.MapClaims{"sub": "spiffe://example.org/ns/prod/sa/web", "aud": "spiffe://example.org/billing"}), http.StatusUnauthorized},
+		// x509-svid keys don't sign JWT-SVIDs
+		{sign("ca-1", caKey, jwt.MapClaims{"sub": "spiffe://example.org/ns/prod/sa/web", "aud": "spiffe://example.org/billing"}), http.StatusUnauthorized},
+		// untrusted domain and invalid SPIFFE IDs
+		{sign("jwt-1", key, jwt.MapClaims{"sub": "spiffe://evil.org/web", "aud": "spiffe://example.org/billing"}), http.StatusUnauthorized},
+		{sign("jwt-1", key, jwt.MapClaims{"sub": "spiffe://example.org/../web", "aud": "spiffe://example.org/billing"}), http.StatusUnauthorized},
+		{sign("jwt-1", key, jwt.MapClaims{"sub": "web", "aud": "spiffe://example.org/billing"}), http.StatusUnauthorized},
+	} {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + tt.token
+		res := req.Get()
+		r.Equal(tt.status, res.Code, tt.token)
+		if tt.status == http.StatusOK {
+			r.Contains(res.Body.String(), "spiffe://")
+		}
+	}
+
+	_, err = tokenauth.NewWithError(tokenauth.Options{SPIFFE: &tokenauth.SPIFFE{
+		Bundles: []*tokenauth.SPIFFEBundle{{TrustDomain: "example.org", URL: ts.URL, Client: ts.Client()}},
+	}})
+	r.Error(err)
+	_, err = tokenauth.NewWithError(tokenauth.Options{SPIFFE: &tokenauth.SPIFFE{
+		Bundles:   []*tokenauth.SPIFFEBundle{{TrustDomain: "example.org", File: "testdata/missing.json"}},
+		Audiences: []string{"spiffe://example.org/billing"},
+	}})
+	r.Error(err)
+	r.Contains(err.Error(), "couldn't load SPIFFE bundle of example.org")
+}
@@ -0,0 +1,5 @@
+// Package store is the home of the state the middleware keeps about tokens
+// beyond their verification, shared by the instances of an app, e.g. revoked
+// tokens and the jti values of seen tokens. Its implementations are kept out of
+// the tokenauth package, so apps only import the backends they use.
+package store
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is a Store keeping the keys in memory, it suits apps running a single
+// instance. Once it is full the least recently added keys are evicted,
+// even if they haven't expired yet.
+type Memory struct {
+	size int
+
+	mu    sync.Mutex
+	keys  map[string]*list.Element
+	order *list.List
+	swept time.Time
+}
+
+// sweepEvery is how often the expired keys of unbounded stores are removed
+const sweepEvery = time.Minute
+
+type entry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemory returns a Memory store keeping up to size keys, keys are never
+// evicted before they expire if size is 0, e.g. the jti of revoked tokens
+func NewMemory(size int) *Memory {
+	return &Memory{size: size, keys: map[string]*list.Element{}, order: list.New(), swept: time.Now()}
+}
+
+// Add stores the key until expires
+func (m *Memory) Add(_ context.Context, key string, expires time.Time) error {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.keys[key]; ok {
+		if now.Before(e.Value.(*entry).expires) {
+			return ErrExists
+		}
+		m.remove(e)
+	}
+	// the oldest keys are evicted, expired or not
+	for m.order.Len() > 0 && ((m.size > 0 && m.order.Len() >= m.size) || !now.Before(m.order.Front().Value.(*entry).expires)) {
+		m.remove(m.order.Front())
+	}
+	if m.size <= 0 && now.Sub(m.swept) > sweepEvery {
+		m.sweep(now)
+	}
+	m.keys[key] = m.order.PushBack(&entry{key: key, expires: expires})
+	return nil
+}
+
+// Contains reports if the key is stored and not expired
+func (m *Memory) Contains(_ context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.keys[key]
+	return ok && time.Now().Before(e.Value.(*entry).expires), nil
+}
+
+// Len returns the number of stored keys, including expired ones not evicted yet
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// sweep removes the expired keys, must be called with mu held
+func (m *Memory) sweep(now time.Time) {
+	m.swept = now
+	for e := m.order.Front(); e != nil; {
+		next := e.Next()
+		if !now.Before(e.Value.(*entry).expires) {
+			m.remove(e)
+		}
+		e = next
+	}
+}
+
+func (m *Memory) remove(e *list.Element) {
+	m.order.Remove(e)
+	delete(m.keys, e.Value.(*entry).key)
+}
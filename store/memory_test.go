@@ -0,0 +1,49 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	m := store.NewMemory(2)
+	later := time.Now().Add(time.Minute)
+
+	r.NoError(m.Add(ctx, "a", later))
+	r.Equal(store.ErrExists, m.Add(ctx, "a", later))
+	ok, err := m.Contains(ctx, "a")
+	r.NoError(err)
+	r.True(ok)
+
+	// expired keys can be added again
+	r.NoError(m.Add(ctx, "b", time.Now().Add(-time.Second)))
+	ok, _ = m.Contains(ctx, "b")
+	r.False(ok)
+	r.NoError(m.Add(ctx, "b", later))
+
+	// the oldest key is evicted once the store is full
+	r.NoError(m.Add(ctx, "c", later))
+	r.Equal(2, m.Len())
+	ok, _ = m.Contains(ctx, "a")
+	r.False(ok)
+	ok, _ = m.Contains(ctx, "c")
+	r.True(ok)
+}
+
+func TestMemoryUnbounded(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	m := store.NewMemory(0)
+	for _, key := range []string{"a", "b", "c"} {
+		r.NoError(m.Add(ctx, key, time.Now().Add(time.Minute)))
+	}
+	r.Equal(3, m.Len())
+	ok, _ := m.Contains(ctx, "a")
+	r.True(ok)
+}
@@ -0,0 +1,87 @@
+// Package popstore is a store.Store keeping the keys in the database of a pop
+// connection, so apps on Buffalo's ORM share revoked tokens between their
+// instances without running Redis. The table is created by a migration of the
+// app, e.g. migrations/20240101000000_create_revoked_tokens.up.fizz with
+// MigrationUp and the down migration with MigrationDown.
+//
+//	app.Use(tokenauth.New(tokenauth.Options{
+//		Revoker: store.NewRevoker(popstore.New(models.DB)),
+//	}))
+//
+// Expired keys are kept until DeleteExpired removes them, e.g. from a grift task.
+package popstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+)
+
+// MigrationUp is the fizz migration creating the table of the keys
+const MigrationUp = `create_table("revoked_tokens") {
+	t.Column("id", "string", {primary: true})
+	t.Column("expires_at", "timestamp", {})
+	t.Index("expires_at", {})
+	t.DisableTimestamps()
+}
+`
+
+// MigrationDown is the fizz migration dropping the table of the keys
+const MigrationDown = `drop_table("revoked_tokens")
+`
+
+// Store is a store.Store keeping the keys in the revoked_tokens table
+type Store struct {
+	conn *pop.Connection
+}
+
+// row is a key in the revoked_tokens table
+type row struct {
+	ID        string    `db:"id"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// TableName is the table of the keys
+func (row) TableName() string {
+	return "revoked_tokens"
+}
+
+// New returns a Store keeping the keys in the database of the connection
+func New(conn *pop.Connection) *Store {
+	return &Store{conn: conn}
+}
+
+// Add stores the key until expires
+func (s *Store) Add(ctx context.Context, key string, expires time.Time) error {
+	now := time.Now().UTC()
+	// an expired key is added again, e.g. the jti of a replayed expired token
+	if err := s.conn.RawQuery("DELETE FROM revoked_tokens WHERE id = ? AND expires_at <= ?", key, now).Exec(); err != nil {
+		return errors.Wrap(err, "couldn't delete expired key")
+	}
+	err := s.conn.Create(&row{ID: key, ExpiresAt: expires.UTC()})
+	if err == nil {
+		return nil
+	}
+	// the insert fails on the primary key if the key is stored
+	if exists, _ := s.Contains(ctx, key); exists {
+		return store.ErrExists
+	}
+	return errors.Wrap(err, "couldn't store key")
+}
+
+// Contains reports if the key is stored and not expired
+func (s *Store) Contains(_ context.Context, key string) (bool, error) {
+	exists, err := s.conn.Where("id = ? AND expires_at > ?", key, time.Now().UTC()).Exists(&row{})
+	if err != nil {
+		return false, errors.Wrap(err, "couldn't query key")
+	}
+	return exists, nil
+}
+
+// DeleteExpired removes the expired keys
+func (s *Store) DeleteExpired() error {
+	return s.conn.RawQuery("DELETE FROM revoked_tokens WHERE expires_at <= ?", time.Now().UTC()).Exec()
+}
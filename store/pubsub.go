@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// PubSub publishes messages to the instances of an app subscribed to a
+// channel, e.g. with Redis pub/sub or NATS. Implementations must be safe
+// for concurrent use. NATS connections of nats.go are adapted with
+//
+//	type natsPubSub struct{ *nats.Conn }
+//
+//	func (n natsPubSub) Publish(_ context.Context, channel string, message []byte) error {
+//		return n.Conn.Publish(channel, message)
+//	}
+//
+//	func (n natsPubSub) Subscribe(ctx context.Context, channel string, handler func([]byte)) error {
+//		sub, err := n.Conn.Subscribe(channel, func(m *nats.Msg) { handler(m.Data) })
+//		if err != nil {
+//			return err
+//		}
+//		defer sub.Unsubscribe()
+//		<-ctx.Done()
+//		return ctx.Err()
+//	}
+type PubSub interface {
+	// Publish sends the message to the subscribers of the channel
+	Publish(ctx context.Context, channel string, message []byte) error
+	// Subscribe calls handler with the messages of the channel until ctx is
+	// done or the subscription fails, messages published meanwhile are lost
+	Subscribe(ctx context.Context, channel string, handler func(message []byte)) error
+}
+
+// RevokedChannel is the channel revocations are published on
+const RevokedChannel = "revoked"
+
+// DefaultRevokerCacheTTL is how long a CachedRevoker caches tokens that aren't revoked
+const DefaultRevokerCacheTTL = 30 * time.Second
+
+// CachedRevoker is a Revoker caching the lookups of its store in memory, so
+// the store isn't queried on every request. Revocations are published to the
+// other instances of the app, which add them to their caches as they receive
+// them. Revocations an instance misses, e.g. while its subscription reconnects,
+// take effect there once the cached lookup expires, after the cache TTL at most.
+//
+//	rs, _ := redis.New(envy.Get("REDIS_URL", "redis://localhost:6379/0"))
+//	revoker := store.NewCachedRevoker(rs, rs, 0)
+//	defer revoker.Close()
+//	app.Use(tokenauth.New(tokenauth.Options{Revoker: revoker}))
+type CachedRevoker struct {
+	store  Store
+	pubsub PubSub
+	ttl    time.Duration
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// revoked are the ids known to be revoked
+	revoked *Memory
+	mu      sync.RWMutex
+	// valid are the ids known not to be revoked
+	valid *Memory
+}
+
+// maxCachedValid is the number of tokens cached as not revoked
+const maxCachedValid = 100000
+
+// NewCachedRevoker returns a CachedRevoker keeping the revoked tokens in the
+// store and caching tokens that aren't revoked for ttl, DefaultRevokerCacheTTL
+// if ttl is 0. It subscribes to the revocations published by the other
+// instances until it is closed.
+func NewCachedRevoker(s Store, ps PubSub, ttl time.Duration) *CachedRevoker {
+	if ttl <= 0 {
+		ttl = DefaultRevokerCacheTTL
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &CachedRevoker{
+		store:   s,
+		pubsub:  ps,
+		ttl:     ttl,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		revoked: NewMemory(0),
+		valid:   NewMemory(maxCachedValid),
+	}
+	go r.subscribe(ctx)
+	return r
+}
+
+// IsRevoked reports if the token of the verified claims was revoked
+func (r *CachedRevoker) IsRevoked(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	id := TokenID(claims)
+	if id == "" {
+		return false, nil
+	}
+	if ok, _ := r.revoked.Contains(ctx, id); ok {
+		return true, nil
+	}
+	r.mu.RLock()
+	valid := r.valid
+	r.mu.RUnlock()
+	if ok, _ := valid.Contains(ctx, id); ok {
+		return false, nil
+	}
+	revoked, err := r.store.Contains(ctx, revokedKey(id))
+	if err != nil {
+		return false, err
+	}
+	if revoked {
+		exp := time.Now().Add(r.ttl)
+		if f, ok := claims["exp"].(float64); ok {
+			exp = time.Unix(int64(f), 0)
+		}
+		r.revoked.Add(ctx, id, exp)
+		return true, nil
+	}
+	valid.Add(ctx, id, time.Now().Add(r.ttl))
+	return false, nil
+}
+
+// Revoke revokes the token of the jti in the store and publishes the revocation,
+// failed publishes are logged since the revocation is in effect already
+func (r *CachedRevoker) Revoke(ctx context.Context, jti string, exp time.Time) error {
+	if err := r.store.Add(ctx, revokedKey(jti), exp); err != nil && err != ErrExists {
+		return err
+	}
+	r.revoked.Add(ctx, jti, exp)
+	// the revocation is stored, if it isn't published the other instances pick
+	// it up from the store at the latest once their cached lookup expires
+	if err := r.pubsub.Publish(ctx, RevokedChannel, []byte(strconv.FormatInt(exp.Unix(), 10)+" "+jti)); err != nil {
+		log.Printf("tokenauth: couldn't publish revocation of %s: %v", jti, err)
+	}
+	return nil
+}
+
+// Close stops the subscription to the revocations of the other instances
+func (r *CachedRevoker) Close() error {
+	r.cancel()
+	<-r.done
+	return nil
+}
+
+// subscribe adds the published revocations to the cache until ctx is done,
+// resubscribing after failures
+func (r *CachedRevoker) subscribe(ctx context.Context) {
+	defer close(r.done)
+	delay := 100 * time.Millisecond
+	for {
+		err := r.pubsub.Subscribe(ctx, RevokedChannel, r.received)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			delay = 100 * time.Millisecond
+		}
+		// revocations published while the subscription was down are
+		// missed, the tokens cached as not revoked are looked up again
+		r.mu.Lock()
+		r.valid = NewMemory(maxCachedValid)
+		r.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > r.ttl {
+			delay = r.ttl
+		}
+	}
+}
+
+// received adds a published revocation, "<exp> <jti>", to the cache
+func (r *CachedRevoker) received(message []byte) {
+	parts := strings.SplitN(string(message), " ", 2)
+	if len(parts) != 2 {
+		return
+	}
+	exp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return
+	}
+	r.revoked.Add(context.Background(), parts[1], time.Unix(exp, 0))
+}
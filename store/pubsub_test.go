@@ -0,0 +1,173 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// broker delivers the published messages to the subscribers in memory
+type broker struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]bool
+	fail        chan struct{}
+}
+
+func newBroker() *broker {
+	return &broker{subscribers: map[chan []byte]bool{}, fail: make(chan struct{})}
+}
+
+func (b *broker) Publish(_ context.Context, _ string, message []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		ch <- message
+	}
+	return nil
+}
+
+func (b *broker) Subscribe(ctx context.Context, _ string, handler func([]byte)) error {
+	ch := make(chan []byte, 16)
+	b.mu.Lock()
+	b.subscribers[ch] = true
+	fail := b.fail
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}()
+	for {
+		select {
+		case m := <-ch:
+			handler(m)
+		case <-fail:
+			return errors.New("connection lost")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *broker) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// countingStore counts the lookups of the keys
+type countingStore struct {
+	*store.Memory
+	mu      sync.Mutex
+	lookups int
+}
+
+func (s *countingStore) Contains(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	s.lookups++
+	s.mu.Unlock()
+	return s.Memory.Contains(ctx, key)
+}
+
+func (s *countingStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookups
+}
+
+func TestCachedRevoker(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	b := newBroker()
+	shared := &countingStore{Memory: store.NewMemory(0)}
+	one := store.NewCachedRevoker(shared, b, time.Hour)
+	defer one.Close()
+	two := store.NewCachedRevoker(shared, b, time.Hour)
+	defer two.Close()
+	r.Eventually(func() bool { return b.len() == 2 }, time.Second, time.Millisecond)
+
+	claims := jwt.MapClaims{"jti": "a", "exp": float64(time.Now().Add(time.Minute).Unix())}
+	revoked, err := two.IsRevoked(ctx, claims)
+	r.NoError(err)
+	r.False(revoked)
+	// the lookup is cached
+	_, err = two.IsRevoked(ctx, claims)
+	r.NoError(err)
+	r.Equal(1, shared.count())
+
+	// the revocation on one instance reaches the cache of the other
+	r.NoError(one.Revoke(ctx, "a", time.Now().Add(time.Minute)))
+	r.Eventually(func() bool {
+		revoked, _ := two.IsRevoked(ctx, claims)
+		return revoked
+	}, time.Second, time.Millisecond)
+	r.Equal(1, shared.count())
+
+	// tokens revoked before the instance started are looked up in the store
+	three := store.NewCachedRevoker(shared, b, time.Hour)
+	defer three.Close()
+	revoked, err = three.IsRevoked(ctx, claims)
+	r.NoError(err)
+	r.True(revoked)
+}
+
+func TestCachedRevokerResubscribes(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	b := newBroker()
+	shared := store.NewMemory(0)
+	revoker := store.NewCachedRevoker(shared, b, time.Hour)
+	defer revoker.Close()
+	r.Eventually(func() bool { return b.len() == 1 }, time.Second, time.Millisecond)
+
+	claims := jwt.MapClaims{"jti": "a"}
+	revoked, err := revoker.IsRevoked(ctx, claims)
+	r.NoError(err)
+	r.False(revoked)
+
+	// the subscription fails and a revocation is missed meanwhile
+	b.mu.Lock()
+	close(b.fail)
+	b.fail = make(chan struct{})
+	b.mu.Unlock()
+	r.NoError(store.NewRevoker(shared).Revoke(ctx, "a", time.Now().Add(time.Minute)))
+
+	// the cached lookups are dropped, so the revocation is looked up in the store
+	r.Eventually(func() bool {
+		revoked, _ := revoker.IsRevoked(ctx, claims)
+		return revoked
+	}, time.Second, time.Millisecond)
+	r.Eventually(func() bool { return b.len() == 1 }, time.Second, time.Millisecond)
+}
+
+// downPubSub fails to publish, its subscriptions last until ctx is done
+type downPubSub struct{}
+
+func (downPubSub) Publish(context.Context, string, []byte) error {
+	return errors.New("connection refused")
+}
+
+func (downPubSub) Subscribe(ctx context.Context, _ string, _ func([]byte)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCachedRevokerPublishFails(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	shared := store.NewMemory(0)
+	revoker := store.NewCachedRevoker(shared, downPubSub{}, time.Hour)
+	defer revoker.Close()
+
+	// the revocation is stored even if it isn't published
+	r.NoError(revoker.Revoke(ctx, "a", time.Now().Add(time.Minute)))
+	revoked, err := store.NewRevoker(shared).IsRevoked(ctx, jwt.MapClaims{"jti": "a"})
+	r.NoError(err)
+	r.True(revoked)
+}
@@ -0,0 +1,310 @@
+// Package redis is a store.Store keeping the keys in Redis, so the instances of
+// an app share revoked tokens and the jti values of seen tokens. The keys expire
+// with the tokens. It speaks the Redis protocol itself, so apps don't pull in a
+// Redis client for it. It is also a store.PubSub, so revocations can be cached
+// by the instances with store.NewCachedRevoker.
+//
+//	rs, err := redis.New(envy.Get("REDIS_URL", "redis://localhost:6379/0"))
+//	if err != nil {
+//		return err
+//	}
+//	app.Use(tokenauth.New(tokenauth.Options{
+//		Revoker:     store.NewRevoker(rs),
+//		ReplayStore: rs,
+//	}))
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
+	"github.com/pkg/errors"
+)
+
+// Store is a store.Store keeping the keys in Redis
+type Store struct {
+	// Prefix of the keys in Redis, defaults to tokenauth:
+	Prefix string
+	// Timeout of the commands, defaults to 2s
+	Timeout time.Duration
+
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	idle     chan *conn
+}
+
+// maxIdle is the number of idle connections kept for later commands
+const maxIdle = 16
+
+// New returns a Store for the Redis server at the URL,
+// redis://[[username]:password@]host[:port][/db], or rediss:// for TLS
+func New(rawURL string) (*Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid Redis URL")
+	}
+	s := &Store{
+		Prefix:  "tokenauth:",
+		Timeout: 2 * time.Second,
+		addr:    u.Host,
+		idle:    make(chan *conn, maxIdle),
+	}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		s.tls = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, errors.Errorf("invalid Redis URL scheme %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, errors.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return s, nil
+}
+
+// Add stores the key until expires
+func (s *Store) Add(ctx context.Context, key string, expires time.Time) error {
+	ttl := time.Until(expires).Milliseconds()
+	if ttl <= 0 {
+		// expired keys are not stored
+		return nil
+	}
+	reply, err := s.do(ctx, "SET", s.Prefix+key, "1", "NX", "PX", strconv.FormatInt(ttl, 10))
+	if err != nil {
+		return err
+	}
+	// SET NX replies nil if the key exists
+	if reply == nil {
+		return store.ErrExists
+	}
+	return nil
+}
+
+// Contains reports if the key is stored and not expired
+func (s *Store) Contains(ctx context.Context, key string) (bool, error) {
+	reply, err := s.do(ctx, "EXISTS", s.Prefix+key)
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n > 0, nil
+}
+
+// Publish sends the message to the subscribers of the channel
+func (s *Store) Publish(ctx context.Context, channel string, message []byte) error {
+	_, err := s.do(ctx, "PUBLISH", s.Prefix+channel, string(message))
+	return err
+}
+
+// Subscribe calls handler with the messages of the channel on a connection of
+// its own, until ctx is done or the connection fails
+func (s *Store) Subscribe(ctx context.Context, channel string, handler func(message []byte)) error {
+	c, err := s.dial(ctx)
+	if err != nil {
+		return errors.Wrap(err, "couldn't connect to Redis")
+	}
+	defer c.Close()
+	if _, err := c.do(s.deadline(ctx), "SUBSCRIBE", s.Prefix+channel); err != nil {
+		return errors.Wrap(err, "couldn't subscribe to Redis channel")
+	}
+	// messages arrive whenever they are published
+	if err := c.SetDeadline(time.Time{}); err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblocks the read of the next message
+			c.Close()
+		case <-stop:
+		}
+	}()
+	for {
+		reply, err := readReply(c.r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Wrap(err, "Redis subscription failed")
+		}
+		// messages are pushed as ["message", channel, payload]
+		values, _ := reply.([]interface{})
+		if len(values) == 3 && values[0] == "message" {
+			payload, _ := values[2].(string)
+			handler([]byte(payload))
+		}
+	}
+}
+
+// Close closes the idle connections
+func (s *Store) Close() error {
+	for {
+		select {
+		case c := <-s.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends the command on an idle or new connection
+func (s *Store) do(ctx context.Context, args ...string) (interface{}, error) {
+	var c *conn
+	select {
+	case c = <-s.idle:
+	default:
+		var err error
+		if c, err = s.dial(ctx); err != nil {
+			return nil, errors.Wrap(err, "couldn't connect to Redis")
+		}
+	}
+	reply, err := c.do(s.deadline(ctx), args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		// the connection is in an unknown state
+		c.Close()
+		return nil, errors.Wrapf(err, "couldn't send Redis %s", args[0])
+	}
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Redis %s failed", args[0])
+	}
+	return reply, nil
+}
+
+// deadline of a command, the deadline of the context if it is earlier
+func (s *Store) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(s.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// dial connects to the server, authenticates and selects the database
+func (s *Store) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: s.Timeout}
+	nc, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.tls != nil {
+		nc = tls.Client(nc, s.tls)
+	}
+	c := &conn{Conn: nc, r: bufio.NewReader(nc)}
+	deadline := s.deadline(ctx)
+	if s.password != "" {
+		args := []string{"AUTH", s.password}
+		if s.username != "" {
+			args = []string{"AUTH", s.username, s.password}
+		}
+		if _, err := c.do(deadline, args...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := c.do(deadline, "SELECT", strconv.Itoa(s.db)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// redisError is an error reply of the server
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do sends the command and reads its reply
+func (c *conn) do(deadline time.Time, args ...string) (interface{}, error) {
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+// readReply reads a RESP reply, nil replies are returned as nil
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("invalid Redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, errors.Errorf("invalid Redis reply %q", line)
+}
@@ -0,0 +1,249 @@
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
+	"github.com/gobuffalo/mw-tokenauth/v2/store/redis"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis serves the commands the store sends from memory
+type fakeRedis struct {
+	net.Listener
+	password string
+
+	mu          sync.Mutex
+	keys        map[string]time.Time
+	dbs         []string
+	subscribers map[string][]net.Conn
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeRedis{Listener: l, password: password, keys: map[string]time.Time{}, subscribers: map[string][]net.Conn{}}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authenticated := f.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authenticated = args[len(args)-1] == f.password
+			if authenticated {
+				io.WriteString(c, "+OK\r\n")
+			} else {
+				io.WriteString(c, "-WRONGPASS invalid password\r\n")
+			}
+		case !authenticated:
+			io.WriteString(c, "-NOAUTH Authentication required.\r\n")
+		case cmd == "SELECT":
+			f.dbs = append(f.dbs, args[1])
+			io.WriteString(c, "+OK\r\n")
+		case cmd == "SET":
+			ms, _ := strconv.Atoi(args[5])
+			if exp, ok := f.keys[args[1]]; ok && time.Now().Before(exp) {
+				io.WriteString(c, "$-1\r\n")
+			} else {
+				f.keys[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+				io.WriteString(c, "+OK\r\n")
+			}
+		case cmd == "EXISTS":
+			exp, ok := f.keys[args[1]]
+			if ok && time.Now().Before(exp) {
+				io.WriteString(c, ":1\r\n")
+			} else {
+				io.WriteString(c, ":0\r\n")
+			}
+		case cmd == "SUBSCRIBE":
+			f.subscribers[args[1]] = append(f.subscribers[args[1]], c)
+			fmt.Fprintf(c, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		case cmd == "PUBLISH":
+			for _, sc := range f.subscribers[args[1]] {
+				fmt.Fprintf(sc, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(args[1]), args[1], len(args[2]), args[2])
+			}
+			fmt.Fprintf(c, ":%d\r\n", len(f.subscribers[args[1]]))
+		default:
+			fmt.Fprintf(c, "-ERR unknown command '%s'\r\n", cmd)
+		}
+		f.mu.Unlock()
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestStore(t *testing.T) {
+	r := require.New(t)
+	f := newFakeRedis(t, "s3cret")
+	defer f.Close()
+	rs, err := redis.New("redis://:s3cret@" + f.Addr().String() + "/2")
+	r.NoError(err)
+	defer rs.Close()
+	ctx := context.Background()
+
+	r.NoError(rs.Add(ctx, "a", time.Now().Add(time.Minute)))
+	r.Equal(store.ErrExists, rs.Add(ctx, "a", time.Now().Add(time.Minute)))
+	ok, err := rs.Contains(ctx, "a")
+	r.NoError(err)
+	r.True(ok)
+	ok, err = rs.Contains(ctx, "b")
+	r.NoError(err)
+	r.False(ok)
+	// expired keys are not stored
+	r.NoError(rs.Add(ctx, "b", time.Now().Add(-time.Second)))
+	ok, _ = rs.Contains(ctx, "b")
+	r.False(ok)
+
+	f.mu.Lock()
+	_, prefixed := f.keys["tokenauth:a"]
+	dbs := f.dbs
+	f.mu.Unlock()
+	r.True(prefixed)
+	// the connection is reused
+	r.Equal([]string{"2"}, dbs)
+
+	// revocations are shared by the instances of the app
+	revoker := store.NewRevoker(rs)
+	r.NoError(revoker.Revoke(ctx, "session-1", time.Now().Add(time.Minute)))
+	other, err := redis.New("redis://:s3cret@" + f.Addr().String() + "/2")
+	r.NoError(err)
+	defer other.Close()
+	revoked, err := store.NewRevoker(other).IsRevoked(ctx, jwt.MapClaims{"jti": "session-1"})
+	r.NoError(err)
+	r.True(revoked)
+}
+
+func TestStoreErrors(t *testing.T) {
+	r := require.New(t)
+	f := newFakeRedis(t, "s3cret")
+	defer f.Close()
+	ctx := context.Background()
+
+	rs, err := redis.New("redis://:wrong@" + f.Addr().String())
+	r.NoError(err)
+	_, err = rs.Contains(ctx, "a")
+	r.Error(err)
+	r.Contains(err.Error(), "WRONGPASS")
+
+	_, err = redis.New("http://" + f.Addr().String())
+	r.Error(err)
+	_, err = redis.New("redis://" + f.Addr().String() + "/db")
+	r.Error(err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	r.NoError(err)
+	addr := l.Addr().String()
+	l.Close()
+	rs, err = redis.New("redis://" + addr)
+	r.NoError(err)
+	r.Error(rs.Add(ctx, "a", time.Now().Add(time.Minute)))
+}
+
+func TestPubSub(t *testing.T) {
+	r := require.New(t)
+	f := newFakeRedis(t, "")
+	defer f.Close()
+	rs, err := redis.New("redis://" + f.Addr().String())
+	r.NoError(err)
+	defer rs.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- rs.Subscribe(ctx, "revoked", func(m []byte) { messages <- string(m) })
+	}()
+	r.Eventually(func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return len(f.subscribers["tokenauth:revoked"]) == 1
+	}, time.Second, time.Millisecond)
+
+	r.NoError(rs.Publish(ctx, "revoked", []byte("1700000000 a")))
+	r.Equal("1700000000 a", <-messages)
+
+	// the subscription ends with the context
+	cancel()
+	r.Equal(context.Canceled, <-done)
+}
+
+func TestCachedRevoker(t *testing.T) {
+	r := require.New(t)
+	f := newFakeRedis(t, "")
+	defer f.Close()
+	ctx := context.Background()
+	one, err := redis.New("redis://" + f.Addr().String())
+	r.NoError(err)
+	defer one.Close()
+	two, err := redis.New("redis://" + f.Addr().String())
+	r.NoError(err)
+	defer two.Close()
+
+	revokerOne := store.NewCachedRevoker(one, one, time.Hour)
+	defer revokerOne.Close()
+	revokerTwo := store.NewCachedRevoker(two, two, time.Hour)
+	defer revokerTwo.Close()
+	r.Eventually(func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return len(f.subscribers["tokenauth:revoked"]) == 2
+	}, time.Second, time.Millisecond)
+
+	claims := jwt.MapClaims{"jti": "session-1"}
+	revoked, err := revokerTwo.IsRevoked(ctx, claims)
+	r.NoError(err)
+	r.False(revoked)
+
+	// the revocation invalidates the cached lookup of the other instance
+	r.NoError(revokerOne.Revoke(ctx, "session-1", time.Now().Add(time.Minute)))
+	r.Eventually(func() bool {
+		revoked, _ := revokerTwo.IsRevoked(ctx, claims)
+		return revoked
+	}, time.Second, time.Millisecond)
+}
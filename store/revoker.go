@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Revoker invalidates tokens before they expire, e.g. on logout or when
+// an account is compromised. Implementations must be safe for concurrent use.
+type Revoker interface {
+	// IsRevoked reports if the token of the verified claims was revoked
+	IsRevoked(ctx context.Context, claims jwt.MapClaims) (bool, error)
+	// Revoke revokes the token of the jti, exp is when it expires anyway.
+	// Pass the TokenID of the claims to revoke tokens without jti
+	Revoke(ctx context.Context, jti string, exp time.Time) error
+}
+
+// TokenID returns the jti of the claims, or the sub and iat claims for tokens
+// without jti, which identify a token as long as its subject gets one token at a time
+func TokenID(claims jwt.MapClaims) string {
+	if jti, _ := claims["jti"].(string); jti != "" {
+		return jti
+	}
+	sub, _ := claims["sub"].(string)
+	iat, ok := claims["iat"].(float64)
+	if sub == "" || !ok {
+		return ""
+	}
+	return sub + "@" + strconv.FormatFloat(iat, 'f', -1, 64)
+}
+
+// NewRevoker returns a Revoker keeping the TokenID of the revoked tokens in the
+// store until they expire, tokens without TokenID can't be revoked
+func NewRevoker(s Store) Revoker {
+	return storeRevoker{store: s}
+}
+
+type storeRevoker struct {
+	store Store
+}
+
+// revokedKey is the key of a revoked jti, so the store can be shared, e.g. with the replay guard
+func revokedKey(jti string) string {
+	return "revoked:" + jti
+}
+
+func (r storeRevoker) IsRevoked(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	id := TokenID(claims)
+	if id == "" {
+		return false, nil
+	}
+	return r.store.Contains(ctx, revokedKey(id))
+}
+
+func (r storeRevoker) Revoke(ctx context.Context, jti string, exp time.Time) error {
+	if err := r.store.Add(ctx, revokedKey(jti), exp); err != nil && err != ErrExists {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrExists is returned by Add if the key is already stored
+var ErrExists = errors.New("key already stored")
+
+// Store keeps keys until they expire, e.g. the jti of seen or revoked tokens
+// until the tokens expire. Implementations must be safe for concurrent use.
+type Store interface {
+	// Add stores the key until expires, it returns ErrExists if the key is
+	// stored and not expired, atomically, so concurrent Adds of a key fail but one
+	Add(ctx context.Context, key string, expires time.Time) error
+	// Contains reports if the key is stored and not expired
+	Contains(ctx context.Context, key string) (bool, error)
+}
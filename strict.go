@@ -0,0 +1,57 @@
+package tokenauth
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// isHMAC reports if the sign method is symmetric
+func isHMAC(method jwt.SigningMethod) bool {
+	return strings.HasPrefix(method.Alg(), "HS")
+}
+
+// checkStrictOptions checks the options follow the JWT best current practices of RFC 8725
+func checkStrictOptions(options Options) error {
+	if options.TrustMode == TrustModeGatewayUnverified {
+		return errors.New("Strict requires the signatures of the tokens to be verified")
+	}
+	var asymmetric, symmetric bool
+	for _, method := range []jwt.SigningMethod{options.SignMethod, options.Canary.signMethod()} {
+		switch {
+		case method == nil:
+		case method.Alg() == "none":
+			return errors.New("Strict forbids the none sign method")
+		case isHMAC(method):
+			symmetric = true
+		default:
+			asymmetric = true
+		}
+	}
+	// a public key must never be usable as HMAC secret, RFC 8725 section 3.1
+	if asymmetric && symmetric {
+		return errors.New("Strict forbids HMAC sign methods next to asymmetric ones")
+	}
+	if options.MaxTokenBytes < 0 {
+		return errors.New("Strict requires MaxTokenBytes")
+	}
+	if len(options.Issuer) == 0 && options.OIDC == nil {
+		return errors.New("Strict requires Issuer")
+	}
+	if len(options.Audience) == 0 && options.SPIFFE == nil {
+		return errors.New("Strict requires Audience")
+	}
+	return nil
+}
+
+// checkStrict checks the header and the claims of a verified token in Strict mode
+func checkStrict(token *jwt.Token, options Options) error {
+	if alg := token.Method.Alg(); alg == "none" || (strings.HasPrefix(alg, "HS") && !isHMAC(options.SignMethod)) {
+		return ErrBadSigningMethod
+	}
+	if _, ok := ExpiresAt(token.Claims.(jwt.MapClaims)); !ok {
+		return errors.Wrap(ErrMissingClaim, "exp")
+	}
+	return nil
+}
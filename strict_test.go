@@ -0,0 +1,91 @@
+package tokenauth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrict(t *testing.T) {
+	r := require.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+	options := tokenauth.Options{
+		Strict:     true,
+		SignMethod: jwt.SigningMethodES256,
+		KeyFunc:    tokenauth.StaticKey(&key.PublicKey),
+		Issuer:     []string{"https://idp.example.com"},
+		Audience:   []string{"api"},
+	}
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(options))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String("ok"))
+	})
+	w := httptest.New(a)
+
+	sign := func(claims jwt.MapClaims, header map[string]interface{}) string {
+		claims["iss"], claims["aud"] = "https://idp.example.com", "api"
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		for k, v := range header {
+			token.Header[k] = v
+		}
+		tokenString, err := token.SignedString(key)
+		r.NoError(err)
+		return tokenString
+	}
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	r.NoError(err)
+	// the public key used as HMAC secret
+	confused, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": exp, "iss": "https://idp.example.com", "aud": "api"}).SignedString(public)
+	r.NoError(err)
+
+	for _, tt := range []struct {
+		token  string
+		status int
+	}{
+		{sign(jwt.MapClaims{"exp": exp}, nil), http.StatusOK},
+		{sign(jwt.MapClaims{}, nil), http.StatusUnauthorized},
+		{sign(jwt.MapClaims{"exp": exp}, map[string]interface{}{"crit": []string{"exp"}, "exp": exp}), http.StatusUnauthorized},
+		{sign(jwt.MapClaims{"exp": exp, "padding": strings.Repeat("a", tokenauth.DefaultMaxTokenBytes)}, nil), http.StatusUnauthorized},
+		{confused, http.StatusUnauthorized},
+	} {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + tt.token
+		r.Equal(tt.status, req.Get().Code, tt.token)
+	}
+
+	for msg, misconfigure := range map[string]func(o *tokenauth.Options){
+		"requires Issuer":   func(o *tokenauth.Options) { o.Issuer = nil },
+		"requires Audience": func(o *tokenauth.Options) { o.Audience = nil },
+		"none":              func(o *tokenauth.Options) { o.SignMethod = jwt.SigningMethodNone },
+		"verified": func(o *tokenauth.Options) {
+			o.TrustMode, o.AllowUnverified = tokenauth.TrustModeGatewayUnverified, true
+		},
+		"MaxTokenBytes": func(o *tokenauth.Options) { o.MaxTokenBytes = -1 },
+		"HMAC": func(o *tokenauth.Options) {
+			o.Canary = &tokenauth.CanaryIssuer{SignMethod: jwt.SigningMethodHS256, GetKey: func(jwt.SigningMethod) (interface{}, error) {
+				return []byte("secret"), nil
+			}}
+		},
+	} {
+		o := options
+		misconfigure(&o)
+		_, err := tokenauth.NewWithError(o)
+		r.Error(err, msg)
+		r.Contains(err.Error(), msg)
+	}
+}
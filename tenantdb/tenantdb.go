@@ -0,0 +1,98 @@
+// Package tenantdb isolates the data of the tenants of multi-tenant apps with a
+// database per tenant: it selects the pop connection of the tenant claim of the
+// token verified by the tokenauth middleware and sets it in the context
+//
+//	tenants := tenantdb.NewRegistry()
+//	tenants.Register("acme", acmeDB)
+//	app.Use(tokenauth.New(tokenauth.Options{}))
+//	app.Use(tenantdb.Middleware(tenants, tenantdb.Options{}))
+//	...
+//	tx := c.Value("tx").(*pop.Connection)
+package tenantdb
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gobuffalo/buffalo"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/gobuffalo/pop"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoTenant is returned if the token has no tenant claim
+	ErrNoTenant = errors.New("token has no tenant")
+	// ErrUnknownTenant is returned if no connection is registered for the tenant of the token
+	ErrUnknownTenant = errors.New("tenant not registered")
+)
+
+// Registry holds the connections of the tenants, it is safe for concurrent use,
+// so tenants can be registered while the app is serving
+type Registry struct {
+	mu    sync.RWMutex
+	conns map[string]*pop.Connection
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{conns: map[string]*pop.Connection{}}
+}
+
+// Register sets the connection of the tenant
+func (r *Registry) Register(tenant string, conn *pop.Connection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conns[tenant] = conn
+}
+
+// Unregister removes the connection of the tenant
+func (r *Registry) Unregister(tenant string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, tenant)
+}
+
+// Connection returns the connection of the tenant, false if it isn't registered
+func (r *Registry) Connection(tenant string) (*pop.Connection, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	conn, ok := r.conns[tenant]
+	return conn, ok
+}
+
+// Options for the Middleware
+type Options struct {
+	// Claim is the claim holding the tenant, defaults to "tenant"
+	Claim string
+	// ContextKey is the key the connection is set under, defaults to "tx"
+	// like the transaction middleware of buffalo-pop
+	ContextKey string
+}
+
+// Middleware sets the connection of the tenant of the verified token in the
+// context, it must be used after the tokenauth middleware. Requests with
+// tokens of tenants without connection are rejected with 403 Forbidden.
+func Middleware(registry *Registry, options Options) buffalo.MiddlewareFunc {
+	if options.Claim == "" {
+		options.Claim = "tenant"
+	}
+	if options.ContextKey == "" {
+		options.ContextKey = "tx"
+	}
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			claims := tokenauth.ClaimsMap(c)
+			tenant, _ := claims[options.Claim].(string)
+			if tenant == "" {
+				return c.Error(http.StatusForbidden, ErrNoTenant)
+			}
+			conn, ok := registry.Connection(tenant)
+			if !ok {
+				return c.Error(http.StatusForbidden, errors.Wrapf(ErrUnknownTenant, "tenant %q", tenant))
+			}
+			c.Set(options.ContextKey, conn)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package tenantdb_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/gobuffalo/mw-tokenauth/v2/tenantdb"
+	"github.com/gobuffalo/pop"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := require.New(t)
+	tenants := tenantdb.NewRegistry()
+	tenants.Register("acme", &pop.Connection{ID: "acme"})
+	tenants.Register("globex", &pop.Connection{ID: "globex"})
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{KeyFunc: tokenauth.StaticKey([]byte("secret"))}))
+	a.Use(tenantdb.Middleware(tenants, tenantdb.Options{Claim: "org"}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, render.String(c.Value("tx").(*pop.Connection).ID))
+	})
+	w := httptest.New(a)
+
+	sign := func(claims jwt.MapClaims) string {
+		claims["exp"] = time.Now().Add(time.Minute * 5).Unix()
+		tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		r.NoError(err)
+		return tokenString
+	}
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + sign(jwt.MapClaims{"org": "acme"})
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("acme", res.Body.String())
+
+	req.Headers["Authorization"] = "Bearer " + sign(jwt.MapClaims{"org": "globex"})
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("globex", res.Body.String())
+
+	req.Headers["Authorization"] = "Bearer " + sign(jwt.MapClaims{"org": "initech"})
+	r.Equal(http.StatusForbidden, req.Get().Code)
+	req.Headers["Authorization"] = "Bearer " + sign(jwt.MapClaims{"tenant": "acme"})
+	r.Equal(http.StatusForbidden, req.Get().Code)
+
+	tenants.Unregister("acme")
+	req.Headers["Authorization"] = "Bearer " + sign(jwt.MapClaims{"org": "acme"})
+	r.Equal(http.StatusForbidden, req.Get().Code)
+}
@@ -0,0 +1,69 @@
+package tokenauth
+
+import (
+	"github.com/gobuffalo/buffalo"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TrustTier describes how much the caller of a request is trusted,
+// downstream middlewares (rate limiting, body size limits) can use it
+// to vary their behaviour
+type TrustTier string
+
+const (
+	// TierPublic is the tier of callers that are not otherwise classified
+	TierPublic TrustTier = "public"
+	// TierPartner is the tier of callers belonging to trusted partners
+	TierPartner TrustTier = "partner"
+	// TierInternal is the tier of callers from internal services
+	TierInternal TrustTier = "internal"
+)
+
+// TrustTierKey is the context key the trust tier of the caller is stored under
+const TrustTierKey = "trust_tier"
+
+// TierByIssuer returns a TrustTier func which selects the tier according to the
+// iss claim of the token, tokens with an unknown issuer get the fallback tier.
+func TierByIssuer(tiers map[string]TrustTier, fallback TrustTier) func(jwt.Claims) TrustTier {
+	return func(claims jwt.Claims) TrustTier {
+		mc, ok := claims.(jwt.MapClaims)
+		if !ok {
+			return fallback
+		}
+		iss, _ := mc["iss"].(string)
+		if tier, ok := tiers[iss]; ok {
+			return tier
+		}
+		return fallback
+	}
+}
+
+// TierFromContext returns the trust tier set by the middleware,
+// TierPublic is returned if no tier was set.
+func TierFromContext(c buffalo.Context) TrustTier {
+	if tier, ok := c.Value(TrustTierKey).(TrustTier); ok {
+		return tier
+	}
+	return TierPublic
+}
+
+// stripTrustTier deletes the tier header sent by the client, which is never trusted,
+// before the request is authenticated or let through, e.g. by FlagReportOnly
+func stripTrustTier(c buffalo.Context, options Options) {
+	if options.TrustTierHeader != "" {
+		c.Request().Header.Del(options.TrustTierHeader)
+	}
+}
+
+// setTrustTier tags the request with the trust tier of the caller
+// as a context value and, if configured, as a request header.
+func setTrustTier(c buffalo.Context, options Options, claims jwt.Claims) {
+	if options.TrustTier == nil {
+		return
+	}
+	tier := options.TrustTier(claims)
+	c.Set(TrustTierKey, tier)
+	if options.TrustTierHeader != "" {
+		c.Request().Header.Set(options.TrustTierHeader, string(tier))
+	}
+}
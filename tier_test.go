@@ -0,0 +1,80 @@
+package tokenauth_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func appTrustTier() *buffalo.App {
+	h := func(c buffalo.Context) error {
+		return c.Render(200, render.String(fmt.Sprintf("%s|%s",
+			tokenauth.TierFromContext(c), c.Request().Header.Get("X-Trust-Tier"))))
+	}
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		TrustTier: tokenauth.TierByIssuer(map[string]tokenauth.TrustTier{
+			"https://internal.example.com": tokenauth.TierInternal,
+			"https://partner.example.com":  tokenauth.TierPartner,
+		}, tokenauth.TierPublic),
+		TrustTierHeader: "X-Trust-Tier",
+	}))
+	a.GET("/", h)
+	return a
+}
+
+func TestTrustTier(t *testing.T) {
+	r := require.New(t)
+	w := httptest.New(appTrustTier())
+
+	tests := map[string]tokenauth.TrustTier{
+		"https://internal.example.com": tokenauth.TierInternal,
+		"https://partner.example.com":  tokenauth.TierPartner,
+		"https://unknown.example.com":  tokenauth.TierPublic,
+	}
+	for iss, tier := range tests {
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signHMAC(jwt.MapClaims{
+			"iss": iss,
+			"exp": time.Now().Add(time.Minute * 5).Unix(),
+		})
+		// a tier sent by the client must be overwritten
+		req.Headers["X-Trust-Tier"] = string(tokenauth.TierInternal)
+		res := req.Get()
+		r.Equal(http.StatusOK, res.Code)
+		r.Equal(fmt.Sprintf("%s|%s", tier, tier), res.Body.String())
+	}
+}
+
+func TestTrustTierPassThrough(t *testing.T) {
+	r := require.New(t)
+	for _, flag := range []string{tokenauth.FlagReportOnly, tokenauth.FlagOptional} {
+		a := buffalo.New(buffalo.Options{})
+		a.Use(tokenauth.New(tokenauth.Options{
+			KeyFunc:         tokenauth.StaticKey([]byte("secret")),
+			TrustTier:       tokenauth.TierByIssuer(nil, tokenauth.TierPublic),
+			TrustTierHeader: "X-Trust-Tier",
+			Flags:           &staticFlags{flags: map[string]bool{flag: true}},
+		}))
+		a.GET("/", func(c buffalo.Context) error {
+			return c.Render(200, render.String(fmt.Sprintf("%s|%s",
+				tokenauth.TierFromContext(c), c.Request().Header.Get("X-Trust-Tier"))))
+		})
+		// the tier sent by the client is removed from requests let through without token
+		req := httptest.New(a).HTML("/")
+		req.Headers["X-Trust-Tier"] = string(tokenauth.TierInternal)
+		res := req.Get()
+		r.Equal(http.StatusOK, res.Code, flag)
+		r.Equal("public|", res.Body.String(), flag)
+	}
+}
@@ -0,0 +1,105 @@
+package tokenauth
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// PhaseTimingsKey is the context key of the *PhaseTimings of the request,
+// for APM agents to pick up
+const PhaseTimingsKey = "tokenauth_timings"
+
+// PhaseTimings are the durations of the phases of the token validation
+type PhaseTimings struct {
+	// Extraction is reading the token from the request
+	Extraction time.Duration
+	// KeyFetch is loading the verification key, e.g. from a JWKS endpoint
+	KeyFetch time.Duration
+	// Verification is parsing the token and verifying its signature and claims
+	Verification time.Duration
+	// Guards are the PreVerify hook and the claims mappers
+	Guards time.Duration
+
+	observed bool
+}
+
+// PhaseMetrics accumulates the phase timings of the validated requests,
+// so latency can be attributed to JWKS fetches, crypto or store lookups
+type PhaseMetrics struct {
+	count        uint64
+	extraction   int64
+	keyFetch     int64
+	verification int64
+	guards       int64
+}
+
+// Count returns the number of requests observed
+func (m *PhaseMetrics) Count() uint64 {
+	return atomic.LoadUint64(&m.count)
+}
+
+// Total returns the summed up phase timings of all observed requests
+func (m *PhaseMetrics) Total() PhaseTimings {
+	return PhaseTimings{
+		Extraction:   time.Duration(atomic.LoadInt64(&m.extraction)),
+		KeyFetch:     time.Duration(atomic.LoadInt64(&m.keyFetch)),
+		Verification: time.Duration(atomic.LoadInt64(&m.verification)),
+		Guards:       time.Duration(atomic.LoadInt64(&m.guards)),
+	}
+}
+
+// start sets up the timings of the request, nil if timings are not recorded
+func (m *PhaseMetrics) start(c buffalo.Context) *PhaseTimings {
+	if m == nil {
+		return nil
+	}
+	t := &PhaseTimings{}
+	c.Set(PhaseTimingsKey, t)
+	return t
+}
+
+// observe adds the timings of the request once it is decided
+func (m *PhaseMetrics) observe(c buffalo.Context) {
+	if m == nil {
+		return
+	}
+	t, ok := c.Value(PhaseTimingsKey).(*PhaseTimings)
+	if !ok || t.observed {
+		return
+	}
+	t.observed = true
+	atomic.AddUint64(&m.count, 1)
+	atomic.AddInt64(&m.extraction, int64(t.Extraction))
+	atomic.AddInt64(&m.keyFetch, int64(t.KeyFetch))
+	atomic.AddInt64(&m.verification, int64(t.Verification))
+	atomic.AddInt64(&m.guards, int64(t.Guards))
+}
+
+// phase of the token validation
+type phase int
+
+const (
+	phaseExtraction phase = iota
+	phaseKeyFetch
+	phaseVerification
+	phaseGuards
+)
+
+// add adds the duration to the phase, if timings are recorded
+func (t *PhaseTimings) add(p phase, d time.Duration) {
+	if t == nil {
+		return
+	}
+	switch p {
+	case phaseExtraction:
+		t.Extraction += d
+	case phaseKeyFetch:
+		t.KeyFetch += d
+	case phaseVerification:
+		t.Verification += d
+	case phaseGuards:
+		t.Guards += d
+	}
+}
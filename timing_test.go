@@ -0,0 +1,48 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhaseMetrics(t *testing.T) {
+	r := require.New(t)
+	metrics := &tokenauth.PhaseMetrics{}
+	var timings *tokenauth.PhaseTimings
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		PhaseMetrics: metrics,
+		KeyFunc: func(*jwt.Token) (interface{}, error) {
+			time.Sleep(10 * time.Millisecond)
+			return []byte("secret"), nil
+		},
+		PreVerify: func(buffalo.Context, tokenauth.UnverifiedToken) error {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		timings = c.Value(tokenauth.PhaseTimingsKey).(*tokenauth.PhaseTimings)
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}, "secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+	r.True(timings.KeyFetch >= 10*time.Millisecond)
+	r.True(timings.Guards >= 5*time.Millisecond)
+	r.True(timings.Verification < timings.KeyFetch)
+
+	// rejected requests are observed too
+	r.Equal(http.StatusUnauthorized, w.HTML("/").Get().Code)
+	r.Equal(uint64(2), metrics.Count())
+	r.Equal(timings.KeyFetch, metrics.Total().KeyFetch)
+}
@@ -11,21 +11,68 @@
 //      SignMethod: jwt.SigningMethodRS256,
 //  }))
 // By default the Key used is loaded from the JWT_SECRET or JWT_PUBLIC_KEY env variable depending
-// on the SigningMethod used. However you can retrive the key from a different source.
+// on the SigningMethod used, JWT_PUBLIC_KEY is either the key file location or the key itself,
+// a PEM or DER encoded key or X.509 certificate, or in JWK format.
+// However you can retrive the key from a different source.
 //  app.Use(tokenauth.New(tokenauth.Options{
 //      GetKey: func(jwt.SigningMethod) (interface{}, error) {
 //           // Your Implementation here ...
 //      },
 //  }))
+// Keys can be fetched from the JWKS endpoint of an IdP, they are cached and selected by the kid header of the token.
+//  app.Use(tokenauth.New(tokenauth.Options{
+//      SignMethod: jwt.SigningMethodRS256,
+//      JWKS:       tokenauth.NewJWKSProvider("https://idp.example.com/.well-known/jwks.json"),
+//  }))
+// With an OpenID Connect IdP the key set is discovered and the issuer of the tokens validated.
+//  app.Use(tokenauth.New(tokenauth.Options{
+//      OIDC: tokenauth.NewOIDCProvider("https://idp.example.com"),
+//  }))
+// Several keys can be registered by kid, so keys can be rotated without downtime.
+//  app.Use(tokenauth.New(tokenauth.Options{
+//      Keys: map[string]interface{}{
+//          "2019": oldSecret,
+//          "2020": newSecret,
+//      },
+//  }))
 // Default authorisation scheme is Bearer, you can specify your own.
 //  app.Use(tokenauth.New(tokenauth.Options{
 //      AuthScheme: "Token"
 //  }))
+// The token can be read from a different header than Authorization.
+//  app.Use(tokenauth.New(tokenauth.Options{
+//      HeaderName: "X-Access-Token",
+//  }))
+// The token can be read from a cookie instead, the header is used as a fallback.
+//  app.Use(tokenauth.New(tokenauth.Options{
+//      TokenSource: tokenauth.FromCookie("access_token"),
+//  }))
+// Legacy clients can send the token in a form encoded body.
+//  app.Use(tokenauth.New(tokenauth.Options{
+//      TokenSource: tokenauth.FromForm("access_token"),
+//  }))
+// WebSocket and EventSource clients can't set headers, reading the token from the query
+// string has to be allowed explicitly since it is less secure.
+//  app.Use(tokenauth.New(tokenauth.Options{
+//      TokenSource:     tokenauth.FromQuery("access_token"),
+//      AllowQueryToken: true,
+//  }))
+// Several sources can be tried in order, the first token found is used.
+//  app.Use(tokenauth.New(tokenauth.Options{
+//      Extractors: []tokenauth.TokenExtractor{
+//          tokenauth.FromHeader("Authorization", "Bearer"),
+//          tokenauth.FromCookie("access_token"),
+//      },
+//  }))
 //
 //
 // Creating a new token
 //
-// This can be referred from the underlying JWT package being used https://github.com/golang-jwt/jwt
+// An Issuer signs tokens with the registered claims the middleware verifies
+//  issuer := &tokenauth.Issuer{SignMethod: jwt.SigningMethodHS256, Key: []byte(SecretKey)}
+//  tokenString, err := issuer.Issue(jwt.MapClaims{"userid": "123"})
+//
+// Tokens can also be signed with the underlying JWT package being used https://github.com/golang-jwt/jwt
 //
 // Example
 //  claims := jwt.MapClaims{}
@@ -41,88 +88,709 @@
 // Example of retriving username from claims (this step is same regardless of the signing method used)
 //  claims := c.Value("claims").(jwt.MapClaims)
 //  username := claims["username"].(string)
+//
+// With the Claims option the claims are decoded into a struct of the app
+//  app.Use(tokenauth.New(tokenauth.Options{
+//      Claims: func() jwt.Claims { return &UserClaims{} },
+//  }))
+//  claims := c.Value("claims").(*UserClaims)
+//
+// On Go 1.18 and newer NewWithClaims and ClaimsAs do the same without type assertions
+//  app.Use(tokenauth.NewWithClaims[UserClaims](tokenauth.Options{}))
+//  claims, err := tokenauth.ClaimsAs[*UserClaims](c)
 package tokenauth
 
 import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/mw-tokenauth/v2/extractor"
+	"github.com/gobuffalo/mw-tokenauth/v2/guard"
+	"github.com/gobuffalo/mw-tokenauth/v2/keysource"
+	"github.com/gobuffalo/mw-tokenauth/v2/store"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/pkg/errors"
 )
 
 var (
 	// ErrTokenInvalid is returned when the token provided is invalid
-	ErrTokenInvalid = errors.New("token invalid")
+	ErrTokenInvalid = extractor.ErrTokenInvalid
 	// ErrNoToken is returned if no token is supplied in the request.
-	ErrNoToken = errors.New("token not found in request")
+	ErrNoToken = extractor.ErrNoToken
 	// ErrBadSigningMethod is returned if the token sign method in the request
 	// does not match the signing method used
 	ErrBadSigningMethod = errors.New("unexpected signing method")
+	// ErrTokenTooLarge is returned if the token is larger than MaxTokenBytes
+	ErrTokenTooLarge = errors.New("token too large")
 )
 
+// DefaultMaxTokenBytes is the default MaxTokenBytes, far more than tokens
+// with dozens of claims take, but less than the header limits of most proxies
+const DefaultMaxTokenBytes = 8 << 10
+
 // Options for the JWT middleware
 type Options struct {
 	SignMethod jwt.SigningMethod
 	GetKey     func(jwt.SigningMethod) (interface{}, error)
-	AuthScheme string
+	// GetKeyContext if set, is called with the context of the request for every
+	// token, so remote key fetches honor the request deadline and carry its trace
+	// spans. Keys are not cached, unlike with GetKey. It is also called on start
+	// unless LazyKey is set, and takes precedence over GetKey, KeyFunc and JWKS
+	GetKeyContext func(ctx context.Context, method jwt.SigningMethod) (interface{}, error)
+	AuthScheme    string
+	// HeaderName is the header the token is read from, defaults to Authorization
+	HeaderName string
+	// TokenSource is where the token is read from, the HeaderName header
+	// is used as a fallback when the source finds no token
+	TokenSource TokenExtractor
+	// Extractors are tried in order and the first token found is used,
+	// when set TokenSource and the HeaderName header are not used
+	Extractors []TokenExtractor
+	// GetToken if set, replaces the token extraction of the middleware,
+	// it must return ErrNoToken if the request carries no token
+	GetToken func(c buffalo.Context) (string, error)
+	// AllowQueryToken enables the FromQuery extractor, tokens in URLs leak
+	// into logs so this should only be used for WebSocket and EventSource routes
+	AllowQueryToken bool
+	// Versions are the accepted values of the ver claim, with the mapper upgrading
+	// the claims of that version to the current contract, a nil mapper keeps the
+	// claims as they are. Tokens without ver claim have the version ""
+	Versions map[string]ClaimsMapper
+	// Canary is a secondary issuer accepted next to the primary configuration
+	Canary *CanaryIssuer
+	// IssuerMetrics if set, counts the accepted tokens per issuer
+	IssuerMetrics *IssuerMetrics
+	// JWKS if set, the verification key is selected by the kid header
+	// of the token from the key set, GetKey is not used
+	JWKS *JWKSProvider
+	// OIDC if set, tokens are verified with the keys of the OpenID Connect
+	// IdP and must be issued by it, SignMethod defaults to RS256
+	OIDC *OIDCProvider
+	// SPIFFE if set, tokens are JWT-SVIDs of the workloads of the trusted SPIFFE
+	// domains, SignMethod defaults to ES256. Validators are run after its checks
+	SPIFFE *SPIFFE
+	// Audience if set, the aud claim of the token, a string or an array of
+	// strings, must contain one of these values, so tokens issued for other
+	// services are rejected with ErrInvalidAudience
+	Audience []string
+	// Issuer if set, the iss claim of the token must be one of these values,
+	// e.g. when several services share a signing key, so tokens of other
+	// issuers are rejected with ErrInvalidIssuer. Canary tokens are not checked
+	Issuer []string
+	// Type if set, the typ header of the token must be this type, e.g. at+jwt, so
+	// ID tokens of the same issuer can't be replayed as access tokens. Tokens of
+	// other types are rejected with ErrInvalidType. Canary tokens are not checked
+	Type string
+	// AccessTokenProfile validates tokens as JWT access tokens of RFC 9068, the typ
+	// header must be at+jwt unless Type is set, and the iss, exp, aud, sub, client_id,
+	// iat and jti claims are required. Use Issuer and Audience to check their values
+	AccessTokenProfile bool
+	// Strict enables the JWT best current practices of RFC 8725: the none and, next
+	// to asymmetric sign methods, the HMAC sign methods are rejected, tokens must
+	// have an exp claim, MaxTokenBytes can't be disabled, and Issuer and
+	// Audience are required unless OIDC or SPIFFE check them
+	Strict bool
+	// Crit are the handlers of the custom critical header parameters the app
+	// understands, tokens listing other parameters in their crit header are
+	// rejected with ErrUnsupportedCrit
+	Crit map[string]CritHandler
+	// MaxTokenBytes is the size of the largest token accepted, larger tokens are
+	// rejected with ErrTokenTooLarge before they are decoded, so they can't be used
+	// to make the app allocate memory. Defaults to DefaultMaxTokenBytes, -1 disables it
+	MaxTokenBytes int
+	// GetDecryptionKey if set, decrypts tokens encrypted as JWE before they are
+	// verified, so claims with personal data can't be read by proxies or clients.
+	// It returns the *rsa.PrivateKey for RSA-OAEP and RSA-OAEP-256, or the []byte
+	// shared key for dir and AES key wrap, of the JWE header. Tokens encrypted with
+	// an RSA key must wrap a signed JWT (cty JWT), which is verified as usual.
+	// Defaults to the keys of DecryptionKeyFromEnv if RequireEncryption is set
+	GetDecryptionKey func(header map[string]interface{}) (interface{}, error)
+	// RequireEncryption rejects tokens which aren't encrypted with ErrNotEncrypted
+	RequireEncryption bool
+	// PASETO if set, verifies PASETO tokens instead of JWTs
+	PASETO *PASETO
+	// Branca if set, verifies Branca tokens instead of JWTs
+	Branca *Branca
+	// PreventReplay accepts each token once, e.g. one-time tokens of password
+	// resets. Tokens must have a jti and an exp claim, their jti is kept in the
+	// ReplayStore until they expire and tokens with a seen jti are rejected with
+	// ErrTokenReplayed. Claims of the LegacySession are not checked
+	PreventReplay bool
+	// ReplayStore keeps the jti of the accepted tokens, it enables PreventReplay and
+	// defaults to an in-memory store, use a shared one for apps with several instances
+	ReplayStore Store
+	// Revoker if set, rejects the tokens it revoked before they expire with
+	// ErrTokenRevoked, e.g. after a logout, see NewMemoryRevoker, and
+	// store.NewCachedRevoker for apps running several instances
+	Revoker Revoker
+	// SessionVersions if set, rejects tokens whose sver or token_version claim
+	// is older than the current session version of their subject with
+	// ErrSessionVersion, e.g. after a logout everywhere or a password reset
+	SessionVersions SessionVersions
+	// SessionVersionCacheTTL is how long the session versions are cached,
+	// defaults to DefaultSessionVersionCacheTTL, -1 disables the cache
+	SessionVersionCacheTTL time.Duration
+	// RenewWindow if set, renews tokens expiring within it for sliding sessions,
+	// the renewed token is signed with the SignMethod and RenewKey and sent in the
+	// RenewHeader, so clients replace their token while they are active. It
+	// can't be used with PASETO, Branca, RequireEncryption or a Canary issuer
+	RenewWindow time.Duration
+	// RenewKey signs the renewed tokens, e.g. the HMAC secret or the private key
+	RenewKey interface{}
+	// RenewKeyID is the kid header of the renewed tokens
+	RenewKeyID string
+	// RenewHeader is the response header of the renewed tokens, defaults to DefaultRenewHeader
+	RenewHeader string
+	// KeyFunc if set, selects the verification key of each token, e.g. by its
+	// kid header with KeysByKid to rotate keys without downtime or by its issuer
+	// with KeysByIssuer. GetKey and JWKS are not used, the signing method is
+	// still checked against SignMethod
+	KeyFunc jwt.Keyfunc
+	// KeyProvider if set, returns the verification key of each token with the
+	// context of the request, it takes precedence over KeyFunc, GetKey and JWKS.
+	// It is refreshed on start unless LazyKey is set and every KeyRefreshInterval.
+	// The signing method is still checked against SignMethod
+	KeyProvider KeyProvider
+	// Keys are the verification keys by kid, tokens signed with any of them
+	// are accepted, e.g. the old and the new key during a rotation window.
+	// A shortcut for KeyFunc: KeysByKid(Keys)
+	Keys map[string]interface{}
+	// PreVerify if set, is called with the unverified token before the key is
+	// resolved, e.g. to reject unknown tenants early or to set up the context
+	// for the key selection. Requests are rejected if it returns an error
+	PreVerify func(c buffalo.Context, unverified UnverifiedToken) error
+	// LazyKey defers loading the key with GetKey to the first request, e.g. for
+	// secret volumes mounted after startup. Failed loads respond with an error
+	// and are retried on the next request, the loaded key is cached
+	LazyKey bool
+	// KeyRefreshInterval if set, GetKey is called again at this interval and the
+	// key swapped, so rotated secrets are picked up without a restart. The current
+	// key is kept if loading the new key fails
+	KeyRefreshInterval time.Duration
+	// KeyFileWatchInterval if set, the key file is polled at this interval and the
+	// key reloaded with GetKey when the file changes, e.g. when Kubernetes updates
+	// a mounted secret
+	KeyFileWatchInterval time.Duration
+	// KeyFile is the file watched, defaults to the JWT_PUBLIC_KEY env variable
+	KeyFile string
+	// RetryHints if set, rejected requests are answered with machine
+	// readable error details instead of the buffalo error handlers
+	RetryHints *RetryHints
+	// NoRejectBody answers rejected requests with the status and headers only,
+	// for bandwidth sensitive clients. The buffalo error handlers are not called
+	NoRejectBody bool
+	// ClaimsEcho are the claims written into response headers for edge log
+	// correlation, by claim name, e.g. {"sub": "X-Auth-Subject"}
+	ClaimsEcho map[string]string
+	// BaggageClaims are the claims propagated as trace baggage to downstream
+	// services, serialized in the context under BaggageKey
+	BaggageClaims []string
+	// Baggage if set, adds the BaggageClaims to the baggage of the request context
+	Baggage BaggageFunc
+	// ClaimsGuard if set, is called after the handler if it replaced the claims
+	// in the context or changed them, which usually is a privilege escalation bug
+	ClaimsGuard func(c buffalo.Context, verified, current jwt.Claims)
+	// PhaseMetrics if set, times the phases of the token validation, the
+	// timings of the request are set in the context under PhaseTimingsKey
+	PhaseMetrics *PhaseMetrics
+	// Snapshots if set, records redacted snapshots of the validation
+	// of a sample of the requests
+	Snapshots *SnapshotRecorder
+	// CryptoBackend verifies the signatures, defaults to StdCrypto.
+	// It must implement the sign methods of the primary and canary issuer
+	CryptoBackend CryptoBackend
+	// Flags if set, evaluates the feature flags toggling the enforcement per
+	// request, FlagReportOnly, FlagOptional and FlagCanary
+	Flags FlagProvider
+	// VerifyLimiter if set, bounds the number of tokens verified concurrently,
+	// requests beyond the limit are rejected with 503 Service Unavailable
+	VerifyLimiter *VerifyLimiter
+	// LegacySession accepts the session cookie of legacy clients
+	// for requests without token during a migration
+	LegacySession *LegacySession
+	// TrustMode selects how much of the token is verified, defaults to the
+	// JWT_TRUST_MODE env variable or TrustModeFull if it isn't set
+	TrustMode TrustMode
+	// Gateway is the key tokens are verified with in TrustModeGatewaySigned
+	Gateway *GatewayKey
+	// AllowUnverified must be set for TrustModeGatewayUnverified, so the
+	// JWT_TRUST_MODE env variable alone can't turn off signature verification
+	AllowUnverified bool
+	// TrustTier derives the trust tier of the caller from the token claims,
+	// the tier is stored in the context under TrustTierKey
+	TrustTier func(jwt.Claims) TrustTier
+	// TrustTierHeader if set, the trust tier is also set as a request header
+	// with this name, so it can be read by middlewares not aware of buffalo
+	TrustTierHeader string
+	// Extensions enables registered extensions by name with their config,
+	// they are applied before the options are used, see RegisterExtension
+	Extensions map[string]map[string]string
+	// Leeway is the clock skew allowed validating the exp, nbf and iat claims,
+	// e.g. for clients and issuers whose clocks drift by up to a minute
+	Leeway time.Duration
+	// RequireNotBefore rejects tokens without nbf claim
+	RequireNotBefore bool
+	// RequireIssuedAt rejects tokens without iat claim, tokens issued in the
+	// future beyond the Leeway are always rejected, e.g. minted with a broken clock
+	RequireIssuedAt bool
+	// RequiredClaims are the claims the handlers rely on, e.g. sub or tenant_id,
+	// tokens lacking any of them are rejected with ErrMissingClaim
+	RequiredClaims []string
+	// Claims if set, returns a pointer to the struct the verified claims are
+	// decoded into with encoding/json, e.g. a struct embedding jwt.RegisteredClaims,
+	// which is set in the context instead of jwt.MapClaims. The claims are still
+	// validated as map, their Valid method is not called. ValidateClaims, Guards
+	// and handlers get the struct, ClaimsMap returns the claims as map
+	Claims func() jwt.Claims
+	// Validators check the claims of verified tokens, tokens failing
+	// any of them are rejected with 401 Unauthorized
+	Validators []Validator
+	// ValidateClaims if set, is called with the claims of verified tokens after the
+	// Validators, e.g. to enforce business rules like the subscription status. Requests
+	// are rejected with 401 Unauthorized if it returns an error, 403 Forbidden for
+	// ErrInsufficientScope or ErrInsufficientRole, or the HTTPStatus of a returned AuthError
+	ValidateClaims func(c buffalo.Context, claims jwt.Claims) error
+	// Guards decide if the caller may access the route, requests denied by any
+	// of them are rejected with 403 Forbidden, or the HTTPStatus of a returned AuthError
+	Guards []Guard
 }
 
 // New enables jwt token verification if no Sign method is provided,
-// by default uses HMAC
+// by default uses HMAC. It exits the process if the middleware can't be
+// configured (e.g. the key couldn't be loaded), use NewWithError to handle it.
 func New(options Options) buffalo.MiddlewareFunc {
-	// set sign method to HMAC if not provided
+	mw, err := NewWithError(options)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return mw
+}
+
+// NewWithError is like New but returns the error if the middleware
+// can't be configured, so the app can retry or fall back
+func NewWithError(options Options) (buffalo.MiddlewareFunc, error) {
+	stop := make(chan struct{})
+	mw, err := newMiddleware(options, stop)
+	if err != nil {
+		close(stop)
+	}
+	return mw, err
+}
+
+// newMiddleware returns the middleware of the options, the background
+// key refreshes it starts run until stop is closed
+func newMiddleware(options Options, stop chan struct{}) (buffalo.MiddlewareFunc, error) {
+	if err := applyExtensions(&options); err != nil {
+		return nil, err
+	}
+	// set sign method to HMAC if not provided,
+	// OIDC IdPs sign with RS256 by default
+	if options.SignMethod == nil && options.OIDC != nil {
+		options.SignMethod = jwt.SigningMethodRS256
+	}
+	if options.SPIFFE != nil {
+		if len(options.SPIFFE.Audiences) == 0 {
+			return nil, errors.New("SPIFFE requires Audiences")
+		}
+		// SPIRE signs JWT-SVIDs with P-256 keys by default
+		if options.SignMethod == nil {
+			options.SignMethod = jwt.SigningMethodES256
+		}
+		if options.KeyProvider == nil {
+			options.KeyProvider = options.SPIFFE
+		}
+		options.Validators = append([]Validator{options.SPIFFE}, options.Validators...)
+	}
 	if options.SignMethod == nil {
 		options.SignMethod = jwt.SigningMethodHS256
 	}
+	if options.TrustMode == "" {
+		options.TrustMode = TrustMode(envy.Get("JWT_TRUST_MODE", string(TrustModeFull)))
+	}
+	if err := applyTrustMode(&options); err != nil {
+		return nil, err
+	}
+	if options.PASETO != nil {
+		if err := options.PASETO.validate(); err != nil {
+			return nil, err
+		}
+		// the key of JWTs is never loaded, they are rejected
+		options.LazyKey = true
+	}
+	if options.Branca != nil {
+		if options.PASETO != nil {
+			return nil, errors.New("Branca and PASETO can't be used together")
+		}
+		if err := options.Branca.validate(); err != nil {
+			return nil, err
+		}
+		options.LazyKey = true
+	}
 	if options.GetKey == nil {
 		options.GetKey = selectGetKeyFunc(options.SignMethod)
 	}
-	// get key for validation
-	key, err := options.GetKey(options.SignMethod)
-	// if error on getting key exit.
-	if err != nil {
-		log.Fatal(errors.Wrap(err, "couldn't get key"))
+	keys := newKeyLoader(options.SignMethod, options.GetKey)
+	if options.KeyProvider == nil && options.GetKeyContext != nil {
+		options.KeyProvider = contextKeyProvider{method: options.SignMethod, getKey: options.GetKeyContext}
+	}
+	if options.KeyFunc == nil && len(options.Keys) > 0 {
+		options.KeyFunc = KeysByKid(options.Keys)
+	}
+	if options.KeyFunc == nil && options.JWKS != nil {
+		options.KeyFunc = options.JWKS.Keyfunc
+	}
+	if options.KeyFunc == nil && options.OIDC != nil {
+		options.KeyFunc = options.OIDC.Keyfunc
+	}
+	// keys are selected per token, e.g. from the JWKS by kid
+	useKeyFunc := (options.KeyFunc != nil || options.KeyProvider != nil) && options.TrustMode == TrustModeFull
+	if useKeyFunc && options.KeyProvider != nil {
+		if !options.LazyKey {
+			if err := options.KeyProvider.Refresh(context.Background()); err != nil {
+				return nil, errors.Wrap(err, "couldn't get key")
+			}
+		}
+		if options.KeyRefreshInterval > 0 {
+			refreshEvery(options.KeyProvider, options.KeyRefreshInterval, stop)
+		}
+	}
+	// no key is needed if signatures are not verified,
+	// lazy keys are loaded on the first request
+	if options.TrustMode != TrustModeGatewayUnverified && !options.LazyKey && !useKeyFunc {
+		// get key for validation
+		if _, err := keys.Key(); err != nil {
+			return nil, errors.Wrap(err, "couldn't get key")
+		}
+	}
+	if options.TrustMode != TrustModeGatewayUnverified && !useKeyFunc {
+		if options.KeyRefreshInterval > 0 {
+			refreshEvery(keys, options.KeyRefreshInterval, stop)
+		}
+		if options.KeyFileWatchInterval > 0 {
+			if options.KeyFile == "" {
+				options.KeyFile = envy.Get("JWT_PUBLIC_KEY", "")
+			}
+			if options.KeyFile == "" || isInlineKey(options.KeyFile) {
+				return nil, errors.New("KeyFileWatchInterval requires KeyFile or JWT_PUBLIC_KEY")
+			}
+			keys.watchFile(options.KeyFile, options.KeyFileWatchInterval, stop)
+		}
+	}
+	var canaryKey interface{}
+	var err error
+	if options.Canary != nil {
+		canary := *options.Canary
+		options.Canary = &canary
+		if options.Canary.SignMethod == nil {
+			options.Canary.SignMethod = options.SignMethod
+		}
+		if options.Canary.GetKey == nil {
+			options.Canary.GetKey = selectGetKeyFunc(options.Canary.SignMethod)
+		}
+		canaryKey, err = options.Canary.GetKey(options.Canary.SignMethod)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't get canary key")
+		}
+		canaryKey = keysource.VerificationKey(canaryKey)
+	}
+	if options.CryptoBackend != nil {
+		for _, method := range []jwt.SigningMethod{options.SignMethod, options.Canary.signMethod()} {
+			if method != nil && options.CryptoBackend.SigningMethod(method.Alg()) == nil {
+				return nil, errors.Errorf("crypto backend %s doesn't implement %s", options.CryptoBackend.Name(), method.Alg())
+			}
+		}
+	}
+	if options.PreventReplay && options.ReplayStore == nil {
+		options.ReplayStore = store.NewMemory(DefaultReplayCacheSize)
+	}
+	if options.SessionVersions != nil && options.SessionVersionCacheTTL >= 0 {
+		if options.SessionVersionCacheTTL == 0 {
+			options.SessionVersionCacheTTL = DefaultSessionVersionCacheTTL
+		}
+		options.SessionVersions = &cachedSessionVersions{
+			SessionVersions: options.SessionVersions,
+			ttl:             options.SessionVersionCacheTTL,
+			versions:        map[string]cachedSessionVersion{},
+		}
+	}
+	if options.RenewWindow > 0 {
+		// renewed tokens are JWTs signed with the RenewKey, which
+		// the middleware rejects in these modes or for canary issuers
+		switch {
+		case options.PASETO != nil, options.Branca != nil:
+			return nil, errors.New("RenewWindow can't renew PASETO or Branca tokens")
+		case options.RequireEncryption:
+			return nil, errors.New("RenewWindow can't renew tokens if RequireEncryption is set")
+		case options.Canary != nil:
+			return nil, errors.New("RenewWindow can't renew the tokens of a Canary issuer")
+		}
+		// a key not matching the SignMethod would fail every renewal
+		if _, err := jwt.New(options.SignMethod).SignedString(options.RenewKey); err != nil {
+			return nil, errors.Wrap(err, "invalid RenewKey")
+		}
+		if options.RenewHeader == "" {
+			options.RenewHeader = DefaultRenewHeader
+		}
+	}
+	if options.MaxTokenBytes == 0 {
+		options.MaxTokenBytes = DefaultMaxTokenBytes
+	}
+	if options.RequireEncryption && options.GetDecryptionKey == nil {
+		getKey, err := DecryptionKeyFromEnv()
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't get decryption key")
+		}
+		options.GetDecryptionKey = getKey
+	}
+	if options.Strict {
+		if err := checkStrictOptions(options); err != nil {
+			return nil, err
+		}
 	}
 	if options.AuthScheme == "" {
 		options.AuthScheme = "Bearer"
 	}
-	return func(next buffalo.Handler) buffalo.Handler {
-		return func(c buffalo.Context) error {
-			// get Authorisation header value
-			authString := c.Request().Header.Get("Authorization")
+	if options.HeaderName == "" {
+		options.HeaderName = "Authorization"
+	}
+	getToken := FromHeader(options.HeaderName, options.AuthScheme)
+	if options.TokenSource != nil {
+		getToken = extractor.First(options.TokenSource, getToken)
+	}
+	if len(options.Extractors) > 0 {
+		getToken = extractor.First(options.Extractors...)
+	}
+	if options.GetToken != nil {
+		getToken = options.GetToken
+	}
+	mw := func(next buffalo.Handler) buffalo.Handler {
+		// authenticated hands the request with the verified claims to the next handler
+		authenticated := func(c buffalo.Context, claims jwt.MapClaims, source string) error {
+			typed, err := decodeClaims(options, claims)
+			if err != nil {
+				return reject(c, options, http.StatusUnauthorized, err)
+			}
+			if options.Revoker != nil {
+				if status, err := checkRevoked(c, options, claims); err != nil {
+					return reject(c, options, status, err)
+				}
+			}
+			if options.SessionVersions != nil {
+				if status, err := checkSessionVersion(c, options, claims); err != nil {
+					return reject(c, options, status, err)
+				}
+			}
+			if status, err := checkClaims(c, options, claims, typed); err != nil {
+				return reject(c, options, status, err)
+			}
+			// the token is used up once it passed all checks
+			if options.ReplayStore != nil && source != IssuerLegacySession {
+				if status, err := checkReplay(c, options, claims); err != nil {
+					return reject(c, options, status, err)
+				}
+			}
+			options.IssuerMetrics.inc(source)
+			options.PhaseMetrics.observe(c)
+			finishSnapshot(c, options, source, 0, nil)
+			c.Set(IssuerSourceKey, source)
 
-			tokenString, err := getJwtToken(authString, options.AuthScheme)
+			// set the claims as context parameter.
+			// so that the actions can use the claims from jwt token
+			c.Set("claims", typed)
+			c.Set(MapClaimsKey, claims)
+			// tag the request with the trust tier of the caller
+			setTrustTier(c, options, claims)
+			setBaggage(c, options, claims)
+			echoClaims(c, options, claims)
+			if options.RenewWindow > 0 && source != IssuerLegacySession {
+				if err := renewToken(c, options, claims); err != nil {
+					return reject(c, options, http.StatusInternalServerError, err)
+				}
+			}
+			// calling next handler
+			return guardClaims(c, options, typed, next)
+		}
+		return func(c buffalo.Context) error {
+			options.Snapshots.start(c)
+			timings := options.PhaseMetrics.start(c)
+			stripTrustTier(c, options)
+			toggles := evalToggles(c, options, next)
+			if options.AllowQueryToken {
+				extractor.AllowQuery(c)
+			}
+			start := time.Now()
+			tokenString, err := getToken(c)
+			timings.add(phaseExtraction, time.Since(start))
+			// requests of legacy clients carry a session cookie instead of a token
+			if err == ErrNoToken && options.LegacySession != nil {
+				claims, err := options.LegacySession.claims(c)
+				if err != nil {
+					return reject(c, options, http.StatusUnauthorized, err)
+				}
+				if claims != nil {
+					return authenticated(c, claims, IssuerLegacySession)
+				}
+			}
 			// if error on getting the token, return with status unauthorized
 			if err != nil {
-				return c.Error(http.StatusUnauthorized, err)
+				return reject(c, options, http.StatusUnauthorized, err)
+			}
+			// reject oversized tokens before they are decoded
+			if options.MaxTokenBytes > 0 && len(tokenString) > options.MaxTokenBytes {
+				return reject(c, options, http.StatusUnauthorized, ErrTokenTooLarge)
+			}
+			snapshotToken(c, options, tokenString)
+
+			// tokens authenticated without JWS signature, PASETO and Branca tokens
+			// and encrypted tokens carrying the claims instead of a signed token
+			var decoded *jwt.Token
+			if options.PASETO != nil {
+				decoded, err = options.PASETO.verify(tokenString, options)
+				if err != nil {
+					return reject(c, options, http.StatusUnauthorized, err)
+				}
+			} else if options.Branca != nil {
+				decoded, err = options.Branca.verify(tokenString, options)
+				if err != nil {
+					return reject(c, options, http.StatusUnauthorized, err)
+				}
+			} else if options.GetDecryptionKey != nil && isJWE(tokenString) {
+				tokenString, decoded, err = decryptToken(tokenString, options)
+				if err != nil {
+					return reject(c, options, http.StatusUnauthorized, err)
+				}
+			} else if options.RequireEncryption {
+				return reject(c, options, http.StatusUnauthorized, ErrNotEncrypted)
+			}
+
+			// the issuer selects the key the token is verified with
+			unverified, peekErr := peekToken(tokenString)
+			untrusted := unverified.Claims
+			// malformed tokens are rejected by the parser
+			if peekErr == nil && options.PreVerify != nil {
+				start = time.Now()
+				err := options.PreVerify(c, unverified)
+				timings.add(phaseGuards, time.Since(start))
+				if err != nil {
+					return reject(c, options, http.StatusUnauthorized, err)
+				}
+			}
+
+			// the key is fetched after PreVerify, tokens it rejects don't load keys
+			var key interface{}
+			if options.TrustMode != TrustModeGatewayUnverified && !useKeyFunc && decoded == nil {
+				start = time.Now()
+				key, err = keys.Key()
+				timings.add(phaseKeyFetch, time.Since(start))
+				if err != nil {
+					return reject(c, options, http.StatusInternalServerError, errors.Wrap(err, "couldn't get key"))
+				}
 			}
 
 			// validating and parsing the tokenString
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			source := IssuerPrimary
+			// time spent fetching keys while parsing
+			var keyFetch time.Duration
+			keyFunc := func(token *jwt.Token) (interface{}, error) {
+				// tokens of the canary issuer are verified with its own key
+				if options.Canary.isCanary(untrusted) {
+					if !toggles.acceptsCanary() {
+						return nil, ErrInvalidIssuer
+					}
+					source = IssuerCanary
+					if token.Method.Alg() != options.Canary.SignMethod.Alg() {
+						return nil, ErrBadSigningMethod
+					}
+					return canaryKey, nil
+				}
 				// Validating if algorithm used for signing is same as the algorithm in token
 				if token.Method.Alg() != options.SignMethod.Alg() {
 					return nil, ErrBadSigningMethod
 				}
+				if useKeyFunc {
+					start := time.Now()
+					defer func() { keyFetch += time.Since(start) }()
+					if options.KeyProvider != nil {
+						return options.KeyProvider.KeyFor(c, token)
+					}
+					return options.KeyFunc(token)
+				}
 				return key, nil
-			})
+			}
+			var token *jwt.Token
+			start = time.Now()
+			if decoded != nil {
+				token = decoded
+			} else if options.TrustMode == TrustModeGatewayUnverified {
+				token, err = parseUnverified(tokenString, options)
+				if err == nil && options.Canary.isCanary(untrusted) {
+					source = IssuerCanary
+					if !toggles.acceptsCanary() {
+						err = ErrInvalidIssuer
+					}
+				}
+			} else {
+				// shed load before spending CPU on the signature
+				if !options.VerifyLimiter.acquire() {
+					return reject(c, options, http.StatusServiceUnavailable, ErrOverloaded)
+				}
+				token, err = parse(tokenString, keyFunc, options)
+				options.VerifyLimiter.release()
+			}
+			timings.add(phaseKeyFetch, keyFetch)
+			timings.add(phaseVerification, time.Since(start)-keyFetch)
 			// if error validating jwt token, return with status unauthorized
 			if err != nil {
-				return c.Error(http.StatusUnauthorized, err)
+				return reject(c, options, http.StatusUnauthorized, err)
+			}
+			verified := token.Claims.(jwt.MapClaims)
+			if err := checkCrit(c, token, options); err != nil {
+				return reject(c, options, http.StatusUnauthorized, err)
+			}
+			if options.Strict {
+				if err := checkStrict(token, options); err != nil {
+					return reject(c, options, http.StatusUnauthorized, err)
+				}
+			}
+			if source == IssuerPrimary {
+				if err := checkProfile(token, options); err != nil {
+					return reject(c, options, http.StatusUnauthorized, err)
+				}
+			}
+			if iss, _ := verified["iss"].(string); source == IssuerPrimary && len(options.Issuer) > 0 && !guard.ContainsAny([]string{iss}, options.Issuer...) {
+				return reject(c, options, http.StatusUnauthorized, ErrInvalidIssuer)
+			}
+			if len(options.Audience) > 0 && !guard.ContainsAny(guard.Audience(verified), options.Audience...) {
+				return reject(c, options, http.StatusUnauthorized, ErrInvalidAudience)
 			}
 
-			// set the claims as context parameter.
-			// so that the actions can use the claims from jwt token
-			c.Set("claims", token.Claims)
-			// calling next handler
-			err = next(c)
-
-			return err
+			// map canary claims to the primary contract,
+			// or upgrade claims of older token versions
+			start = time.Now()
+			switch {
+			case source == IssuerCanary && options.Canary.Mapper != nil:
+				token.Claims, err = options.Canary.Mapper(token.Claims.(jwt.MapClaims))
+			case source == IssuerPrimary && len(options.Versions) > 0:
+				token.Claims, err = mapVersion(token.Claims, options.Versions)
+			}
+			timings.add(phaseGuards, time.Since(start))
+			if err != nil {
+				return reject(c, options, http.StatusUnauthorized, err)
+			}
+			return authenticated(c, token.Claims.(jwt.MapClaims), source)
 		}
 	}
+	return mw, nil
 }
 
 // selectGetKeyFunc is an helper function to choose the GetKey function
@@ -142,23 +810,132 @@ func selectGetKeyFunc(method jwt.SigningMethod) func(jwt.SigningMethod) (interfa
 	}
 }
 
-// GetHMACKey gets secret key from env
+// parseKey parses the key data for the sign method, the secret of HMAC
+// methods is the data itself, public keys are parsed in auto format
+func parseKey(method jwt.SigningMethod, data []byte) (interface{}, error) {
+	var parsePEM func([]byte) (interface{}, error)
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		parsePEM = func(data []byte) (interface{}, error) {
+			return jwt.ParseRSAPublicKeyFromPEM(data)
+		}
+	case *jwt.SigningMethodECDSA:
+		parsePEM = func(data []byte) (interface{}, error) {
+			return jwt.ParseECPublicKeyFromPEM(data)
+		}
+	case *jwt.SigningMethodEd25519:
+		parsePEM = func(data []byte) (interface{}, error) {
+			return jwt.ParseEdPublicKeyFromPEM(data)
+		}
+	default:
+		return data, nil
+	}
+	return parsePublicKey(data, "auto", parsePEM)
+}
+
+// GetHMACKey gets secret key from env, secrets handed out base64 or
+// base64url encoded by IdPs can be set in JWT_SECRET_BASE64 instead
 func GetHMACKey(jwt.SigningMethod) (interface{}, error) {
+	if encoded := envy.Get("JWT_SECRET_BASE64", ""); encoded != "" {
+		return decodeBase64(encoded)
+	}
 	key, err := envy.MustGet("JWT_SECRET")
 	return []byte(key), err
 }
 
-// GetKeyRSA gets the public key file location from env and returns rsa.PublicKey
-func GetKeyRSA(jwt.SigningMethod) (interface{}, error) {
+// decodeBase64 decodes standard or URL safe base64, with or without padding
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if key, err := enc.DecodeString(s); err == nil {
+			return key, nil
+		}
+	}
+	return nil, errors.New("JWT_SECRET_BASE64 is not valid base64")
+}
+
+// publicKeyData reads the public key in JWT_PUBLIC_KEY, which is either the
+// location of the key file or the key itself, as on platforms without a
+// writable filesystem. Escaped newlines of single line values are restored.
+func publicKeyData() ([]byte, error) {
 	key, err := envy.MustGet("JWT_PUBLIC_KEY")
 	if err != nil {
 		return nil, err
 	}
-	keyData, err := ioutil.ReadFile(key)
+	if isInlineKey(key) {
+		return []byte(strings.Replace(strings.TrimSpace(key), `\n`, "\n", -1)), nil
+	}
+	return ioutil.ReadFile(key)
+}
+
+// readPublicKey reads the key in JWT_PUBLIC_KEY in the JWT_PUBLIC_KEY_FORMAT
+// (pem, der, jwk or auto, the default). Keys in JWK format, DER keys and X.509
+// certificates are parsed here, other PEM keys with parsePEM
+func readPublicKey(parsePEM func([]byte) (interface{}, error)) (interface{}, error) {
+	keyData, err := publicKeyData()
 	if err != nil {
 		return nil, err
 	}
-	return jwt.ParseRSAPublicKeyFromPEM(keyData)
+	return parsePublicKey(keyData, envy.Get("JWT_PUBLIC_KEY_FORMAT", "auto"), parsePEM)
+}
+
+// parsePublicKey parses the key data in the format, see readPublicKey
+func parsePublicKey(keyData []byte, format string, parsePEM func([]byte) (interface{}, error)) (interface{}, error) {
+	if format == "auto" {
+		switch {
+		case isJWK(keyData):
+			format = "jwk"
+		case bytes.Contains(keyData, []byte("-----BEGIN")):
+			format = "pem"
+		default:
+			format = "der"
+		}
+	}
+	switch format {
+	case "jwk":
+		return parseJWK(keyData)
+	case "der":
+		return parseDERKey(keyData)
+	case "pem":
+		if block, _ := pem.Decode(keyData); block != nil && block.Type == "CERTIFICATE" {
+			return keysource.CertificateKey(block.Bytes)
+		}
+		return parsePEM(keyData)
+	}
+	return nil, errors.Errorf("unknown JWT_PUBLIC_KEY_FORMAT %q, use pem, der, jwk or auto", format)
+}
+
+// parseDERKey parses a DER encoded PKIX or PKCS #1 public key or X.509 certificate
+func parseDERKey(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return key, nil
+	}
+	if _, err := x509.ParseCertificate(der); err == nil {
+		return keysource.CertificateKey(der)
+	}
+	return nil, errors.New("couldn't parse DER key, expected a PKIX or PKCS #1 public key or an X.509 certificate")
+}
+
+// isInlineKey reports if the env value is PEM or JWK content rather than a file location
+func isInlineKey(value string) bool {
+	value = strings.TrimSpace(value)
+	return strings.HasPrefix(value, "-----BEGIN") || strings.HasPrefix(value, "{")
+}
+
+// isJWK reports if the key data is in JWK format rather than PEM
+func isJWK(data []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(data)), "{")
+}
+
+// GetKeyRSA gets the public key file location from env and returns rsa.PublicKey,
+// the key is either PEM encoded, an X.509 certificate or in JWK format as exported by IdPs
+func GetKeyRSA(jwt.SigningMethod) (interface{}, error) {
+	return readPublicKey(func(data []byte) (interface{}, error) {
+		return jwt.ParseRSAPublicKeyFromPEM(data)
+	})
 }
 
 // GetKeyRSAPSS uses GetKeyRSA() since both requires rsa.PublicKey
@@ -168,41 +945,35 @@ func GetKeyRSAPSS(signingMethod jwt.SigningMethod) (interface{}, error) {
 
 // GetKeyECDSA gets the public.pem file location from env and returns ecdsa.PublicKey
 func GetKeyECDSA(jwt.SigningMethod) (interface{}, error) {
-	key, err := envy.MustGet("JWT_PUBLIC_KEY")
-	if err != nil {
-		return nil, err
-	}
-	keyData, err := ioutil.ReadFile(key)
-	if err != nil {
-		return nil, err
-	}
-	return jwt.ParseECPublicKeyFromPEM(keyData)
+	return readPublicKey(func(data []byte) (interface{}, error) {
+		return jwt.ParseECPublicKeyFromPEM(data)
+	})
 }
 
 // GetKeyECDSA gets the public.pem file location from env and returns eddsa.PublicKey
 func GetkeyEdDSA(jwt.SigningMethod) (interface{}, error) {
-	key, err := envy.MustGet("JWT_PUBLIC_KEY")
-	if err != nil {
-		return nil, err
+	return readPublicKey(func(data []byte) (interface{}, error) {
+		return jwt.ParseEdPublicKeyFromPEM(data)
+	})
+}
+
+// parse verifies the token with the CryptoBackend of the options if set,
+// the claims are normalized before they are validated
+func parse(tokenString string, keyFunc jwt.Keyfunc, options Options) (*jwt.Token, error) {
+	var token *jwt.Token
+	var err error
+	if options.CryptoBackend != nil {
+		token, err = parseWith(options.CryptoBackend, tokenString, keyFunc)
+	} else {
+		parser := &jwt.Parser{SkipClaimsValidation: true}
+		token, err = parser.Parse(tokenString, keyFunc)
 	}
-	keyData, err := ioutil.ReadFile(key)
 	if err != nil {
 		return nil, err
 	}
-	return jwt.ParseEdPublicKeyFromPEM(keyData)
-}
-
-// getJwtToken gets the token from the Authorisation header
-// removes the given authorisation scheme part (e.g. Bearer) from the authorisation header value.
-// returns No token error if Token is not found
-// returns Token Invalid error if the token value cannot be obtained by removing authorisation scheme part (e.g. `Bearer `)
-func getJwtToken(authString, authScheme string) (string, error) {
-	if authString == "" {
-		return "", ErrNoToken
-	}
-	l := len(authScheme)
-	if len(authString) > l+1 && authString[:l] == authScheme {
-		return authString[l+1:], nil
+	token.Claims = NormalizeClaims(token.Claims.(jwt.MapClaims))
+	if err := validTimes(token.Claims.(jwt.MapClaims), options); err != nil {
+		return nil, err
 	}
-	return "", ErrTokenInvalid
+	return token, nil
 }
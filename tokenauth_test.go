@@ -1,10 +1,21 @@
 package tokenauth_test
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,7 +25,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/gobuffalo/buffalo"
-	tokenauth "github.com/gobuffalo/mw-tokenauth"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
 	"github.com/stretchr/testify/require"
 )
 
@@ -346,3 +357,544 @@ func TestAuthScheme(t *testing.T) {
 	res := req.Get()
 	r.Equal(http.StatusOK, res.Code)
 }
+
+// signHMAC signs the claims with the HMAC secret used by the test apps
+func signHMAC(claims jwt.MapClaims) string {
+	secretKey := envy.Get("JWT_SECRET", "secret")
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(secretKey))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "error signing token"))
+	}
+	return tokenString
+}
+
+func TestNewWithError(t *testing.T) {
+	r := require.New(t)
+
+	envy.Set("JWT_PUBLIC_KEY", "test_certs/missing.pub")
+	_, err := tokenauth.NewWithError(tokenauth.Options{
+		SignMethod: jwt.SigningMethodRS256,
+	})
+	r.Error(err)
+	r.Contains(err.Error(), "couldn't get key")
+
+	envy.Set("JWT_PUBLIC_KEY", "test_certs/sample_key.pub")
+	mw, err := tokenauth.NewWithError(tokenauth.Options{
+		SignMethod: jwt.SigningMethodRS256,
+	})
+	r.NoError(err)
+	r.NotNil(mw)
+}
+
+func TestLazyKey(t *testing.T) {
+	r := require.New(t)
+	loads := 0
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		LazyKey: true,
+		GetKey: func(jwt.SigningMethod) (interface{}, error) {
+			loads++
+			if loads == 1 {
+				return nil, errors.New("secret not mounted yet")
+			}
+			return []byte("secret"), nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	r.Equal(0, loads)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{
+		"exp": time.Now().Add(time.Minute * 5).Unix(),
+	}, "secret")
+	res := req.Get()
+	r.Equal(http.StatusInternalServerError, res.Code)
+
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	res = req.Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal(2, loads)
+}
+
+func TestKeysByKid(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.KeysByKid(map[string]interface{}{
+			"2019": []byte("old-secret"),
+			"2020": []byte("new-secret"),
+		}),
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	sign := func(kid, secret string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"exp": time.Now().Add(time.Minute * 5).Unix(),
+		})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		tokenString, err := token.SignedString([]byte(secret))
+		r.NoError(err)
+		return tokenString
+	}
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + sign("2019", "old-secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+	req.Headers["Authorization"] = "Bearer " + sign("2020", "new-secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+	// key of another kid
+	req.Headers["Authorization"] = "Bearer " + sign("2019", "new-secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+	// unknown kid
+	req.Headers["Authorization"] = "Bearer " + sign("2021", "new-secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+	req.Headers["Authorization"] = "Bearer " + sign("", "new-secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+}
+
+func TestKeys(t *testing.T) {
+	r := require.New(t)
+	secrets := map[string]string{"old": "old-secret", "new": "new-secret"}
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		Keys: map[string]interface{}{
+			"old": []byte(secrets["old"]),
+			"new": []byte(secrets["new"]),
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	for kid, secret := range secrets {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"exp": time.Now().Add(time.Minute * 5).Unix(),
+		})
+		token.Header["kid"] = kid
+		tokenString, err := token.SignedString([]byte(secret))
+		r.NoError(err)
+		req.Headers["Authorization"] = "Bearer " + tokenString
+		r.Equal(http.StatusOK, req.Get().Code)
+	}
+}
+
+func TestAudienceOption(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc:  tokenauth.StaticKey([]byte("secret")),
+		Audience: []string{"billing", "https://api.example.com"},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	for _, tt := range []struct {
+		aud    interface{}
+		status int
+	}{
+		{"billing", http.StatusOK},
+		{[]string{"payments", "https://api.example.com"}, http.StatusOK},
+		{"payments", http.StatusUnauthorized},
+		{[]string{"payments", "shipping"}, http.StatusUnauthorized},
+		{nil, http.StatusUnauthorized},
+	} {
+		claims := jwt.MapClaims{"exp": exp}
+		if tt.aud != nil {
+			claims["aud"] = tt.aud
+		}
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret")
+		r.Equal(tt.status, req.Get().Code, tt.aud)
+	}
+}
+
+func TestIssuer(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+		Issuer:  []string{"https://auth.example.com", "https://auth-eu.example.com"},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	for iss, status := range map[string]int{
+		"https://auth-eu.example.com": http.StatusOK,
+		"https://billing.example.com": http.StatusUnauthorized,
+		"https://auth.example.com/":   http.StatusUnauthorized,
+		"":                            http.StatusUnauthorized,
+	} {
+		claims := jwt.MapClaims{"exp": exp}
+		if iss != "" {
+			claims["iss"] = iss
+		}
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret")
+		r.Equal(status, req.Get().Code, iss)
+	}
+}
+
+func TestGetKeyContext(t *testing.T) {
+	r := require.New(t)
+	var calls, requests int
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		GetKeyContext: func(ctx context.Context, method jwt.SigningMethod) (interface{}, error) {
+			calls++
+			r.Equal(jwt.SigningMethodHS256, method)
+			if _, ok := ctx.(buffalo.Context); ok {
+				requests++
+			}
+			return []byte("secret"), nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	r.Equal(1, calls)
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}, "secret")
+	r.Equal(http.StatusOK, req.Get().Code)
+	r.Equal(http.StatusOK, req.Get().Code)
+	r.Equal(3, calls)
+	r.Equal(2, requests)
+
+	_, err := tokenauth.NewWithError(tokenauth.Options{
+		GetKeyContext: func(ctx context.Context, method jwt.SigningMethod) (interface{}, error) {
+			return nil, errors.New("key service unavailable")
+		},
+	})
+	r.Error(err)
+	r.Contains(err.Error(), "couldn't get key")
+}
+
+// tenantKeys is a KeyProvider selecting the key by the X-Tenant header of the request
+type tenantKeys struct {
+	keys      map[string]interface{}
+	refreshes int
+	err       error
+}
+
+func (p *tenantKeys) KeyFor(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	key, ok := p.keys[ctx.(buffalo.Context).Request().Header.Get("X-Tenant")]
+	if !ok {
+		return nil, errors.New("unknown tenant")
+	}
+	return key, nil
+}
+
+func (p *tenantKeys) Refresh(ctx context.Context) error {
+	p.refreshes++
+	return p.err
+}
+
+func TestKeyProvider(t *testing.T) {
+	r := require.New(t)
+	provider := &tenantKeys{keys: map[string]interface{}{"a": []byte("secret-a"), "b": []byte("secret-b")}}
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyProvider: provider,
+		// ignored, the provider takes precedence
+		KeyFunc: tokenauth.StaticKey([]byte("secret")),
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	r.Equal(1, provider.refreshes)
+	w := httptest.New(a)
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}
+
+	req := w.HTML("/")
+	req.Headers["X-Tenant"] = "a"
+	req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret-a")
+	r.Equal(http.StatusOK, req.Get().Code)
+	req.Headers["X-Tenant"] = "b"
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+	req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+
+	// keys which can't be loaded fail on start, unless they are lazy
+	provider.err = errors.New("vault sealed")
+	_, err := tokenauth.NewWithError(tokenauth.Options{KeyProvider: provider})
+	r.Error(err)
+	r.Contains(err.Error(), "vault sealed")
+	_, err = tokenauth.NewWithError(tokenauth.Options{KeyProvider: provider, LazyKey: true})
+	r.NoError(err)
+	r.Equal(2, provider.refreshes)
+
+	// GetKey funcs are adapted
+	loads := 0
+	keys := tokenauth.GetKeyProvider(jwt.SigningMethodHS256, func(jwt.SigningMethod) (interface{}, error) {
+		loads++
+		return []byte("secret"), nil
+	})
+	key, err := keys.KeyFor(context.Background(), nil)
+	r.NoError(err)
+	r.Equal([]byte("secret"), key)
+	_, err = keys.KeyFor(context.Background(), nil)
+	r.NoError(err)
+	r.Equal(1, loads)
+	r.NoError(keys.Refresh(context.Background()))
+	r.Equal(2, loads)
+}
+
+func TestKeyRefreshInterval(t *testing.T) {
+	r := require.New(t)
+	var mu sync.Mutex
+	secret := "old-secret"
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyRefreshInterval: 10 * time.Millisecond,
+		GetKey: func(jwt.SigningMethod) (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return []byte(secret), nil
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{
+		"exp": time.Now().Add(time.Minute * 5).Unix(),
+	}, "new-secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+
+	// rotate the secret
+	mu.Lock()
+	secret = "new-secret"
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	r.Equal(http.StatusOK, req.Get().Code)
+}
+
+func TestKeyFileWatch(t *testing.T) {
+	r := require.New(t)
+	f, err := ioutil.TempFile("", "tokenauth-key")
+	r.NoError(err)
+	defer os.Remove(f.Name())
+	r.NoError(ioutil.WriteFile(f.Name(), []byte("old-secret"), 0600))
+
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFileWatchInterval: 10 * time.Millisecond,
+		KeyFile:              f.Name(),
+		GetKey: func(jwt.SigningMethod) (interface{}, error) {
+			return ioutil.ReadFile(f.Name())
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{
+		"exp": time.Now().Add(time.Minute * 5).Unix(),
+	}, "rotated-secret")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+
+	// the secret is rotated
+	r.NoError(ioutil.WriteFile(f.Name(), []byte("rotated-secret"), 0600))
+	time.Sleep(50 * time.Millisecond)
+	r.Equal(http.StatusOK, req.Get().Code)
+}
+
+func TestInlinePEM(t *testing.T) {
+	r := require.New(t)
+	for file, getKey := range map[string]func(jwt.SigningMethod) (interface{}, error){
+		"test_certs/sample_key.pub":     tokenauth.GetKeyRSA,
+		"test_certs/ec256-public.pem":   tokenauth.GetKeyECDSA,
+		"test_certs/ed25519-public.pem": tokenauth.GetkeyEdDSA,
+	} {
+		data, err := ioutil.ReadFile(file)
+		r.NoError(err)
+
+		envy.Set("JWT_PUBLIC_KEY", string(data))
+		key, err := getKey(nil)
+		r.NoError(err, file)
+		r.NotNil(key)
+
+		// single line value with escaped newlines
+		envy.Set("JWT_PUBLIC_KEY", strings.Replace(string(data), "\n", `\n`, -1))
+		key, err = getKey(nil)
+		r.NoError(err, file)
+		r.NotNil(key)
+	}
+	envy.Set("JWT_PUBLIC_KEY", "test_certs/sample_key.pub")
+}
+
+func TestHMACKeyBase64(t *testing.T) {
+	r := require.New(t)
+	defer envy.Set("JWT_SECRET_BASE64", "")
+
+	secret := []byte{0xfb, 0xff, 0x01, 's', 'e', 'c'}
+	for _, encoded := range []string{
+		base64.StdEncoding.EncodeToString(secret),
+		base64.RawURLEncoding.EncodeToString(secret),
+	} {
+		envy.Set("JWT_SECRET_BASE64", encoded)
+		key, err := tokenauth.GetHMACKey(jwt.SigningMethodHS256)
+		r.NoError(err)
+		r.Equal(secret, key)
+	}
+
+	envy.Set("JWT_SECRET_BASE64", "not base64!")
+	_, err := tokenauth.GetHMACKey(jwt.SigningMethodHS256)
+	r.Error(err)
+}
+
+func TestCertificateKey(t *testing.T) {
+	r := require.New(t)
+	defer envy.Set("JWT_PUBLIC_KEY", "test_certs/sample_key.pub")
+	defer envy.Set("JWT_CERT_CHECK_EXPIRY", "false")
+	key := rsaTestKey(t)
+
+	certPEM := func(notAfter time.Time) string {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "signer"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		r.NoError(err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+
+	envy.Set("JWT_PUBLIC_KEY", certPEM(time.Now().Add(time.Hour)))
+	got, err := tokenauth.GetKeyRSA(jwt.SigningMethodRS256)
+	r.NoError(err)
+	r.Equal(&key.PublicKey, got)
+
+	// expired certificates are only rejected if asked to
+	envy.Set("JWT_PUBLIC_KEY", certPEM(time.Now().Add(-time.Minute)))
+	_, err = tokenauth.GetKeyRSA(jwt.SigningMethodRS256)
+	r.NoError(err)
+	envy.Set("JWT_CERT_CHECK_EXPIRY", "true")
+	_, err = tokenauth.GetKeyRSA(jwt.SigningMethodRS256)
+	r.Error(err)
+	r.Contains(err.Error(), "expired")
+}
+
+func TestDERKey(t *testing.T) {
+	r := require.New(t)
+	defer envy.Set("JWT_PUBLIC_KEY", "test_certs/sample_key.pub")
+	defer envy.Set("JWT_PUBLIC_KEY_FORMAT", "auto")
+
+	data, err := ioutil.ReadFile("test_certs/ec256-public.pem")
+	r.NoError(err)
+	block, _ := pem.Decode(data)
+	f, err := ioutil.TempFile("", "key.der")
+	r.NoError(err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(block.Bytes)
+	r.NoError(err)
+	r.NoError(f.Close())
+	envy.Set("JWT_PUBLIC_KEY", f.Name())
+
+	for _, format := range []string{"auto", "der"} {
+		envy.Set("JWT_PUBLIC_KEY_FORMAT", format)
+		key, err := tokenauth.GetKeyECDSA(jwt.SigningMethodES256)
+		r.NoError(err, format)
+		r.IsType(&ecdsa.PublicKey{}, key)
+	}
+
+	envy.Set("JWT_PUBLIC_KEY_FORMAT", "pem")
+	_, err = tokenauth.GetKeyECDSA(jwt.SigningMethodES256)
+	r.Error(err)
+	envy.Set("JWT_PUBLIC_KEY_FORMAT", "p12")
+	_, err = tokenauth.GetKeyECDSA(jwt.SigningMethodES256)
+	r.Error(err)
+}
+
+func TestKeysByIssuer(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		KeyFunc: tokenauth.KeysByIssuer(map[string]jwt.Keyfunc{
+			"https://tenant-a.example.com": tokenauth.StaticKey([]byte("secret-a")),
+			"https://tenant-b.example.com": tokenauth.KeysByKid(map[string]interface{}{"b1": []byte("secret-b")}),
+		}),
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"iss": "https://tenant-a.example.com", "exp": exp}, "secret-a")
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": "https://tenant-b.example.com", "exp": exp})
+	token.Header["kid"] = "b1"
+	tokenString, err := token.SignedString([]byte("secret-b"))
+	r.NoError(err)
+	req.Headers["Authorization"] = "Bearer " + tokenString
+	r.Equal(http.StatusOK, req.Get().Code)
+
+	// signed by tenant a claiming to be tenant b
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"iss": "https://tenant-b.example.com", "exp": exp}, "secret-a")
+	r.Equal(http.StatusUnauthorized, req.Get().Code)
+
+	// not an allowed issuer
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{"iss": "https://evil.example.com", "exp": exp}, "secret-a")
+	res := req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), "token issuer not accepted")
+}
+
+func TestMaxTokenBytes(t *testing.T) {
+	r := require.New(t)
+	exp := time.Now().Add(time.Minute * 5).Unix()
+	small := signWith(jwt.MapClaims{"exp": exp, "roles": strings.Repeat("a", 100)}, "secret")
+	large := signWith(jwt.MapClaims{"exp": exp, "roles": strings.Repeat("a", tokenauth.DefaultMaxTokenBytes)}, "secret")
+
+	for _, tt := range []struct {
+		max    int
+		token  string
+		status int
+	}{
+		{0, small, http.StatusOK},
+		{0, large, http.StatusUnauthorized},
+		{len(small) - 1, small, http.StatusUnauthorized},
+		{-1, large, http.StatusOK},
+	} {
+		a := buffalo.New(buffalo.Options{})
+		a.Use(tokenauth.New(tokenauth.Options{
+			KeyFunc:       tokenauth.StaticKey([]byte("secret")),
+			MaxTokenBytes: tt.max,
+		}))
+		a.GET("/", func(c buffalo.Context) error {
+			return c.Render(200, nil)
+		})
+		req := httptest.New(a).HTML("/")
+		req.Headers["Authorization"] = "Bearer " + tt.token
+		res := req.Get()
+		r.Equal(tt.status, res.Code, tt.max)
+		if tt.status == http.StatusUnauthorized {
+			r.Contains(res.Header().Get("WWW-Authenticate"), tokenauth.ErrTokenTooLarge.Error())
+		}
+	}
+}
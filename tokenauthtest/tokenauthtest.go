@@ -0,0 +1,122 @@
+// Package tokenauthtest helps testing apps using the tokenauth middleware, with
+// ephemeral keys signing test tokens and a middleware setting fixed claims, so
+// tests don't need checked-in keys or signing code
+//
+//	key := tokenauthtest.NewKey(t, jwt.SigningMethodES256)
+//	app.Use(tokenauth.New(key.Options()))
+//	req := httptest.New(app).HTML("/")
+//	req.Headers["Authorization"] = "Bearer " + key.Sign(t, jwt.MapClaims{"sub": "42"})
+//
+// Handlers can also be tested without tokens
+//
+//	app.Use(tokenauthtest.MiddlewareWithStaticClaims(jwt.MapClaims{"sub": "42"}))
+package tokenauthtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Key is an ephemeral key of a signing method
+type Key struct {
+	Method jwt.SigningMethod
+	// Private signs the tokens, the secret of HMAC methods
+	Private interface{}
+	// Public verifies the tokens, the secret of HMAC methods
+	Public interface{}
+	// KID is the kid header of the tokens
+	KID string
+}
+
+// NewKey generates a key for the signing method, the test fails if the method
+// isn't supported
+func NewKey(t testing.TB, method jwt.SigningMethod) *Key {
+	t.Helper()
+	k := &Key{Method: method, KID: randomHex(t, 8)}
+	var err error
+	switch m := method.(type) {
+	case *jwt.SigningMethodHMAC:
+		secret := []byte(randomHex(t, 32))
+		k.Private, k.Public = secret, secret
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		var key *rsa.PrivateKey
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err == nil {
+			k.Private, k.Public = key, &key.PublicKey
+		}
+	case *jwt.SigningMethodECDSA:
+		curves := map[int]elliptic.Curve{256: elliptic.P256(), 384: elliptic.P384(), 521: elliptic.P521()}
+		var key *ecdsa.PrivateKey
+		key, err = ecdsa.GenerateKey(curves[m.CurveBits], rand.Reader)
+		if err == nil {
+			k.Private, k.Public = key, &key.PublicKey
+		}
+	case *jwt.SigningMethodEd25519:
+		var public ed25519.PublicKey
+		var private ed25519.PrivateKey
+		public, private, err = ed25519.GenerateKey(rand.Reader)
+		k.Private, k.Public = private, public
+	default:
+		t.Fatalf("tokenauthtest: unsupported signing method %s", method.Alg())
+	}
+	if err != nil {
+		t.Fatalf("tokenauthtest: couldn't generate %s key: %v", method.Alg(), err)
+	}
+	return k
+}
+
+// Options returns middleware options verifying the tokens of the key
+func (k *Key) Options() tokenauth.Options {
+	return tokenauth.Options{
+		SignMethod: k.Method,
+		KeyFunc:    tokenauth.StaticKey(k.Public),
+	}
+}
+
+// Sign signs a token with the claims, it expires in 5 minutes unless the
+// claims have an exp claim
+func (k *Key) Sign(t testing.TB, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.MapClaims{"exp": time.Now().Add(5 * time.Minute).Unix()}
+	for name, v := range claims {
+		token[name] = v
+	}
+	jt := jwt.NewWithClaims(k.Method, token)
+	jt.Header["kid"] = k.KID
+	signed, err := jt.SignedString(k.Private)
+	if err != nil {
+		t.Fatalf("tokenauthtest: couldn't sign token: %v", err)
+	}
+	return signed
+}
+
+// MiddlewareWithStaticClaims returns a middleware authenticating every request
+// with the claims, like tokenauth.New does for a verified token with them
+func MiddlewareWithStaticClaims(claims jwt.MapClaims) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			c.Set(tokenauth.IssuerSourceKey, tokenauth.IssuerPrimary)
+			c.Set("claims", claims)
+			c.Set(tokenauth.MapClaimsKey, claims)
+			return next(c)
+		}
+	}
+}
+
+func randomHex(t testing.TB, n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("tokenauthtest: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
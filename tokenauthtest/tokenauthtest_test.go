@@ -0,0 +1,65 @@
+package tokenauthtest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/gobuffalo/mw-tokenauth/v2/tokenauthtest"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	methods := []jwt.SigningMethod{
+		jwt.SigningMethodHS256,
+		jwt.SigningMethodRS256,
+		jwt.SigningMethodPS256,
+		jwt.SigningMethodES256,
+		jwt.SigningMethodES384,
+		jwt.SigningMethodES512,
+		jwt.SigningMethodEdDSA,
+	}
+	for _, method := range methods {
+		t.Run(method.Alg(), func(t *testing.T) {
+			r := require.New(t)
+			key := tokenauthtest.NewKey(t, method)
+			a := buffalo.New(buffalo.Options{})
+			a.Use(tokenauth.New(key.Options()))
+			a.GET("/", func(c buffalo.Context) error {
+				return c.Render(200, nil)
+			})
+			w := httptest.New(a)
+
+			req := w.HTML("/")
+			req.Headers["Authorization"] = "Bearer " + key.Sign(t, jwt.MapClaims{"sub": "42"})
+			r.Equal(http.StatusOK, req.Get().Code)
+
+			// tokens of other keys are rejected
+			other := tokenauthtest.NewKey(t, method)
+			req.Headers["Authorization"] = "Bearer " + other.Sign(t, jwt.MapClaims{"sub": "42"})
+			r.Equal(http.StatusUnauthorized, req.Get().Code)
+		})
+	}
+}
+
+func TestMiddlewareWithStaticClaims(t *testing.T) {
+	r := require.New(t)
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauthtest.MiddlewareWithStaticClaims(jwt.MapClaims{"sub": "42", "scope": "read:users"}))
+	a.GET("/users", tokenauth.RequireScopes("read:users")(func(c buffalo.Context) error {
+		return c.Render(200, render.String(tokenauth.ClaimsMap(c)["sub"].(string)))
+	}))
+	a.DELETE("/users", tokenauth.RequireScopes("write:users")(func(c buffalo.Context) error {
+		return c.Render(204, nil)
+	}))
+	w := httptest.New(a)
+
+	res := w.HTML("/users").Get()
+	r.Equal(http.StatusOK, res.Code)
+	r.Equal("42", res.Body.String())
+	r.Equal(http.StatusForbidden, w.HTML("/users").Delete().Code)
+}
@@ -0,0 +1,69 @@
+package tokenauth
+
+import (
+	"log"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// TrustMode selects how much of the token the middleware verifies
+type TrustMode string
+
+const (
+	// TrustModeFull verifies the token signature with the configured key
+	TrustModeFull TrustMode = "full"
+	// TrustModeGatewaySigned verifies a token minted by a verifying gateway
+	// with the gateway key, instead of the key of the original issuer
+	TrustModeGatewaySigned TrustMode = "gateway-signed"
+	// TrustModeGatewayUnverified only decodes the token and validates its time based
+	// claims, the signature is NOT verified. It must only be used behind a gateway
+	// which verifies every token and strips the header from requests it rejects,
+	// and requires AllowUnverified.
+	TrustModeGatewayUnverified TrustMode = "gateway-unverified"
+)
+
+// GatewayKey is the key of a gateway minting its own tokens after verification
+type GatewayKey struct {
+	SignMethod jwt.SigningMethod
+	GetKey     func(jwt.SigningMethod) (interface{}, error)
+}
+
+// applyTrustMode validates the trust mode and logs loudly which mode is active,
+// in TrustModeGatewaySigned the gateway key replaces the configured key
+func applyTrustMode(options *Options) error {
+	switch options.TrustMode {
+	case TrustModeFull:
+		log.Printf("tokenauth: trust mode %s, token signatures are verified with the %s key", options.TrustMode, options.SignMethod.Alg())
+	case TrustModeGatewaySigned:
+		if options.Gateway == nil || options.Gateway.SignMethod == nil {
+			return errors.Errorf("trust mode %s requires the gateway key", options.TrustMode)
+		}
+		options.SignMethod = options.Gateway.SignMethod
+		options.GetKey = options.Gateway.GetKey
+		log.Printf("tokenauth: trust mode %s, only tokens minted by the gateway are accepted, verified with the %s gateway key", options.TrustMode, options.SignMethod.Alg())
+	case TrustModeGatewayUnverified:
+		if !options.AllowUnverified {
+			return errors.Errorf("trust mode %s requires AllowUnverified", options.TrustMode)
+		}
+		log.Printf("tokenauth: WARNING trust mode %s, token signatures are NOT verified, the gateway in front of this app must verify every token", options.TrustMode)
+	default:
+		return errors.Errorf("unknown trust mode %q", options.TrustMode)
+	}
+	return nil
+}
+
+// parseUnverified decodes the token without verifying its signature,
+// the time based claims are still validated
+func parseUnverified(tokenString string, options Options) (*jwt.Token, error) {
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
+	token.Claims = NormalizeClaims(token.Claims.(jwt.MapClaims))
+	if err := validTimes(token.Claims.(jwt.MapClaims), options); err != nil {
+		return nil, err
+	}
+	token.Valid = true
+	return token, nil
+}
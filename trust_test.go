@@ -0,0 +1,90 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func signWith(claims jwt.MapClaims, secret string) string {
+	tokenString, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	return tokenString
+}
+
+func TestTrustModeGatewayUnverified(t *testing.T) {
+	r := require.New(t)
+	w := httptest.New(appExtractor(tokenauth.Options{
+		TrustMode:       tokenauth.TrustModeGatewayUnverified,
+		AllowUnverified: true,
+	}))
+
+	// signature is not verified
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{
+		"exp": time.Now().Add(time.Minute * 5).Unix(),
+	}, "unknown")
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+
+	// time based claims are
+	req.Headers["Authorization"] = "Bearer " + signWith(jwt.MapClaims{
+		"exp": time.Now().Add(-time.Minute * 5).Unix(),
+	}, "unknown")
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+	r.Contains(res.Body.String(), "Token is expired")
+
+	req.Headers["Authorization"] = "Bearer badcreds"
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+}
+
+func TestTrustModeGatewayUnverifiedNotAllowed(t *testing.T) {
+	r := require.New(t)
+	_, err := tokenauth.NewWithError(tokenauth.Options{TrustMode: tokenauth.TrustModeGatewayUnverified})
+	r.Error(err)
+	r.Contains(err.Error(), "requires AllowUnverified")
+
+	// the env variable alone doesn't turn off verification
+	envy.Set("JWT_TRUST_MODE", string(tokenauth.TrustModeGatewayUnverified))
+	defer envy.Set("JWT_TRUST_MODE", string(tokenauth.TrustModeFull))
+	_, err = tokenauth.NewWithError(tokenauth.Options{})
+	r.Error(err)
+}
+
+func TestTrustModeGatewaySigned(t *testing.T) {
+	r := require.New(t)
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		TrustMode: tokenauth.TrustModeGatewaySigned,
+		Gateway: &tokenauth.GatewayKey{
+			SignMethod: jwt.SigningMethodHS256,
+			GetKey: func(jwt.SigningMethod) (interface{}, error) {
+				return []byte("gateway"), nil
+			},
+		},
+	}))
+	a.GET("/", func(c buffalo.Context) error {
+		return c.Render(200, nil)
+	})
+	w := httptest.New(a)
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute * 5).Unix()}
+
+	req := w.HTML("/")
+	req.Headers["Authorization"] = "Bearer " + signWith(claims, "gateway")
+	res := req.Get()
+	r.Equal(http.StatusOK, res.Code)
+
+	// tokens of the original issuer are not accepted
+	req.Headers["Authorization"] = "Bearer " + signWith(claims, "secret")
+	res = req.Get()
+	r.Equal(http.StatusUnauthorized, res.Code)
+}
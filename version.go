@@ -0,0 +1,48 @@
+package tokenauth
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+// ErrTokenVersion is returned if the ver claim of the token is not one of the accepted versions
+var ErrTokenVersion = errors.New("token version not accepted")
+
+// ClaimsMapper upgrades the claims of an older token version to the current claims contract
+type ClaimsMapper func(jwt.MapClaims) (jwt.MapClaims, error)
+
+// RenameClaims returns a ClaimsMapper moving the claims to their new names
+func RenameClaims(renames map[string]string) ClaimsMapper {
+	return func(claims jwt.MapClaims) (jwt.MapClaims, error) {
+		for from, to := range renames {
+			if v, ok := claims[from]; ok {
+				delete(claims, from)
+				claims[to] = v
+			}
+		}
+		return claims, nil
+	}
+}
+
+// mapVersion looks up the ver claim in the accepted versions and maps the claims
+// with the mapper registered for it, tokens without ver claim have the version ""
+func mapVersion(claims jwt.Claims, versions map[string]ClaimsMapper) (jwt.Claims, error) {
+	mc, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return claims, nil
+	}
+	ver := ""
+	if v, ok := mc["ver"]; ok && v != nil {
+		ver = fmt.Sprint(v)
+	}
+	mapper, ok := versions[ver]
+	if !ok {
+		return nil, ErrTokenVersion
+	}
+	if mapper == nil {
+		return mc, nil
+	}
+	return mapper(mc)
+}
@@ -0,0 +1,59 @@
+package tokenauth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/envy"
+	"github.com/gobuffalo/httptest"
+	tokenauth "github.com/gobuffalo/mw-tokenauth/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func appVersions() *buffalo.App {
+	h := func(c buffalo.Context) error {
+		claims := c.Value("claims").(jwt.MapClaims)
+		return c.Render(200, render.String(claims["tenant_id"].(string)))
+	}
+	envy.Set("JWT_SECRET", "secret")
+	a := buffalo.New(buffalo.Options{})
+	a.Use(tokenauth.New(tokenauth.Options{
+		Versions: map[string]tokenauth.ClaimsMapper{
+			"1": tokenauth.RenameClaims(map[string]string{"tenant": "tenant_id"}),
+			"2": nil,
+		},
+	}))
+	a.GET("/", h)
+	return a
+}
+
+func TestVersions(t *testing.T) {
+	r := require.New(t)
+	w := httptest.New(appVersions())
+
+	tests := []struct {
+		claims jwt.MapClaims
+		code   int
+	}{
+		{jwt.MapClaims{"ver": 1, "tenant": "acme"}, http.StatusOK},
+		{jwt.MapClaims{"ver": "2", "tenant_id": "acme"}, http.StatusOK},
+		{jwt.MapClaims{"ver": 3, "tenant_id": "acme"}, http.StatusUnauthorized},
+		{jwt.MapClaims{"tenant_id": "acme"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		tt.claims["exp"] = time.Now().Add(time.Minute * 5).Unix()
+		req := w.HTML("/")
+		req.Headers["Authorization"] = "Bearer " + signHMAC(tt.claims)
+		res := req.Get()
+		r.Equal(tt.code, res.Code)
+		if tt.code == http.StatusOK {
+			r.Equal("acme", res.Body.String())
+		} else {
+			r.Contains(res.Body.String(), "token version not accepted")
+		}
+	}
+}